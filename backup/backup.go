@@ -0,0 +1,168 @@
+// Package backup takes scheduled snapshots of the database and prunes them by the retention policy.
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gelfand/mettu/repo"
+)
+
+// Policy tells which snapshots are kept, the newest snapshot is always kept.
+type Policy struct {
+	// Hourly is for how long the newest snapshot of every hour is kept.
+	Hourly time.Duration
+	// Daily is for how long the newest snapshot of every day is kept.
+	Daily time.Duration
+}
+
+// DefaultPolicy keeps hourly snapshots for a day and daily snapshots for a month.
+var DefaultPolicy = Policy{
+	Hourly: 24 * time.Hour,
+	Daily:  30 * 24 * time.Hour,
+}
+
+// Snapshot is the snapshot directory and the time it was taken at.
+type Snapshot struct {
+	Path string
+	Time time.Time
+}
+
+const (
+	namePrefix = "mettu-"
+	timeLayout = "20060102T150405Z"
+)
+
+// Name returns the directory name of the snapshot taken at t.
+func Name(t time.Time) string {
+	return namePrefix + t.UTC().Format(timeLayout)
+}
+
+// List returns snapshots in dir ordered by time, other files are ignored.
+func List(dir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), namePrefix) {
+			continue
+		}
+		t, err := time.Parse(timeLayout, strings.TrimPrefix(e.Name(), namePrefix))
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{Path: filepath.Join(dir, e.Name()), Time: t})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.Before(snapshots[j].Time) })
+	return snapshots, nil
+}
+
+// Expired returns snapshots which are not kept by the policy as of now, snapshots are ordered by time.
+func (p Policy) Expired(snapshots []Snapshot, now time.Time) []Snapshot {
+	var expired []Snapshot
+	kept := make(map[string]bool)
+	// NOTE: newer snapshots are visited first, so they take their hour or day.
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		s := snapshots[i]
+		age := now.Sub(s.Time)
+
+		var slot string
+		switch {
+		case i == len(snapshots)-1:
+			continue
+		case age < p.Hourly:
+			slot = "h" + s.Time.UTC().Truncate(time.Hour).Format(timeLayout)
+		case age < p.Daily:
+			slot = "d" + s.Time.UTC().Format("20060102")
+		default:
+			expired = append(expired, s)
+			continue
+		}
+
+		if kept[slot] {
+			expired = append(expired, s)
+			continue
+		}
+		kept[slot] = true
+	}
+
+	sort.Slice(expired, func(i, j int) bool { return expired[i].Time.Before(expired[j].Time) })
+	return expired
+}
+
+// Take takes the snapshot of db into dir.
+func Take(ctx context.Context, db repo.Storage, dir string, now time.Time) (Snapshot, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Snapshot{}, err
+	}
+	s := Snapshot{Path: filepath.Join(dir, Name(now)), Time: now.UTC().Truncate(time.Second)}
+	if err := db.Snapshot(ctx, s.Path); err != nil {
+		return Snapshot{}, err
+	}
+	return s, nil
+}
+
+// Prune removes snapshots in dir expired by the policy and returns them.
+func Prune(dir string, p Policy, now time.Time) ([]Snapshot, error) {
+	snapshots, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := p.Expired(snapshots, now)
+	for _, s := range expired {
+		if err := os.RemoveAll(s.Path); err != nil {
+			return nil, fmt.Errorf("unable to remove snapshot %s: %w", s.Path, err)
+		}
+	}
+	return expired, nil
+}
+
+// Scheduler takes snapshots every Interval and prunes them by the Policy.
+type Scheduler struct {
+	Dir      string
+	Interval time.Duration
+	Policy   Policy
+}
+
+// Run takes snapshots of db until ctx is done. Nil Scheduler takes no snapshots.
+func (s *Scheduler) Run(ctx context.Context, db repo.Storage) {
+	if s == nil {
+		return
+	}
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			snapshot, err := Take(ctx, db, s.Dir, now)
+			if err != nil {
+				log.Printf("ERROR: unable to take snapshot: %v", err)
+				continue
+			}
+			log.Printf("INFO: took snapshot %s", snapshot.Path)
+
+			expired, err := Prune(s.Dir, s.Policy, now)
+			if err != nil {
+				log.Printf("ERROR: unable to prune snapshots: %v", err)
+			}
+			for _, e := range expired {
+				log.Printf("INFO: removed expired snapshot %s", e.Path)
+			}
+		}
+	}
+}
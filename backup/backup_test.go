@@ -0,0 +1,76 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPolicy_Expired(t *testing.T) {
+	now := time.Date(2021, 12, 31, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) Snapshot {
+		t := now.Add(-d)
+		return Snapshot{Path: Name(t), Time: t}
+	}
+
+	tests := []struct {
+		name      string
+		snapshots []Snapshot
+		want      []Snapshot
+	}{
+		{
+			name:      "hourly within a day",
+			snapshots: []Snapshot{at(3 * time.Hour), at(2*time.Hour + 30*time.Minute), at(2 * time.Hour), at(time.Hour)},
+			// NOTE: 9:00 and 9:30 share the hour, the newer one is kept.
+			want: []Snapshot{at(3 * time.Hour)},
+		},
+		{
+			name:      "daily within a month",
+			snapshots: []Snapshot{at(50 * time.Hour), at(49 * time.Hour), at(26 * time.Hour), at(time.Hour)},
+			want:      []Snapshot{at(50 * time.Hour)},
+		},
+		{
+			name:      "older than a month",
+			snapshots: []Snapshot{at(31 * 24 * time.Hour), at(29 * 24 * time.Hour), at(time.Hour)},
+			want:      []Snapshot{at(31 * 24 * time.Hour)},
+		},
+		{
+			name:      "newest is kept",
+			snapshots: []Snapshot{at(40 * 24 * time.Hour), at(35 * 24 * time.Hour)},
+			want:      []Snapshot{at(40 * 24 * time.Hour)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultPolicy.Expired(tt.snapshots, now); !cmp.Equal(got, tt.want) {
+				t.Errorf("Policy.Expired() diff = %v", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	t1 := time.Date(2021, 12, 31, 11, 0, 0, 0, time.UTC)
+	t0 := t1.Add(-time.Hour)
+	for _, name := range []string{Name(t1), Name(t0), "mettu-garbage", Name(t0) + ".tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Snapshot{
+		{Path: filepath.Join(dir, Name(t0)), Time: t0},
+		{Path: filepath.Join(dir, Name(t1)), Time: t1},
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("List() diff = %v", cmp.Diff(want, got))
+	}
+}
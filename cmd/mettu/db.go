@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gelfand/mettu/repo"
+)
+
+// errMismatches is returned by check if the database has mismatches.
+var errMismatches = errors.New("database has mismatches")
+
+// dbCommand runs the database maintenance subcommand, args are the subcommand arguments.
+func dbCommand(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("db", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mettu db check|rebuild")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	switch fs.Arg(0) {
+	case "check":
+		return checkDB(ctx, dbPath)
+	case "rebuild":
+		return rebuildDB(ctx, dbPath)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+// checkDB prints the mismatches of the derived data, errMismatches is returned if there are any.
+func checkDB(ctx context.Context, dbPath string) error {
+	db, err := repo.NewDBReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	var mismatches []repo.Mismatch
+	if err := db.View(ctx, func(tx repo.Tx) error {
+		mismatches, err = db.Check(tx)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if len(mismatches) == 0 {
+		log.Printf("Successfully checked database, no mismatches")
+		return nil
+	}
+	if err := printMismatches(mismatches); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %d", errMismatches, len(mismatches))
+}
+
+// rebuildDB regenerates the derived data and prints the fixed mismatches.
+// NOTE: mettu must not be running against the database.
+func rebuildDB(ctx context.Context, dbPath string) error {
+	db, err := repo.NewDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	var mismatches []repo.Mismatch
+	if err := db.Update(ctx, func(tx repo.RwTx) error {
+		mismatches, err = db.Rebuild(tx)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if len(mismatches) != 0 {
+		if err := printMismatches(mismatches); err != nil {
+			return err
+		}
+	}
+	log.Printf("Successfully rebuilt derived data, %d mismatches fixed", len(mismatches))
+	return nil
+}
+
+func printMismatches(mismatches []repo.Mismatch) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tKEY\tFIELD\tSTORED\tWANT")
+	for _, m := range mismatches {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Table, m.Key, m.Field, m.Stored, m.Want)
+	}
+	return w.Flush()
+}
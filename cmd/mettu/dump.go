@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gelfand/mettu/repo"
+)
+
+// exportDB writes every table into a file of the output directory, args are the subcommand arguments.
+func exportDB(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "ndjson", "output format, ndjson or csv")
+	tables := fs.String("tables", "", "comma separated tables to export, all if empty")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mettu export [-format ndjson|csv] [-tables t1,t2] DIR")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f, err := repo.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+	names, err := selectTables(*tables)
+	if err != nil {
+		return err
+	}
+
+	dir := fs.Arg(0)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	db, err := repo.NewDBReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	// NOTE: every table is exported by the same read transaction, so the files are consistent with each other.
+	return db.View(ctx, func(tx repo.Tx) error {
+		for _, name := range names {
+			path := filepath.Join(dir, name+"."+string(f))
+			out, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			n, err := db.Export(tx, name, f, out)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+			log.Printf("Exported %d %s records to %s", n, name, path)
+		}
+		return nil
+	})
+}
+
+// importDB reads the tables exported by exportDB from the input directory, args are the subcommand arguments.
+// Tables are imported in one transaction, so an invalid record leaves the database untouched.
+func importDB(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	tables := fs.String("tables", "", "comma separated tables to import, all found in DIR if empty")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mettu import [-tables t1,t2] DIR")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	names, err := selectTables(*tables)
+	if err != nil {
+		return err
+	}
+
+	db, err := repo.NewDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	return db.Update(ctx, func(tx repo.RwTx) error {
+		for _, name := range names {
+			path, f, ok := findTableFile(fs.Arg(0), name)
+			if !ok {
+				if *tables != "" {
+					return fmt.Errorf("no file of %s table found", name)
+				}
+				continue
+			}
+
+			in, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			n, err := db.Import(tx, name, f, in)
+			in.Close()
+			if err != nil {
+				return fmt.Errorf("unable to import %s: %w", path, err)
+			}
+			log.Printf("Imported %d %s records from %s", n, name, path)
+		}
+		return nil
+	})
+}
+
+func selectTables(list string) ([]string, error) {
+	all := repo.ExportTables()
+	if list == "" {
+		return all, nil
+	}
+
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		known := false
+		for _, t := range all {
+			known = known || t == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown table %q, expected one of %s", name, strings.Join(all, ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// findTableFile returns the file of the table in dir and it's format.
+func findTableFile(dir, table string) (string, repo.Format, bool) {
+	for _, f := range []repo.Format{repo.NDJSON, repo.CSV} {
+		path := filepath.Join(dir, table+"."+string(f))
+		if _, err := os.Stat(path); err == nil {
+			return path, f, true
+		}
+	}
+	return "", "", false
+}
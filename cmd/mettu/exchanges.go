@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/repo"
+)
+
+// errConflicts is returned by add if some of the addresses are hot wallets of another exchange.
+var errConflicts = errors.New("conflicting labels")
+
+// exchangesCommand manages the exchange registry, args are the subcommand arguments.
+func exchangesCommand(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("exchanges", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mettu exchanges list|add|remove|import|export|rename|merge")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	args = fs.Args()[1:]
+	switch fs.Arg(0) {
+	case "list":
+		return listExchanges(ctx, dbPath, args)
+	case "add":
+		return addExchange(ctx, dbPath, args)
+	case "remove":
+		return removeHotWallets(ctx, dbPath, args)
+	case "import":
+		return importLabels(ctx, dbPath, args)
+	case "export":
+		return exportLabels(ctx, dbPath, args)
+	case "rename":
+		return renameExchange(ctx, dbPath, args)
+	case "merge":
+		return mergeExchanges(ctx, dbPath, args)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+// listExchanges prints exchanges with the number of their hot wallets, or the hot wallets themselves.
+func listExchanges(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("exchanges list", flag.ExitOnError)
+	wallets := fs.Bool("wallets", false, "print every hot wallet address")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := repo.NewDBReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	var entities []repo.ExchangeEntity
+	if err := db.View(ctx, func(tx repo.Tx) error {
+		entities, err = db.ExchangeEntities(tx)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	if *wallets {
+		fmt.Fprintln(w, "ID\tNAME\tADDRESS")
+		for _, e := range entities {
+			for _, addr := range e.HotWallets {
+				fmt.Fprintf(w, "%d\t%s\t%v\n", e.ID, e.Name, addr)
+			}
+		}
+		return w.Flush()
+	}
+	fmt.Fprintln(w, "ID\tNAME\tHOT WALLETS")
+	for _, e := range entities {
+		fmt.Fprintf(w, "%d\t%s\t%d\n", e.ID, e.Name, len(e.HotWallets))
+	}
+	return w.Flush()
+}
+
+// addExchange labels the addresses as hot wallets of the exchange.
+func addExchange(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("exchanges add", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mettu exchanges add NAME ADDRESS...")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	labels := make([]repo.Exchange, 0, fs.NArg()-1)
+	for _, arg := range fs.Args()[1:] {
+		if !common.IsHexAddress(arg) {
+			return fmt.Errorf("invalid address %q", arg)
+		}
+		labels = append(labels, repo.Exchange{Name: fs.Arg(0), Address: common.HexToAddress(arg)})
+	}
+
+	db, err := repo.NewDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	return db.Update(ctx, func(tx repo.RwTx) error {
+		report, err := db.PlanLabels(tx, labels)
+		if err != nil {
+			return err
+		}
+		if len(report.Conflicts) != 0 {
+			printConflicts(report.Conflicts)
+			return fmt.Errorf("%w: %d", errConflicts, len(report.Conflicts))
+		}
+		if _, err := db.ImportLabels(tx, labels); err != nil {
+			return err
+		}
+		log.Printf("Successfully added %d hot wallets of %s", len(report.Added), fs.Arg(0))
+		return nil
+	})
+}
+
+// removeHotWallets deletes the hot wallets, their exchanges keep the history.
+func removeHotWallets(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("exchanges remove", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mettu exchanges remove ADDRESS...")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db, err := repo.NewDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	return db.Update(ctx, func(tx repo.RwTx) error {
+		for _, arg := range fs.Args() {
+			if !common.IsHexAddress(arg) {
+				return fmt.Errorf("invalid address %q", arg)
+			}
+			addr := common.HexToAddress(arg)
+			e, err := db.PeekExchange(tx, addr)
+			if err != nil {
+				return err
+			}
+			if e.ID == 0 {
+				return fmt.Errorf("%v is not a hot wallet", addr)
+			}
+			if err := db.DeleteExchange(tx, addr); err != nil {
+				return err
+			}
+			log.Printf("Successfully removed hot wallet %v of %s", addr, e.Name)
+		}
+		return nil
+	})
+}
+
+// importLabels imports the label file, conflicting labels are printed and skipped.
+func importLabels(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("exchanges import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be imported without writing it")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mettu exchanges import [-dry-run] FILE.json|FILE.csv")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db, err := repo.NewDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	return loadLabels(ctx, db, fs.Arg(0), *dryRun)
+}
+
+// loadLabels imports hot wallets of the label file, nothing is written if dryRun is set.
+func loadLabels(ctx context.Context, db *repo.DB, path string, dryRun bool) error {
+	format, err := repo.LabelFormatOf(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	labels, err := repo.ReadLabels(f, format)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	return applyLabels(ctx, db, path, labels, dryRun)
+}
+
+// applyLabels imports the labels read from the source, or only reports what would be imported if dryRun.
+func applyLabels(ctx context.Context, db *repo.DB, source string, labels []repo.Exchange, dryRun bool) error {
+	var (
+		report repo.LabelReport
+		err    error
+	)
+	if dryRun {
+		err = db.View(ctx, func(tx repo.Tx) error {
+			report, err = db.PlanLabels(tx, labels)
+			return err
+		})
+	} else {
+		err = db.Update(ctx, func(tx repo.RwTx) error {
+			report, err = db.ImportLabels(tx, labels)
+			return err
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	printConflicts(report.Conflicts)
+	verb := "imported"
+	if dryRun {
+		verb = "would import"
+	}
+	log.Printf("Successfully read %d labels of %s: %s %d, %d unchanged, %d duplicates, %d conflicts",
+		len(labels), source, verb, len(report.Added), report.Unchanged, report.Duplicates, len(report.Conflicts))
+	return nil
+}
+
+// exportLabels writes every hot wallet as the label file ReadLabels imports.
+func exportLabels(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("exchanges export", flag.ExitOnError)
+	format := fs.String("format", "json", "output format, json or csv")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mettu exchanges export [-format json|csv] [FILE]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f, err := repo.LabelFormatOf("." + *format)
+	if err != nil {
+		return err
+	}
+
+	db, err := repo.NewDBReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	var exchanges []repo.Exchange
+	if err := db.View(ctx, func(tx repo.Tx) error {
+		exchanges, err = db.AllExchanges(tx)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if fs.NArg() == 1 {
+		file, err := os.Create(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := repo.WriteLabels(out, f, exchanges); err != nil {
+		return err
+	}
+	if fs.NArg() == 1 {
+		log.Printf("Exported %d hot wallets to %s", len(exchanges), fs.Arg(0))
+	}
+	return nil
+}
+
+// renameExchange renames the exchange, it's hot wallets and history stay attached.
+func renameExchange(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("exchanges rename", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mettu exchanges rename OLD NEW")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db, err := repo.NewDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.Update(ctx, func(tx repo.RwTx) error {
+		return db.RenameExchange(tx, fs.Arg(0), fs.Arg(1))
+	}); err != nil {
+		return err
+	}
+	log.Printf("Successfully renamed %s to %s", fs.Arg(0), fs.Arg(1))
+	return nil
+}
+
+// mergeExchanges moves the hot wallets and history of the first exchange to the second one.
+func mergeExchanges(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("exchanges merge", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mettu exchanges merge FROM INTO")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db, err := repo.NewDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.Update(ctx, func(tx repo.RwTx) error {
+		return db.MergeExchanges(tx, fs.Arg(0), fs.Arg(1))
+	}); err != nil {
+		return err
+	}
+	log.Printf("Successfully merged %s into %s", fs.Arg(0), fs.Arg(1))
+	return nil
+}
+
+func printConflicts(conflicts []repo.LabelConflict) {
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "conflict: %v\n", c)
+	}
+}
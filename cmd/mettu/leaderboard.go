@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gelfand/mettu/repo"
+)
+
+// leaderboard prints the best scored wallets, args are the subcommand arguments.
+func leaderboard(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("leaderboard", flag.ExitOnError)
+	limit := fs.Int("n", 20, "number of wallets to print, 0 prints all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := repo.NewDBReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	var scores []repo.WalletScore
+	if err := db.View(ctx, func(tx repo.Tx) error {
+		scores, err = db.Leaderboard(tx, *limit)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tWALLET\tEXCHANGE\tSWAPS\tTOKENS\tWIN RATE\tMEDIAN RETURN\t2X\tBLOCKS TO 2X\tSCORE")
+	for i, s := range scores {
+		fmt.Fprintf(w, "%d\t%v\t%s\t%d\t%d\t%.2f\t%.2f\t%d\t%d\t%.4f\n",
+			i+1, s.Wallet, s.Exchange, s.Swaps, s.DistinctTokens, s.WinRate, s.MedianReturn,
+			s.Reached2x, s.MedianBlocksTo2x, s.Score)
+	}
+	return w.Flush()
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -12,24 +11,49 @@ import (
 	"runtime"
 	"runtime/pprof"
 
+	"github.com/gelfand/mettu/backup"
 	"github.com/gelfand/mettu/core"
 	_ "github.com/gelfand/mettu/internal/abi"
+	"github.com/gelfand/mettu/notify"
+	"github.com/gelfand/mettu/pgsink"
 	"github.com/gelfand/mettu/repo"
+	"github.com/gelfand/mettu/signals"
 )
 
 var homedir, _ = os.UserHomeDir()
 
 var (
-	doInit  = flag.Bool("init", false, "initialize new database")
-	rpcAddr = flag.String("rpc.addr", "ws://127.0.0.1:8545", "Ethereum RPC address")
-	datadir = flag.String("datadir", homedir+"/.mettu/", "path to the mettu database")
+	doInit           = flag.Bool("init", false, "initialize new database")
+	initLabels       = flag.String("init.labels", "", "path to the JSON or CSV hot wallet label file imported by -init, the bundled labels if empty")
+	rpcAddr          = flag.String("rpc.addr", "ws://127.0.0.1:8545", "Ethereum RPC address")
+	datadir          = flag.String("datadir", homedir+"/.mettu/", "path to the mettu database")
+	rules            = flag.String("signals.rules", "", "path to the JSON file with signal rules, default rules are used if empty")
+	notifyConfig     = flag.String("notify.config", "", "path to the JSON file with alert sinks, alerts are only logged if empty")
+	snapshotDir      = flag.String("snapshot.dir", homedir+"/.mettu-snapshots/", "directory of the database snapshots")
+	snapshotInterval = flag.Duration("snapshot.interval", 0, "how often the database snapshot is taken, e.g. 1h, every snapshot is a full copy of the database, 0 disables scheduled snapshots")
+	pgDSN            = flag.String("pg.dsn", "", "PostgreSQL connection string of the analytics mirror, disabled if empty")
 
 	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
 	memprofile = flag.String("memprofile", "", "write memory profile to `file`")
 )
 
 func usage() {
-	fmt.Fprintln(os.Stderr, "Usage of mettu...")
+	fmt.Fprintln(os.Stderr, "Usage of mettu: mettu [flags] [command]")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  leaderboard [-n N]\tprint the best scored wallets")
+	fmt.Fprintln(os.Stderr, "  export [-format F] DIR\tdump every table into DIR as NDJSON or CSV")
+	fmt.Fprintln(os.Stderr, "  import DIR\tload the tables dumped by export")
+	fmt.Fprintln(os.Stderr, "  snapshot [-prune]\ttake a consistent copy of the database into -snapshot.dir")
+	fmt.Fprintln(os.Stderr, "  restore SNAPSHOT\treplace the database with the snapshot, mettu must be stopped")
+	fmt.Fprintln(os.Stderr, "  db check\trecompute the aggregates from the swaps and fundings and report mismatches")
+	fmt.Fprintln(os.Stderr, "  db rebuild\tregenerate the derived tables from the swaps and fundings, mettu must be stopped")
+	fmt.Fprintln(os.Stderr, "  exchanges list [-wallets]\tprint the exchanges and their hot wallets")
+	fmt.Fprintln(os.Stderr, "  exchanges add NAME ADDRESS...\tlabel the addresses as hot wallets of the exchange, mettu picks them up on restart")
+	fmt.Fprintln(os.Stderr, "  exchanges remove ADDRESS...\tremove the hot wallets, mettu drops them on restart")
+	fmt.Fprintln(os.Stderr, "  exchanges import [-dry-run] FILE\timport the JSON or CSV label file, mettu picks it up on restart")
+	fmt.Fprintln(os.Stderr, "  exchanges export [-format F] [FILE]\twrite the hot wallets as a label file")
+	fmt.Fprintln(os.Stderr, "  exchanges rename OLD NEW\trename the exchange")
+	fmt.Fprintln(os.Stderr, "  exchanges merge FROM INTO\tmove the hot wallets and history of FROM to INTO")
 	flag.PrintDefaults()
 }
 
@@ -58,6 +82,48 @@ func main() {
 		log.Fatalf("invalid path: %v", err)
 	}
 
+	switch flag.Arg(0) {
+	case "":
+	case "leaderboard":
+		if err := leaderboard(ctx, dbPath, flag.Args()[1:]); err != nil {
+			log.Fatalf("Unable to print leaderboard: %v", err)
+		}
+		return
+	case "export":
+		if err := exportDB(ctx, dbPath, flag.Args()[1:]); err != nil {
+			log.Fatalf("Unable to export database: %v", err)
+		}
+		return
+	case "import":
+		if err := importDB(ctx, dbPath, flag.Args()[1:]); err != nil {
+			log.Fatalf("Unable to import database: %v", err)
+		}
+		return
+	case "snapshot":
+		if err := snapshot(ctx, dbPath, *snapshotDir, flag.Args()[1:]); err != nil {
+			log.Fatalf("Unable to take snapshot: %v", err)
+		}
+		return
+	case "restore":
+		if err := restore(ctx, dbPath, flag.Args()[1:]); err != nil {
+			log.Fatalf("Unable to restore snapshot: %v", err)
+		}
+		return
+	case "db":
+		if err := dbCommand(ctx, dbPath, flag.Args()[1:]); err != nil {
+			log.Fatalf("Unable to run db %s: %v", flag.Arg(1), err)
+		}
+		return
+	case "exchanges":
+		if err := exchangesCommand(ctx, dbPath, flag.Args()[1:]); err != nil {
+			log.Fatalf("Unable to run exchanges %s: %v", flag.Arg(1), err)
+		}
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	if *doInit {
 		if err := initDB(ctx, dbPath); err != nil {
 			log.Fatalf("Unable to initialize new database: %v", err)
@@ -66,7 +132,31 @@ func main() {
 		log.Printf("Successfully initialized new db")
 	}
 
-	coordinator, err := core.NewCoordinator(ctx, dbPath, *rpcAddr)
+	signalRules, err := loadRules(*rules)
+	if err != nil {
+		log.Fatalf("Unable to load signal rules: %v", err)
+	}
+
+	notifier, err := loadNotifier(*notifyConfig)
+	if err != nil {
+		log.Fatalf("Unable to load notifier config: %v", err)
+	}
+	defer notifier.Close()
+	go notifier.Run(ctx)
+
+	sink, err := openSink(ctx, *pgDSN)
+	if err != nil {
+		log.Fatalf("Unable to open postgres sink: %v", err)
+	}
+	defer sink.Close()
+
+	db, err := repo.NewDB(dbPath)
+	if err != nil {
+		log.Fatalf("Unable to open database: %v", err)
+	}
+	defer db.Close()
+
+	coordinator, err := core.NewCoordinator(ctx, db, *rpcAddr, signalRules, notifier, sink, loadScheduler())
 	if err != nil {
 		log.Fatalf("Unable to create new Coordinator: %v", err)
 	}
@@ -93,29 +183,52 @@ func initDB(ctx context.Context, dbPath string) error {
 	}
 	defer db.Close()
 
-	f, err := os.Open("./repo/testdata/exchanges.json")
+	if *initLabels == "" {
+		labels, err := repo.DefaultLabels()
+		if err != nil {
+			return fmt.Errorf("unable to read the default labels: %w", err)
+		}
+		return applyLabels(ctx, db, "the default labels", labels, false)
+	}
+	return loadLabels(ctx, db, *initLabels, false)
+}
+
+func loadRules(path string) ([]signals.Rule, error) {
+	if path == "" {
+		return signals.DefaultRules, nil
+	}
+
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("unable to open `exchanges.json`, err=%w", err)
+		return nil, err
 	}
 	defer f.Close()
+	return signals.ReadRules(f)
+}
 
-	var exchanges []repo.Exchange
-	dec := json.NewDecoder(f)
-	if err := dec.Decode(&exchanges); err != nil {
-		return fmt.Errorf("unable to unmarshal data of `exchanges.json`, err=%w", err)
+func loadNotifier(path string) (*notify.Notifier, error) {
+	if path == "" {
+		return nil, nil
 	}
 
-	tx, err := db.BeginRw(ctx)
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("unable to begin read-write transaction, err=%w", err)
+		return nil, err
 	}
-	defer tx.Rollback()
+	defer f.Close()
+	return notify.Load(f)
+}
 
-	for i := range exchanges {
-		if err := db.PutExchange(tx, exchanges[i]); err != nil {
-			return fmt.Errorf(fmt.Sprintf("unable to insert %d exchange: %v,", i, exchanges[i])+"err=%w", err)
-		}
+func openSink(ctx context.Context, dsn string) (*pgsink.Sink, error) {
+	if dsn == "" {
+		return nil, nil
 	}
+	return pgsink.Open(ctx, dsn)
+}
 
-	return tx.Commit()
+func loadScheduler() *backup.Scheduler {
+	if *snapshotInterval <= 0 {
+		return nil
+	}
+	return &backup.Scheduler{Dir: *snapshotDir, Interval: *snapshotInterval, Policy: backup.DefaultPolicy}
 }
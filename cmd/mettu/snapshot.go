@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gelfand/mettu/backup"
+	"github.com/gelfand/mettu/repo"
+)
+
+// snapshot takes the snapshot of the database into dir, args are the subcommand arguments.
+// It may run while mettu keeps writing into the database.
+func snapshot(ctx context.Context, dbPath, dir string, args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	prune := fs.Bool("prune", false, "remove snapshots expired by the retention policy")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := repo.NewDBReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	s, err := backup.Take(ctx, db, dir, now)
+	if err != nil {
+		return err
+	}
+	log.Printf("Successfully took snapshot %s", s.Path)
+
+	if !*prune {
+		return nil
+	}
+	expired, err := backup.Prune(dir, backup.DefaultPolicy, now)
+	for _, e := range expired {
+		log.Printf("Removed expired snapshot %s", e.Path)
+	}
+	return err
+}
+
+// restore replaces the database with the snapshot, args are the subcommand arguments.
+func restore(ctx context.Context, dbPath string, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mettu restore SNAPSHOT")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	old, err := repo.Restore(ctx, fs.Arg(0), dbPath)
+	if err != nil {
+		return err
+	}
+	if old != "" {
+		log.Printf("Previous database was moved to %s", old)
+	}
+	log.Printf("Successfully restored %s", fs.Arg(0))
+	return nil
+}
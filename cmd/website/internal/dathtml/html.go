@@ -5,6 +5,19 @@ import "html/template"
 func LoadHTML() map[string]*template.Template {
 	accountsTmpl := template.Must(template.New("accounts.tmpl.html").ParseFiles("./static/templates/accounts.tmpl.html"))
 	exchangesTmpl := template.Must(template.New("exchanges.tmpl.html").ParseFiles("./static/templates/exchanges.tmpl.html"))
+	patternsTmpl := template.Must(template.New("patterns.tmpl.html").ParseFiles("./static/templates/patterns.tmpl.html"))
+	leaderboardTmpl := template.Must(template.New("leaderboard.tmpl.html").Funcs(template.FuncMap{
+		"inc": func(i int) int { return i + 1 },
+	}).ParseFiles("./static/templates/leaderboard.tmpl.html"))
+	tokensTmpl := template.Must(template.New("tokens.tmpl.html").Funcs(template.FuncMap{
+		"mul100": func(x float64) float64 { return x * 100 },
+	}).ParseFiles("./static/templates/tokens.tmpl.html"))
 
-	return map[string]*template.Template{"accounts": accountsTmpl, "exchanges": exchangesTmpl}
+	return map[string]*template.Template{
+		"accounts":    accountsTmpl,
+		"exchanges":   exchangesTmpl,
+		"leaderboard": leaderboardTmpl,
+		"patterns":    patternsTmpl,
+		"tokens":      tokensTmpl,
+	}
 }
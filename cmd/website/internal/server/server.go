@@ -1,12 +1,15 @@
 package server
 
 import (
+	"fmt"
 	"html/template"
+	"math/big"
 	"net/http"
 	"os"
+	"strconv"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gelfand/log"
-	"github.com/gelfand/mettu/cmd/website/internal/config"
 	"github.com/gelfand/mettu/cmd/website/internal/dathtml"
 	"github.com/gelfand/mettu/repo"
 	"github.com/go-chi/chi/v5"
@@ -16,25 +19,16 @@ import (
 type Server struct {
 	mux       *chi.Mux
 	templates map[string]*template.Template
-	db        *repo.DB
+	db        repo.Storage
 }
 
-func NewServer(cfg *config.Config) (*Server, error) {
-	if cfg == nil {
-		cfg = config.DefaultConfig
-	}
-	db, err := repo.NewDB(cfg.DBPath)
-	if err != nil {
-		return nil, err
-	}
-
-	s := &Server{
+// NewServer creates new Server serving the storage.
+func NewServer(db repo.Storage) *Server {
+	return &Server{
 		mux:       chi.NewMux(),
 		templates: dathtml.LoadHTML(),
 		db:        db,
 	}
-
-	return s, nil
 }
 
 func (s *Server) ListenAndServeTLS(addr, certFile, keyFile string) {
@@ -85,12 +79,162 @@ func (s *Server) Install() {
 		}
 		defer tx.Rollback()
 
-		accs, err := s.db.AllAccounts(tx)
+		page, err := pageOptions(r)
 		if err != nil {
-			log.Fatal(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// NOTE: one more record tells if there is the next page, it's the first record of it.
+		limit := page.Limit
+		if limit > 0 {
+			page.Limit++
+		}
+		accs, err := s.db.AccountsData(tx, page)
+		if err != nil {
+			log.Errorf("could not retrieve accounts: %v", err)
+			return
+		}
+		data := listing{Rows: accs}
+		if limit > 0 && len(accs) > limit {
+			data.Rows, data.Next = accs[:limit], nextPage(r, accs[limit].Address)
 		}
 
 		t := s.templates["accounts"]
-		t.Execute(w, accs)
+		t.Execute(w, data)
+	})
+	s.mux.HandleFunc("/patterns", func(w http.ResponseWriter, r *http.Request) {
+		tx, err := s.db.BeginRo(r.Context())
+		if err != nil {
+			log.Errorf("could not begin database transaction: %v", err)
+			return
+		}
+		defer tx.Rollback()
+
+		// Patterns of unsafe tokens are hidden unless ?all is set.
+		patternsData := s.db.SafePatternsData
+		if r.URL.Query().Has("all") {
+			patternsData = s.db.AllPatternsData
+		}
+		patterns, err := patternsData(tx)
+		if err != nil {
+			log.Errorf("could not retrieve patterns: %v", err)
+			return
+		}
+		s.templates["patterns"].Execute(w, patterns)
+	})
+	s.mux.HandleFunc("/tokens", func(w http.ResponseWriter, r *http.Request) {
+		tx, err := s.db.BeginRo(r.Context())
+		if err != nil {
+			log.Errorf("could not begin database transaction: %v", err)
+			return
+		}
+		defer tx.Rollback()
+
+		filter, err := tokenFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page, err := pageOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit := page.Limit
+		if limit > 0 {
+			page.Limit++
+		}
+		tokens, err := s.db.TokensData(tx, page, filter.Match)
+		if err != nil {
+			log.Errorf("could not retrieve tokens: %v", err)
+			return
+		}
+		data := listing{Rows: tokens}
+		if limit > 0 && len(tokens) > limit {
+			data.Rows, data.Next = tokens[:limit], nextPage(r, tokens[limit].Token.Address)
+		}
+		s.templates["tokens"].Execute(w, data)
 	})
+	s.mux.HandleFunc("/leaderboard", func(w http.ResponseWriter, r *http.Request) {
+		tx, err := s.db.BeginRo(r.Context())
+		if err != nil {
+			log.Errorf("could not begin database transaction: %v", err)
+			return
+		}
+		defer tx.Rollback()
+
+		scores, err := s.db.Leaderboard(tx, 100)
+		if err != nil {
+			log.Errorf("could not retrieve leaderboard: %v", err)
+			return
+		}
+		s.templates["leaderboard"].Execute(w, scores)
+	})
+}
+
+// pageSize is the number of records shown on the page unless the limit is given.
+const pageSize = 500
+
+// pageOptions parses the page of the listing, start is the address of it's first record.
+func pageOptions(r *http.Request) (repo.IterOptions, error) {
+	opts := repo.IterOptions{Limit: pageSize}
+	q := r.URL.Query()
+	if v := q.Get("start"); v != "" {
+		if !common.IsHexAddress(v) {
+			return repo.IterOptions{}, fmt.Errorf("invalid start: %q", v)
+		}
+		opts.Start = common.HexToAddress(v).Bytes()
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return repo.IterOptions{}, fmt.Errorf("invalid limit: %q", v)
+		}
+		opts.Limit = limit
+	}
+	opts.Reverse = q.Has("reverse")
+	return opts, nil
+}
+
+// listing is the page of records rendered by the templates, Next links to the next page, empty on the last one.
+type listing struct {
+	Rows interface{}
+	Next string
+}
+
+// nextPage returns the link to the page starting at the given address, other query parameters are kept.
+func nextPage(r *http.Request, start common.Address) string {
+	q := r.URL.Query()
+	q.Set("start", start.Hex())
+	return r.URL.Path + "?" + q.Encode()
+}
+
+// tokenFilter parses token filter from the query: min_liquidity in ETH, max_age in blocks, min_lp_locked
+// as a share and safe which excludes unsafe tokens.
+func tokenFilter(r *http.Request) (repo.TokenFilter, error) {
+	var f repo.TokenFilter
+	q := r.URL.Query()
+	if v := q.Get("min_liquidity"); v != "" {
+		eth, ok := new(big.Float).SetString(v)
+		if !ok {
+			return repo.TokenFilter{}, fmt.Errorf("invalid min_liquidity: %q", v)
+		}
+		f.MinLiquidity, _ = eth.Mul(eth, big.NewFloat(1e18)).Int(nil)
+	}
+	if v := q.Get("max_age"); v != "" {
+		age, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return repo.TokenFilter{}, fmt.Errorf("invalid max_age: %w", err)
+		}
+		f.MaxAge = age
+	}
+	if v := q.Get("min_lp_locked"); v != "" {
+		share, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return repo.TokenFilter{}, fmt.Errorf("invalid min_lp_locked: %w", err)
+		}
+		f.MinLPLocked = share
+	}
+	f.ExcludeUnsafe = q.Has("safe")
+	return f, nil
 }
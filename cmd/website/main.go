@@ -9,6 +9,7 @@ import (
 	"github.com/gelfand/log"
 	"github.com/gelfand/mettu/cmd/website/internal/config"
 	"github.com/gelfand/mettu/cmd/website/internal/server"
+	"github.com/gelfand/mettu/repo"
 )
 
 const (
@@ -50,10 +51,13 @@ func main() {
 		RPCAddr: rpcAddr,
 		DBPath:  *datadirFlag,
 	}
-	server, err := server.NewServer(cfg)
+	db, err := repo.NewDB(cfg.DBPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer db.Close()
+
+	server := server.NewServer(db)
 	server.Install()
 	server.ListenAndServeTLS("127.0.0.1:4444", *certFlag, *certkeyFlag)
 
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gelfand/mettu/internal/ethclient"
+	"github.com/gelfand/mettu/pgsink"
+	"github.com/gelfand/mettu/repo"
+)
+
+// backfillSwaps fills the block metadata and log index of the swaps recorded before they were stored from the
+// transaction receipts, so that the swaps are found by block, replicated and put into the pattern buckets.
+// The backfill runs once, it's marked complete after the first run and swaps whose receipts can't be retrieved
+// are left undated and logged, new swaps are always recorded with the block metadata.
+// NOTE: the redated swaps are older than the replication cursor, so they are published to the sink directly.
+func backfillSwaps(ctx context.Context, db repo.Storage, client *ethclient.Client, sink *pgsink.Sink) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to begin database transaction: %w", err)
+	}
+	done, err := db.SwapsBackfilled(tx)
+	if err != nil || done {
+		tx.Rollback()
+		return err
+	}
+	undated, err := db.UndatedSwaps(tx)
+	tx.Rollback()
+	if err != nil {
+		return err
+	}
+	if len(undated) == 0 {
+		return db.Update(ctx, func(tx repo.RwTx) error { return db.MarkSwapsBackfilled(tx) })
+	}
+	log.Printf("INFO: Backfilling block metadata of %d swaps", len(undated))
+
+	// NOTE: receipts are retrieved outside of the database transaction.
+	headers := make(map[uint64]*types.Header)
+	dated := make(map[int]repo.Swap, len(undated))
+	var failed int
+	for i, s := range undated {
+		receipt, err := client.TransactionReceipt(ctx, s.TxHash)
+		if err != nil {
+			failed++
+			log.Printf("ERROR: unable to retrieve receipt of swap %v: %v", s.TxHash, err)
+			continue
+		}
+		blockNumber := receipt.BlockNumber.Uint64()
+		header, ok := headers[blockNumber]
+		if !ok {
+			if header, err = client.HeaderByNumber(ctx, receipt.BlockNumber); err != nil {
+				failed++
+				log.Printf("ERROR: unable to retrieve header of block %d: %v", blockNumber, err)
+				continue
+			}
+			headers[blockNumber] = header
+		}
+
+		// NOTE: the swap is keyed by the `Swap` log of it's last hop.
+		logIndex, ok := ethclient.SwapLogIndex(receipt)
+		if !ok {
+			failed++
+			log.Printf("ERROR: swap %v has no `Swap` log, the transaction reverted", s.TxHash)
+			continue
+		}
+		s.BlockNumber, s.Timestamp, s.TxIndex, s.LogIndex = blockNumber, header.Time, receipt.TransactionIndex, logIndex
+		dated[i] = s
+	}
+
+	if err := db.Update(ctx, func(tx repo.RwTx) error {
+		for i, s := range dated {
+			if err := db.RedateSwap(tx, undated[i], s); err != nil {
+				return err
+			}
+
+			// NOTE: patterns are attributed to the exchange of the wallet's account, see repo.DB.Check.
+			ok, err := db.HasAccount(tx, s.Wallet)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			acc, err := db.PeekAccount(tx, s.Wallet)
+			if err != nil {
+				return err
+			}
+			if acc.Exchange == "" {
+				continue
+			}
+			if err := db.AddPatternBuckets(tx, s.TokenAddr, acc.Exchange, s.Value, time.Unix(int64(s.Timestamp), 0)); err != nil {
+				return fmt.Errorf("unable to add pattern buckets of swap %v: %w", s.TxHash, err)
+			}
+		}
+		return db.MarkSwapsBackfilled(tx)
+	}); err != nil {
+		return fmt.Errorf("unable to backfill swaps: %w", err)
+	}
+
+	batch := pgsink.Batch{Swaps: make([]repo.Swap, 0, len(dated))}
+	for _, s := range dated {
+		batch.Swaps = append(batch.Swaps, s)
+	}
+	sink.Publish(batch)
+
+	if failed > 0 {
+		log.Printf("INFO: %d swaps are left without block metadata for good, they are missing from block ranges, replication and pattern buckets", failed)
+	}
+	return nil
+}
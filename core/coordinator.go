@@ -10,31 +10,38 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gelfand/mettu/backup"
 	abintr "github.com/gelfand/mettu/internal/abi"
 	"github.com/gelfand/mettu/internal/ethclient"
 	"github.com/gelfand/mettu/lib"
+	"github.com/gelfand/mettu/notify"
+	"github.com/gelfand/mettu/pgsink"
+	"github.com/gelfand/mettu/pnl"
 	"github.com/gelfand/mettu/repo"
+	"github.com/gelfand/mettu/signals"
 )
 
 type Coordinator struct {
 	// TODO: maybe make use of this lock.
 	lock sync.Mutex
 
-	db        *repo.DB
+	db        repo.Storage
 	client    *ethclient.Client
 	signer    types.Signer
 	exchanges map[common.Address]repo.Exchange
+	reserves  *reserveState
+	pnl       *pnl.Engine
+	signals   *signals.Engine
+	notifier  *notify.Notifier
+	sink      *pgsink.Sink
+	backups   *backup.Scheduler
+	checker   *tokenChecker
 	headersCh chan *types.Header
-	txsChan   chan []*types.Transaction
+	blocksCh  chan *types.Block
 }
 
-// NewCoordinator creates new Coordinator.
-func NewCoordinator(ctx context.Context, dbPath string, rpcAddr string) (*Coordinator, error) {
-	db, err := repo.NewDB(dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("unable to open database: %w", err)
-	}
-
+// NewCoordinator creates new Coordinator on top of the storage, the caller closes the storage once Run returns.
+func NewCoordinator(ctx context.Context, db repo.Storage, rpcAddr string, rules []signals.Rule, notifier *notify.Notifier, sink *pgsink.Sink, backups *backup.Scheduler) (*Coordinator, error) {
 	client, err := ethclient.DialContext(ctx, rpcAddr)
 	if err != nil {
 		return nil, fmt.Errorf("unable to establlish connection with Ethereum RPC: %w", err)
@@ -45,6 +52,10 @@ func NewCoordinator(ctx context.Context, dbPath string, rpcAddr string) (*Coordi
 		return nil, fmt.Errorf("unable to retrieve chainID: %w", err)
 	}
 
+	if err := backfillSwaps(ctx, db, client, sink); err != nil {
+		return nil, err
+	}
+
 	tx, err := db.BeginRo(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("unable to begin database transaction: %w", err)
@@ -56,20 +67,41 @@ func NewCoordinator(ctx context.Context, dbPath string, rpcAddr string) (*Coordi
 		return nil, fmt.Errorf("unable to retrieve all exchanges from the database: %w", err)
 	}
 
+	reserves, err := newReserveState(db, client, tx)
+	if err != nil {
+		return nil, err
+	}
+
 	c := &Coordinator{
 		db:        db,
 		client:    client,
 		signer:    types.LatestSignerForChainID(chainID),
 		exchanges: exchanges,
+		reserves:  reserves,
+		notifier:  notifier,
+		sink:      sink,
+		backups:   backups,
+		checker:   newTokenChecker(client),
 		headersCh: make(chan *types.Header),
-		txsChan:   make(chan []*types.Transaction),
+		blocksCh:  make(chan *types.Block),
+	}
+	if c.pnl, err = loadPnL(c, tx); err != nil {
+		return nil, err
+	}
+	if c.signals, err = loadSignals(ctx, c, tx, rules); err != nil {
+		return nil, err
 	}
 	fmt.Println(len(c.exchanges))
 	return c, tx.Commit()
 }
 
 // TODO: Parallelize.
-func (c *Coordinator) processTransactions(ctx context.Context, txs []*types.Transaction) error {
+func (c *Coordinator) processBlock(ctx context.Context, block *types.Block) error {
+	syncEvents, err := c.client.SyncLogs(ctx, block.Hash())
+	if err != nil {
+		return fmt.Errorf("could not retrieve sync events: %w", err)
+	}
+
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	tx, err := c.db.BeginRw(ctx)
@@ -77,17 +109,52 @@ func (c *Coordinator) processTransactions(ctx context.Context, txs []*types.Tran
 		return fmt.Errorf("unexpected error: could not begin database transaction: %w", err)
 	}
 	defer tx.Rollback()
+	// NOTE: reserves and signals staged by the block are dropped unless the transaction is committed.
+	defer c.reserves.discard()
+	defer c.signals.Discard()
 
-	for _, txn := range txs {
+	changedHops, err := c.reserves.applySync(tx, block.NumberU64(), syncEvents)
+	if err != nil {
+		return fmt.Errorf("could not apply sync events: %w", err)
+	}
+	if err = c.recordValuation(tx, block.NumberU64()); err != nil {
+		return fmt.Errorf("could not record valuation: %w", err)
+	}
+
+	var (
+		recorded []pnl.Position
+		checks   []tokenCheck
+	)
+	blockTime := time.Unix(int64(block.Time()), 0)
+	batch := pgsink.Batch{BlockNumber: block.NumberU64()}
+
+	for txIndex, txn := range block.Transactions() {
 		if txn.To() == nil || txn.Value().Cmp(big.NewInt(1e18)) == -1 {
 			continue
 		}
 		if _, ok := c.exchanges[*txn.To()]; ok {
 			continue
 		}
+		// NOTE: the block may be processed again after a resubscribe, replay or reorg, skip applied transactions.
+		processed, err := c.db.IsTxProcessed(tx, txn.Hash())
+		if err != nil {
+			return err
+		}
+		if processed {
+			continue
+		}
 
 		from, _ := types.Sender(c.signer, txn)
-		cex, ok := c.exchanges[from]
+		var cex repo.Exchange
+		_, ok := c.exchanges[from]
+		if ok {
+			// NOTE: the cache only tells hot wallets apart, the exchange is read from the block transaction
+			// so that renames and merges made while running are written under the current exchange ID.
+			if cex, err = c.db.PeekExchange(tx, from); err != nil {
+				return fmt.Errorf("could not peek exchange: %w", err)
+			}
+			ok = cex.Name != ""
+		}
 		if ok {
 			log.Printf("Detected new CEX transfer, to: %v, from: %v, value: %v ETH", *txn.To(), cex.Name, new(big.Int).Div(txn.Value(), big.NewInt(1e18)))
 
@@ -114,10 +181,26 @@ func (c *Coordinator) processTransactions(ctx context.Context, txs []*types.Tran
 			if err := c.db.PutAccount(tx, acc); err != nil {
 				return fmt.Errorf("could not put account into key value storage: %w", err)
 			}
+			funding := repo.Funding{
+				TxHash:      txn.Hash(),
+				Exchange:    cex.Name,
+				Wallet:      acc.Address,
+				Value:       txn.Value(),
+				BlockNumber: block.NumberU64(),
+				Timestamp:   block.Time(),
+			}
+			if err := c.db.PutFunding(tx, funding); err != nil {
+				return fmt.Errorf("could not put funding record: %w", err)
+			}
+			if err := c.db.MarkTxProcessed(tx, txn.Hash(), block.NumberU64()); err != nil {
+				return err
+			}
+			batch.Accounts = append(batch.Accounts, acc)
+			batch.Fundings = append(batch.Fundings, funding)
 			continue
 		}
 
-		ok, err := c.db.HasAccount(tx, from)
+		ok, err = c.db.HasAccount(tx, from)
 		if err != nil {
 			return fmt.Errorf("could not check if account exists in the db: %w", err)
 		}
@@ -143,6 +226,16 @@ func (c *Coordinator) processTransactions(ctx context.Context, txs []*types.Tran
 		if err != nil {
 			continue
 		}
+		// NOTE: the swap is keyed by the `Swap` log of it's last hop, reverted transactions have none.
+		receipt, err := c.client.TransactionReceipt(ctx, txn.Hash())
+		if err != nil {
+			log.Printf("ERROR: unable to retrieve receipt of swap %v: %v", txn.Hash(), err)
+			continue
+		}
+		logIndex, ok := ethclient.SwapLogIndex(receipt)
+		if !ok {
+			continue
+		}
 
 		var tokens []repo.Token
 		for _, tokenAddr := range txData.Path {
@@ -162,18 +255,26 @@ func (c *Coordinator) processTransactions(ctx context.Context, txs []*types.Tran
 
 			token, err = c.client.TokenAt(tokenAddr)
 			if err != nil {
-				continue
+				log.Printf("could not resolve token: %v", err)
+				break
 			}
 			tokens = append(tokens, token)
 		}
+		// NOTE: every token of the path is stored below, skip the swap if some of them could not be resolved.
+		if len(tokens) == 0 || len(tokens) != len(txData.Path) {
+			continue
+		}
 
 		tokenOut := tokens[len(tokens)-1]
-		reserves, err := c.client.GetReservesPath(factoryAddr, txData.Path)
+		reserves, err := c.reserves.reservesPath(tx, factoryAddr, txData.Path, block.NumberU64())
 		if err != nil {
 			log.Printf("could not retrieve reserves: %v, path: %v", err, txData.Path)
 			continue
 		}
 		price := lib.CalculatePrice(tokenOut.Denominator(), reserves)
+		if err = c.db.PutPriceAt(tx, tokenOut.Address, block.NumberU64(), price); err != nil {
+			return fmt.Errorf("unable to put price history record: %w", err)
+		}
 
 		ok, err = c.db.HasToken(tx, tokenOut.Address)
 		if err != nil {
@@ -227,20 +328,43 @@ func (c *Coordinator) processTransactions(ctx context.Context, txs []*types.Tran
 		if err = c.db.PutPattern(tx, pattern); err != nil {
 			return fmt.Errorf("unable to put updated pattern data: %w", err)
 		}
+		if err = c.db.AddPatternBuckets(tx, tokenOut.Address, acc.Exchange, txn.Value(), blockTime); err != nil {
+			return fmt.Errorf("unable to update pattern buckets: %w", err)
+		}
 
 		s := repo.Swap{
-			TxHash:    txn.Hash(),
-			Wallet:    from,
-			TokenAddr: tokenOut.Address,
-			Price:     price,
-			Path:      txData.Path,
-			Factory:   factoryAddr,
-			Value:     txn.Value(),
+			TxHash:      txn.Hash(),
+			Wallet:      from,
+			TokenAddr:   tokenOut.Address,
+			Price:       price,
+			Path:        txData.Path,
+			Factory:     factoryAddr,
+			Value:       txn.Value(),
+			BlockNumber: block.NumberU64(),
+			Timestamp:   block.Time(),
+			TxIndex:     uint(txIndex),
+			LogIndex:    logIndex,
 		}
 
 		if err = c.db.PutSwap(tx, s); err != nil {
 			return fmt.Errorf("unable to put swap record: %w", err)
 		}
+		if err = c.db.MarkTxProcessed(tx, s.TxHash, s.BlockNumber); err != nil {
+			return err
+		}
+		recorded = append(recorded, pnl.Position{Swap: s, Exchange: acc.Exchange})
+		checks = append(checks, tokenCheck{router: *txn.To(), factory: factoryAddr, token: s.TokenAddr, blockNumber: s.BlockNumber})
+		batch.Accounts = append(batch.Accounts, acc)
+		batch.Patterns = append(batch.Patterns, pattern)
+		batch.Swaps = append(batch.Swaps, s)
+		c.signals.Observe(signals.Buy{
+			TxHash:   s.TxHash,
+			Wallet:   s.Wallet,
+			Token:    s.TokenAddr,
+			Exchange: acc.Exchange,
+			Value:    s.Value,
+			Time:     blockTime,
+		})
 
 		for _, token := range tokens {
 			if err = c.db.PutToken(tx, token); err != nil {
@@ -248,20 +372,45 @@ func (c *Coordinator) processTransactions(ctx context.Context, txs []*types.Tran
 			}
 			log.Printf("INFO: Successfully updated %s: %v", token.Symbol, token.Address)
 		}
+		batch.Tokens = append(batch.Tokens, tokens...)
+	}
+	fired, err := c.fireSignals(tx, block)
+	if err != nil {
+		return err
 	}
-	return tx.Commit()
+	states, missed, err := c.revaluePositions(ctx, tx, block.NumberU64(), changedHops, recorded)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	c.reserves.commit()
+	c.signals.Commit()
+	c.pnl.Commit(recorded, states, missed)
+	c.notifier.Notify(fired)
+	c.sink.Publish(batch)
+
+	c.checkSafety(checks)
+	return nil
 }
 
 func (c *Coordinator) proccessorLifecycle(ctx context.Context) {
 	log.Printf("Successfully started Proccessor lifecycle")
 	cycleCounter := 0
+	leaderboardTicker := time.NewTicker(leaderboardInterval)
+	defer leaderboardTicker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case txs := <-c.txsChan:
+		case <-leaderboardTicker.C:
+			if err := c.refreshLeaderboard(ctx); err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+		case block := <-c.blocksCh:
 			log.Printf("Cycle: %d", cycleCounter)
-			if err := c.processTransactions(ctx, txs); err != nil {
+			if err := c.processBlock(ctx, block); err != nil {
 				panic(err)
 			}
 			cycleCounter++
@@ -270,8 +419,12 @@ func (c *Coordinator) proccessorLifecycle(ctx context.Context) {
 }
 
 func (c *Coordinator) Run(ctx context.Context) error {
-	defer c.db.Close()
 	go c.proccessorLifecycle(ctx)
+	go c.metaLifecycle(ctx)
+	go c.safetyLifecycle(ctx)
+	go c.repriceLifecycle(ctx)
+	go c.sink.Run(ctx, c.db)
+	go c.backups.Run(ctx, c.db)
 
 	sub, err := c.client.SubscribeNewHead(ctx, c.headersCh)
 	if err != nil {
@@ -293,7 +446,7 @@ func (c *Coordinator) Run(ctx context.Context) error {
 			}
 			cancel()
 
-			c.txsChan <- block.Transactions()
+			c.blocksCh <- block
 		}
 	}
 }
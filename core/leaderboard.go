@@ -0,0 +1,29 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gelfand/mettu/repo"
+	"github.com/gelfand/mettu/score"
+)
+
+// leaderboardInterval is how often the wallet leaderboard is recomputed.
+const leaderboardInterval = 10 * time.Minute
+
+// refreshLeaderboard scores wallets by their cached positions and replaces the stored leaderboard.
+func (c *Coordinator) refreshLeaderboard(ctx context.Context) error {
+	head := c.reserves.headBlock()
+	if head == 0 {
+		return nil
+	}
+
+	scores := score.DefaultModel.Leaderboard(c.pnl.Positions(), head)
+	if err := c.db.Update(ctx, func(tx repo.RwTx) error {
+		return c.db.PutLeaderboard(tx, scores)
+	}); err != nil {
+		return fmt.Errorf("could not refresh leaderboard: %w", err)
+	}
+	return nil
+}
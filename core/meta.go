@@ -0,0 +1,73 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gelfand/mettu/repo"
+)
+
+const (
+	// metaInterval is how often stale token metadata is refreshed.
+	metaInterval = 10 * time.Minute
+	// metaMaxAge is the number of blocks after which token metadata is stale.
+	metaMaxAge = 300
+	// metaBatch is the maximum number of tokens refreshed at once.
+	metaBatch = 50
+)
+
+func (c *Coordinator) metaLifecycle(ctx context.Context) {
+	ticker := time.NewTicker(metaInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.refreshTokenMeta(ctx); err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+		}
+	}
+}
+
+// refreshTokenMeta refreshes metadata of the least recently refreshed tokens.
+func (c *Coordinator) refreshTokenMeta(ctx context.Context) error {
+	head := c.reserves.headBlock()
+	if head <= metaMaxAge {
+		return nil
+	}
+
+	var stale []repo.Token
+	if err := c.db.View(ctx, func(tx repo.Tx) (err error) {
+		stale, err = c.db.StaleTokens(tx, head-metaMaxAge, metaBatch)
+		return err
+	}); err != nil {
+		return fmt.Errorf("could not retrieve stale tokens: %w", err)
+	}
+
+	for _, t := range stale {
+		meta, err := c.client.TokenMetaAt(ctx, uniswapV2Factory, wethAddr, t.Address, head, t.Meta)
+		if err != nil {
+			log.Printf("ERROR: could not refresh metadata of %s (%v): %v", t.Symbol, t.Address, err)
+			continue
+		}
+
+		c.lock.Lock()
+		err = c.db.Update(ctx, func(tx repo.RwTx) error {
+			t, err := c.db.PeekToken(tx, t.Address)
+			if err != nil {
+				return err
+			}
+			t.Meta = meta
+			return c.db.PutToken(tx, t)
+		})
+		c.lock.Unlock()
+		if err != nil {
+			return fmt.Errorf("could not put token metadata: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/pnl"
+	"github.com/gelfand/mettu/repo"
+)
+
+// loadPnL creates pnl.Engine with all the stored swaps and their persisted positions.
+func loadPnL(c *Coordinator, tx repo.Tx) (*pnl.Engine, error) {
+	exchanges := make(map[common.Address]string)
+	if err := c.db.IterAccounts(tx, repo.IterOptions{}, func(acc repo.Account) error {
+		exchanges[acc.Address] = acc.Exchange
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to retrieve all accounts from the database: %w", err)
+	}
+	positions, err := c.db.AllPositionsMap(tx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve all positions from the database: %w", err)
+	}
+
+	e := pnl.NewEngine(c)
+	if err := c.db.IterSwaps(tx, repo.IterOptions{}, func(s repo.Swap) error {
+		state, ok := positions[string(s.Key())]
+		e.Restore(s, exchanges[s.Wallet], state, ok)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to retrieve all swaps from the database: %w", err)
+	}
+	return e, nil
+}
+
+// revaluePositions revalues the swaps recorded in the block, pending positions and positions affected by the block
+// within the block transaction and persists their states in it. The positions are priced from the price history
+// and the local reserves only, the ones which can't be priced so are returned as missed and keep their states,
+// they are left to the repricer. Returned states are kept by the engine once tx is committed.
+func (c *Coordinator) revaluePositions(ctx context.Context, tx repo.RwTx, blockNumber uint64, changed []pnl.Hop, added []pnl.Position) ([]repo.Position, []pnl.Position, error) {
+	states, missed, err := c.pnl.Revalue(ctx, blockPrices{c: c, tx: tx}, blockNumber, changed, added)
+	if err != nil && !errors.Is(err, errNoLocalPrice) {
+		log.Printf("ERROR: %v", err)
+	}
+
+	for _, state := range states {
+		if err := c.db.PutPosition(tx, state); err != nil {
+			return nil, nil, err
+		}
+	}
+	return states, missed, nil
+}
+
+const (
+	// repriceInterval is how often the pending positions are repriced through the node.
+	repriceInterval = time.Minute
+	// repriceMaxBackoff is the longest delay between the attempts to price a path which can't be priced.
+	repriceMaxBackoff = time.Hour
+)
+
+// repricer backs off pricing of the paths which couldn't be priced through the node, the delay doubles with every
+// failed attempt up to repriceMaxBackoff. Paths are keyed by factory and tokens.
+type repricer struct {
+	c       *Coordinator
+	retries map[string]retry
+	failed  int
+}
+
+type retry struct {
+	at    time.Time
+	delay time.Duration
+}
+
+// PriceAt implements pnl.PriceSource.
+func (r *repricer) PriceAt(ctx context.Context, factoryAddr common.Address, path []common.Address, blockNumber uint64) (*big.Int, error) {
+	key := string(factoryAddr.Bytes())
+	for _, addr := range path {
+		key += string(addr.Bytes())
+	}
+	next, ok := r.retries[key]
+	if ok && time.Now().Before(next.at) {
+		return nil, errBackoff
+	}
+
+	price, err := r.c.PriceAt(ctx, factoryAddr, path, blockNumber)
+	if err != nil {
+		if next.delay *= 2; next.delay == 0 {
+			next.delay = repriceInterval
+		} else if next.delay > repriceMaxBackoff {
+			next.delay = repriceMaxBackoff
+		}
+		next.at = time.Now().Add(next.delay)
+		r.retries[key] = next
+		r.failed++
+		return nil, err
+	}
+	delete(r.retries, key)
+	return price, nil
+}
+
+// errBackoff is returned by repricer for paths whose next attempt is not due yet.
+var errBackoff = errors.New("pricing backed off")
+
+func (c *Coordinator) repriceLifecycle(ctx context.Context) {
+	r := &repricer{c: c, retries: make(map[string]retry)}
+	ticker := time.NewTicker(repriceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.repricePositions(ctx, r); err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+		}
+	}
+}
+
+// repricePositions revalues the pending positions at the last processed block through the node, outside of the
+// block transaction and without the coordinator lock. Only persisting the states takes the lock.
+func (c *Coordinator) repricePositions(ctx context.Context, r *repricer) error {
+	head := c.reserves.headBlock()
+	if head == 0 || len(c.pnl.Pending()) == 0 {
+		return nil
+	}
+
+	r.failed = 0
+	states, _, err := c.pnl.Revalue(ctx, r, head, nil, nil)
+	if err != nil && r.failed > 0 {
+		log.Printf("ERROR: %v", err)
+	}
+	if len(states) == 0 {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// NOTE: the block processed meanwhile may have revalued the positions already, newer states are kept.
+	fresh := states[:0]
+	for _, state := range states {
+		if p, ok := c.pnl.Position(state.TxHash, state.LogIndex); ok && state.BlockNumber >= p.State.BlockNumber {
+			fresh = append(fresh, state)
+		}
+	}
+	if err := c.db.Update(ctx, func(tx repo.RwTx) error {
+		for _, state := range fresh {
+			if err := c.db.PutPosition(tx, state); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("could not put repriced positions: %w", err)
+	}
+	c.pnl.Commit(nil, fresh, nil)
+	return nil
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/lib"
+	"github.com/gelfand/mettu/repo"
+)
+
+// errNoLocalPrice is returned by blockPrices for paths which can't be priced without the node.
+var errNoLocalPrice = errors.New("no local price")
+
+// PriceAt returns ETH price of the last token of the path at the given block.
+// The price is looked up in the price history first, so the archive node is queried only once per token and block.
+// The node is queried outside of the database transactions.
+// PriceAt implements pnl.PriceSource.
+func (c *Coordinator) PriceAt(ctx context.Context, factoryAddr common.Address, path []common.Address, blockNumber uint64) (*big.Int, error) {
+	if len(path) < 2 {
+		return nil, fmt.Errorf("invalid path of %d tokens", len(path))
+	}
+	tokenAddr := path[len(path)-1]
+
+	var (
+		price  *big.Int
+		token  repo.Token
+		stored bool
+	)
+	if err := c.db.View(ctx, func(tx repo.Tx) (err error) {
+		if price, err = c.localPriceAt(tx, factoryAddr, path, blockNumber); err != errNoLocalPrice {
+			return err
+		}
+		price = nil
+		if stored, err = c.db.HasToken(tx, tokenAddr); err != nil || !stored {
+			return err
+		}
+		token, err = c.db.PeekToken(tx, tokenAddr)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if price != nil {
+		return price, nil
+	}
+
+	if !stored {
+		var err error
+		if token, err = c.client.TokenAt(tokenAddr); err != nil {
+			return nil, fmt.Errorf("could not resolve token: %w", err)
+		}
+	}
+	price, err := c.client.PriceAt(factoryAddr, path, token.Denominator(), new(big.Int).SetUint64(blockNumber))
+	if err != nil {
+		return nil, err
+	}
+	if err = c.db.Update(ctx, func(tx repo.RwTx) error {
+		return c.db.PutPriceAt(tx, tokenAddr, blockNumber, price)
+	}); err != nil {
+		return nil, err
+	}
+	return price, nil
+}
+
+// blockPrices prices within the block transaction, it sees the reserves staged by the block. It never queries the
+// node, paths without the price history or local reserves are left to the repricer, see repricePositions.
+type blockPrices struct {
+	c  *Coordinator
+	tx repo.RwTx
+}
+
+// PriceAt implements pnl.PriceSource.
+func (p blockPrices) PriceAt(_ context.Context, factoryAddr common.Address, path []common.Address, blockNumber uint64) (*big.Int, error) {
+	if len(path) < 2 {
+		return nil, fmt.Errorf("invalid path of %d tokens", len(path))
+	}
+	return p.c.localPriceAt(p.tx, factoryAddr, path, blockNumber)
+}
+
+// localPriceAt returns ETH price of the last token of the path at the given block from the price history or
+// the local reserves, errNoLocalPrice is returned if neither has it.
+func (c *Coordinator) localPriceAt(tx repo.Tx, factoryAddr common.Address, path []common.Address, blockNumber uint64) (*big.Int, error) {
+	tokenAddr := path[len(path)-1]
+
+	price, ok, err := c.db.PeekPriceAt(tx, tokenAddr, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return price, nil
+	}
+
+	// NOTE: fast path, local reserves are exact as of the last processed block and the block being processed.
+	reserves, ok := c.reserves.reservesAt(factoryAddr, path, blockNumber)
+	if !ok {
+		return nil, errNoLocalPrice
+	}
+	ok, err = c.db.HasToken(tx, tokenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not check if token exists in the db: %w", err)
+	}
+	if !ok {
+		return nil, errNoLocalPrice
+	}
+	token, err := c.db.PeekToken(tx, tokenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not peek token: %w", err)
+	}
+	return lib.CalculatePrice(token.Denominator(), reserves), nil
+}
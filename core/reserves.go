@@ -0,0 +1,286 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/internal/ethclient"
+	"github.com/gelfand/mettu/lib"
+	"github.com/gelfand/mettu/pnl"
+	"github.com/gelfand/mettu/repo"
+	"github.com/gelfand/mettu/uniswap/pair"
+)
+
+type pairKey struct {
+	factory        common.Address
+	token0, token1 common.Address
+}
+
+func newPairKey(factory, tokenA, tokenB common.Address) pairKey {
+	if bytes.Compare(tokenA.Bytes(), tokenB.Bytes()) > 0 {
+		tokenA, tokenB = tokenB, tokenA
+	}
+	return pairKey{factory: factory, token0: tokenA, token1: tokenB}
+}
+
+// reserveState is local copy of the reserves of every pair touched by the tracked tokens.
+// Pairs are seeded lazily over RPC on the first sight and kept up to date by `Sync` events.
+// Pairs which could have traded in the blocks which were never applied, e.g. while mettu was down,
+// are reseeded over RPC before the next block is applied.
+// Changes made within the block transaction are staged and become visible to readers only once
+// commit is called after the transaction is committed, discard drops them if it's rolled back.
+type reserveState struct {
+	mu sync.RWMutex
+
+	db     repo.Storage
+	client *ethclient.Client
+
+	pairs map[common.Address]repo.Pair
+	index map[pairKey]common.Address
+	// head is the last block whose `Sync` events were applied, it's persisted with the pairs.
+	head uint64
+
+	staged      map[common.Address]repo.Pair
+	stagedIndex map[pairKey]common.Address
+	stagedHead  uint64
+}
+
+func newReserveState(db repo.Storage, client *ethclient.Client, tx repo.Tx) (*reserveState, error) {
+	s := &reserveState{
+		db:     db,
+		client: client,
+		pairs:  make(map[common.Address]repo.Pair),
+		index:  make(map[pairKey]common.Address),
+
+		staged:      make(map[common.Address]repo.Pair),
+		stagedIndex: make(map[pairKey]common.Address),
+	}
+	if err := db.IterPairs(tx, repo.IterOptions{}, func(p repo.Pair) error {
+		s.pairs[p.Address] = p
+		s.index[newPairKey(p.Factory, p.Token0, p.Token1)] = p.Address
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to retrieve all pairs from the database: %w", err)
+	}
+	head, err := db.ReservesHead(tx)
+	if err != nil {
+		return nil, err
+	}
+	s.head = head
+	return s, nil
+}
+
+// pair returns pair of the tokenA and tokenB, seeding it if it's seen for the first time.
+func (s *reserveState) pair(tx repo.RwTx, factory, tokenA, tokenB common.Address, blockNumber uint64) (repo.Pair, error) {
+	key := newPairKey(factory, tokenA, tokenB)
+
+	s.mu.RLock()
+	p, ok := s.lookup(key)
+	s.mu.RUnlock()
+	if ok {
+		return p, nil
+	}
+
+	p, err := s.client.PairAt(factory, tokenA, tokenB, new(big.Int).SetUint64(blockNumber))
+	if err != nil {
+		return repo.Pair{}, fmt.Errorf("unable to seed pair: %w", err)
+	}
+	p.BlockNumber = blockNumber
+
+	if err := s.db.PutPair(tx, p); err != nil {
+		return repo.Pair{}, err
+	}
+
+	s.mu.Lock()
+	s.staged[p.Address] = p
+	s.stagedIndex[key] = p.Address
+	s.mu.Unlock()
+
+	return p, nil
+}
+
+// lookup returns the pair of the key with the staged changes applied, s.mu must be held.
+func (s *reserveState) lookup(key pairKey) (repo.Pair, bool) {
+	addr, ok := s.stagedIndex[key]
+	if !ok {
+		if addr, ok = s.index[key]; !ok {
+			return repo.Pair{}, false
+		}
+	}
+	if p, ok := s.staged[addr]; ok {
+		return p, true
+	}
+	return s.pairs[addr], true
+}
+
+// reservesPath returns reserves for every hop of the path.
+func (s *reserveState) reservesPath(tx repo.RwTx, factory common.Address, path []common.Address, blockNumber uint64) ([]lib.Reserves, error) {
+	reserves := make([]lib.Reserves, 0, len(path))
+	for i := 1; i < len(path); i++ {
+		p, err := s.pair(tx, factory, path[i-1], path[i], blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		reserves = append(reserves, p.Reserves(path[i-1]))
+	}
+
+	return reserves, nil
+}
+
+// reservesAt returns reserves for every hop of the path from the local state, the staged changes are used
+// for the block being processed. ok is false if the state is not as of the given block or some pair is not tracked.
+func (s *reserveState) reservesAt(factory common.Address, path []common.Address, blockNumber uint64) ([]lib.Reserves, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	staged := s.stagedHead != 0 && blockNumber == s.stagedHead
+	if !staged && blockNumber != s.head {
+		return nil, false
+	}
+
+	reserves := make([]lib.Reserves, 0, len(path))
+	for i := 1; i < len(path); i++ {
+		key := newPairKey(factory, path[i-1], path[i])
+		var (
+			p  repo.Pair
+			ok bool
+		)
+		if staged {
+			p, ok = s.lookup(key)
+		} else {
+			var addr common.Address
+			if addr, ok = s.index[key]; ok {
+				p = s.pairs[addr]
+			}
+		}
+		if !ok {
+			return nil, false
+		}
+		reserves = append(reserves, p.Reserves(path[i-1]))
+	}
+	return reserves, true
+}
+
+// applySync updates reserves of the tracked pairs from `Sync` events of the block, events are expected in the log order.
+// It returns hops of the pairs whose reserves were changed.
+func (s *reserveState) applySync(tx repo.RwTx, blockNumber uint64, events []*pair.PairSync) ([]pnl.Hop, error) {
+	changed, err := s.reseed(tx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ev := range events {
+		p, ok := s.staged[ev.Raw.Address]
+		if !ok {
+			p, ok = s.pairs[ev.Raw.Address]
+		}
+		if !ok || ev.Raw.BlockNumber < p.BlockNumber {
+			continue
+		}
+
+		p.Reserve0, p.Reserve1 = ev.Reserve0, ev.Reserve1
+		p.BlockNumber = ev.Raw.BlockNumber
+		if err := s.db.PutPair(tx, p); err != nil {
+			return nil, fmt.Errorf("unable to put synced pair: %w", err)
+		}
+		s.staged[p.Address] = p
+		changed = append(changed, pnl.NewHop(p.Token0, p.Token1))
+	}
+	if err := s.db.PutReservesHead(tx, blockNumber); err != nil {
+		return nil, err
+	}
+	s.stagedHead = blockNumber
+
+	return changed, nil
+}
+
+// reseed retrieves reserves as of the previous block of every pair which was not updated since,
+// if some blocks before the given one were never applied. It returns hops of the reseeded pairs.
+// NOTE: pairs are only tracked from the blocks mettu has seen, so a pair older than the previous block
+// after a gap could have traded in the missed blocks.
+func (s *reserveState) reseed(tx repo.RwTx, blockNumber uint64) ([]pnl.Hop, error) {
+	s.mu.RLock()
+	gap := blockNumber > 0 && (s.head == 0 || blockNumber > s.head+1)
+	var stale []repo.Pair
+	if gap {
+		for _, p := range s.pairs {
+			if p.BlockNumber < blockNumber-1 {
+				stale = append(stale, p)
+			}
+		}
+	}
+	head := s.head
+	s.mu.RUnlock()
+	if len(stale) == 0 {
+		return nil, nil
+	}
+	log.Printf("INFO: Reseeding %d pairs missing blocks %d-%d", len(stale), head+1, blockNumber-1)
+
+	// NOTE: reserves are retrieved without the lock, readers don't use the state of the missed blocks.
+	prev := new(big.Int).SetUint64(blockNumber - 1)
+	reseeded := make([]repo.Pair, 0, len(stale))
+	for _, p := range stale {
+		fresh, err := s.client.PairAt(p.Factory, p.Token0, p.Token1, prev)
+		if err != nil {
+			return nil, fmt.Errorf("unable to reseed pair %v: %w", p.Address, err)
+		}
+		fresh.BlockNumber = blockNumber - 1
+		if err := s.db.PutPair(tx, fresh); err != nil {
+			return nil, err
+		}
+		reseeded = append(reseeded, fresh)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := make([]pnl.Hop, 0, len(reseeded))
+	for _, p := range reseeded {
+		s.staged[p.Address] = p
+		changed = append(changed, pnl.NewHop(p.Token0, p.Token1))
+	}
+	return changed, nil
+}
+
+// commit makes the staged changes visible, it's called once the block transaction is committed.
+func (s *reserveState) commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for addr, p := range s.staged {
+		s.pairs[addr] = p
+	}
+	for key, addr := range s.stagedIndex {
+		s.index[key] = addr
+	}
+	if s.stagedHead != 0 {
+		s.head = s.stagedHead
+	}
+	s.reset()
+}
+
+// discard drops the staged changes of the rolled back block transaction.
+func (s *reserveState) discard() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+}
+
+func (s *reserveState) reset() {
+	s.staged = make(map[common.Address]repo.Pair)
+	s.stagedIndex = make(map[pairKey]common.Address)
+	s.stagedHead = 0
+}
+
+// headBlock returns the last block whose `Sync` events were applied.
+func (s *reserveState) headBlock() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.head
+}
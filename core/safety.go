@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/repo"
+	"github.com/gelfand/mettu/safety"
+)
+
+const (
+	// safetyWorkers is the number of safety checks run at once.
+	safetyWorkers = 4
+	// safetyQueueSize is the number of safety checks waiting for a worker.
+	safetyQueueSize = 256
+)
+
+// tokenCheck is the safety check of the token bought through the router.
+type tokenCheck struct {
+	router      common.Address
+	factory     common.Address
+	token       common.Address
+	blockNumber uint64
+}
+
+// tokenChecker runs safety checks of the bought tokens in the background, every token is checked once per run.
+type tokenChecker struct {
+	mu       sync.Mutex
+	analyzer *safety.Analyzer
+	seen     map[common.Address]struct{}
+	queue    chan tokenCheck
+}
+
+func newTokenChecker(c safety.OverrideCaller) *tokenChecker {
+	return &tokenChecker{
+		analyzer: &safety.Analyzer{Caller: safety.WithChecker(c), WETH: wethAddr},
+		seen:     make(map[common.Address]struct{}),
+		queue:    make(chan tokenCheck, safetyQueueSize),
+	}
+}
+
+// claim reports whether the token should be checked and marks it as seen.
+func (t *tokenChecker) claim(token common.Address) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.seen[token]; ok {
+		return false
+	}
+	t.seen[token] = struct{}{}
+	return true
+}
+
+// unclaim forgets the token, so it's checked on the next swap.
+func (t *tokenChecker) unclaim(token common.Address) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.seen, token)
+}
+
+// checkSafety queues checks of the tokens which were never checked, it never blocks.
+// Checks which do not fit into the queue are dropped and retried on the next swap of the token.
+func (c *Coordinator) checkSafety(checks []tokenCheck) {
+	for _, ch := range checks {
+		if !c.checker.claim(ch.token) {
+			continue
+		}
+		select {
+		case c.checker.queue <- ch:
+		default:
+			c.checker.unclaim(ch.token)
+			log.Printf("ERROR: safety check queue is full, dropping check of %v", ch.token)
+		}
+	}
+}
+
+// safetyLifecycle runs queued safety checks with safetyWorkers workers until ctx is done.
+func (c *Coordinator) safetyLifecycle(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < safetyWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case ch := <-c.checker.queue:
+					if err := c.checkToken(ctx, ch); err != nil {
+						log.Printf("ERROR: %v", err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *Coordinator) checkToken(ctx context.Context, ch tokenCheck) error {
+	token := ch.token
+	var (
+		pairAddr common.Address
+		ok       bool
+		checked  bool
+	)
+	if err := c.db.View(ctx, func(tx repo.Tx) (err error) {
+		t, err := c.db.PeekToken(tx, token)
+		if err != nil {
+			return err
+		}
+		checked = t.Safety.CheckedAt != 0
+		pairAddr, ok, err = c.db.PairAddress(tx, ch.factory, wethAddr, token)
+		return err
+	}); err != nil {
+		return fmt.Errorf("could not look up pair of %v: %w", token, err)
+	}
+	if checked || !ok {
+		return nil
+	}
+
+	s, err := c.checker.analyzer.Check(ctx, ch.router, pairAddr, token, ch.blockNumber)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.db.Update(ctx, func(tx repo.RwTx) error {
+		t, err := c.db.PeekToken(tx, token)
+		if err != nil {
+			return err
+		}
+		t.Safety = s
+		if s.Unsafe() {
+			log.Printf("INFO: %s (%v) is unsafe: %+v", t.Symbol, token, s)
+		}
+		return c.db.PutToken(tx, t)
+	})
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gelfand/mettu/repo"
+	"github.com/gelfand/mettu/signals"
+)
+
+// blockInterval is the expected time between blocks, it's used to estimate the blocks within the rule windows.
+const blockInterval = 12 * time.Second
+
+// loadSignals creates signals.Engine which remembers signals fired within the cool-down
+// and the swaps made within the widest rule window.
+func loadSignals(ctx context.Context, c *Coordinator, tx repo.Tx, rules []signals.Rule) (*signals.Engine, error) {
+	e := signals.NewEngine(rules)
+
+	now := time.Now()
+	fired, err := c.db.Signals(tx, now.Add(-e.MaxCooldown()), now.Add(time.Hour))
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve recent signals from the database: %w", err)
+	}
+	e.Restore(fired)
+
+	head, err := c.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve head header: %w", err)
+	}
+	// NOTE: block times vary, so twice the expected number of blocks is read and filtered by timestamp.
+	var from uint64
+	if n := uint64(2 * e.MaxWindow() / blockInterval); n < head.Number.Uint64() {
+		from = head.Number.Uint64() - n
+	}
+	swaps, err := c.db.SwapsByBlock(tx, from, math.MaxUint64)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve recent swaps from the database: %w", err)
+	}
+	cutoff := now.Add(-e.MaxWindow())
+	for _, s := range swaps {
+		at := time.Unix(int64(s.Timestamp), 0)
+		if at.Before(cutoff) {
+			continue
+		}
+		acc, err := c.db.PeekAccount(tx, s.Wallet)
+		if err != nil {
+			return nil, err
+		}
+		e.Observe(signals.Buy{
+			TxHash:   s.TxHash,
+			Wallet:   s.Wallet,
+			Token:    s.TokenAddr,
+			Exchange: acc.Exchange,
+			Value:    s.Value,
+			Time:     at,
+		})
+	}
+	e.Commit()
+	return e, nil
+}
+
+// fireSignals evaluates the signal rules after the block swaps were observed and persists the fired signals.
+func (c *Coordinator) fireSignals(tx repo.RwTx, block *types.Block) ([]repo.Signal, error) {
+	lookup := func(token common.Address) (repo.Token, bool) {
+		t, err := c.db.PeekToken(tx, token)
+		return t, err == nil
+	}
+	fired := c.signals.Evaluate(time.Unix(int64(block.Time()), 0), block.NumberU64(), lookup)
+	for _, s := range fired {
+		if err := c.db.PutSignal(tx, s); err != nil {
+			return nil, fmt.Errorf("unable to put signal: %w", err)
+		}
+		log.Printf("INFO: Signal %s fired for %v: %d wallets from %v spent %v wei", s.Rule, s.TokenAddr, s.Wallets, s.Exchanges, s.Value)
+	}
+	return fired, nil
+}
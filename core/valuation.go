@@ -0,0 +1,57 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/lib"
+	"github.com/gelfand/mettu/repo"
+)
+
+var (
+	uniswapV2Factory = common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f")
+	wethAddr         = common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+)
+
+// stablecoin is USD pegged token paired with WETH on Uniswap V2.
+type stablecoin struct {
+	Address  common.Address
+	Decimals int64
+}
+
+// stablecoins are used to value ETH in USD.
+var stablecoins = []stablecoin{
+	{Address: common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), Decimals: 6}, // USDC
+	{Address: common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"), Decimals: 6}, // USDT
+}
+
+// recordValuation records ETH/USD price at the block as average over WETH/stablecoin pairs.
+// The pairs are tracked by the reserveState, so no RPC calls are made after they are seeded.
+func (c *Coordinator) recordValuation(tx repo.RwTx, blockNumber uint64) error {
+	sum := new(big.Rat)
+	n := int64(0)
+	for _, stable := range stablecoins {
+		p, err := c.reserves.pair(tx, uniswapV2Factory, wethAddr, stable.Address, blockNumber)
+		if err != nil {
+			log.Printf("could not retrieve WETH/stablecoin pair: %v, stablecoin: %v", err, stable.Address)
+			continue
+		}
+
+		sum.Add(sum, lib.EthUSD(p.Reserves(wethAddr), stable.Decimals))
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+
+	v := repo.Valuation{
+		BlockNumber: blockNumber,
+		EthUSD:      sum.Quo(sum, big.NewRat(n, 1)),
+	}
+	if err := c.db.PutValuation(tx, v); err != nil {
+		return fmt.Errorf("unable to put valuation: %w", err)
+	}
+	return nil
+}
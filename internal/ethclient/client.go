@@ -2,23 +2,42 @@ package ethclient
 
 import (
 	"context"
+	"math/big"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 var defaultTimeout = 10 * time.Second
 
 type Client struct {
 	*ethclient.Client
+	geth   *gethclient.Client
+	tokens *TokenResolver
+
+	mu sync.Mutex
+	// noCreation are the contracts whose creation block couldn't be found and when, see TokenMetaAt.
+	noCreation map[common.Address]time.Time
 }
 
 func DialContext(ctx context.Context, rawurl string) (*Client, error) {
-	ec, err := ethclient.DialContext(ctx, rawurl)
+	rc, err := rpc.DialContext(ctx, rawurl)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{ec}, nil
+	c := &Client{Client: ethclient.NewClient(rc), geth: gethclient.New(rc)}
+	c.tokens = NewTokenResolver(c.Client, DefaultNegativeTTL)
+	return c, nil
+}
+
+// CallContractOverride executes eth_call at the given block with the state overrides.
+func (c *Client) CallContractOverride(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int, overrides map[common.Address]gethclient.OverrideAccount) ([]byte, error) {
+	return c.geth.CallContract(ctx, msg, blockNumber, &overrides)
 }
 
 // // PriceAt calculates price of end token by it's swap path.
@@ -48,73 +67,6 @@ func DialContext(ctx context.Context, rawurl string) (*Client, error) {
 // 	return v, nil
 // }
 
-// func (c *Client) FetchSwapsData(swaps []repo.SwapWithToken) ([]repo.SwapWithToken, error) {
-// 	for i := range swaps {
-// 		var err error
-// 		swaps[i].CurrPrice, err = c.PriceAt(swaps[i].Factory, swaps[i].Path)
-// 		if err != nil {
-// 			continue
-// 		}
-
-// 		if swaps[i].Price.Cmp(common.Big0) == 0 {
-// 			continue
-// 		}
-// 		amount := new(big.Int).Div(swaps[i].Value, swaps[i].Price)
-// 		swaps[i].Profit = new(big.Int).Sub(new(big.Int).Mul(amount, swaps[i].CurrPrice), swaps[i].Value)
-
-// 		valRat := new(big.Rat).SetInt(swaps[i].Value)
-// 		profitRat := new(big.Rat).SetInt(swaps[i].Profit)
-
-// 		profitabilityRat := new(big.Rat).Quo(profitRat, valRat)
-// 		profitabilityRat = profitabilityRat.Mul(profitabilityRat, new(big.Rat).SetFloat64(100.0))
-// 		profitability, _ := profitabilityRat.Float64()
-// 		swaps[i].Profitability = int(profitability)
-
-// 		priceRat := new(big.Rat).SetInt(swaps[i].Price)
-// 		priceRat = priceRat.Quo(priceRat, new(big.Rat).SetUint64(1e18))
-// 		swaps[i].PriceFloat, _ = priceRat.Float64()
-
-// 		currPriceRat := new(big.Rat).SetInt(swaps[i].CurrPrice)
-// 		currPriceRat = currPriceRat.Quo(currPriceRat, new(big.Rat).SetUint64(1e18))
-// 		swaps[i].CurrPriceFloat, _ = currPriceRat.Float64()
-
-// 	}
-// 	return swaps, nil
-// }
-
-// func (c *Client) FetchSwapsDataMap(swapsDat map[common.Address][]repo.SwapWithToken) (map[common.Address][]repo.SwapWithToken, error) {
-// 	for k, swaps := range swapsDat {
-// 		for i := 0; i < len(swaps); i++ {
-// 			var err error
-// 			swaps[i].CurrPrice, err = c.PriceAt(swaps[i].Factory, swaps[i].Path)
-// 			if err != nil {
-// 				return nil, err
-// 			}
-
-// 			amount := new(big.Int).Div(swaps[i].Value, swaps[i].Price)
-// 			swaps[i].Profit = new(big.Int).Sub(new(big.Int).Mul(amount, swaps[i].CurrPrice), swaps[i].Value)
-
-// 			valRat := new(big.Rat).SetInt(swaps[i].Value)
-// 			profitRat := new(big.Rat).SetInt(swaps[i].Profit)
-
-// 			profitabilityRat := new(big.Rat).Quo(profitRat, valRat)
-// 			profitabilityRat = profitabilityRat.Mul(profitabilityRat, new(big.Rat).SetFloat64(100.0))
-// 			profitability, _ := profitabilityRat.Float64()
-// 			swaps[i].Profitability = int(profitability)
-
-// 			priceRat := new(big.Rat).SetInt(swaps[i].Price)
-// 			priceRat = priceRat.Quo(priceRat, new(big.Rat).SetUint64(1e18))
-// 			swaps[i].PriceFloat, _ = priceRat.Float64()
-
-// 			currPriceRat := new(big.Rat).SetInt(swaps[i].CurrPrice)
-// 			currPriceRat = currPriceRat.Quo(currPriceRat, new(big.Rat).SetUint64(1e18))
-// 			swaps[i].CurrPriceFloat, _ = currPriceRat.Float64()
-// 		}
-// 		swapsDat[k] = swaps
-// 	}
-// 	return swapsDat, nil
-// }
-
 // func (c *Client) reservesAt(f *factory.FactoryCaller, token0 repo.Token, token1 repo.Token) (reserves, error) {
 // 	flag := cmpAddresses(token0.Address, token1.Address)
 // 	if flag {
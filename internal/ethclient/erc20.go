@@ -0,0 +1,193 @@
+package ethclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/repo"
+)
+
+// ErrNotToken is returned for contracts which answer none of the ERC-20 metadata calls.
+var ErrNotToken = errors.New("not an ERC-20 token")
+
+// ERC-20 metadata selectors.
+var (
+	nameSelector     = []byte{0x06, 0xfd, 0xde, 0x03}
+	symbolSelector   = []byte{0x95, 0xd8, 0x9b, 0x41}
+	decimalsSelector = []byte{0x31, 0x3c, 0xe5, 0x67}
+)
+
+const (
+	// defaultDecimals is assumed for tokens reverting on `decimals()`.
+	defaultDecimals = 18
+	// maxDecimals bounds decimals of the token, larger values are treated as broken.
+	maxDecimals = 77
+
+	maxSymbolLen = 32
+	maxNameLen   = 64
+
+	// DefaultNegativeTTL is how long broken contracts are not queried again.
+	DefaultNegativeTTL = time.Hour
+)
+
+// TokenResolver fetches ERC-20 metadata tolerating non-standard tokens:
+// `bytes32` names and symbols, reverting `decimals()` and malicious strings.
+// Contracts which are not tokens are remembered and not queried again until the negative TTL expires.
+type TokenResolver struct {
+	caller ethereum.ContractCaller
+	ttl    time.Duration
+
+	mu     sync.Mutex
+	failed map[common.Address]time.Time
+	now    func() time.Time
+}
+
+// NewTokenResolver creates new TokenResolver.
+func NewTokenResolver(caller ethereum.ContractCaller, ttl time.Duration) *TokenResolver {
+	return &TokenResolver{
+		caller: caller,
+		ttl:    ttl,
+		failed: make(map[common.Address]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Resolve returns the token at the given address with it's name, symbol and decimals.
+func (r *TokenResolver) Resolve(ctx context.Context, addr common.Address) (repo.Token, error) {
+	if r.broken(addr) {
+		return repo.Token{}, fmt.Errorf("%v: %w (cached)", addr, ErrNotToken)
+	}
+
+	symbol, symbolErr := r.callString(ctx, addr, symbolSelector, maxSymbolLen)
+	name, nameErr := r.callString(ctx, addr, nameSelector, maxNameLen)
+	decimals, decimalsErr := r.callDecimals(ctx, addr)
+	if err := ctx.Err(); err != nil {
+		// NOTE: timeouts say nothing about the contract, don't cache them.
+		return repo.Token{}, err
+	}
+	if symbolErr != nil && nameErr != nil && decimalsErr != nil {
+		r.markBroken(addr)
+		return repo.Token{}, fmt.Errorf("%v: %w", addr, ErrNotToken)
+	}
+
+	if symbol == "" {
+		symbol = name
+	}
+	if symbol == "" {
+		symbol = addr.Hex()[:8]
+	}
+	if decimalsErr != nil {
+		decimals = defaultDecimals
+	}
+
+	return repo.Token{
+		Address:     addr,
+		Symbol:      symbol,
+		Name:        name,
+		Decimals:    decimals,
+		TotalBought: big.NewInt(0),
+	}, nil
+}
+
+func (r *TokenResolver) broken(addr common.Address) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until, ok := r.failed[addr]
+	if ok && r.now().After(until) {
+		delete(r.failed, addr)
+		return false
+	}
+	return ok
+}
+
+func (r *TokenResolver) markBroken(addr common.Address) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed[addr] = r.now().Add(r.ttl)
+}
+
+func (r *TokenResolver) call(ctx context.Context, addr common.Address, selector []byte) ([]byte, error) {
+	out, err := r.caller.CallContract(ctx, ethereum.CallMsg{To: &addr, Data: selector}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, errors.New("empty return data")
+	}
+	return out, nil
+}
+
+func (r *TokenResolver) callString(ctx context.Context, addr common.Address, selector []byte, maxLen int) (string, error) {
+	out, err := r.call(ctx, addr, selector)
+	if err != nil {
+		return "", err
+	}
+	s, err := decodeString(out)
+	if err != nil {
+		return "", err
+	}
+	return sanitize(s, maxLen), nil
+}
+
+func (r *TokenResolver) callDecimals(ctx context.Context, addr common.Address) (int64, error) {
+	out, err := r.call(ctx, addr, decimalsSelector)
+	if err != nil {
+		return 0, err
+	}
+	if len(out) < 32 {
+		return 0, fmt.Errorf("invalid decimals length: %d", len(out))
+	}
+	d := new(big.Int).SetBytes(out[:32])
+	if !d.IsUint64() || d.Uint64() > maxDecimals {
+		return 0, fmt.Errorf("invalid decimals: %v", d)
+	}
+	return int64(d.Uint64()), nil
+}
+
+// decodeString decodes ABI encoded `string` or `bytes32` return data.
+func decodeString(out []byte) (string, error) {
+	if len(out) == 32 {
+		return string(out), nil
+	}
+	if len(out) < 64 {
+		return "", fmt.Errorf("invalid string length: %d", len(out))
+	}
+
+	offset := new(big.Int).SetBytes(out[:32])
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(out)-32) {
+		return "", fmt.Errorf("invalid string offset: %v", offset)
+	}
+	start := offset.Uint64() + 32
+	size := new(big.Int).SetBytes(out[start-32 : start])
+	if !size.IsUint64() || size.Uint64() > uint64(len(out))-start {
+		return "", fmt.Errorf("invalid string size: %v", size)
+	}
+	return string(out[start : start+size.Uint64()]), nil
+}
+
+// sanitize drops invalid UTF-8, control and markup characters and truncates s to maxLen runes.
+func sanitize(s string, maxLen int) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		if n == maxLen {
+			break
+		}
+		if r == utf8.RuneError || unicode.IsControl(r) || !unicode.IsPrint(r) && r != ' ' || strings.ContainsRune("<>&\"'`", r) {
+			continue
+		}
+		b.WriteRune(r)
+		n++
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,152 @@
+package ethclient
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var errReverted = errors.New("execution reverted")
+
+// fakeCaller answers calls by the address and the selector, missing answers revert.
+type fakeCaller struct {
+	returns map[common.Address]map[string][]byte
+	calls   int
+}
+
+func (f *fakeCaller) CodeAt(context.Context, common.Address, *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (f *fakeCaller) CallContract(_ context.Context, msg ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	f.calls++
+	out, ok := f.returns[*msg.To][string(msg.Data)]
+	if !ok {
+		return nil, errReverted
+	}
+	return out, nil
+}
+
+func abiString(t *testing.T, s string) []byte {
+	t.Helper()
+	typ, err := abi.NewType("string", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := abi.Arguments{{Type: typ}}.Pack(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func bytes32(s string) []byte {
+	return common.RightPadBytes([]byte(s), 32)
+}
+
+func TestTokenResolver_Resolve(t *testing.T) {
+	t.Parallel()
+
+	var (
+		standard = common.HexToAddress("0x01")
+		mkr      = common.HexToAddress("0x02")
+		noDec    = common.HexToAddress("0x03")
+		evil     = common.HexToAddress("0x04")
+		noSymbol = common.HexToAddress("0x05")
+		broken   = common.HexToAddress("0x06")
+	)
+	caller := &fakeCaller{returns: map[common.Address]map[string][]byte{
+		standard: {
+			string(symbolSelector):   abiString(t, "WETH"),
+			string(nameSelector):     abiString(t, "Wrapped Ether"),
+			string(decimalsSelector): common.LeftPadBytes([]byte{18}, 32),
+		},
+		mkr: {
+			string(symbolSelector):   bytes32("MKR"),
+			string(nameSelector):     bytes32("Maker"),
+			string(decimalsSelector): common.LeftPadBytes([]byte{18}, 32),
+		},
+		noDec: {
+			string(symbolSelector): abiString(t, "NODEC"),
+		},
+		evil: {
+			string(symbolSelector):   abiString(t, "<script>alert(1)</script>\x00\n"+strings.Repeat("A", 64)),
+			string(decimalsSelector): common.LeftPadBytes([]byte{9}, 32),
+		},
+		noSymbol: {
+			string(nameSelector):     abiString(t, "Nameless"),
+			string(decimalsSelector): common.LeftPadBytes([]byte{6}, 32),
+		},
+		broken: {
+			string(decimalsSelector): common.LeftPadBytes([]byte{1, 0}, 32),
+		},
+	}}
+	r := NewTokenResolver(caller, time.Hour)
+
+	tests := []struct {
+		name         string
+		addr         common.Address
+		wantSymbol   string
+		wantName     string
+		wantDecimals int64
+		wantErr      bool
+	}{
+		{"standard", standard, "WETH", "Wrapped Ether", 18, false},
+		{"bytes32", mkr, "MKR", "Maker", 18, false},
+		{"reverting decimals", noDec, "NODEC", "", defaultDecimals, false},
+		{"malicious symbol", evil, "scriptalert(1)/script" + strings.Repeat("A", 11), "", 9, false},
+		{"symbol from name", noSymbol, "Nameless", "Nameless", 6, false},
+		{"not a token", broken, "", "", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := r.Resolve(context.Background(), tt.addr)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: TokenResolver.Resolve() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if tt.wantErr {
+			if !errors.Is(err, ErrNotToken) {
+				t.Errorf("%s: TokenResolver.Resolve() error = %v, want %v", tt.name, err, ErrNotToken)
+			}
+			continue
+		}
+		if got.Symbol != tt.wantSymbol || got.Name != tt.wantName || got.Decimals != tt.wantDecimals {
+			t.Errorf("%s: TokenResolver.Resolve() = %q %q %d, want %q %q %d", tt.name, got.Symbol, got.Name, got.Decimals, tt.wantSymbol, tt.wantName, tt.wantDecimals)
+		}
+	}
+}
+
+func TestTokenResolver_NegativeCache(t *testing.T) {
+	t.Parallel()
+
+	broken := common.HexToAddress("0x01")
+	caller := &fakeCaller{}
+	now := time.Unix(0, 0)
+	r := NewTokenResolver(caller, time.Hour)
+	r.now = func() time.Time { return now }
+
+	if _, err := r.Resolve(context.Background(), broken); !errors.Is(err, ErrNotToken) {
+		t.Fatalf("TokenResolver.Resolve() error = %v, want %v", err, ErrNotToken)
+	}
+	calls := caller.calls
+
+	now = now.Add(30 * time.Minute)
+	if _, err := r.Resolve(context.Background(), broken); !errors.Is(err, ErrNotToken) {
+		t.Fatalf("TokenResolver.Resolve() error = %v, want %v", err, ErrNotToken)
+	}
+	if caller.calls != calls {
+		t.Errorf("cached contract was queried %d times", caller.calls-calls)
+	}
+
+	now = now.Add(time.Hour)
+	r.Resolve(context.Background(), broken)
+	if caller.calls == calls {
+		t.Error("contract was not queried after the negative cache expired")
+	}
+}
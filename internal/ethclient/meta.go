@@ -0,0 +1,202 @@
+package ethclient
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gelfand/mettu/erc20"
+	"github.com/gelfand/mettu/repo"
+	"github.com/gelfand/mettu/uniswap/factory"
+	"github.com/gelfand/mettu/uniswap/pair"
+)
+
+// lpLockers hold liquidity tokens which are burned or locked.
+var lpLockers = []common.Address{
+	common.HexToAddress("0x0000000000000000000000000000000000000000"),
+	common.HexToAddress("0x000000000000000000000000000000000000dEaD"),
+	// Unicrypt
+	common.HexToAddress("0x663A5C229c09b049E36dCc11a9B0d4a8Eb9db214"),
+	// Team Finance
+	common.HexToAddress("0xE2fE530C047f2d85298b07D9333C05737f1435fB"),
+}
+
+// TokenMetaAt fetches metadata of the token and it's pair with weth created by the factory as of the given block.
+// Creation blocks and the deployer are only looked up if prev does not have them yet.
+func (c *Client) TokenMetaAt(ctx context.Context, factoryAddr, weth, token common.Address, blockNumber uint64, prev repo.TokenMeta) (repo.TokenMeta, error) {
+	m := prev
+	m.UpdatedAt = blockNumber
+
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(blockNumber)}
+	t, err := erc20.NewErc20Caller(token, c)
+	if err != nil {
+		return repo.TokenMeta{}, err
+	}
+	if m.TotalSupply, err = t.TotalSupply(opts); err != nil {
+		return repo.TokenMeta{}, fmt.Errorf("unable to retrieve total supply: %w", err)
+	}
+
+	// NOTE: the creation block is left unknown if it can't be found, e.g. the node is not an archive node,
+	// the failure is remembered, so it's not searched for again on every refresh until the negative TTL expires.
+	if m.CreationBlock == 0 && !c.creationFailed(token) {
+		if creationBlock, err := c.CreationBlock(ctx, token, blockNumber); err != nil {
+			c.markCreationFailed(token)
+		} else if m.Deployer, err = c.Deployer(ctx, token, creationBlock); err != nil {
+			return repo.TokenMeta{}, err
+		} else {
+			m.CreationBlock = creationBlock
+		}
+	}
+
+	f, err := factory.NewFactory(factoryAddr, c)
+	if err != nil {
+		return repo.TokenMeta{}, err
+	}
+	pairAddr, err := f.GetPair(opts, weth, token)
+	if err != nil {
+		return repo.TokenMeta{}, fmt.Errorf("unable to get pair address: %w", err)
+	}
+	if pairAddr == (common.Address{}) {
+		m.Liquidity, m.LPLocked = new(big.Int), 0
+		return m, nil
+	}
+
+	if m.PairCreationBlock == 0 {
+		if m.PairCreationBlock, err = c.pairCreationBlock(ctx, f, weth, token, m.CreationBlock, blockNumber); err != nil {
+			return repo.TokenMeta{}, err
+		}
+	}
+
+	p, err := pair.NewPairCaller(pairAddr, c)
+	if err != nil {
+		return repo.TokenMeta{}, err
+	}
+	reserves, err := p.GetReserves(opts)
+	if err != nil {
+		return repo.TokenMeta{}, fmt.Errorf("unable to retrieve reserves: %w", err)
+	}
+	m.Liquidity = reserves.Reserve1
+	if isLess, _ := cmpAddresses(weth, token); isLess {
+		m.Liquidity = reserves.Reserve0
+	}
+
+	if m.LPLocked, err = lpLocked(p, opts); err != nil {
+		return repo.TokenMeta{}, err
+	}
+	return m, nil
+}
+
+// CreationBlock finds the block the contract was created at by binary search over it's code,
+// it requires an archive node, a full node fails to retrieve the code at the pruned blocks.
+func (c *Client) CreationBlock(ctx context.Context, addr common.Address, head uint64) (uint64, error) {
+	lo, hi := uint64(0), head
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		code, err := c.CodeAt(ctx, addr, new(big.Int).SetUint64(mid))
+		if err != nil {
+			return 0, fmt.Errorf("unable to retrieve code at block %d: %w", mid, err)
+		}
+		if len(code) > 0 {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
+
+// Deployer returns the sender of the transaction which created the contract in the block,
+// zero address means the contract was created by another contract.
+func (c *Client) Deployer(ctx context.Context, addr common.Address, blockNumber uint64) (common.Address, error) {
+	block, err := c.BlockByNumber(ctx, new(big.Int).SetUint64(blockNumber))
+	if err != nil {
+		return common.Address{}, fmt.Errorf("unable to retrieve block %d: %w", blockNumber, err)
+	}
+
+	chainID, err := c.ChainID(ctx)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("unable to retrieve chain id: %w", err)
+	}
+	// NOTE: the signer of the chain recovers the pre EIP-155 transactions as well.
+	signer := types.LatestSignerForChainID(chainID)
+	for _, txn := range block.Transactions() {
+		if txn.To() != nil {
+			continue
+		}
+		from, err := types.Sender(signer, txn)
+		if err != nil {
+			continue
+		}
+		if crypto.CreateAddress(from, txn.Nonce()) == addr {
+			return from, nil
+		}
+	}
+	return common.Address{}, nil
+}
+
+// creationFailed reports whether the creation block of the contract couldn't be found within the negative TTL.
+func (c *Client) creationFailed(addr common.Address) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	at, ok := c.noCreation[addr]
+	return ok && time.Since(at) < DefaultNegativeTTL
+}
+
+func (c *Client) markCreationFailed(addr common.Address) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.noCreation == nil {
+		c.noCreation = make(map[common.Address]time.Time)
+	}
+	c.noCreation[addr] = time.Now()
+}
+
+// pairCreationBlock returns the block `PairCreated` of the pair was emitted at, the search starts at the from block.
+func (c *Client) pairCreationBlock(ctx context.Context, f *factory.Factory, tokenA, tokenB common.Address, from, to uint64) (uint64, error) {
+	token0, token1 := tokenA, tokenB
+	if isLess, _ := cmpAddresses(tokenA, tokenB); !isLess {
+		token0, token1 = tokenB, tokenA
+	}
+
+	it, err := f.FilterPairCreated(&bind.FilterOpts{Start: from, End: &to, Context: ctx}, []common.Address{token0}, []common.Address{token1})
+	if err != nil {
+		return 0, fmt.Errorf("unable to filter PairCreated events: %w", err)
+	}
+	defer it.Close()
+
+	if !it.Next() {
+		if err := it.Error(); err != nil {
+			return 0, fmt.Errorf("unable to filter PairCreated events: %w", err)
+		}
+		return 0, nil
+	}
+	return it.Event.Raw.BlockNumber, nil
+}
+
+// lpLocked returns the share of the pair liquidity tokens held by lpLockers.
+func lpLocked(p *pair.PairCaller, opts *bind.CallOpts) (float64, error) {
+	totalSupply, err := p.TotalSupply(opts)
+	if err != nil {
+		return 0, fmt.Errorf("unable to retrieve liquidity total supply: %w", err)
+	}
+	if totalSupply.Sign() == 0 {
+		return 0, nil
+	}
+
+	locked := new(big.Int)
+	for _, holder := range lpLockers {
+		balance, err := p.BalanceOf(opts, holder)
+		if err != nil {
+			return 0, fmt.Errorf("unable to retrieve liquidity balance: %w", err)
+		}
+		locked.Add(locked, balance)
+	}
+
+	share, _ := new(big.Rat).SetFrac(locked, totalSupply).Float64()
+	return share, nil
+}
@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"math/big"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/gelfand/mettu/erc20"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/gelfand/mettu/lib"
 	"github.com/gelfand/mettu/repo"
 	"github.com/gelfand/mettu/uniswap/factory"
@@ -24,6 +26,12 @@ var (
 
 var zeroAddress = big.NewInt(0)
 
+// SyncTopic is topic of the Uniswap V2 pair `Sync(uint112,uint112)` event.
+var SyncTopic = crypto.Keccak256Hash([]byte("Sync(uint112,uint112)"))
+
+// SwapTopic is the topic of the pair `Swap` event.
+var SwapTopic = crypto.Keccak256Hash([]byte("Swap(address,uint256,uint256,uint256,uint256,address)"))
+
 // type pairCaller struct {
 // 	caller *pair.PairCaller
 // 	flag   bool
@@ -52,8 +60,10 @@ var zeroAddress = big.NewInt(0)
 // 	}, nil
 // }
 
-func (c *Client) GetReservesPath(factoryAddr common.Address, path []common.Address) ([]lib.Reserves, error) {
+// GetReservesPath returns reserves for every hop of the path as of the given block, nil blockNumber means latest block.
+func (c *Client) GetReservesPath(factoryAddr common.Address, path []common.Address, blockNumber *big.Int) ([]lib.Reserves, error) {
 	var r []lib.Reserves
+	opts := &bind.CallOpts{BlockNumber: blockNumber}
 
 	factoryCaller, err := factory.NewFactoryCaller(factoryAddr, c)
 	if err != nil {
@@ -68,7 +78,7 @@ func (c *Client) GetReservesPath(factoryAddr common.Address, path []common.Addre
 			return nil, err
 		}
 
-		pairAddr, err := factoryCaller.GetPair(&bind.CallOpts{}, tokenA, tokenB)
+		pairAddr, err := factoryCaller.GetPair(opts, tokenA, tokenB)
 		if err != nil {
 			return nil, err
 		}
@@ -77,7 +87,7 @@ func (c *Client) GetReservesPath(factoryAddr common.Address, path []common.Addre
 			return nil, err
 		}
 
-		reserves, err := p.GetReserves(&bind.CallOpts{})
+		reserves, err := p.GetReserves(opts)
 		if err != nil {
 			return nil, err
 		}
@@ -96,7 +106,9 @@ func (c *Client) GetReservesPath(factoryAddr common.Address, path []common.Addre
 	return r, nil
 }
 
-func (c *Client) GetReserves(factoryAddr, tokenA, tokenB common.Address) (lib.Reserves, error) {
+// GetReserves returns reserves of the tokenA and tokenB pair as of the given block, nil blockNumber means latest block.
+func (c *Client) GetReserves(factoryAddr, tokenA, tokenB common.Address, blockNumber *big.Int) (lib.Reserves, error) {
+	opts := &bind.CallOpts{BlockNumber: blockNumber}
 	flag, err := cmpAddresses(tokenA, tokenB)
 	if err != nil {
 		return lib.Reserves{}, err
@@ -106,7 +118,7 @@ func (c *Client) GetReserves(factoryAddr, tokenA, tokenB common.Address) (lib.Re
 		return lib.Reserves{}, err
 	}
 
-	pairAddr, err := factoryCaller.GetPair(&bind.CallOpts{}, tokenA, tokenB)
+	pairAddr, err := factoryCaller.GetPair(opts, tokenA, tokenB)
 	if err != nil {
 		return lib.Reserves{}, err
 	}
@@ -115,7 +127,7 @@ func (c *Client) GetReserves(factoryAddr, tokenA, tokenB common.Address) (lib.Re
 		return lib.Reserves{}, err
 	}
 
-	reserves, err := p.GetReserves(&bind.CallOpts{})
+	reserves, err := p.GetReserves(opts)
 	if err != nil {
 		return lib.Reserves{}, err
 	}
@@ -196,49 +208,134 @@ func (c *Client) GetReserves(factoryAddr, tokenA, tokenB common.Address) (lib.Re
 	// return getReservesFast(pCaller)
 }
 
-func (c *Client) FactoryAt(routerAddr common.Address) (common.Address, error) {
-	r, err := router.NewRouterCaller(routerAddr, c)
+// PairAt resolves pair of the tokenA and tokenB created by the factory together with it's reserves
+// as of the given block, nil blockNumber means latest block.
+func (c *Client) PairAt(factoryAddr, tokenA, tokenB common.Address, blockNumber *big.Int) (repo.Pair, error) {
+	factoryCaller, err := factory.NewFactoryCaller(factoryAddr, c)
 	if err != nil {
-		return common.Address{}, fmt.Errorf("could not resolve router at: %v, err: %w", routerAddr, err)
+		return repo.Pair{}, err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: blockNumber}
 
-	factoryAddr, err := r.Factory(&bind.CallOpts{Context: ctx})
+	pairAddr, err := factoryCaller.GetPair(opts, tokenA, tokenB)
 	if err != nil {
-		return common.Address{}, fmt.Errorf("invalid router address: %w", err)
+		return repo.Pair{}, fmt.Errorf("unable to get pair address: %w", err)
+	}
+	if pairAddr == (common.Address{}) {
+		return repo.Pair{}, fmt.Errorf("pair does not exist, tokenA: %v, tokenB: %v", tokenA, tokenB)
 	}
 
-	return factoryAddr, nil
+	p, err := pair.NewPairCaller(pairAddr, c)
+	if err != nil {
+		return repo.Pair{}, err
+	}
+	token0, err := p.Token0(opts)
+	if err != nil {
+		return repo.Pair{}, fmt.Errorf("unable to retrieve token0: %w", err)
+	}
+	token1, err := p.Token1(opts)
+	if err != nil {
+		return repo.Pair{}, fmt.Errorf("unable to retrieve token1: %w", err)
+	}
+	reserves, err := p.GetReserves(opts)
+	if err != nil {
+		return repo.Pair{}, fmt.Errorf("unable to retrieve reserves: %w", err)
+	}
+
+	return repo.Pair{
+		Address:  pairAddr,
+		Factory:  factoryAddr,
+		Token0:   token0,
+		Token1:   token1,
+		Reserve0: reserves.Reserve0,
+		Reserve1: reserves.Reserve1,
+	}, nil
 }
 
-func (c *Client) TokenAt(addr common.Address) (repo.Token, error) {
-	t, err := erc20.NewErc20Caller(addr, c)
+// SyncLogs returns all `Sync` events emitted in the block with the given hash.
+func (c *Client) SyncLogs(ctx context.Context, blockHash common.Hash) ([]*pair.PairSync, error) {
+	logs, err := c.FilterLogs(ctx, ethereum.FilterQuery{
+		BlockHash: &blockHash,
+		Topics:    [][]common.Hash{{SyncTopic}},
+	})
 	if err != nil {
-		return repo.Token{}, err
+		return nil, fmt.Errorf("unable to filter sync logs: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
-	defer cancel()
+	filterer, err := pair.NewPairFilterer(common.Address{}, c)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*pair.PairSync, 0, len(logs))
+	for i := range logs {
+		if logs[i].Removed {
+			continue
+		}
+		ev, err := filterer.ParseSync(logs[i])
+		if err != nil {
+			// NOTE: some non-pair contracts emit event with the same signature.
+			continue
+		}
+		events = append(events, ev)
+	}
+
+	return events, nil
+}
 
-	symbol, err := t.Symbol(&bind.CallOpts{Context: ctx})
+// SwapLogIndex returns index of the `Swap` log of the last hop of the swap made by the transaction, false if the
+// transaction failed or emitted no `Swap` log. Pairs emit `Swap` after the transfers of the hop, so the log of the
+// last hop is the last one even if the tokens swap on transfer.
+func SwapLogIndex(receipt *types.Receipt) (uint, bool) {
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return 0, false
+	}
+	for i := len(receipt.Logs) - 1; i >= 0; i-- {
+		l := receipt.Logs[i]
+		if len(l.Topics) > 0 && l.Topics[0] == SwapTopic && !l.Removed {
+			return l.Index, true
+		}
+	}
+	return 0, false
+}
+
+// PriceAt calculates ETH price of the last token of the path as of the given block,
+// nil blockNumber means latest block.
+func (c *Client) PriceAt(factoryAddr common.Address, path []common.Address, denominator *big.Int, blockNumber *big.Int) (*big.Int, error) {
+	reserves, err := c.GetReservesPath(factoryAddr, path, blockNumber)
 	if err != nil {
-		return repo.Token{}, fmt.Errorf("unable to retrieve token symbol: %w", err)
+		return nil, fmt.Errorf("could not retrieve reserves: %w", err)
 	}
 
-	decimals, err := t.Decimals(&bind.CallOpts{Context: ctx})
+	return lib.CalculatePrice(denominator, reserves), nil
+}
+
+func (c *Client) FactoryAt(routerAddr common.Address) (common.Address, error) {
+	r, err := router.NewRouterCaller(routerAddr, c)
 	if err != nil {
-		return repo.Token{}, fmt.Errorf("unable to retrieve token decimals: %w", err)
+		return common.Address{}, fmt.Errorf("could not resolve router at: %v, err: %w", routerAddr, err)
 	}
 
-	return repo.Token{
-		Address:     addr,
-		Symbol:      symbol,
-		Decimals:    int64(decimals),
-		TotalBought: big.NewInt(0),
-		TimesBought: 0,
-	}, nil
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	factoryAddr, err := r.Factory(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid router address: %w", err)
+	}
+
+	return factoryAddr, nil
+}
+
+// TokenAt resolves ERC-20 metadata of the token, see TokenResolver.
+func (c *Client) TokenAt(addr common.Address) (repo.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	return c.tokens.Resolve(ctx, addr)
 }
 
 func cmpAddresses(x, y common.Address) (bool, error) {
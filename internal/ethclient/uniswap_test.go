@@ -0,0 +1,45 @@
+package ethclient
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestSwapLogIndex(t *testing.T) {
+	t.Parallel()
+
+	transfer := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	logs := []*types.Log{
+		{Topics: []common.Hash{transfer}, Index: 4},
+		{Topics: []common.Hash{SyncTopic}, Index: 5},
+		{Topics: []common.Hash{SwapTopic}, Index: 6},
+		{Topics: []common.Hash{transfer}, Index: 7},
+		{Topics: []common.Hash{SyncTopic}, Index: 8},
+		{Topics: []common.Hash{SwapTopic}, Index: 9},
+		{Topics: []common.Hash{transfer}, Index: 10},
+	}
+	tests := []struct {
+		name    string
+		receipt *types.Receipt
+		want    uint
+		wantOK  bool
+	}{
+		{name: "last hop", receipt: &types.Receipt{Status: types.ReceiptStatusSuccessful, Logs: logs}, want: 9, wantOK: true},
+		{name: "failed", receipt: &types.Receipt{Status: types.ReceiptStatusFailed, Logs: logs}},
+		{name: "no swap", receipt: &types.Receipt{Status: types.ReceiptStatusSuccessful, Logs: logs[:2]}},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := SwapLogIndex(tt.receipt)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("SwapLogIndex() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"errors"
+	"math/big"
+)
+
+// errors.
+var (
+	ErrInsufficientInputAmount  = errors.New("insufficient input amount")
+	ErrInsufficientOutputAmount = errors.New("insufficient output amount")
+	ErrInsufficientLiquidity    = errors.New("insufficient liquidity")
+	ErrInvalidPath              = errors.New("invalid path")
+)
+
+// Uniswap V2 charges 0.3% fee on the input amount.
+var (
+	feeNumerator   = big.NewInt(997)
+	feeDenominator = big.NewInt(1000)
+)
+
+var (
+	big0   = big.NewInt(0)
+	big1   = big.NewInt(1)
+	ratOne = big.NewRat(1, 1)
+)
+
+// GetAmountOut returns the maximum output amount of the other asset for the given input amount,
+// exactly as UniswapV2Library.getAmountOut does.
+func GetAmountOut(amountIn *big.Int, r Reserves) (*big.Int, error) {
+	if amountIn.Cmp(big0) <= 0 {
+		return nil, ErrInsufficientInputAmount
+	}
+	if r.In.Cmp(big0) <= 0 || r.Out.Cmp(big0) <= 0 {
+		return nil, ErrInsufficientLiquidity
+	}
+
+	amountInWithFee := new(big.Int).Mul(amountIn, feeNumerator)
+	numerator := new(big.Int).Mul(amountInWithFee, r.Out)
+	denominator := new(big.Int).Mul(r.In, feeDenominator)
+	denominator.Add(denominator, amountInWithFee)
+
+	return numerator.Div(numerator, denominator), nil
+}
+
+// GetAmountIn returns the required input amount of the other asset for the given output amount,
+// exactly as UniswapV2Library.getAmountIn does.
+func GetAmountIn(amountOut *big.Int, r Reserves) (*big.Int, error) {
+	if amountOut.Cmp(big0) <= 0 {
+		return nil, ErrInsufficientOutputAmount
+	}
+	if r.In.Cmp(big0) <= 0 || r.Out.Cmp(amountOut) <= 0 {
+		return nil, ErrInsufficientLiquidity
+	}
+
+	numerator := new(big.Int).Mul(r.In, amountOut)
+	numerator.Mul(numerator, feeDenominator)
+	denominator := new(big.Int).Sub(r.Out, amountOut)
+	denominator.Mul(denominator, feeNumerator)
+
+	amountIn := numerator.Div(numerator, denominator)
+	return amountIn.Add(amountIn, big1), nil
+}
+
+// GetAmountsOut performs chained GetAmountOut calculations over the reserves of the path.
+func GetAmountsOut(amountIn *big.Int, reserves []Reserves) ([]*big.Int, error) {
+	if len(reserves) == 0 {
+		return nil, ErrInvalidPath
+	}
+
+	amounts := make([]*big.Int, len(reserves)+1)
+	amounts[0] = new(big.Int).Set(amountIn)
+	for i, r := range reserves {
+		amountOut, err := GetAmountOut(amounts[i], r)
+		if err != nil {
+			return nil, err
+		}
+		amounts[i+1] = amountOut
+	}
+
+	return amounts, nil
+}
+
+// GetAmountsIn performs chained GetAmountIn calculations over the reserves of the path.
+func GetAmountsIn(amountOut *big.Int, reserves []Reserves) ([]*big.Int, error) {
+	if len(reserves) == 0 {
+		return nil, ErrInvalidPath
+	}
+
+	amounts := make([]*big.Int, len(reserves)+1)
+	amounts[len(reserves)] = new(big.Int).Set(amountOut)
+	for i := len(reserves) - 1; i >= 0; i-- {
+		amountIn, err := GetAmountIn(amounts[i+1], reserves[i])
+		if err != nil {
+			return nil, err
+		}
+		amounts[i] = amountIn
+	}
+
+	return amounts, nil
+}
+
+// MidPrice returns price of the one unit of the last asset of the path
+// denominated in the units of the first asset, ignoring fees and trade size.
+func MidPrice(reserves []Reserves) (*big.Rat, error) {
+	if len(reserves) == 0 {
+		return nil, ErrInvalidPath
+	}
+
+	price := new(big.Rat).Set(ratOne)
+	for _, r := range reserves {
+		if r.In.Sign() <= 0 || r.Out.Sign() <= 0 {
+			return nil, ErrInsufficientLiquidity
+		}
+		price.Mul(price, new(big.Rat).SetFrac(r.In, r.Out))
+	}
+
+	return price, nil
+}
+
+// ExecutionPrice returns the price actually paid for the one unit of the output asset.
+func ExecutionPrice(amountIn, amountOut *big.Int) (*big.Rat, error) {
+	if amountOut.Sign() <= 0 {
+		return nil, ErrInsufficientOutputAmount
+	}
+	return new(big.Rat).SetFrac(amountIn, amountOut), nil
+}
+
+// PriceImpact returns the share of the output amount lost compared to the trade executed at MidPrice,
+// it includes both the swap fees and the trade's own impact on the reserves.
+func PriceImpact(amountIn *big.Int, reserves []Reserves) (*big.Rat, error) {
+	midPrice, err := MidPrice(reserves)
+	if err != nil {
+		return nil, err
+	}
+	amounts, err := GetAmountsOut(amountIn, reserves)
+	if err != nil {
+		return nil, err
+	}
+	executionPrice, err := ExecutionPrice(amountIn, amounts[len(amounts)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	// 1 - quoted/actual, where quoted = amountIn / midPrice and actual = amountIn / executionPrice.
+	impact := new(big.Rat).Quo(midPrice, executionPrice)
+	return impact.Sub(ratOne, impact), nil
+}
+
+// Slippage returns the slippage tolerance of the trade, that is the share of the expected
+// output amount the trader is ready to lose by setting amountOutMin.
+func Slippage(amountOut, amountOutMin *big.Int) (*big.Rat, error) {
+	if amountOut.Sign() <= 0 {
+		return nil, ErrInsufficientOutputAmount
+	}
+
+	slippage := new(big.Rat).SetFrac(amountOutMin, amountOut)
+	return slippage.Sub(ratOne, slippage), nil
+}
@@ -0,0 +1,228 @@
+package lib
+
+import (
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+func mustBig(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid big.Int: " + s)
+	}
+	return v
+}
+
+func TestGetAmountOut(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		amountIn *big.Int
+		reserves Reserves
+		want     *big.Int
+		wantErr  error
+	}{
+		{
+			name:     "equal reserves",
+			amountIn: big.NewInt(1e18),
+			reserves: Reserves{In: mustBig("100000000000000000000"), Out: mustBig("100000000000000000000")},
+			want:     mustBig("987158034397061298"),
+		},
+		{
+			name:     "weth usdc",
+			amountIn: big.NewInt(3e18),
+			reserves: Reserves{In: mustBig("5000000000000000000000"), Out: big.NewInt(2e9)},
+			want:     big.NewInt(1195684),
+		},
+		{
+			name:     "zero input",
+			amountIn: big.NewInt(0),
+			reserves: Reserves{In: big.NewInt(1), Out: big.NewInt(1)},
+			wantErr:  ErrInsufficientInputAmount,
+		},
+		{
+			name:     "empty pair",
+			amountIn: big.NewInt(1),
+			reserves: Reserves{In: big.NewInt(0), Out: big.NewInt(0)},
+			wantErr:  ErrInsufficientLiquidity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetAmountOut(tt.amountIn, tt.reserves)
+			if err != tt.wantErr {
+				t.Fatalf("GetAmountOut() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got.Cmp(tt.want) != 0 {
+				t.Errorf("GetAmountOut() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAmountIn(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		amountOut *big.Int
+		reserves  Reserves
+		want      *big.Int
+		wantErr   error
+	}{
+		{
+			name:      "equal reserves",
+			amountOut: big.NewInt(1e18),
+			reserves:  Reserves{In: mustBig("100000000000000000000"), Out: mustBig("100000000000000000000")},
+			want:      mustBig("1013140431395195689"),
+		},
+		{
+			name:      "drain pair",
+			amountOut: big.NewInt(100),
+			reserves:  Reserves{In: big.NewInt(100), Out: big.NewInt(100)},
+			wantErr:   ErrInsufficientLiquidity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetAmountIn(tt.amountOut, tt.reserves)
+			if err != tt.wantErr {
+				t.Fatalf("GetAmountIn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got.Cmp(tt.want) != 0 {
+				t.Errorf("GetAmountIn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMidPriceAndImpact(t *testing.T) {
+	t.Parallel()
+
+	reserves := []Reserves{
+		{In: mustBig("100000000000000000000"), Out: mustBig("100000000000000000000")},
+	}
+
+	mid, err := MidPrice(reserves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mid.Cmp(big.NewRat(1, 1)) != 0 {
+		t.Errorf("MidPrice() = %v, want %v", mid, 1)
+	}
+
+	// 1 - 987158034397061298 / 1e18
+	want := new(big.Rat).SetFrac(mustBig("12841965602938702"), big.NewInt(1e18))
+	impact, err := PriceImpact(big.NewInt(1e18), reserves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if impact.Cmp(want) != 0 {
+		t.Errorf("PriceImpact() = %v, want %v", impact.FloatString(18), want.FloatString(18))
+	}
+
+	slippage, err := Slippage(big.NewInt(1000), big.NewInt(995))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slippage.Cmp(big.NewRat(1, 200)) != 0 {
+		t.Errorf("Slippage() = %v, want %v", slippage, big.NewRat(1, 200))
+	}
+}
+
+func TestCalculatePrice(t *testing.T) {
+	t.Parallel()
+
+	// 1 token with 18 decimals is worth 3 wei through two hops, naive per hop integer
+	// division rounds it down to zero.
+	reserves := []Reserves{
+		{In: big.NewInt(3), Out: big.NewInt(10)},
+		{In: big.NewInt(10), Out: mustBig("1000000000000000000")},
+	}
+	if got := CalculatePrice(big.NewInt(1e18), reserves); got.Cmp(big.NewInt(3)) != 0 {
+		t.Errorf("CalculatePrice() = %v, want %v", got, 3)
+	}
+}
+
+// ammInput is a random pair with a trade that fits into it.
+type ammInput struct {
+	Reserves Reserves
+	Amount   *big.Int
+}
+
+func (ammInput) Generate(r *rand.Rand, _ int) reflect.Value {
+	rnd := func(bits int) *big.Int {
+		v := new(big.Int).Rand(r, new(big.Int).Lsh(big1, uint(bits)))
+		return v.Add(v, big1)
+	}
+
+	in := ammInput{
+		Reserves: Reserves{In: rnd(10 + r.Intn(100)), Out: rnd(10 + r.Intn(100))},
+	}
+	in.Amount = new(big.Int).Rand(r, in.Reserves.Out)
+	in.Amount.Add(in.Amount, big1)
+	if in.Amount.Cmp(in.Reserves.Out) >= 0 {
+		in.Amount.Sub(in.Reserves.Out, big1)
+	}
+	return reflect.ValueOf(in)
+}
+
+func TestAMMProperties(t *testing.T) {
+	t.Parallel()
+
+	// Paying GetAmountIn must always be enough to receive the requested amount.
+	roundTrip := func(in ammInput) bool {
+		if in.Amount.Sign() <= 0 {
+			return true
+		}
+		amountIn, err := GetAmountIn(in.Amount, in.Reserves)
+		if err != nil {
+			return false
+		}
+		amountOut, err := GetAmountOut(amountIn, in.Reserves)
+		if err != nil {
+			return false
+		}
+		return amountOut.Cmp(in.Amount) >= 0
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+
+	// Constant product can not decrease after the swap with fee.
+	invariant := func(in ammInput) bool {
+		amountOut, err := GetAmountOut(in.Amount, in.Reserves)
+		if err != nil {
+			return false
+		}
+		before := new(big.Int).Mul(in.Reserves.In, in.Reserves.Out)
+		after := new(big.Int).Mul(
+			new(big.Int).Add(in.Reserves.In, in.Amount),
+			new(big.Int).Sub(in.Reserves.Out, amountOut),
+		)
+		return after.Cmp(before) >= 0
+	}
+	if err := quick.Check(invariant, nil); err != nil {
+		t.Error(err)
+	}
+
+	// Price impact is never lower than the fee and never reaches 100%.
+	fee := big.NewRat(3, 1000)
+	impactBounds := func(in ammInput) bool {
+		impact, err := PriceImpact(in.Amount, []Reserves{in.Reserves})
+		if err == ErrInsufficientOutputAmount {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+		return impact.Cmp(fee) >= 0 && impact.Cmp(ratOne) < 0
+	}
+	if err := quick.Check(impactBounds, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -4,18 +4,27 @@ import "math/big"
 
 var big10 = big.NewInt(10)
 
-// Reserves is
+// Reserves are reserves of the pair ordered by the swap direction.
 type Reserves struct {
 	In, Out *big.Int
 }
 
 // CalculatePrice calculates token price in ETH by using it's path with denomoinator.
+// The result is truncated only once, so cheap tokens are not rounded down to zero on every hop.
 func CalculatePrice(amountOut *big.Int, reserves []Reserves) *big.Int {
-	value := new(big.Int).Set(amountOut)
+	price := CalculatePriceRat(amountOut, reserves)
+	return new(big.Int).Quo(price.Num(), price.Denom())
+}
+
+// CalculatePriceRat is exact version of CalculatePrice.
+func CalculatePriceRat(amountOut *big.Int, reserves []Reserves) *big.Rat {
+	value := new(big.Rat).SetInt(amountOut)
 
 	for _, reserve := range reserves {
-		value = new(big.Int).Mul(value, reserve.In)
-		value = new(big.Int).Div(value, reserve.Out)
+		if reserve.Out.Sign() == 0 {
+			return new(big.Rat)
+		}
+		value.Mul(value, new(big.Rat).SetFrac(reserve.In, reserve.Out))
 	}
 
 	return value
@@ -0,0 +1,28 @@
+package lib
+
+import "math/big"
+
+// weiPerEther is the denominator of the ETH amounts.
+var weiPerEther = new(big.Int).Exp(big10, big.NewInt(18), nil)
+
+// EthUSD returns price of the one ETH in USD by reserves of the WETH/stablecoin pair,
+// reserves must be ordered from WETH to the stablecoin.
+func EthUSD(r Reserves, usdDecimals int64) *big.Rat {
+	if r.In.Sign() == 0 {
+		return new(big.Rat)
+	}
+
+	usd := new(big.Rat).SetFrac(r.Out, new(big.Int).Exp(big10, big.NewInt(usdDecimals), nil))
+	eth := new(big.Rat).SetFrac(r.In, weiPerEther)
+	return usd.Quo(usd, eth)
+}
+
+// WeiToUSD converts wei amount into USD by the given ETH/USD price.
+func WeiToUSD(wei *big.Int, ethUSD *big.Rat) *big.Rat {
+	if wei == nil || ethUSD == nil {
+		return new(big.Rat)
+	}
+
+	usd := new(big.Rat).SetFrac(wei, weiPerEther)
+	return usd.Mul(usd, ethUSD)
+}
@@ -0,0 +1,21 @@
+package lib
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestEthUSD(t *testing.T) {
+	t.Parallel()
+
+	// 1000 WETH against 4,000,000 USDC.
+	r := Reserves{In: mustBig("1000000000000000000000"), Out: big.NewInt(4_000_000e6)}
+	ethUSD := EthUSD(r, 6)
+	if ethUSD.Cmp(big.NewRat(4000, 1)) != 0 {
+		t.Errorf("EthUSD() = %v, want %v", ethUSD, 4000)
+	}
+
+	if got := WeiToUSD(big.NewInt(5e17), ethUSD); got.Cmp(big.NewRat(2000, 1)) != 0 {
+		t.Errorf("WeiToUSD() = %v, want %v", got, 2000)
+	}
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/gelfand/mettu/signals"
+)
+
+// Config describes sinks of the Notifier in JSON.
+type Config struct {
+	Webhooks []struct {
+		URL    string `json:"url"`
+		Secret string `json:"secret"`
+		SinkConfig
+	} `json:"webhooks"`
+	Telegram []struct {
+		BaseURL string `json:"base_url"`
+		Token   string `json:"token"`
+		ChatID  string `json:"chat_id"`
+		SinkConfig
+	} `json:"telegram"`
+	SMTP []struct {
+		Addr     string   `json:"addr"`
+		Username string   `json:"username"`
+		Password string   `json:"password"`
+		From     string   `json:"from"`
+		To       []string `json:"to"`
+		Subject  string   `json:"subject"`
+		SinkConfig
+	} `json:"smtp"`
+	NDJSON []struct {
+		// Path is the file signals are appended to, "-" is stdout.
+		Path string `json:"path"`
+		SinkConfig
+	} `json:"ndjson"`
+}
+
+// SinkConfig holds settings common to every sink, DefaultOptions are used for the options which are not set.
+type SinkConfig struct {
+	Template   string           `json:"template"`
+	Retries    int              `json:"retries"`
+	Backoff    signals.Duration `json:"backoff"`
+	MaxBackoff signals.Duration `json:"max_backoff"`
+	Every      signals.Duration `json:"every"`
+	Burst      int              `json:"burst"`
+	Digest     signals.Duration `json:"digest"`
+}
+
+func (c SinkConfig) options() Options {
+	return Options{
+		Retries:    c.Retries,
+		Backoff:    time.Duration(c.Backoff),
+		MaxBackoff: time.Duration(c.MaxBackoff),
+		Every:      time.Duration(c.Every),
+		Burst:      c.Burst,
+		Digest:     time.Duration(c.Digest),
+	}
+}
+
+func (c SinkConfig) template(name string) (*template.Template, error) {
+	if c.Template == "" {
+		return nil, nil
+	}
+	tmpl, err := ParseTemplate(name, c.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// Load creates Notifier from the JSON config, the Notifier must be closed to close NDJSON files.
+func Load(r io.Reader) (*Notifier, error) {
+	var cfg Config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("unable to decode notifier config: %w", err)
+	}
+
+	n := New()
+	for _, c := range cfg.Webhooks {
+		tmpl, err := c.template("webhook")
+		if err != nil {
+			return nil, err
+		}
+		n.Add(&Webhook{URL: c.URL, Secret: []byte(c.Secret), Template: tmpl}, c.options())
+	}
+	for _, c := range cfg.Telegram {
+		tmpl, err := c.template("telegram")
+		if err != nil {
+			return nil, err
+		}
+		n.Add(&Telegram{BaseURL: c.BaseURL, Token: c.Token, ChatID: c.ChatID, Template: tmpl}, c.options())
+	}
+	for _, c := range cfg.SMTP {
+		tmpl, err := c.template("smtp")
+		if err != nil {
+			return nil, err
+		}
+		n.Add(&SMTP{
+			Addr:     c.Addr,
+			Username: c.Username,
+			Password: c.Password,
+			From:     c.From,
+			To:       c.To,
+			Subject:  c.Subject,
+			Template: tmpl,
+		}, c.options())
+	}
+	for _, c := range cfg.NDJSON {
+		if c.Path == "" || c.Path == "-" {
+			n.Add(NewNDJSON(os.Stdout), c.options())
+			continue
+		}
+		f, err := os.OpenFile(c.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			n.Close()
+			return nil, fmt.Errorf("unable to open ndjson file: %w", err)
+		}
+		n.closers = append(n.closers, f)
+		n.Add(NewNDJSON(f), c.options())
+	}
+
+	return n, nil
+}
@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/gelfand/mettu/repo"
+)
+
+// NDJSON writes every signal as a single JSON line.
+type NDJSON struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewNDJSON creates NDJSON sink writing to w, e.g. os.Stdout or a file opened for appending.
+func NewNDJSON(w io.Writer) *NDJSON {
+	return &NDJSON{w: w}
+}
+
+func (n *NDJSON) Name() string { return "ndjson" }
+
+func (n *NDJSON) Send(_ context.Context, signals []repo.Signal) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	enc := json.NewEncoder(n.w)
+	for _, s := range signals {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+// Package notify delivers fired signals to webhooks, chat bots, email and JSON lines.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gelfand/mettu/repo"
+)
+
+// Sink delivers a batch of signals somewhere.
+type Sink interface {
+	// Name identifies the sink in logs.
+	Name() string
+	Send(ctx context.Context, signals []repo.Signal) error
+}
+
+// Options control how signals are delivered to a single sink.
+type Options struct {
+	// Retries is the number of retries after the first failed attempt, negative Retries disable retries.
+	Retries int
+	// Backoff is the delay before the first retry, it doubles after every retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Every and Burst limit the rate of sends to Burst sends per Every, negative Every disables the limit.
+	Every time.Duration
+	Burst int
+	// Digest batches signals and sends them once per Digest, zero Digest sends signals right away.
+	Digest time.Duration
+	// QueueSize is the number of batches waiting for delivery, new batches are dropped when the queue is full.
+	QueueSize int
+}
+
+// DefaultOptions replace zero fields of the sink Options.
+var DefaultOptions = Options{
+	Retries:    3,
+	Backoff:    time.Second,
+	MaxBackoff: time.Minute,
+	Every:      time.Second,
+	Burst:      5,
+	QueueSize:  64,
+}
+
+// Notifier delivers signals to every sink independently, so a slow sink does not delay the others.
+type Notifier struct {
+	deliverers []*deliverer
+	closers    []io.Closer
+}
+
+// New creates new Notifier.
+func New() *Notifier {
+	return &Notifier{}
+}
+
+// Add adds the sink, zero fields of opts are replaced with DefaultOptions.
+func (n *Notifier) Add(sink Sink, opts Options) {
+	opts = opts.withDefaults()
+	n.deliverers = append(n.deliverers, &deliverer{
+		sink:    sink,
+		opts:    opts,
+		limiter: newLimiter(opts.Every, opts.Burst),
+		queue:   make(chan []repo.Signal, opts.QueueSize),
+	})
+}
+
+// withDefaults returns the options with zero fields replaced with DefaultOptions.
+func (o Options) withDefaults() Options {
+	switch {
+	case o.Retries == 0:
+		o.Retries = DefaultOptions.Retries
+	case o.Retries < 0:
+		o.Retries = 0
+	}
+	if o.Backoff == 0 {
+		o.Backoff = DefaultOptions.Backoff
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = DefaultOptions.MaxBackoff
+	}
+	if o.Every == 0 {
+		o.Every = DefaultOptions.Every
+	}
+	if o.Burst == 0 {
+		o.Burst = DefaultOptions.Burst
+	}
+	if o.Digest == 0 {
+		o.Digest = DefaultOptions.Digest
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = DefaultOptions.QueueSize
+	}
+	return o
+}
+
+// Notify queues signals for delivery, it never blocks. Nil Notifier discards signals.
+func (n *Notifier) Notify(signals []repo.Signal) {
+	if n == nil || len(signals) == 0 {
+		return
+	}
+	for _, d := range n.deliverers {
+		select {
+		case d.queue <- signals:
+		default:
+			log.Printf("ERROR: %s queue is full, dropping %d signals", d.sink.Name(), len(signals))
+		}
+	}
+}
+
+// Run delivers queued signals until ctx is done.
+func (n *Notifier) Run(ctx context.Context) {
+	if n == nil {
+		return
+	}
+	done := make(chan struct{})
+	for _, d := range n.deliverers {
+		go func(d *deliverer) {
+			d.run(ctx)
+			done <- struct{}{}
+		}(d)
+	}
+	for range n.deliverers {
+		<-done
+	}
+}
+
+// Close closes files opened by Load.
+func (n *Notifier) Close() error {
+	if n == nil {
+		return nil
+	}
+	var err error
+	for _, c := range n.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+type deliverer struct {
+	sink    Sink
+	opts    Options
+	limiter *limiter
+	queue   chan []repo.Signal
+}
+
+func (d *deliverer) run(ctx context.Context) {
+	var (
+		pending []repo.Signal
+		flush   <-chan time.Time
+	)
+	if d.opts.Digest > 0 {
+		ticker := time.NewTicker(d.opts.Digest)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case signals := <-d.queue:
+			if d.opts.Digest > 0 {
+				pending = append(pending, signals...)
+				continue
+			}
+			d.deliver(ctx, signals)
+		case <-flush:
+			if len(pending) == 0 {
+				continue
+			}
+			d.deliver(ctx, pending)
+			pending = nil
+		}
+	}
+}
+
+func (d *deliverer) deliver(ctx context.Context, signals []repo.Signal) {
+	if err := d.send(ctx, signals); err != nil {
+		log.Printf("ERROR: could not deliver %d signals to %s: %v", len(signals), d.sink.Name(), err)
+	}
+}
+
+// send sends the signals respecting the rate limit, failed attempts are retried with exponential backoff.
+func (d *deliverer) send(ctx context.Context, signals []repo.Signal) error {
+	backoff := d.opts.Backoff
+	var err error
+	for attempt := 0; attempt <= d.opts.Retries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, backoff); err != nil {
+				return err
+			}
+			backoff *= 2
+			if d.opts.MaxBackoff > 0 && backoff > d.opts.MaxBackoff {
+				backoff = d.opts.MaxBackoff
+			}
+		}
+
+		if err := d.limiter.wait(ctx); err != nil {
+			return err
+		}
+		if err = d.sink.Send(ctx, signals); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("gave up after %d attempts: %w", d.opts.Retries+1, err)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// limiter is a token bucket refilled with a token every `every / burst`.
+type limiter struct {
+	interval time.Duration
+	burst    int
+	tokens   float64
+	last     time.Time
+}
+
+func newLimiter(every time.Duration, burst int) *limiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	l := &limiter{burst: burst, tokens: float64(burst)}
+	if every > 0 {
+		l.interval = every / time.Duration(burst)
+	}
+	return l
+}
+
+// wait blocks until a token is available, limiter is used by a single goroutine.
+func (l *limiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		delay := time.Duration((1 - l.tokens) * float64(l.interval))
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+		l.tokens, l.last = 1, time.Now()
+	}
+	l.tokens--
+	return nil
+}
+
+var templateFuncs = template.FuncMap{
+	"eth":  formatETH,
+	"join": strings.Join,
+}
+
+// ParseTemplate parses text template of the message, the template is executed with []repo.Signal.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+func render(tmpl *template.Template, signals []repo.Signal) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, signals); err != nil {
+		return "", fmt.Errorf("could not render %s template: %w", tmpl.Name(), err)
+	}
+	return b.String(), nil
+}
+
+// formatETH formats wei as ETH with 4 decimals.
+func formatETH(wei *big.Int) string {
+	if wei == nil {
+		return "0"
+	}
+	eth := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18))
+	return eth.Text('f', 4)
+}
+
+// defaultText is the default plain text message of the chat and email sinks.
+const defaultText = `{{ range . }}{{ .Rule }}: {{ .TokenAddr }} bought by {{ .Wallets }} wallets from {{ join .Exchanges ", " }} for {{ eth .Value }} ETH at block {{ .BlockNumber }}
+{{ end }}`
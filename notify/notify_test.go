@@ -0,0 +1,198 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/repo"
+)
+
+var testSignals = []repo.Signal{
+	{
+		Rule:        "accumulation",
+		TokenAddr:   common.BytesToAddress([]byte("token0")),
+		Time:        time.Unix(1640000000, 0).UTC(),
+		BlockNumber: 100,
+		Wallets:     3,
+		Exchanges:   []string{"Binance", "Kraken"},
+		Value:       big.NewInt(5500000000000000000),
+		TxHashes:    []common.Hash{common.BytesToHash([]byte("tx0"))},
+	},
+}
+
+// testSink records the batches it was sent, it fails the first `failures` sends.
+type testSink struct {
+	mu       sync.Mutex
+	failures int
+	batches  [][]repo.Signal
+	sent     chan struct{}
+}
+
+func newTestSink(failures int) *testSink {
+	return &testSink{failures: failures, sent: make(chan struct{}, 16)}
+}
+
+func (s *testSink) Name() string { return "test" }
+
+func (s *testSink) Send(_ context.Context, signals []repo.Signal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	s.batches = append(s.batches, signals)
+	s.sent <- struct{}{}
+	return nil
+}
+
+func TestDeliverer_send(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		failures int
+		retries  int
+		wantErr  bool
+	}{
+		{"first attempt", 0, 0, false},
+		{"retried", 2, 2, false},
+		{"gave up", 3, 2, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			sink := newTestSink(tt.failures)
+			n := New()
+			n.Add(sink, Options{Retries: tt.retries, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond})
+
+			err := n.deliverers[0].send(context.Background(), testSignals)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("deliverer.send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOptions_withDefaults(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		opts Options
+		want Options
+	}{
+		{"zero", Options{}, DefaultOptions},
+		{
+			"digest only",
+			Options{Digest: time.Minute},
+			Options{Retries: 3, Backoff: time.Second, MaxBackoff: time.Minute, Every: time.Second, Burst: 5, Digest: time.Minute, QueueSize: 64},
+		},
+		{
+			"disabled",
+			Options{Retries: -1, Every: -1},
+			Options{Retries: 0, Backoff: time.Second, MaxBackoff: time.Minute, Every: -1, Burst: 5, QueueSize: 64},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.opts.withDefaults(); got != tt.want {
+				t.Errorf("Options.withDefaults() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimiter_wait(t *testing.T) {
+	t.Parallel()
+
+	l := newLimiter(100*time.Millisecond, 2)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The burst is spent right away, the third token is refilled in 50ms.
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("limiter.wait() returned after %v, want at least %v", elapsed, 40*time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx); err == nil {
+		t.Error("limiter.wait() error = nil on canceled context")
+	}
+}
+
+func TestNotifier_Digest(t *testing.T) {
+	t.Parallel()
+
+	sink := newTestSink(0)
+	n := New()
+	n.Add(sink, Options{Digest: 20 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	n.Notify(testSignals)
+	n.Notify(testSignals)
+	select {
+	case <-sink.sent:
+	case <-time.After(time.Second):
+		t.Fatal("digest was not sent")
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.batches) != 1 || len(sink.batches[0]) != 2 {
+		t.Errorf("sink got batches %+v, want a single batch of %d signals", sink.batches, 2)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		config    string
+		wantSinks int
+		wantErr   bool
+	}{
+		{
+			name: "all sinks",
+			config: `{
+				"webhooks": [{"url": "http://127.0.0.1/hook", "secret": "s", "retries": 5, "backoff": "2s"}],
+				"telegram": [{"token": "t", "chat_id": "1", "template": "{{ len . }} signals"}],
+				"smtp": [{"addr": "127.0.0.1:25", "from": "a@b.c", "to": ["d@e.f"], "digest": "1h"}],
+				"ndjson": [{"path": "-"}]
+			}`,
+			wantSinks: 4,
+		},
+		{name: "invalid template", config: `{"telegram": [{"template": "{{ .Nope "}]}`, wantErr: true},
+		{name: "unknown sink", config: `{"slack": []}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			n, err := Load(strings.NewReader(tt.config))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(n.deliverers) != tt.wantSinks {
+				t.Errorf("Load() sinks = %d, want %d", len(n.deliverers), tt.wantSinks)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/gelfand/mettu/repo"
+)
+
+func TestWebhook_Send(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	var (
+		got     []repo.Signal
+		sigOK   bool
+		ctype   string
+		gotText string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sigOK = r.Header.Get(SignatureHeader) == Sign(secret, r.Header.Get(TimestampHeader), body)
+		ctype = r.Header.Get("Content-Type")
+		if ctype == "application/json" {
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Error(err)
+			}
+		} else {
+			gotText = string(body)
+		}
+	}))
+	defer srv.Close()
+
+	w := &Webhook{URL: srv.URL, Secret: secret}
+	if err := w.Send(context.Background(), testSignals); err != nil {
+		t.Fatalf("Webhook.Send() error = %v", err)
+	}
+	if !sigOK {
+		t.Error("Webhook.Send() signature does not match")
+	}
+	if len(got) != 1 || got[0].TokenAddr != testSignals[0].TokenAddr || got[0].Value.Cmp(testSignals[0].Value) != 0 {
+		t.Errorf("Webhook.Send() body = %+v", got)
+	}
+
+	w.Template = mustParseTemplate(t, "{{ range . }}{{ .Rule }} {{ eth .Value }}{{ end }}")
+	if err := w.Send(context.Background(), testSignals); err != nil {
+		t.Fatalf("Webhook.Send() error = %v", err)
+	}
+	if gotText != "accumulation 5.5000" || !strings.HasPrefix(ctype, "text/plain") {
+		t.Errorf("Webhook.Send() body = %q, content type = %q", gotText, ctype)
+	}
+}
+
+func TestWebhook_SendError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	w := &Webhook{URL: srv.URL}
+	if err := w.Send(context.Background(), testSignals); err == nil || !strings.Contains(err.Error(), "slow down") {
+		t.Errorf("Webhook.Send() error = %v, want error with the response body", err)
+	}
+}
+
+func TestTelegram_Send(t *testing.T) {
+	t.Parallel()
+
+	var (
+		path string
+		msg  struct {
+			ChatID string `json:"chat_id"`
+			Text   string `json:"text"`
+		}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer srv.Close()
+
+	tg := &Telegram{BaseURL: srv.URL + "/", Token: "123:abc", ChatID: "-42"}
+	if err := tg.Send(context.Background(), testSignals); err != nil {
+		t.Fatalf("Telegram.Send() error = %v", err)
+	}
+	if path != "/bot123:abc/sendMessage" || msg.ChatID != "-42" {
+		t.Errorf("Telegram.Send() path = %q, chat = %q", path, msg.ChatID)
+	}
+	want := "accumulation: " + testSignals[0].TokenAddr.Hex() + " bought by 3 wallets from Binance, Kraken for 5.5000 ETH at block 100\n"
+	if msg.Text != want {
+		t.Errorf("Telegram.Send() text = %q, want %q", msg.Text, want)
+	}
+}
+
+func TestTelegram_SendError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	tg := &Telegram{BaseURL: srv.URL, Token: "123:abc", ChatID: "-42"}
+	err := tg.Send(context.Background(), testSignals)
+	if err == nil || strings.Contains(err.Error(), "123:abc") {
+		t.Errorf("Telegram.Send() error = %v, want error without the token", err)
+	}
+}
+
+func TestSMTP_Send(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan testMail, 1)
+	go serveSMTP(t, l, received)
+
+	s := &SMTP{Addr: l.Addr().String(), From: "mettu@example.com", To: []string{"alice@example.com", "bob@example.com"}}
+	if err := s.Send(context.Background(), testSignals); err != nil {
+		t.Fatalf("SMTP.Send() error = %v", err)
+	}
+
+	m := <-received
+	if m.from != "<mettu@example.com>" || len(m.to) != 2 {
+		t.Errorf("SMTP.Send() envelope = %q -> %q", m.from, m.to)
+	}
+	if !strings.Contains(m.data, "Subject: mettu: 1 signals\r\n") || !strings.Contains(m.data, "for 5.5000 ETH at block 100") {
+		t.Errorf("SMTP.Send() message = %q", m.data)
+	}
+}
+
+func TestSMTP_SendTimeout(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// NOTE: the server accepts the connection but never greets.
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s := &SMTP{Addr: l.Addr().String(), From: "mettu@example.com", To: []string{"alice@example.com"}}
+	start := time.Now()
+	if err := s.Send(ctx, testSignals); err == nil {
+		t.Error("SMTP.Send() error = nil, want timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("SMTP.Send() took %v, want it bound by the context", elapsed)
+	}
+}
+
+type testMail struct {
+	from, data string
+	to         []string
+}
+
+// serveSMTP accepts a single connection and speaks just enough SMTP to receive one mail.
+func serveSMTP(t *testing.T, l net.Listener, received chan<- testMail) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	tc := textproto.NewConn(conn)
+	var m testMail
+	tc.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			tc.PrintfLine("250 localhost")
+		case "MAIL":
+			m.from = strings.TrimPrefix(line, "MAIL FROM:")
+			tc.PrintfLine("250 OK")
+		case "RCPT":
+			m.to = append(m.to, strings.TrimPrefix(line, "RCPT TO:"))
+			tc.PrintfLine("250 OK")
+		case "DATA":
+			tc.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(tc.DotReader())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			m.data = strings.ReplaceAll(string(data), "\n", "\r\n")
+			tc.PrintfLine("250 OK")
+		case "QUIT":
+			tc.PrintfLine("221 bye")
+			received <- m
+			return
+		default:
+			tc.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestNDJSON_Send(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	n := NewNDJSON(&buf)
+	if err := n.Send(context.Background(), append(testSignals, testSignals...)); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := 0
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var s repo.Signal
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			t.Fatalf("line %d is not a signal: %v", lines, err)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("NDJSON.Send() wrote %d lines, want %d", lines, 2)
+	}
+}
+
+func mustParseTemplate(t *testing.T, text string) *template.Template {
+	t.Helper()
+	tmpl, err := ParseTemplate(t.Name(), text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gelfand/mettu/repo"
+)
+
+// smtpTimeout bounds the SMTP session when the context has no deadline.
+const smtpTimeout = 10 * time.Second
+
+// SMTP emails signals, it's meant to be used with Options.Digest to send a periodic digest.
+type SMTP struct {
+	// Addr is host:port of the SMTP server.
+	Addr string
+	// Username and Password are used for PLAIN auth if Username is set.
+	Username string
+	Password string
+	From     string
+	To       []string
+	Subject  string
+	// Template renders the body, default plain text message is used if it's nil.
+	Template *template.Template
+}
+
+func (s *SMTP) Name() string { return "smtp " + strings.Join(s.To, ",") }
+
+func (s *SMTP) Send(ctx context.Context, signals []repo.Signal) error {
+	tmpl := s.Template
+	if tmpl == nil {
+		tmpl = template.Must(ParseTemplate("smtp", defaultText))
+	}
+	body, err := render(tmpl, signals)
+	if err != nil {
+		return err
+	}
+
+	subject := s.Subject
+	if subject == "" {
+		subject = fmt.Sprintf("mettu: %d signals", len(signals))
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return s.sendMail(ctx, []byte(msg.String()))
+}
+
+// sendMail is smtp.SendMail bound by the context, the session is dialed with the context and it's connection
+// deadline is the context deadline or smtpTimeout.
+func (s *SMTP) sendMail(ctx context.Context, msg []byte) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid smtp address: %w", err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	// NOTE: the deadline doesn't see the cancellation, closing the connection interrupts the session.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	for _, to := range s.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
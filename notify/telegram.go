@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/gelfand/mettu/repo"
+)
+
+// DefaultTelegramURL is the Telegram bot API endpoint.
+const DefaultTelegramURL = "https://api.telegram.org"
+
+// Telegram sends signals as a message through Telegram style bot API.
+type Telegram struct {
+	// BaseURL is the bot API endpoint, DefaultTelegramURL is used if it's empty.
+	BaseURL string
+	Token   string
+	ChatID  string
+	// Template renders the message, default plain text message is used if it's nil.
+	Template *template.Template
+	Client   *http.Client
+}
+
+func (t *Telegram) Name() string { return "telegram " + t.ChatID }
+
+func (t *Telegram) Send(ctx context.Context, signals []repo.Signal) error {
+	tmpl := t.Template
+	if tmpl == nil {
+		tmpl = template.Must(ParseTemplate("telegram", defaultText))
+	}
+	text, err := render(tmpl, signals)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(struct {
+		ChatID                string `json:"chat_id"`
+		Text                  string `json:"text"`
+		DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+	}{t.ChatID, text, true})
+	if err != nil {
+		return fmt.Errorf("could not encode message: %w", err)
+	}
+
+	baseURL := t.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultTelegramURL
+	}
+	endpoint := strings.TrimRight(baseURL, "/") + "/bot" + t.Token + "/sendMessage"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid bot api url %q", baseURL)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// NOTE: the bot token is part of the URL, *url.Error is unwrapped so the token doesn't end up in the logs.
+	err = do(t.Client, req)
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return fmt.Errorf("%s %s/bot<token>/sendMessage: %w", uerr.Op, strings.TrimRight(baseURL, "/"), uerr.Err)
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/gelfand/mettu/repo"
+)
+
+const (
+	// SignatureHeader carries hex HMAC-SHA256 of "timestamp.body" keyed with the webhook secret.
+	SignatureHeader = "X-Mettu-Signature"
+	// TimestampHeader carries unix time the request was signed at.
+	TimestampHeader = "X-Mettu-Timestamp"
+)
+
+// defaultClient is used by sinks without Client, the timeout keeps a hung endpoint from stalling the deliverer.
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// Webhook POSTs signals to the URL, the body is signed if Secret is set.
+type Webhook struct {
+	URL    string
+	Secret []byte
+	// Template renders the body, signals are sent as JSON array if it's nil.
+	Template *template.Template
+	// Client sends the requests, defaultClient with 10s timeout is used if it's nil.
+	Client *http.Client
+}
+
+func (w *Webhook) Name() string { return "webhook " + w.URL }
+
+func (w *Webhook) Send(ctx context.Context, signals []repo.Signal) error {
+	var (
+		body        []byte
+		contentType = "application/json"
+	)
+	if w.Template != nil {
+		text, err := render(w.Template, signals)
+		if err != nil {
+			return err
+		}
+		body, contentType = []byte(text), "text/plain; charset=utf-8"
+	} else {
+		var err error
+		if body, err = json.Marshal(signals); err != nil {
+			return fmt.Errorf("could not encode signals: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if len(w.Secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(w.Secret, timestamp, body))
+	}
+
+	return do(w.Client, req)
+}
+
+// Sign returns signature of the webhook body sent at timestamp.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// do sends the request and treats any non 2xx response as an error.
+func do(client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
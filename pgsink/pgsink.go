@@ -0,0 +1,276 @@
+// Package pgsink mirrors accounts, fundings, tokens, swaps and patterns of the kv store into PostgreSQL for analytics.
+package pgsink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/gelfand/mettu/repo"
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+// DefaultQueueSize is the number of batches waiting to be written.
+const DefaultQueueSize = 256
+
+// retryBackoff is the delay before a failed write is retried.
+var retryBackoff = 5 * time.Second
+
+// Batch is every change made by the block.
+type Batch struct {
+	BlockNumber uint64
+	Accounts    []repo.Account
+	Fundings    []repo.Funding
+	Tokens      []repo.Token
+	Swaps       []repo.Swap
+	Patterns    []repo.Pattern
+}
+
+func (b Batch) empty() bool {
+	return len(b.Accounts) == 0 && len(b.Fundings) == 0 && len(b.Tokens) == 0 && len(b.Swaps) == 0 && len(b.Patterns) == 0
+}
+
+// Sink writes batches into PostgreSQL in the background.
+//
+// Every write is idempotent and moves the replication cursor in the same transaction,
+// so batches replayed after a restart or a catch-up Sync do not duplicate rows.
+type Sink struct {
+	db    *sql.DB
+	queue chan Batch
+	// behind is set when a batch was dropped, Run catches up from the kv store before writing the next one.
+	behind int32
+}
+
+// Open connects to the database at dsn and creates the schema.
+func Open(ctx context.Context, dsn string) (*Sink, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open postgres: %w", err)
+	}
+	s := New(db)
+	if err := s.Init(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// New creates new Sink writing into db.
+func New(db *sql.DB) *Sink {
+	return &Sink{
+		db:    db,
+		queue: make(chan Batch, DefaultQueueSize),
+	}
+}
+
+// Init creates the tables missing in the database.
+func (s *Sink) Init(ctx context.Context) error {
+	for _, stmt := range schema {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("unable to create postgres schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *Sink) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Cursor returns the last block mirrored into the database.
+func (s *Sink) Cursor(ctx context.Context) (uint64, error) {
+	var blockNumber int64
+	if err := s.db.QueryRowContext(ctx, selectCursor).Scan(&blockNumber); err != nil {
+		return 0, fmt.Errorf("unable to read replication cursor: %w", err)
+	}
+	return uint64(blockNumber), nil
+}
+
+// Publish queues the batch for writing, it never blocks. Nil Sink discards batches.
+func (s *Sink) Publish(b Batch) {
+	if s == nil || b.empty() {
+		return
+	}
+	select {
+	case s.queue <- b:
+	default:
+		// NOTE: the dropped records are restored by Sync.
+		log.Printf("ERROR: postgres queue is full, dropping batch of block %d", b.BlockNumber)
+		atomic.StoreInt32(&s.behind, 1)
+	}
+}
+
+// Run catches up with the kv store and writes queued batches until ctx is done.
+func (s *Sink) Run(ctx context.Context, db repo.Storage) {
+	if s == nil {
+		return
+	}
+	atomic.StoreInt32(&s.behind, 1)
+	for {
+		if atomic.LoadInt32(&s.behind) == 1 {
+			if err := s.Sync(ctx, db); err != nil {
+				log.Printf("ERROR: unable to sync postgres: %v", err)
+				if !sleep(ctx, retryBackoff) {
+					return
+				}
+				continue
+			}
+			atomic.StoreInt32(&s.behind, 0)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case b := <-s.queue:
+			for {
+				err := s.Write(ctx, b)
+				if err == nil {
+					break
+				}
+				log.Printf("ERROR: unable to write block %d into postgres: %v", b.BlockNumber, err)
+				if !sleep(ctx, retryBackoff) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// Write writes the batch and moves the replication cursor in one transaction.
+// Accounts, tokens and patterns of the batches older than the cursor are skipped,
+// the database already has their newer state.
+func (s *Sink) Write(ctx context.Context, b Batch) error {
+	return s.update(ctx, func(tx *sql.Tx, cursor uint64) error {
+		if err := writeFundings(ctx, tx, b.Fundings); err != nil {
+			return err
+		}
+		if err := writeSwaps(ctx, tx, b.Swaps); err != nil {
+			return err
+		}
+		if b.BlockNumber <= cursor {
+			return nil
+		}
+		if err := writeAccounts(ctx, tx, b.Accounts); err != nil {
+			return err
+		}
+		if err := writeTokens(ctx, tx, b.Tokens); err != nil {
+			return err
+		}
+		if err := writePatterns(ctx, tx, b.Patterns); err != nil {
+			return err
+		}
+		return moveCursor(ctx, tx, b.BlockNumber)
+	})
+}
+
+// update runs f in a transaction holding the replication cursor row, so concurrent writers are serialized.
+func (s *Sink) update(ctx context.Context, f func(tx *sql.Tx, cursor uint64) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to begin postgres transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var cursor int64
+	if err := tx.QueryRowContext(ctx, selectCursor+" FOR UPDATE").Scan(&cursor); err != nil {
+		return fmt.Errorf("unable to lock replication cursor: %w", err)
+	}
+	if err := f(tx, uint64(cursor)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func moveCursor(ctx context.Context, tx *sql.Tx, blockNumber uint64) error {
+	if _, err := tx.ExecContext(ctx, updateCursor, int64(blockNumber)); err != nil {
+		return fmt.Errorf("unable to move replication cursor: %w", err)
+	}
+	return nil
+}
+
+func writeExchanges(ctx context.Context, tx *sql.Tx, exchanges []repo.Exchange) error {
+	for _, e := range exchanges {
+		if _, err := tx.ExecContext(ctx, upsertExchange, e.Address.Bytes(), e.Name); err != nil {
+			return fmt.Errorf("unable to upsert exchange %s: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+func writeAccounts(ctx context.Context, tx *sql.Tx, accounts []repo.Account) error {
+	for _, acc := range accounts {
+		if _, err := tx.ExecContext(ctx, upsertAccount, acc.Address.Bytes(), acc.Exchange, numeric(acc.Balance), numeric(acc.Received), numeric(acc.Spent)); err != nil {
+			return fmt.Errorf("unable to upsert account %v: %w", acc.Address, err)
+		}
+	}
+	return nil
+}
+
+func writeFundings(ctx context.Context, tx *sql.Tx, fundings []repo.Funding) error {
+	for _, f := range fundings {
+		if _, err := tx.ExecContext(ctx, insertFunding, f.TxHash.Bytes(), f.Exchange, f.Wallet.Bytes(), numeric(f.Value), int64(f.BlockNumber), int64(f.Timestamp)); err != nil {
+			return fmt.Errorf("unable to insert funding %v: %w", f.TxHash, err)
+		}
+	}
+	return nil
+}
+
+func writeTokens(ctx context.Context, tx *sql.Tx, tokens []repo.Token) error {
+	for _, t := range tokens {
+		if _, err := tx.ExecContext(ctx, upsertToken, t.Address.Bytes(), t.Symbol, t.Name, t.Decimals, numeric(t.Price), numeric(t.TotalBought), int64(t.TimesBought)); err != nil {
+			return fmt.Errorf("unable to upsert token %v: %w", t.Address, err)
+		}
+	}
+	return nil
+}
+
+func writeSwaps(ctx context.Context, tx *sql.Tx, swaps []repo.Swap) error {
+	for _, sw := range swaps {
+		if _, err := tx.ExecContext(ctx, insertSwap, sw.TxHash.Bytes(), int64(sw.LogIndex), int64(sw.BlockNumber), int64(sw.Timestamp),
+			int64(sw.TxIndex), sw.Wallet.Bytes(), sw.TokenAddr.Bytes(), sw.Factory.Bytes(), numeric(sw.Price), numeric(sw.Value)); err != nil {
+			return fmt.Errorf("unable to insert swap %v: %w", sw.TxHash, err)
+		}
+		for hop, token := range sw.Path {
+			if _, err := tx.ExecContext(ctx, insertSwapHop, sw.TxHash.Bytes(), int64(sw.LogIndex), hop, token.Bytes()); err != nil {
+				return fmt.Errorf("unable to insert hop %d of swap %v: %w", hop, sw.TxHash, err)
+			}
+		}
+	}
+	return nil
+}
+
+func writePatterns(ctx context.Context, tx *sql.Tx, patterns []repo.Pattern) error {
+	for _, p := range patterns {
+		if _, err := tx.ExecContext(ctx, upsertPattern, p.TokenAddr.Bytes(), p.ExchangeName, numeric(p.Value), int64(p.TimesOccured)); err != nil {
+			return fmt.Errorf("unable to upsert pattern %v/%s: %w", p.TokenAddr, p.ExchangeName, err)
+		}
+	}
+	return nil
+}
+
+// numeric formats x as postgres numeric, nil is zero.
+func numeric(x *big.Int) string {
+	if x == nil {
+		return "0"
+	}
+	return x.String()
+}
@@ -0,0 +1,357 @@
+package pgsink
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/repo"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeDriver records statements of the committed transactions and keeps the replication cursor.
+type fakeDriver struct {
+	mu        sync.Mutex
+	cursor    int64
+	committed []string
+}
+
+var (
+	fakesMu sync.Mutex
+	fakes   = map[string]*fakeDriver{}
+)
+
+func init() {
+	sql.Register("pgsinktest", fakeConnector{})
+}
+
+type fakeConnector struct{}
+
+func (fakeConnector) Open(name string) (driver.Conn, error) {
+	fakesMu.Lock()
+	defer fakesMu.Unlock()
+	return &fakeConn{d: fakes[name]}, nil
+}
+
+type fakeConn struct {
+	d       *fakeDriver
+	pending []string
+	// cursor is the replication cursor as seen by the open transaction.
+	cursor int64
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.d.mu.Lock()
+	c.cursor = c.d.cursor
+	c.d.mu.Unlock()
+	c.pending = nil
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.committed = append(c.d.committed, c.pending...)
+	c.d.cursor = c.cursor
+	c.pending = nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.pending = nil
+	return nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	switch query {
+	case updateCursor:
+		if n := args[0].Value.(int64); n > c.cursor {
+			c.cursor = n
+		}
+	case upsertExchange, upsertAccount, insertFunding, upsertToken, insertSwap, insertSwapHop, upsertPattern:
+		c.pending = append(c.pending, statement(query, args))
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if !strings.HasPrefix(query, selectCursor) {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	return &fakeRows{values: []int64{c.d.cursor}}, nil
+}
+
+// statement formats the query as the table name followed by the arguments.
+func statement(query string, args []driver.NamedValue) string {
+	table := strings.Fields(query)[2]
+	var b strings.Builder
+	b.WriteString(table)
+	for _, arg := range args {
+		switch v := arg.Value.(type) {
+		case []byte:
+			fmt.Fprintf(&b, " %x", v)
+		default:
+			fmt.Fprintf(&b, " %v", v)
+		}
+	}
+	return b.String()
+}
+
+type fakeRows struct {
+	values []int64
+}
+
+func (r *fakeRows) Columns() []string { return []string{"block_number"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+func newTestSink(t *testing.T, cursor uint64) (*Sink, *fakeDriver) {
+	d := &fakeDriver{cursor: int64(cursor)}
+	fakesMu.Lock()
+	fakes[t.Name()] = d
+	fakesMu.Unlock()
+
+	db, err := sql.Open("pgsinktest", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: the fake keeps the transaction state in the connection.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return New(db), d
+}
+
+var (
+	wallet  = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	token   = common.HexToAddress("0x2222222222222222222222222222222222222222")
+	weth    = common.HexToAddress("0x3333333333333333333333333333333333333333")
+	factory = common.HexToAddress("0x4444444444444444444444444444444444444444")
+	cex     = common.HexToAddress("0x5555555555555555555555555555555555555555")
+)
+
+func testSwap(txHash byte, blockNumber uint64) repo.Swap {
+	return repo.Swap{
+		TxHash:      common.BytesToHash([]byte{txHash}),
+		Wallet:      wallet,
+		TokenAddr:   token,
+		Path:        []common.Address{weth, token},
+		Factory:     factory,
+		Price:       big.NewInt(7),
+		Value:       big.NewInt(1e18),
+		BlockNumber: blockNumber,
+		Timestamp:   1600000000,
+		TxIndex:     3,
+		LogIndex:    9,
+	}
+}
+
+func testBatch(blockNumber uint64) Batch {
+	return Batch{
+		BlockNumber: blockNumber,
+		Accounts: []repo.Account{
+			{Address: wallet, Exchange: "Binance", Balance: big.NewInt(0), Received: big.NewInt(2e18), Spent: big.NewInt(1e18)},
+		},
+		Fundings: []repo.Funding{
+			{TxHash: common.BytesToHash([]byte{0xf}), Exchange: "Binance", Wallet: wallet, Value: big.NewInt(2e18), BlockNumber: blockNumber, Timestamp: 1600000000},
+		},
+		Tokens: []repo.Token{
+			{Address: token, Symbol: "TKN", Name: "Token", Decimals: 18, Price: big.NewInt(7), TotalBought: big.NewInt(1e18), TimesBought: 1},
+		},
+		Swaps: []repo.Swap{testSwap(0xa, blockNumber)},
+		Patterns: []repo.Pattern{
+			{TokenAddr: token, ExchangeName: "Binance", Value: big.NewInt(1e18), TimesOccured: 1},
+		},
+	}
+}
+
+var (
+	wantFunding = "fundings 000000000000000000000000000000000000000000000000000000000000000f Binance 1111111111111111111111111111111111111111 2000000000000000000 %d 1600000000"
+	wantSwap    = []string{
+		"swaps 000000000000000000000000000000000000000000000000000000000000000a 9 %d 1600000000 3 1111111111111111111111111111111111111111 2222222222222222222222222222222222222222 4444444444444444444444444444444444444444 7 1000000000000000000",
+		"swap_hops 000000000000000000000000000000000000000000000000000000000000000a 9 0 3333333333333333333333333333333333333333",
+		"swap_hops 000000000000000000000000000000000000000000000000000000000000000a 9 1 2222222222222222222222222222222222222222",
+	}
+	wantAccount = "accounts 1111111111111111111111111111111111111111 Binance 0 2000000000000000000 1000000000000000000"
+	wantToken   = "tokens 2222222222222222222222222222222222222222 TKN Token 18 7 1000000000000000000 1"
+	wantPattern = "patterns 2222222222222222222222222222222222222222 Binance 1000000000000000000 1"
+)
+
+func TestSink_Write(t *testing.T) {
+	tests := []struct {
+		name       string
+		cursor     uint64
+		block      uint64
+		want       []string
+		wantCursor uint64
+	}{
+		{
+			name:   "new block",
+			cursor: 10,
+			block:  11,
+			want: []string{
+				fmt.Sprintf(wantFunding, 11), fmt.Sprintf(wantSwap[0], 11), wantSwap[1], wantSwap[2],
+				wantAccount, wantToken, wantPattern,
+			},
+			wantCursor: 11,
+		},
+		{
+			// NOTE: the block was already mirrored, only the insert-only rows are replayed.
+			name:       "replayed block",
+			cursor:     10,
+			block:      10,
+			want:       []string{fmt.Sprintf(wantFunding, 10), fmt.Sprintf(wantSwap[0], 10), wantSwap[1], wantSwap[2]},
+			wantCursor: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, d := newTestSink(t, tt.cursor)
+			if err := s.Write(context.Background(), testBatch(tt.block)); err != nil {
+				t.Fatalf("Sink.Write() error = %v", err)
+			}
+			if !cmp.Equal(d.committed, tt.want) {
+				t.Errorf("Sink.Write() diff = %v", cmp.Diff(tt.want, d.committed))
+			}
+			cursor, err := s.Cursor(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cursor != tt.wantCursor {
+				t.Errorf("Sink.Cursor() = %d, want %d", cursor, tt.wantCursor)
+			}
+		})
+	}
+}
+
+func TestSink_Sync(t *testing.T) {
+	ctx := context.Background()
+	db := repo.NewMemDB()
+	b := testBatch(0)
+	err := db.Update(ctx, func(tx repo.RwTx) error {
+		if err := db.PutExchange(tx, repo.Exchange{Name: "Binance", Address: cex}); err != nil {
+			return err
+		}
+		if err := db.PutAccount(tx, b.Accounts[0]); err != nil {
+			return err
+		}
+		if err := db.PutToken(tx, b.Tokens[0]); err != nil {
+			return err
+		}
+		if err := db.PutPattern(tx, b.Patterns[0]); err != nil {
+			return err
+		}
+		if err := db.PutSwap(tx, testSwap(0x1, 5)); err != nil {
+			return err
+		}
+		return db.PutSwap(tx, testSwap(0xa, 12))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, d := newTestSink(t, 10)
+	if err := s.Sync(ctx, db); err != nil {
+		t.Fatalf("Sink.Sync() error = %v", err)
+	}
+	// NOTE: the swap at block 5 is behind the cursor and is not copied again.
+	want := []string{
+		"exchanges 5555555555555555555555555555555555555555 Binance",
+		wantAccount, wantToken, wantPattern,
+		fmt.Sprintf(wantSwap[0], 12), wantSwap[1], wantSwap[2],
+	}
+	if !cmp.Equal(d.committed, want) {
+		t.Errorf("Sink.Sync() diff = %v", cmp.Diff(want, d.committed))
+	}
+	if cursor, _ := s.Cursor(ctx); cursor != 12 {
+		t.Errorf("Sink.Cursor() = %d, want 12", cursor)
+	}
+}
+
+func TestSink_Sync_chunks(t *testing.T) {
+	defer func(n int) { syncChunk = n }(syncChunk)
+	syncChunk = 1
+
+	ctx := context.Background()
+	db := repo.NewMemDB()
+	b := testBatch(0)
+	err := db.Update(ctx, func(tx repo.RwTx) error {
+		if err := db.PutExchange(tx, repo.Exchange{Name: "Binance", Address: cex}); err != nil {
+			return err
+		}
+		if err := db.PutAccount(tx, b.Accounts[0]); err != nil {
+			return err
+		}
+		if err := db.PutToken(tx, b.Tokens[0]); err != nil {
+			return err
+		}
+		if err := db.PutPattern(tx, b.Patterns[0]); err != nil {
+			return err
+		}
+		for _, sw := range []repo.Swap{testSwap(0x1, 5), testSwap(0xa, 12), testSwap(0xb, 12)} {
+			if err := db.PutSwap(tx, sw); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, d := newTestSink(t, 0)
+	if err := s.Sync(ctx, db); err != nil {
+		t.Fatalf("Sink.Sync() error = %v", err)
+	}
+	// NOTE: the initial sync copies every record, the chunk of block 12 holds both of it's swaps.
+	want := []string{
+		"exchanges 5555555555555555555555555555555555555555 Binance",
+		wantAccount, wantToken, wantPattern,
+		strings.Replace(fmt.Sprintf(wantSwap[0], 5), "0a", "01", 1),
+		strings.Replace(wantSwap[1], "0a", "01", 1),
+		strings.Replace(wantSwap[2], "0a", "01", 1),
+		fmt.Sprintf(wantSwap[0], 12), wantSwap[1], wantSwap[2],
+		strings.Replace(fmt.Sprintf(wantSwap[0], 12), "0a", "0b", 1),
+		strings.Replace(wantSwap[1], "0a", "0b", 1),
+		strings.Replace(wantSwap[2], "0a", "0b", 1),
+	}
+	if !cmp.Equal(d.committed, want) {
+		t.Errorf("Sink.Sync() diff = %v", cmp.Diff(want, d.committed))
+	}
+	if cursor, _ := s.Cursor(ctx); cursor != 12 {
+		t.Errorf("Sink.Cursor() = %d, want 12", cursor)
+	}
+}
+
+func TestSink_Publish(t *testing.T) {
+	var nilSink *Sink
+	nilSink.Publish(testBatch(1))
+
+	s, _ := newTestSink(t, 0)
+	s.queue = make(chan Batch, 1)
+	s.Publish(Batch{BlockNumber: 1})
+	if len(s.queue) != 0 {
+		t.Fatalf("empty batch was queued")
+	}
+	s.Publish(testBatch(1))
+	s.Publish(testBatch(2))
+	if len(s.queue) != 1 || s.behind != 1 {
+		t.Errorf("Sink.Publish() queued %d batches, behind = %d, want 1 batch and behind", len(s.queue), s.behind)
+	}
+}
@@ -0,0 +1,94 @@
+package pgsink
+
+// schema is the normalized analytics schema, every statement is safe to run on an existing database.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS exchanges (
+		address bytea PRIMARY KEY,
+		name    text NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS accounts (
+		address  bytea PRIMARY KEY,
+		exchange text NOT NULL,
+		balance  numeric NOT NULL,
+		received numeric NOT NULL,
+		spent    numeric NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS fundings (
+		tx_hash      bytea PRIMARY KEY,
+		exchange     text NOT NULL,
+		wallet       bytea NOT NULL,
+		value        numeric NOT NULL,
+		block_number bigint NOT NULL,
+		block_time   timestamptz NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS fundings_wallet_idx ON fundings (wallet)`,
+	`CREATE TABLE IF NOT EXISTS tokens (
+		address      bytea PRIMARY KEY,
+		symbol       text NOT NULL,
+		name         text NOT NULL,
+		decimals     bigint NOT NULL,
+		price        numeric NOT NULL,
+		total_bought numeric NOT NULL,
+		times_bought bigint NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS swaps (
+		tx_hash      bytea NOT NULL,
+		log_index    bigint NOT NULL,
+		block_number bigint NOT NULL,
+		block_time   timestamptz NOT NULL,
+		tx_index     bigint NOT NULL,
+		wallet       bytea NOT NULL,
+		token        bytea NOT NULL,
+		factory      bytea NOT NULL,
+		price        numeric NOT NULL,
+		value        numeric NOT NULL,
+		PRIMARY KEY (tx_hash, log_index)
+	)`,
+	`CREATE INDEX IF NOT EXISTS swaps_wallet_idx ON swaps (wallet, block_number)`,
+	`CREATE INDEX IF NOT EXISTS swaps_token_idx ON swaps (token, block_number)`,
+	`CREATE TABLE IF NOT EXISTS swap_hops (
+		tx_hash   bytea NOT NULL,
+		log_index bigint NOT NULL,
+		hop       int NOT NULL,
+		token     bytea NOT NULL,
+		PRIMARY KEY (tx_hash, log_index, hop),
+		FOREIGN KEY (tx_hash, log_index) REFERENCES swaps ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS patterns (
+		token         bytea NOT NULL,
+		exchange      text NOT NULL,
+		value         numeric NOT NULL,
+		times_occured bigint NOT NULL,
+		PRIMARY KEY (token, exchange)
+	)`,
+	// NOTE: replication_cursor has a single row, block_number is the last block mirrored into the other tables.
+	`CREATE TABLE IF NOT EXISTS replication_cursor (
+		id           smallint PRIMARY KEY CHECK (id = 1),
+		block_number bigint NOT NULL
+	)`,
+	`INSERT INTO replication_cursor (id, block_number) VALUES (1, 0) ON CONFLICT (id) DO NOTHING`,
+}
+
+const (
+	upsertExchange = `INSERT INTO exchanges (address, name) VALUES ($1, $2)
+		ON CONFLICT (address) DO UPDATE SET name = EXCLUDED.name`
+	upsertAccount = `INSERT INTO accounts (address, exchange, balance, received, spent) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (address) DO UPDATE SET exchange = EXCLUDED.exchange, balance = EXCLUDED.balance,
+		received = EXCLUDED.received, spent = EXCLUDED.spent`
+	insertFunding = `INSERT INTO fundings (tx_hash, exchange, wallet, value, block_number, block_time) VALUES ($1, $2, $3, $4, $5, to_timestamp($6))
+		ON CONFLICT (tx_hash) DO NOTHING`
+	upsertToken = `INSERT INTO tokens (address, symbol, name, decimals, price, total_bought, times_bought) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (address) DO UPDATE SET symbol = EXCLUDED.symbol, name = EXCLUDED.name, decimals = EXCLUDED.decimals,
+		price = EXCLUDED.price, total_bought = EXCLUDED.total_bought, times_bought = EXCLUDED.times_bought`
+	insertSwap = `INSERT INTO swaps (tx_hash, log_index, block_number, block_time, tx_index, wallet, token, factory, price, value)
+		VALUES ($1, $2, $3, to_timestamp($4), $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (tx_hash, log_index) DO NOTHING`
+	insertSwapHop = `INSERT INTO swap_hops (tx_hash, log_index, hop, token) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tx_hash, log_index, hop) DO NOTHING`
+	upsertPattern = `INSERT INTO patterns (token, exchange, value, times_occured) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (token, exchange) DO UPDATE SET value = EXCLUDED.value, times_occured = EXCLUDED.times_occured`
+
+	selectCursor = `SELECT block_number FROM replication_cursor WHERE id = 1`
+	// NOTE: GREATEST keeps the cursor from moving back when an older batch is written.
+	updateCursor = `UPDATE replication_cursor SET block_number = GREATEST(block_number, $1) WHERE id = 1`
+)
@@ -0,0 +1,355 @@
+package pgsink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/repo"
+)
+
+// syncChunk is the number of records copied by Sync in a single kv and postgres transaction.
+var syncChunk = 1000
+
+// Sync copies the kv store into the database and moves the replication cursor to the kv head.
+// The first Sync, with the cursor at zero, is the bulk initial sync of every record. The later ones catch up
+// after downtime or dropped batches and copy only the accounts, fundings, tokens, patterns and swaps changed
+// by the blocks after the cursor. Exchanges have no block, the table is small and it's copied every time.
+// Records are copied in chunks of syncChunk, every chunk is read in it's own kv read transaction and written
+// in it's own postgres transaction, so neither the kv tables are loaded whole nor the kv read transaction
+// keeps mdbx from reusing pages for the whole sync. The cursor moves with every chunk of swaps.
+func (s *Sink) Sync(ctx context.Context, db repo.Storage) error {
+	cursor, err := s.Cursor(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := s.copyExchanges(ctx, db); err != nil {
+		return err
+	}
+	if cursor == 0 {
+		if err := s.copyAll(ctx, db); err != nil {
+			return err
+		}
+	} else if err := s.copyFundings(ctx, db, cursor); err != nil {
+		return err
+	}
+	if err := s.copySwaps(ctx, db, cursor); err != nil {
+		return err
+	}
+	return s.moveToHead(ctx, db)
+}
+
+// copyChunks calls chunk with it's own kv and postgres transactions until it returns nil key to resume from.
+func (s *Sink) copyChunks(ctx context.Context, db repo.Storage, what string, chunk func(tx repo.Tx, ptx *sql.Tx, start []byte) ([]byte, error)) error {
+	var start []byte
+	for {
+		var next []byte
+		if err := s.update(ctx, func(ptx *sql.Tx, _ uint64) error {
+			return db.View(ctx, func(tx repo.Tx) (err error) {
+				next, err = chunk(tx, ptx, start)
+				return err
+			})
+		}); err != nil {
+			return fmt.Errorf("unable to copy %s: %w", what, err)
+		}
+		if next == nil {
+			return nil
+		}
+		start = next
+	}
+}
+
+// page is the options reading a chunk of records, the record after the chunk is the start of the next one.
+func page(start []byte) repo.IterOptions {
+	return repo.IterOptions{Start: start, Limit: syncChunk + 1}
+}
+
+func (s *Sink) copyExchanges(ctx context.Context, db repo.Storage) error {
+	return s.copyChunks(ctx, db, "exchanges", func(tx repo.Tx, ptx *sql.Tx, start []byte) ([]byte, error) {
+		var exchanges []repo.Exchange
+		if err := db.IterExchanges(tx, page(start), func(e repo.Exchange) error {
+			exchanges = append(exchanges, e)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		var next []byte
+		if len(exchanges) > syncChunk {
+			next, exchanges = exchanges[syncChunk].Address.Bytes(), exchanges[:syncChunk]
+		}
+		return next, writeExchanges(ctx, ptx, exchanges)
+	})
+}
+
+// copyAll copies every account, funding, token and pattern.
+func (s *Sink) copyAll(ctx context.Context, db repo.Storage) error {
+	if err := s.copyChunks(ctx, db, "accounts", func(tx repo.Tx, ptx *sql.Tx, start []byte) ([]byte, error) {
+		var accounts []repo.Account
+		if err := db.IterAccounts(tx, page(start), func(acc repo.Account) error {
+			accounts = append(accounts, acc)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		var next []byte
+		if len(accounts) > syncChunk {
+			next, accounts = accounts[syncChunk].Address.Bytes(), accounts[:syncChunk]
+		}
+		return next, writeAccounts(ctx, ptx, accounts)
+	}); err != nil {
+		return err
+	}
+	if err := s.copyFundings(ctx, db, 0); err != nil {
+		return err
+	}
+	if err := s.copyChunks(ctx, db, "tokens", func(tx repo.Tx, ptx *sql.Tx, start []byte) ([]byte, error) {
+		var tokens []repo.Token
+		if err := db.IterTokens(tx, page(start), func(t repo.Token) error {
+			tokens = append(tokens, t)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		var next []byte
+		if len(tokens) > syncChunk {
+			next, tokens = tokens[syncChunk].Address.Bytes(), tokens[:syncChunk]
+		}
+		return next, writeTokens(ctx, ptx, tokens)
+	}); err != nil {
+		return err
+	}
+	// NOTE: patterns are resumed by token, so the chunks end with every pattern of the last token.
+	return s.copyChunks(ctx, db, "patterns", func(tx repo.Tx, ptx *sql.Tx, start []byte) ([]byte, error) {
+		var (
+			patterns []repo.Pattern
+			next     []byte
+		)
+		if err := db.IterPatterns(tx, repo.IterOptions{Start: start}, func(p repo.Pattern) error {
+			if len(patterns) >= syncChunk && p.TokenAddr != patterns[len(patterns)-1].TokenAddr {
+				next = p.TokenAddr.Bytes()
+				return repo.ErrStop
+			}
+			patterns = append(patterns, p)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		return next, writePatterns(ctx, ptx, patterns)
+	})
+}
+
+// copyFundings copies fundings made after the block together with the accounts they funded,
+// the accounts are left to copyAll when the block is zero.
+func (s *Sink) copyFundings(ctx context.Context, db repo.Storage, after uint64) error {
+	return s.copyChunks(ctx, db, "fundings", func(tx repo.Tx, ptx *sql.Tx, start []byte) ([]byte, error) {
+		var (
+			fundings []repo.Funding
+			next     []byte
+			n        int
+		)
+		// NOTE: fundings are not indexed by block, the chunk is syncChunk scanned fundings.
+		if err := db.IterFundings(tx, page(start), func(f repo.Funding) error {
+			if n++; n > syncChunk {
+				next = f.TxHash.Bytes()
+				return repo.ErrStop
+			}
+			if f.BlockNumber > after {
+				fundings = append(fundings, f)
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		if err := writeFundings(ctx, ptx, fundings); err != nil {
+			return nil, err
+		}
+		if after == 0 {
+			return next, nil
+		}
+
+		c := newChanged(db, tx)
+		for _, f := range fundings {
+			if err := c.addWallet(f.Wallet); err != nil {
+				return nil, err
+			}
+		}
+		return next, writeAccounts(ctx, ptx, c.accounts)
+	})
+}
+
+// copySwaps copies swaps made after the block in chunks ending at the block boundary and moves the cursor
+// to the last block of every chunk. Accounts, tokens and patterns changed by the swaps are copied with them
+// unless copyAll already copied every record, i.e. the block is zero.
+func (s *Sink) copySwaps(ctx context.Context, db repo.Storage, after uint64) error {
+	from := after + 1
+	for {
+		var next uint64
+		if err := s.update(ctx, func(ptx *sql.Tx, cursor uint64) error {
+			return db.View(ctx, func(tx repo.Tx) error {
+				var swaps []repo.Swap
+				if err := db.IterSwapsByBlock(tx, from, math.MaxUint64, func(sw repo.Swap) error {
+					if len(swaps) >= syncChunk && sw.BlockNumber != swaps[len(swaps)-1].BlockNumber {
+						next = sw.BlockNumber
+						return repo.ErrStop
+					}
+					swaps = append(swaps, sw)
+					return nil
+				}); err != nil {
+					return err
+				}
+				if len(swaps) == 0 {
+					return nil
+				}
+
+				if after > 0 {
+					c := newChanged(db, tx)
+					for _, sw := range swaps {
+						if err := c.addSwap(sw); err != nil {
+							return err
+						}
+					}
+					if err := writeAccounts(ctx, ptx, c.accounts); err != nil {
+						return err
+					}
+					if err := writeTokens(ctx, ptx, c.tokens); err != nil {
+						return err
+					}
+					if err := writePatterns(ctx, ptx, c.patterns); err != nil {
+						return err
+					}
+				}
+				if err := writeSwaps(ctx, ptx, swaps); err != nil {
+					return err
+				}
+				if last := swaps[len(swaps)-1].BlockNumber; last > cursor {
+					return moveCursor(ctx, ptx, last)
+				}
+				return nil
+			})
+		}); err != nil {
+			return fmt.Errorf("unable to copy swaps: %w", err)
+		}
+		if next == 0 {
+			return nil
+		}
+		from = next
+	}
+}
+
+// moveToHead moves the cursor to the last block the kv store has seen, the latest valuation block.
+func (s *Sink) moveToHead(ctx context.Context, db repo.Storage) error {
+	return s.update(ctx, func(ptx *sql.Tx, cursor uint64) error {
+		var head uint64
+		if err := db.View(ctx, func(tx repo.Tx) error {
+			v, _, err := db.LatestValuation(tx)
+			if err != nil {
+				return fmt.Errorf("unable to retrieve latest valuation: %w", err)
+			}
+			head = v.BlockNumber
+			return nil
+		}); err != nil {
+			return err
+		}
+		if head <= cursor {
+			return nil
+		}
+		return moveCursor(ctx, ptx, head)
+	})
+}
+
+// changed collects the current state of the records changed by the copied fundings and swaps, in the order of
+// the first change.
+type changed struct {
+	db repo.Storage
+	tx repo.Tx
+
+	accounts []repo.Account
+	tokens   []repo.Token
+	patterns []repo.Pattern
+
+	exchanges   map[common.Address]string
+	seenTokens  map[common.Address]struct{}
+	seenPattern map[patternKey]struct{}
+}
+
+type patternKey struct {
+	token    common.Address
+	exchange string
+}
+
+func newChanged(db repo.Storage, tx repo.Tx) *changed {
+	return &changed{
+		db:          db,
+		tx:          tx,
+		exchanges:   make(map[common.Address]string),
+		seenTokens:  make(map[common.Address]struct{}),
+		seenPattern: make(map[patternKey]struct{}),
+	}
+}
+
+// addWallet adds the account of the wallet and remembers it's exchange.
+func (c *changed) addWallet(wallet common.Address) error {
+	if _, ok := c.exchanges[wallet]; ok {
+		return nil
+	}
+	ok, err := c.db.HasAccount(c.tx, wallet)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		c.exchanges[wallet] = ""
+		return nil
+	}
+	acc, err := c.db.PeekAccount(c.tx, wallet)
+	if err != nil {
+		return err
+	}
+	c.exchanges[wallet] = acc.Exchange
+	c.accounts = append(c.accounts, acc)
+	return nil
+}
+
+// addSwap adds the account of the swap, the tokens of it's path and the pattern of the bought token.
+func (c *changed) addSwap(sw repo.Swap) error {
+	if err := c.addWallet(sw.Wallet); err != nil {
+		return err
+	}
+	for _, token := range sw.Path {
+		if _, ok := c.seenTokens[token]; ok {
+			continue
+		}
+		c.seenTokens[token] = struct{}{}
+		ok, err := c.db.HasToken(c.tx, token)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		t, err := c.db.PeekToken(c.tx, token)
+		if err != nil {
+			return err
+		}
+		c.tokens = append(c.tokens, t)
+	}
+
+	exchange := c.exchanges[sw.Wallet]
+	key := patternKey{sw.TokenAddr, exchange}
+	if _, ok := c.seenPattern[key]; ok || exchange == "" {
+		return nil
+	}
+	c.seenPattern[key] = struct{}{}
+	ok, err := c.db.HasPattern(c.tx, sw.TokenAddr, exchange)
+	if err != nil || !ok {
+		return err
+	}
+	p, err := c.db.PeekPattern(c.tx, sw.TokenAddr, exchange)
+	if err != nil {
+		return err
+	}
+	c.patterns = append(c.patterns, p)
+	return nil
+}
@@ -0,0 +1,280 @@
+// Package pnl revalues tracked swaps and computes their unrealized returns.
+package pnl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/repo"
+)
+
+// PriceSource returns ETH price of the last token of the path at the given block.
+type PriceSource interface {
+	PriceAt(ctx context.Context, factory common.Address, path []common.Address, blockNumber uint64) (*big.Int, error)
+}
+
+// Hop is a pair of tokens, tokens are sorted so Hop does not depend on the swap direction.
+type Hop [2]common.Address
+
+// NewHop returns Hop of the tokenA and tokenB.
+func NewHop(tokenA, tokenB common.Address) Hop {
+	if bytes.Compare(tokenA.Bytes(), tokenB.Bytes()) > 0 {
+		tokenA, tokenB = tokenB, tokenA
+	}
+	return Hop{tokenA, tokenB}
+}
+
+// Position is repo.Swap together with it's revalued state.
+type Position struct {
+	Swap     repo.Swap
+	Exchange string
+	State    repo.Position
+}
+
+// Return returns unrealized return of the position, 1.0 means +100%.
+func (p Position) Return() float64 {
+	return ratio(p.State.Price, p.Swap.Price) - 1
+}
+
+// PeakReturn returns the highest unrealized return the position ever had.
+func (p Position) PeakReturn() float64 {
+	return ratio(p.State.PeakPrice, p.Swap.Price) - 1
+}
+
+// Engine keeps every tracked swap revalued and recomputes only the positions affected by the new block.
+type Engine struct {
+	mu sync.RWMutex
+
+	prices    PriceSource
+	// positions are keyed by the swap keys.
+	positions map[string]*Position
+	// pending are positions which were never revalued yet or couldn't be priced on their last revaluation.
+	pending map[string]struct{}
+}
+
+// NewEngine creates new Engine.
+func NewEngine(prices PriceSource) *Engine {
+	return &Engine{
+		prices:    prices,
+		positions: make(map[string]*Position),
+		pending:   make(map[string]struct{}),
+	}
+}
+
+// Load adds already stored swaps with their persisted states, swaps without state are revalued on the next Update.
+// States are keyed by the swap keys.
+func (e *Engine) Load(swaps []repo.Swap, accounts map[common.Address]repo.Account, states map[string]repo.Position) {
+	for _, s := range swaps {
+		state, ok := states[string(s.Key())]
+		e.Restore(s, accounts[s.Wallet].Exchange, state, ok)
+	}
+}
+
+// Restore adds already stored swap with it's persisted state, the swap is revalued on the next Update if it has no state.
+func (e *Engine) Restore(s repo.Swap, exchange string, state repo.Position, ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := string(s.Key())
+	p := &Position{Swap: s, Exchange: exchange}
+	if ok {
+		p.State = state
+	} else {
+		e.pending[key] = struct{}{}
+	}
+	e.positions[key] = p
+}
+
+// Add adds new swap, it's revalued on the next Update.
+func (e *Engine) Add(s repo.Swap, exchange string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := string(s.Key())
+	e.positions[key] = &Position{Swap: s, Exchange: exchange}
+	e.pending[key] = struct{}{}
+}
+
+// Update revalues pending positions and positions whose path goes through any of the changed hops
+// at the given block, it returns the states that were changed. Positions which can't be priced are skipped,
+// see Revalue.
+func (e *Engine) Update(ctx context.Context, blockNumber uint64, changed []Hop) ([]repo.Position, error) {
+	states, missed, err := e.Revalue(ctx, e.prices, blockNumber, changed, nil)
+	e.Commit(nil, states, missed)
+	return states, err
+}
+
+// Revalue revalues the added swaps, pending positions and positions whose path goes through any of the changed
+// hops at the given block with the prices of the source. It returns the new states without keeping them,
+// Commit keeps them once they are persisted. Positions which can't be priced are skipped, keep their states and
+// are returned as missed, the returned error counts them and the returned states are valid whatever the error is.
+func (e *Engine) Revalue(ctx context.Context, prices PriceSource, blockNumber uint64, changed []Hop, added []Position) ([]repo.Position, []Position, error) {
+	hops := make(map[Hop]struct{}, len(changed))
+	for _, h := range changed {
+		hops[h] = struct{}{}
+	}
+
+	// NOTE: the positions are copied, so the lock is not held while they're priced.
+	e.mu.RLock()
+	todo := make([]Position, 0, len(e.pending)+len(added))
+	for key, p := range e.positions {
+		if _, isPending := e.pending[key]; isPending || touches(p.Swap.Path, hops) {
+			todo = append(todo, *p)
+		}
+	}
+	e.mu.RUnlock()
+	for i := range added {
+		todo = append(todo, Position{Swap: added[i].Swap, Exchange: added[i].Exchange})
+	}
+
+	memo := make(map[string]*big.Int)
+	var (
+		states   []repo.Position
+		missed   []Position
+		firstErr error
+	)
+	revalueOne := func(p *Position) {
+		price, err := priceAt(ctx, prices, memo, p.Swap, blockNumber)
+		if err != nil {
+			if missed = append(missed, *p); firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		states = append(states, revalue(p.State, p.Swap, price, blockNumber))
+	}
+	for i := range todo {
+		revalueOne(&todo[i])
+	}
+
+	if len(missed) > 0 {
+		return states, missed, fmt.Errorf("could not revalue %d positions: %w", len(missed), firstErr)
+	}
+	return states, nil, nil
+}
+
+// Commit adds the swaps, they are revalued on the next Update unless they have a state, keeps the states
+// returned by Revalue and leaves the missed positions pending. States older than the kept ones are dropped.
+func (e *Engine) Commit(added []Position, states []repo.Position, missed []Position) {
+	if len(added) == 0 && len(states) == 0 && len(missed) == 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, p := range added {
+		key := string(p.Swap.Key())
+		e.positions[key] = &Position{Swap: p.Swap, Exchange: p.Exchange}
+		e.pending[key] = struct{}{}
+	}
+	for _, state := range states {
+		key := string(state.Key())
+		if p, ok := e.positions[key]; ok && state.BlockNumber >= p.State.BlockNumber {
+			p.State = state
+			delete(e.pending, key)
+		}
+	}
+	for _, p := range missed {
+		key := string(p.Swap.Key())
+		if _, ok := e.positions[key]; ok {
+			e.pending[key] = struct{}{}
+		}
+	}
+}
+
+// Position returns the cached position of the swap with the given log index made in the transaction.
+func (e *Engine) Position(txHash common.Hash, logIndex uint) (Position, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	p, ok := e.positions[string(repo.SwapKey(txHash, logIndex))]
+	if !ok {
+		return Position{}, false
+	}
+	return *p, true
+}
+
+// Positions returns all cached positions.
+func (e *Engine) Positions() []Position {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	positions := make([]Position, 0, len(e.positions))
+	for _, p := range e.positions {
+		positions = append(positions, *p)
+	}
+	return positions
+}
+
+// Pending returns the positions waiting to be revalued, see Revalue.
+func (e *Engine) Pending() []Position {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	positions := make([]Position, 0, len(e.pending))
+	for key := range e.pending {
+		positions = append(positions, *e.positions[key])
+	}
+	return positions
+}
+
+// priceAt returns price of the swap token, prices are memoized by factory and path.
+func priceAt(ctx context.Context, prices PriceSource, memo map[string]*big.Int, s repo.Swap, blockNumber uint64) (*big.Int, error) {
+	key := string(s.Factory.Bytes())
+	for _, addr := range s.Path {
+		key += string(addr.Bytes())
+	}
+	if price, ok := memo[key]; ok {
+		return price, nil
+	}
+
+	price, err := prices.PriceAt(ctx, s.Factory, s.Path, blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("could not revalue swap %v: %w", s.TxHash, err)
+	}
+	memo[key] = price
+	return price, nil
+}
+
+func revalue(state repo.Position, s repo.Swap, price *big.Int, blockNumber uint64) repo.Position {
+	state.TxHash, state.LogIndex = s.TxHash, s.LogIndex
+	state.Price = price
+	state.BlockNumber = blockNumber
+	if state.OpenedAt == 0 {
+		// NOTE: swaps recorded before the block numbers were stored open at the first revaluation.
+		state.OpenedAt = s.BlockNumber
+		if state.OpenedAt == 0 {
+			state.OpenedAt = blockNumber
+		}
+	}
+	if state.PeakPrice == nil || price.Cmp(state.PeakPrice) > 0 {
+		state.PeakPrice = price
+	}
+	if state.Reached2xAt == 0 && s.Price != nil && s.Price.Sign() > 0 &&
+		price.Cmp(new(big.Int).Lsh(s.Price, 1)) >= 0 {
+		state.Reached2xAt = blockNumber
+	}
+	return state
+}
+
+func touches(path []common.Address, hops map[Hop]struct{}) bool {
+	for i := 1; i < len(path); i++ {
+		if _, ok := hops[NewHop(path[i-1], path[i])]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func ratio(x, y *big.Int) float64 {
+	if x == nil || y == nil || y.Sign() == 0 {
+		return 1
+	}
+	r, _ := new(big.Rat).SetFrac(x, y).Float64()
+	return r
+}
@@ -0,0 +1,183 @@
+package pnl
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/repo"
+)
+
+// testPrices is PriceSource returning fixed token prices, it counts the lookups and fails on unknown tokens.
+type testPrices struct {
+	prices map[common.Address]*big.Int
+	calls  int
+}
+
+func (p *testPrices) PriceAt(_ context.Context, _ common.Address, path []common.Address, _ uint64) (*big.Int, error) {
+	p.calls++
+	price, ok := p.prices[path[len(path)-1]]
+	if !ok {
+		return nil, errors.New("no price")
+	}
+	return price, nil
+}
+
+var (
+	weth   = common.BytesToAddress([]byte("weth"))
+	token0 = common.BytesToAddress([]byte("token0"))
+	token1 = common.BytesToAddress([]byte("token1"))
+	alice  = common.BytesToAddress([]byte("alice"))
+	bob    = common.BytesToAddress([]byte("bob"))
+)
+
+func testSwap(hash string, wallet, token common.Address, price, value int64) repo.Swap {
+	return repo.Swap{
+		TxHash:    common.BytesToHash([]byte(hash)),
+		Wallet:    wallet,
+		TokenAddr: token,
+		Path:      []common.Address{weth, token},
+		Price:     big.NewInt(price),
+		Value:     big.NewInt(value),
+	}
+}
+
+func almostEqual(x, y float64) bool {
+	return math.Abs(x-y) < 1e-9
+}
+
+func TestEngine_Update(t *testing.T) {
+	t.Parallel()
+
+	prices := &testPrices{prices: map[common.Address]*big.Int{
+		token0: big.NewInt(200),
+		token1: big.NewInt(50),
+	}}
+	e := NewEngine(prices)
+
+	e.Add(testSwap("tx0", alice, token0, 100, 1e18), "Binance")
+	e.Add(testSwap("tx1", alice, token1, 100, 1e18), "Binance")
+	e.Add(testSwap("tx2", bob, token0, 150, 3e18), "Kraken")
+
+	states, err := e.Update(context.Background(), 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 3 {
+		t.Fatalf("Engine.Update() revalued %d positions, want %d", len(states), 3)
+	}
+	// NOTE: tx0 and tx2 share the path, so the price is looked up once.
+	if prices.calls != 2 {
+		t.Errorf("PriceSource.PriceAt() called %d times, want %d", prices.calls, 2)
+	}
+
+	p, ok := e.Position(common.BytesToHash([]byte("tx0")), 0)
+	if !ok {
+		t.Fatal("Engine.Position() ok = false")
+	}
+	if !almostEqual(p.Return(), 1) || p.State.Reached2xAt != 10 || p.State.OpenedAt != 10 {
+		t.Errorf("Engine.Position() = %+v, return = %v", p.State, p.Return())
+	}
+
+	// Only positions going through the changed hop are revalued.
+	prices.calls = 0
+	prices.prices[token1] = big.NewInt(300)
+	states, err = e.Update(context.Background(), 11, []Hop{NewHop(token1, weth)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || prices.calls != 1 {
+		t.Fatalf("Engine.Update() revalued %d positions with %d lookups, want %d, %d", len(states), prices.calls, 1, 1)
+	}
+	p, _ = e.Position(common.BytesToHash([]byte("tx1")), 0)
+	if p.State.OpenedAt != 10 || p.State.Reached2xAt != 11 || p.State.PeakPrice.Cmp(big.NewInt(300)) != 0 {
+		t.Errorf("Engine.Position() = %+v", p.State)
+	}
+	if !almostEqual(p.Return(), 2) {
+		t.Errorf("Engine.Position() return = %v, want %v", p.Return(), 2)
+	}
+}
+
+func TestEngine_Revalue(t *testing.T) {
+	t.Parallel()
+
+	prices := &testPrices{prices: map[common.Address]*big.Int{token0: big.NewInt(200)}}
+	e := NewEngine(prices)
+	e.Add(testSwap("tx0", alice, token0, 100, 1e18), "Binance")
+
+	opened := testSwap("tx1", bob, token0, 100, 1e18)
+	opened.BlockNumber = 7
+	// NOTE: second swap of the same transaction is a position of it's own.
+	second := opened
+	second.LogIndex, second.Price = 3, big.NewInt(50)
+	added := []Position{
+		{Swap: opened, Exchange: "Kraken"},
+		{Swap: second, Exchange: "Kraken"},
+		{Swap: testSwap("tx2", bob, token1, 100, 1e18), Exchange: "Kraken"},
+	}
+
+	// Unpriced token1 is skipped, the rest is still revalued.
+	states, missed, err := e.Revalue(context.Background(), prices, 10, nil, added)
+	if err == nil || len(missed) != 1 {
+		t.Errorf("Engine.Revalue() missed %d positions, error = %v", len(missed), err)
+	}
+	if len(states) != 3 {
+		t.Fatalf("Engine.Revalue() revalued %d positions, want %d", len(states), 3)
+	}
+	if _, ok := e.Position(opened.TxHash, opened.LogIndex); ok {
+		t.Error("Engine.Revalue() added position before Commit")
+	}
+	if p, _ := e.Position(common.BytesToHash([]byte("tx0")), 0); p.State.Price != nil {
+		t.Errorf("Engine.Revalue() changed state before Commit: %+v", p.State)
+	}
+
+	e.Commit(added, states, missed)
+	p, ok := e.Position(opened.TxHash, opened.LogIndex)
+	if !ok || p.State.OpenedAt != 7 || p.State.BlockNumber != 10 {
+		t.Errorf("Engine.Position(tx1) = %+v, ok = %v", p.State, ok)
+	}
+	if p, ok := e.Position(second.TxHash, second.LogIndex); !ok || p.State.Reached2xAt != 10 {
+		t.Errorf("Engine.Position(tx1, 3) = %+v, ok = %v", p.State, ok)
+	}
+
+	// The skipped position stays pending and is revalued once it can be priced.
+	prices.prices[token1] = big.NewInt(50)
+	states, err = e.Update(context.Background(), 11, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].TxHash != common.BytesToHash([]byte("tx2")) {
+		t.Errorf("Engine.Update() = %+v, want only tx2", states)
+	}
+	if pending := e.Pending(); len(pending) != 0 {
+		t.Errorf("Engine.Pending() = %+v, want none", pending)
+	}
+}
+
+func TestEngine_Commit(t *testing.T) {
+	t.Parallel()
+
+	prices := &testPrices{prices: map[common.Address]*big.Int{token0: big.NewInt(200)}}
+	e := NewEngine(prices)
+	s := testSwap("tx0", alice, token0, 100, 1e18)
+	e.Add(s, "Binance")
+	if _, err := e.Update(context.Background(), 11, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: the state revalued at an older block is dropped.
+	stale := repo.Position{TxHash: s.TxHash, Price: big.NewInt(1), PeakPrice: big.NewInt(1), BlockNumber: 10}
+	e.Commit(nil, []repo.Position{stale}, nil)
+	if p, _ := e.Position(s.TxHash, 0); p.State.BlockNumber != 11 {
+		t.Errorf("Engine.Position() = %+v, want the state of block 11", p.State)
+	}
+
+	// The position missed by the revaluation is pending again.
+	e.Commit(nil, nil, []Position{{Swap: s}})
+	if pending := e.Pending(); len(pending) != 1 || pending[0].Swap.TxHash != s.TxHash {
+		t.Errorf("Engine.Pending() = %+v, want tx0", pending)
+	}
+}
@@ -3,11 +3,11 @@ package repo
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/gelfand/mettu/internal/cbor"
-	"github.com/ledgerwatch/erigon-lib/kv"
 )
 
 type Account struct {
@@ -19,100 +19,159 @@ type Account struct {
 }
 
 type _account struct {
+	Balance    []byte
+	Received   []byte
+	Spent      []byte
+	ExchangeID uint32
+}
+
+// _namedAccount is the accountStorage value of the schema before exchange IDs.
+type _namedAccount struct {
 	Balance  []byte
 	Received []byte
 	Spent    []byte
 	Exchange string
 }
 
-func (db *DB) PutAccount(tx kv.RwTx, acc Account) error {
-	a := _account{
-		Balance:  acc.Balance.Bytes(),
-		Received: acc.Received.Bytes(),
-		Spent:    acc.Spent.Bytes(),
-		Exchange: acc.Exchange,
+func (db *DB) PutAccount(tx RwTx, acc Account) error {
+	id, err := db.assignExchangeID(tx, acc.Exchange)
+	if err != nil {
+		return err
 	}
+	return putAccountRecord(tx, acc.Address, _account{
+		Balance:    acc.Balance.Bytes(),
+		Received:   acc.Received.Bytes(),
+		Spent:      acc.Spent.Bytes(),
+		ExchangeID: id,
+	})
+}
 
+func putAccountRecord(tx RwTx, addr common.Address, a _account) error {
 	var accBuf bytes.Buffer
 	if err := cbor.Marshal(&accBuf, a); err != nil {
 		return fmt.Errorf("unable to marshal account value: %w", err)
 	}
 
-	if err := tx.Put(accountStorage, acc.Address.Bytes(), accBuf.Bytes()); err != nil {
+	if err := tx.Put(accountStorage, addr.Bytes(), accBuf.Bytes()); err != nil {
 		return fmt.Errorf("unable to put new account entry: %w", err)
 	}
 	return nil
 }
 
-func (db *DB) HasAccount(tx kv.Tx, addr common.Address) (bool, error) {
+func (db *DB) HasAccount(tx Tx, addr common.Address) (bool, error) {
 	return tx.Has(accountStorage, addr.Bytes())
 }
 
-func (db *DB) PeekAccount(tx kv.Tx, address common.Address) (Account, error) {
+func (db *DB) PeekAccount(tx Tx, address common.Address) (Account, error) {
 	val, err := tx.GetOne(accountStorage, address.Bytes())
 	if err != nil {
 		return Account{}, fmt.Errorf("unable to tx.GetOne: %w", err)
 	}
+	return db.decodeAccount(tx, make(exchangeNames), address.Bytes(), val)
+}
+
+func (db *DB) decodeAccount(tx Tx, names exchangeNames, k, v []byte) (Account, error) {
+	addr := common.BytesToAddress(k)
 	var a _account
-	if err := cbor.Unmarshal(bytes.NewReader(val), &a); err != nil {
-		return Account{}, fmt.Errorf("unable to unmarshal account value: %w", err)
+	if err := cbor.Unmarshal(bytes.NewReader(v), &a); err != nil {
+		return Account{}, fmt.Errorf("unable to unmarshal account value, address: %v, err: %w", addr, err)
+	}
+	exchange, err := names.name(db, tx, a.ExchangeID)
+	if err != nil {
+		return Account{}, err
 	}
 
 	return Account{
-		Address:  address,
+		Address:  addr,
 		Balance:  new(big.Int).SetBytes(a.Balance),
 		Received: new(big.Int).SetBytes(a.Received),
 		Spent:    new(big.Int).SetBytes(a.Spent),
-		Exchange: a.Exchange,
+		Exchange: exchange,
 	}, nil
 }
 
-func (db *DB) AllAccounts(tx kv.Tx) ([]Account, error) {
-	var accounts []Account
-	if err := tx.ForEach(accountStorage, []byte{}, func(k, v []byte) error {
-		addr := common.BytesToAddress(k)
-		var a _account
-		if err := cbor.Unmarshal(bytes.NewReader(v), &a); err != nil {
-			return fmt.Errorf("unable to unmarshal account value, address: %v, err: %w", addr, err)
+// IterAccounts calls f for accounts ordered by address, Start of the options is the address bytes.
+func (db *DB) IterAccounts(tx Tx, opts IterOptions, f func(Account) error) error {
+	names := make(exchangeNames)
+	return iterate(tx, accountStorage, opts, func(k, v []byte) error {
+		acc, err := db.decodeAccount(tx, names, k, v)
+		if err != nil {
+			return err
 		}
+		return f(acc)
+	})
+}
 
-		acc := Account{
-			Address:  addr,
-			Balance:  new(big.Int).SetBytes(a.Balance),
-			Received: new(big.Int).SetBytes(a.Received),
-			Spent:    new(big.Int).SetBytes(a.Spent),
-			Exchange: a.Exchange,
-		}
+func (db *DB) AllAccounts(tx Tx) ([]Account, error) {
+	var accounts []Account
+	if err := db.IterAccounts(tx, IterOptions{}, func(acc Account) error {
 		accounts = append(accounts, acc)
 		return nil
 	}); err != nil {
-		return nil, fmt.Errorf("tx.ForEach: %w", err)
+		return nil, fmt.Errorf("unable to iterate through accounts: %w", err)
 	}
 
 	return accounts, nil
 }
 
-func (db *DB) AllAccountsMap(tx kv.Tx) (map[common.Address]Account, error) {
+func (db *DB) AllAccountsMap(tx Tx) (map[common.Address]Account, error) {
 	accounts := make(map[common.Address]Account)
-	if err := tx.ForEach(accountStorage, []byte{}, func(k, v []byte) error {
-		addr := common.BytesToAddress(k)
-		var a _account
-		if err := cbor.Unmarshal(bytes.NewReader(v), &a); err != nil {
-			return fmt.Errorf("unable to unmarshal account value, address: %v, err: %w", addr, err)
-		}
+	if err := db.IterAccounts(tx, IterOptions{}, func(acc Account) error {
+		accounts[acc.Address] = acc
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through accounts: %w", err)
+	}
 
-		acc := Account{
-			Address:  addr,
-			Balance:  new(big.Int).SetBytes(a.Balance),
-			Received: new(big.Int).SetBytes(a.Received),
-			Spent:    new(big.Int).SetBytes(a.Spent),
-			Exchange: a.Exchange,
+	return accounts, nil
+}
+
+// FullAccount is Account with it's amounts valued in USD.
+type FullAccount struct {
+	Account
+	ReceivedUSD float64
+	SpentUSD    float64
+}
+
+// AccountsData returns accounts selected by the options with their amounts valued in USD at the blocks
+// of their fundings and swaps.
+func (db *DB) AccountsData(tx Tx, opts IterOptions) ([]FullAccount, error) {
+	vals := db.newValuer(tx)
+	var fullAccounts []FullAccount
+	if err := db.IterAccounts(tx, opts, func(acc Account) error {
+		fa, err := db.fullAccount(tx, vals, acc)
+		if err != nil {
+			return err
 		}
-		accounts[addr] = acc
+		fullAccounts = append(fullAccounts, fa)
 		return nil
 	}); err != nil {
-		return nil, fmt.Errorf("tx.ForEach: %w", err)
+		return nil, fmt.Errorf("unable to iterate through accounts: %w", err)
 	}
+	return fullAccounts, nil
+}
 
-	return accounts, nil
+func (db *DB) fullAccount(tx Tx, vals *valuer, acc Account) (FullAccount, error) {
+	fundings, err := db.FundingsByWallet(tx, acc.Address)
+	if err != nil {
+		return FullAccount{}, err
+	}
+	swaps, err := db.SwapsByWallet(tx, acc.Address, 0, math.MaxUint64)
+	if err != nil {
+		return FullAccount{}, err
+	}
+
+	fa := FullAccount{Account: acc}
+	if fa.ReceivedUSD, err = vals.totalUSD(acc.Received, fundingAmounts(fundings)); err != nil {
+		return FullAccount{}, err
+	}
+	if fa.SpentUSD, err = vals.totalUSD(acc.Spent, swapAmounts(swaps)); err != nil {
+		return FullAccount{}, err
+	}
+	return fa, nil
+}
+
+// AllAccountsData returns all accounts with their amounts valued in USD at the blocks they were moved at.
+func (db *DB) AllAccountsData(tx Tx) ([]FullAccount, error) {
+	return db.AccountsData(tx, IterOptions{})
 }
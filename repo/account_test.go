@@ -8,7 +8,6 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
-	"github.com/ledgerwatch/erigon-lib/kv"
 )
 
 func TestDB_PutAccount(t *testing.T) {
@@ -24,10 +23,10 @@ func TestDB_PutAccount(t *testing.T) {
 	}
 
 	type fields struct {
-		d kv.RwDB
+		d Backend
 	}
 	type args struct {
-		tx  kv.RwTx
+		tx  RwTx
 		acc Account
 	}
 	tests := []struct {
@@ -111,10 +110,10 @@ func TestDB_PutAccount(t *testing.T) {
 
 func TestDB_HasAccount(t *testing.T) {
 	type fields struct {
-		d kv.RwDB
+		d Backend
 	}
 	type args struct {
-		tx   kv.Tx
+		tx   Tx
 		addr common.Address
 	}
 	tests := []struct {
@@ -171,10 +170,10 @@ func TestDB_HasAccount(t *testing.T) {
 
 // func TestDB_PeekAccount(t *testing.T) {
 // 	type fields struct {
-// 		d kv.RwDB
+// 		d Backend
 // 	}
 // 	type args struct {
-// 		tx      kv.Tx
+// 		tx      Tx
 // 		address common.Address
 // 	}
 // 	tests := []struct {
@@ -205,10 +204,10 @@ func TestDB_HasAccount(t *testing.T) {
 
 // func TestDB_AllAccounts(t *testing.T) {
 // 	type fields struct {
-// 		d kv.RwDB
+// 		d Backend
 // 	}
 // 	type args struct {
-// 		tx kv.Tx
+// 		tx Tx
 // 	}
 // 	tests := []struct {
 // 		name    string
@@ -238,10 +237,10 @@ func TestDB_HasAccount(t *testing.T) {
 
 func TestDB_AllAccountsMap(t *testing.T) {
 	type fields struct {
-		d kv.RwDB
+		d Backend
 	}
 	type args struct {
-		tx kv.Tx
+		tx Tx
 	}
 	tests := []struct {
 		name    string
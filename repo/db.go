@@ -1,15 +1,15 @@
 package repo
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 
-	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/ledgerwatch/erigon-lib/kv"
-	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
 )
 
 type DB struct {
-	d kv.RwDB
+	d Backend
 }
 
 const (
@@ -18,6 +18,28 @@ const (
 	tokenStorage    = "TokenStorage"
 	accountStorage  = "AccountStorage"
 	swapStorage     = "SwapStorage"
+	fundingStorage  = "FundingStorage"
+
+	pairStorage             = "PairStorage"
+	pairIndexStorage        = "PairIndexStorage"
+	priceHistoryStorage     = "PriceHistoryStorage"
+	valuationStorage        = "ValuationStorage"
+	positionStorage         = "PositionStorage"
+	leaderboardStorage      = "LeaderboardStorage"
+	patternBucketStorage    = "PatternBucketStorage"
+	signalStorage           = "SignalStorage"
+	processedTxStorage      = "ProcessedTxStorage"
+	exchangeIDStorage       = "ExchangeIDStorage"
+	exchangeNameStorage     = "ExchangeNameStorage"
+	patternExchangeIndex    = "PatternExchangeIndex"
+	exchangeWalletIndex     = "ExchangeWalletIndex"
+	fundingWalletIndex      = "FundingWalletIndex"
+	receivedBaselineStorage = "ReceivedBaselineStorage"
+	swapWalletIndex         = "SwapWalletIndex"
+	swapTokenIndex          = "SwapTokenIndex"
+	swapBlockIndex          = "SwapBlockIndex"
+	schemaStorage           = "SchemaStorage"
+	headStorage             = "HeadStorage"
 )
 
 var kvTables = []string{
@@ -26,6 +48,27 @@ var kvTables = []string{
 	patternStorage,
 	tokenStorage,
 	swapStorage,
+	fundingStorage,
+	pairStorage,
+	pairIndexStorage,
+	priceHistoryStorage,
+	valuationStorage,
+	positionStorage,
+	leaderboardStorage,
+	patternBucketStorage,
+	signalStorage,
+	processedTxStorage,
+	exchangeIDStorage,
+	exchangeNameStorage,
+	patternExchangeIndex,
+	exchangeWalletIndex,
+	fundingWalletIndex,
+	receivedBaselineStorage,
+	swapWalletIndex,
+	swapTokenIndex,
+	swapBlockIndex,
+	schemaStorage,
+	headStorage,
 }
 
 var kvTablesCfg = kv.TableCfg{
@@ -34,37 +77,80 @@ var kvTablesCfg = kv.TableCfg{
 	patternStorage:  kv.TableCfgItem{},
 	tokenStorage:    kv.TableCfgItem{},
 	swapStorage:     kv.TableCfgItem{},
+	fundingStorage:  kv.TableCfgItem{},
+
+	pairStorage:             kv.TableCfgItem{},
+	pairIndexStorage:        kv.TableCfgItem{},
+	priceHistoryStorage:     kv.TableCfgItem{},
+	valuationStorage:        kv.TableCfgItem{},
+	positionStorage:         kv.TableCfgItem{},
+	leaderboardStorage:      kv.TableCfgItem{},
+	patternBucketStorage:    kv.TableCfgItem{},
+	signalStorage:           kv.TableCfgItem{},
+	processedTxStorage:      kv.TableCfgItem{},
+	exchangeIDStorage:       kv.TableCfgItem{},
+	exchangeNameStorage:     kv.TableCfgItem{},
+	patternExchangeIndex:    kv.TableCfgItem{},
+	exchangeWalletIndex:     kv.TableCfgItem{},
+	fundingWalletIndex:      kv.TableCfgItem{},
+	receivedBaselineStorage: kv.TableCfgItem{},
+	swapWalletIndex:         kv.TableCfgItem{},
+	swapTokenIndex:          kv.TableCfgItem{},
+	swapBlockIndex:          kv.TableCfgItem{},
+	schemaStorage:           kv.TableCfgItem{},
+	headStorage:             kv.TableCfgItem{},
 }
 
+// NewDB opens the mdbx database and migrates it to the current schema.
 func NewDB(path string) (*DB, error) {
-	db, err := mdbx.NewMDBX(nil).Path(path).WithTablessCfg(
-		func(defaultBuckets kv.TableCfg) kv.TableCfg {
-			return kvTablesCfg
-		}).Open()
+	d, err := openMdbx(path, false)
 	if err != nil {
 		return nil, err
 	}
-	return &DB{db}, nil
+	return newDB(d)
 }
 
+// NewDBReadOnly opens the mdbx database for reading, it fails if the database is not of the current schema.
 func NewDBReadOnly(path string) (*DB, error) {
-	db, err := mdbx.NewMDBX(nil).Path(path).WithTablessCfg(
-		func(defaultBuckets kv.TableCfg) kv.TableCfg {
-			return kvTablesCfg
-		}).Readonly().Open()
+	d, err := openMdbx(path, true)
 	if err != nil {
 		return nil, err
 	}
-	return &DB{db}, nil
+
+	db := &DB{d}
+	if err := db.View(context.Background(), db.checkSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// NewMemDB creates empty in-memory DB, it's meant for tests.
+func NewMemDB() *DB {
+	db, err := newDB(newMemBackend())
+	if err != nil {
+		// NOTE: migrations of the empty database never fail.
+		panic(err)
+	}
+	return db
+}
+
+func newDB(d Backend) (*DB, error) {
+	db := &DB{d}
+	if err := db.Update(context.Background(), db.Migrate); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to migrate database: %w", err)
+	}
+	return db, nil
 }
 
 // BeginRo begins read-only transaction.
-func (db *DB) BeginRo(ctx context.Context) (kv.Tx, error) {
+func (db *DB) BeginRo(ctx context.Context) (Tx, error) {
 	return db.d.BeginRo(ctx)
 }
 
 // BeginRw begins read-write transaction.
-func (db *DB) BeginRw(ctx context.Context) (kv.RwTx, error) {
+func (db *DB) BeginRw(ctx context.Context) (RwTx, error) {
 	return db.d.BeginRw(ctx)
 }
 
@@ -74,41 +160,52 @@ func (db *DB) Close() {
 }
 
 // Update starts read-write transaction, for doing many-things.
-func (db *DB) Update(ctx context.Context, f func(tx kv.RwTx) error) (err error) {
-	return db.d.Update(ctx, f)
-}
-
-// View starts read-only transaction, for doing many-things.
-func (db *DB) View(ctx context.Context, f func(tx kv.Tx) error) (err error) {
-	return db.d.View(ctx, f)
-}
+// The transaction is committed if f succeeds and rolled back otherwise.
+func (db *DB) Update(ctx context.Context, f func(tx RwTx) error) (err error) {
+	tx, err := db.d.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-func (db *DB) FlushBucket(tx kv.RwTx, table string) error {
-	return tx.ClearBucket(table)
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (db *DB) Migrate(tx kv.RwTx) error {
-	for i := range kvTables {
-		if err := tx.ClearBucket(kvTables[i]); err != nil {
-			return err
-		}
+// View starts read-only transaction, for doing many-things.
+func (db *DB) View(ctx context.Context, f func(tx Tx) error) (err error) {
+	tx, err := db.d.BeginRo(ctx)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	return f(tx)
 }
 
-// func (db *DB) InsertToken(ctx context.Context) error {
-// 	tx, err := db.d.BeginTx(ctx, &sql.TxOptions{ReadOnly: false})
-// 	if err != nil {
-// 		return err
-// 	}
-// 	defer tx.Rollback()
+// seekAtOrBefore returns the record with the given key or the closest record before it,
+// k is nil if there is no such record.
+func seekAtOrBefore(tx Tx, table string, key []byte) (k, v []byte, err error) {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer c.Close()
 
-// 	if _, err = tx.ExecContext(ctx, ""); err != nil {
-// 		return fmt.Errorf("unable to execute query")
-// 	}
+	k, v, err = c.Seek(key)
+	if err != nil || bytes.Equal(k, key) {
+		return k, v, err
+	}
 
-// 	return tx.Commit()
-// }
+	// NOTE: cursor is positioned after the key, step back to the previous record.
+	if k == nil {
+		return c.Last()
+	}
+	return c.Prev()
+}
 
-// func pgxConnPool() k
+func (db *DB) FlushBucket(tx RwTx, table string) error {
+	return tx.ClearBucket(table)
+}
@@ -22,15 +22,17 @@ func newTestDBInMem() kv.RwDB {
 	return db
 }
 
-func newTestDB(t *testing.T) kv.RwDB {
+func newTestDB(t testing.TB) Backend {
+	// NOTE: test databases are never closed, the small map keeps all of them within the address space.
 	db, err := mdbx.NewMDBX(nil).Path(t.TempDir()).WithTablessCfg(
 		func(defaultBuckets kv.TableCfg) kv.TableCfg {
 			return kvTablesCfg
-		}).Open()
+		},
+	).MapSize(1 << 30).Open()
 	if err != nil {
 		panic(err)
 	}
-	return db
+	return mdbxBackend{db}
 }
 
 func Test_Has(t *testing.T) {
@@ -1,51 +1,126 @@
 package repo
 
 import (
+	"encoding/binary"
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ledgerwatch/erigon-lib/kv"
 )
 
-// Exchange is CEX.
+// Exchange is CEX hot wallet.
 type Exchange struct {
+	// ID is the stable ID of the exchange, it is assigned by Name on put.
+	ID uint32 `json:"ID,omitempty"`
 	// Name is value corresponding to the Address.
 	Name string `json:"Name"`
 	// We use Address as key in our storage layout.
 	Address common.Address `json:"Address"`
 }
 
+// Hot wallets are stored as
+//
+//	exchangeStorage:     address -> exchange ID
+//	exchangeWalletIndex: exchange ID | address
+//
+// so that the exchange is renamed without touching it's hot wallets.
+
+func exchangeWalletKey(id uint32, addr common.Address) []byte {
+	k := make([]byte, exchangeIDLength+common.AddressLength)
+	binary.BigEndian.PutUint32(k, id)
+	copy(k[exchangeIDLength:], addr.Bytes())
+	return k
+}
+
 // PutExchange inserts Exchange into the storage.
-func (db *DB) PutExchange(tx kv.RwTx, e Exchange) error {
-	if err := tx.Put(exchangeStorage, e.Address.Bytes(), []byte(e.Name)); err != nil {
+func (db *DB) PutExchange(tx RwTx, e Exchange) error {
+	id, err := db.assignExchangeID(tx, e.Name)
+	if err != nil {
+		return err
+	}
+	if err := putHotWallet(tx, e.Address, id); err != nil {
 		return fmt.Errorf("unable to put exchange=%v, err=%w", e, err)
 	}
 
 	return nil
 }
 
+// putHotWallet attaches the address to the exchange ID, detaching it from the previous exchange.
+func putHotWallet(tx RwTx, addr common.Address, id uint32) error {
+	if err := deleteHotWallet(tx, addr); err != nil {
+		return err
+	}
+	if err := tx.Put(exchangeStorage, addr.Bytes(), exchangeIDKey(id)); err != nil {
+		return err
+	}
+	return tx.Put(exchangeWalletIndex, exchangeWalletKey(id, addr), []byte{})
+}
+
+func deleteHotWallet(tx RwTx, addr common.Address) error {
+	v, err := tx.GetOne(exchangeStorage, addr.Bytes())
+	if err != nil || len(v) != exchangeIDLength {
+		return err
+	}
+	if err := tx.Delete(exchangeWalletIndex, exchangeWalletKey(binary.BigEndian.Uint32(v), addr), nil); err != nil {
+		return err
+	}
+	return tx.Delete(exchangeStorage, addr.Bytes(), nil)
+}
+
+// DeleteExchange deletes the hot wallet, the exchange keeps it's ID and history.
+func (db *DB) DeleteExchange(tx RwTx, addr common.Address) error {
+	if err := deleteHotWallet(tx, addr); err != nil {
+		return fmt.Errorf("unable to delete exchange by address=%v, err=%w", addr, err)
+	}
+	return nil
+}
+
 // PeekExchange retrieves Exchange from the storage by give address.
-func (db *DB) PeekExchange(tx kv.Tx, addr common.Address) (Exchange, error) {
+func (db *DB) PeekExchange(tx Tx, addr common.Address) (Exchange, error) {
 	val, err := tx.GetOne(exchangeStorage, addr.Bytes())
 	if err != nil {
 		return Exchange{}, fmt.Errorf("unable to get exchange by address=%v, err=%w", addr, err)
 	}
+	if val == nil {
+		return Exchange{Address: addr}, nil
+	}
+
+	return db.decodeExchange(tx, make(exchangeNames), addr.Bytes(), val)
+}
+
+func (db *DB) decodeExchange(tx Tx, names exchangeNames, k, v []byte) (Exchange, error) {
+	if len(v) != exchangeIDLength {
+		return Exchange{}, fmt.Errorf("invalid exchange ID of hot wallet %x: %x", k, v)
+	}
+	id := binary.BigEndian.Uint32(v)
+	name, err := names.name(db, tx, id)
+	if err != nil {
+		return Exchange{}, err
+	}
 
 	return Exchange{
-		Name:    string(val),
-		Address: addr,
+		ID:      id,
+		Name:    name,
+		Address: common.BytesToAddress(k),
 	}, nil
 }
 
+// IterExchanges calls f for exchanges ordered by address, Start of the options is the address bytes.
+func (db *DB) IterExchanges(tx Tx, opts IterOptions, f func(Exchange) error) error {
+	names := make(exchangeNames)
+	return iterate(tx, exchangeStorage, opts, func(k, v []byte) error {
+		e, err := db.decodeExchange(tx, names, k, v)
+		if err != nil {
+			return err
+		}
+		return f(e)
+	})
+}
+
 // AllExchanges returns all exchanges stored in the exchangeStorage.
-func (db *DB) AllExchanges(tx kv.Tx) ([]Exchange, error) {
+func (db *DB) AllExchanges(tx Tx) ([]Exchange, error) {
 	var exchanges []Exchange
-	if err := tx.ForEach(exchangeStorage, []byte{}, func(k, v []byte) error {
-		exchanges = append(exchanges, Exchange{
-			Name:    string(v),
-			Address: common.BytesToAddress(k),
-		})
-
+	if err := db.IterExchanges(tx, IterOptions{}, func(e Exchange) error {
+		exchanges = append(exchanges, e)
 		return nil
 	}); err != nil {
 		return nil, err
@@ -55,15 +130,10 @@ func (db *DB) AllExchanges(tx kv.Tx) ([]Exchange, error) {
 }
 
 // AllExchangesMap returns all exchanges in map being mapped to their addresses.
-func (db *DB) AllExchangesMap(tx kv.Tx) (map[common.Address]Exchange, error) {
+func (db *DB) AllExchangesMap(tx Tx) (map[common.Address]Exchange, error) {
 	exchanges := make(map[common.Address]Exchange)
-	if err := tx.ForEach(exchangeStorage, []byte{}, func(k, v []byte) error {
-		addr := common.BytesToAddress(k)
-
-		exchanges[addr] = Exchange{
-			Name:    string(v),
-			Address: addr,
-		}
+	if err := db.IterExchanges(tx, IterOptions{}, func(e Exchange) error {
+		exchanges[e.Address] = e
 		return nil
 	}); err != nil {
 		return nil, err
@@ -71,3 +141,15 @@ func (db *DB) AllExchangesMap(tx kv.Tx) (map[common.Address]Exchange, error) {
 
 	return exchanges, nil
 }
+
+// HotWallets returns hot wallet addresses of the exchange ID ordered by address.
+func (db *DB) HotWallets(tx Tx, id uint32) ([]common.Address, error) {
+	var wallets []common.Address
+	if err := tx.ForPrefix(exchangeWalletIndex, exchangeIDKey(id), func(k, _ []byte) error {
+		wallets = append(wallets, common.BytesToAddress(k[exchangeIDLength:]))
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through hot wallets of exchange %d: %w", id, err)
+	}
+	return wallets, nil
+}
@@ -0,0 +1,457 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/internal/cbor"
+)
+
+var (
+	// ErrUnknownExchange is returned when the exchange name has no ID.
+	ErrUnknownExchange = errors.New("unknown exchange")
+	// ErrExchangeExists is returned when the exchange is renamed to the name of another exchange.
+	ErrExchangeExists = errors.New("exchange already exists")
+)
+
+// Exchange IDs are small stable numbers standing for the exchange names in the records,
+//
+//	exchangeIDStorage:   name -> id
+//	exchangeNameStorage: id -> name
+//
+// with big-endian uint32 ids. IDs are assigned in order starting at 1, zero stands for no exchange.
+// Accounts, fundings, patterns and pattern buckets store the IDs, so renaming the exchange keeps them attached.
+
+// exchangeIDLength is the length of the encoded exchange ID.
+const exchangeIDLength = 4
+
+func exchangeIDKey(id uint32) []byte {
+	k := make([]byte, exchangeIDLength)
+	binary.BigEndian.PutUint32(k, id)
+	return k
+}
+
+// ExchangeID returns the ID of the exchange name, ok is false if it has none.
+func (db *DB) ExchangeID(tx Tx, name string) (id uint32, ok bool, err error) {
+	v, err := tx.GetOne(exchangeIDStorage, []byte(name))
+	if err != nil {
+		return 0, false, fmt.Errorf("could not get ID of exchange %q: %w", name, err)
+	}
+	if len(v) != exchangeIDLength {
+		return 0, false, nil
+	}
+	return binary.BigEndian.Uint32(v), true, nil
+}
+
+// ExchangeName returns the name of the exchange ID.
+func (db *DB) ExchangeName(tx Tx, id uint32) (string, error) {
+	if id == 0 {
+		return "", nil
+	}
+	v, err := tx.GetOne(exchangeNameStorage, exchangeIDKey(id))
+	if err != nil {
+		return "", fmt.Errorf("could not get name of exchange %d: %w", id, err)
+	}
+	if v == nil {
+		return "", fmt.Errorf("unknown exchange ID %d", id)
+	}
+	return string(v), nil
+}
+
+// assignExchangeID returns the ID of the exchange name, the next ID is assigned if it has none.
+func (db *DB) assignExchangeID(tx RwTx, name string) (uint32, error) {
+	if name == "" {
+		return 0, nil
+	}
+	id, ok, err := db.ExchangeID(tx, name)
+	if err != nil || ok {
+		return id, err
+	}
+
+	c, err := tx.Cursor(exchangeNameStorage)
+	if err != nil {
+		return 0, fmt.Errorf("could not open exchange names cursor: %w", err)
+	}
+	last, _, err := c.Last()
+	c.Close()
+	if err != nil {
+		return 0, fmt.Errorf("could not find last exchange ID: %w", err)
+	}
+	id = 1
+	if last != nil {
+		id = binary.BigEndian.Uint32(last) + 1
+	}
+
+	if err := putExchangeID(tx, id, name); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func putExchangeID(tx RwTx, id uint32, name string) error {
+	if err := tx.Put(exchangeIDStorage, []byte(name), exchangeIDKey(id)); err != nil {
+		return fmt.Errorf("unable to put ID of exchange %q: %w", name, err)
+	}
+	if err := tx.Put(exchangeNameStorage, exchangeIDKey(id), []byte(name)); err != nil {
+		return fmt.Errorf("unable to put name of exchange %d: %w", id, err)
+	}
+	return nil
+}
+
+// exchangeNames caches names of the exchange IDs seen by a single scan.
+type exchangeNames map[uint32]string
+
+func (n exchangeNames) name(db *DB, tx Tx, id uint32) (string, error) {
+	if name, ok := n[id]; ok {
+		return name, nil
+	}
+	name, err := db.ExchangeName(tx, id)
+	if err != nil {
+		return "", err
+	}
+	n[id] = name
+	return name, nil
+}
+
+// ExchangeEntity is the exchange with it's hot wallets.
+type ExchangeEntity struct {
+	ID         uint32
+	Name       string
+	HotWallets []common.Address
+}
+
+// ExchangeEntities returns exchanges ordered by ID.
+func (db *DB) ExchangeEntities(tx Tx) ([]ExchangeEntity, error) {
+	var entities []ExchangeEntity
+	if err := tx.ForEach(exchangeNameStorage, []byte{}, func(k, v []byte) error {
+		e := ExchangeEntity{ID: binary.BigEndian.Uint32(k), Name: string(v)}
+		wallets, err := db.HotWallets(tx, e.ID)
+		if err != nil {
+			return err
+		}
+		e.HotWallets = wallets
+		entities = append(entities, e)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through exchanges: %w", err)
+	}
+	return entities, nil
+}
+
+// RenameExchange renames the exchange, it's hot wallets and history stay attached to the same ID.
+func (db *DB) RenameExchange(tx RwTx, from, to string) error {
+	if to == "" {
+		return errors.New("empty exchange name")
+	}
+	id, ok, err := db.ExchangeID(tx, from)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownExchange, from)
+	}
+	if _, ok, err := db.ExchangeID(tx, to); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("%w: %q, merge the exchanges instead", ErrExchangeExists, to)
+	}
+
+	if err := tx.Delete(exchangeIDStorage, []byte(from), nil); err != nil {
+		return fmt.Errorf("unable to delete ID of exchange %q: %w", from, err)
+	}
+	return putExchangeID(tx, id, to)
+}
+
+// MergeExchanges moves hot wallets, accounts, fundings, patterns and pattern buckets of the exchange from
+// to the exchange into and deletes the exchange from. Patterns and buckets of both exchanges are summed.
+// NOTE: the leaderboard and signals are snapshots, they keep the old name until they are recomputed.
+func (db *DB) MergeExchanges(tx RwTx, from, into string) error {
+	if from == into {
+		return fmt.Errorf("can't merge exchange %q into itself", from)
+	}
+	var ids [2]uint32
+	for i, name := range []string{from, into} {
+		id, ok, err := db.ExchangeID(tx, name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w %q", ErrUnknownExchange, name)
+		}
+		ids[i] = id
+	}
+
+	for _, move := range []func(tx RwTx, from, into uint32) error{
+		moveHotWallets,
+		moveAccounts,
+		moveFundings,
+		movePatterns,
+		movePatternBuckets,
+	} {
+		if err := move(tx, ids[0], ids[1]); err != nil {
+			return fmt.Errorf("unable to merge exchange %q into %q: %w", from, into, err)
+		}
+	}
+
+	if err := tx.Delete(exchangeIDStorage, []byte(from), nil); err != nil {
+		return fmt.Errorf("unable to delete ID of exchange %q: %w", from, err)
+	}
+	if err := tx.Delete(exchangeNameStorage, exchangeIDKey(ids[0]), nil); err != nil {
+		return fmt.Errorf("unable to delete name of exchange %d: %w", ids[0], err)
+	}
+	return nil
+}
+
+func moveHotWallets(tx RwTx, from, into uint32) error {
+	var wallets []common.Address
+	if err := tx.ForPrefix(exchangeWalletIndex, exchangeIDKey(from), func(k, _ []byte) error {
+		wallets = append(wallets, common.BytesToAddress(k[exchangeIDLength:]))
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, addr := range wallets {
+		if err := putHotWallet(tx, addr, into); err != nil {
+			return fmt.Errorf("unable to move hot wallet %v: %w", addr, err)
+		}
+	}
+	return nil
+}
+
+func moveAccounts(tx RwTx, from, into uint32) error {
+	accounts := make(map[common.Address]_account)
+	if err := tx.ForEach(accountStorage, []byte{}, func(k, v []byte) error {
+		var a _account
+		if err := cbor.Unmarshal(bytes.NewReader(v), &a); err != nil {
+			return fmt.Errorf("unable to unmarshal account value: %w", err)
+		}
+		if a.ExchangeID == from {
+			a.ExchangeID = into
+			accounts[common.BytesToAddress(k)] = a
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for addr, a := range accounts {
+		if err := putAccountRecord(tx, addr, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func moveFundings(tx RwTx, from, into uint32) error {
+	fundings := make(map[common.Hash]_funding)
+	if err := tx.ForEach(fundingStorage, []byte{}, func(k, v []byte) error {
+		var f _funding
+		if err := cbor.Unmarshal(bytes.NewReader(v), &f); err != nil {
+			return fmt.Errorf("unable to decode funding record: %w", err)
+		}
+		if f.ExchangeID == from {
+			f.ExchangeID = into
+			fundings[common.BytesToHash(k)] = f
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for txHash, f := range fundings {
+		if err := putFundingRecord(tx, txHash, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func movePatterns(tx RwTx, from, into uint32) error {
+	var tokens []common.Address
+	if err := tx.ForPrefix(patternExchangeIndex, exchangeIDKey(from), func(k, _ []byte) error {
+		tokens = append(tokens, common.BytesToAddress(k[exchangeIDLength:]))
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		value, err := sumPatternValues(tx, patternStorage, patternKey(token, from), patternKey(token, into))
+		if err != nil {
+			return err
+		}
+		if err := putPatternRecord(tx, token, into, value); err != nil {
+			return err
+		}
+		if err := tx.Delete(patternStorage, patternKey(token, from), nil); err != nil {
+			return fmt.Errorf("unable to delete pattern: %w", err)
+		}
+		if err := tx.Delete(patternExchangeIndex, patternIndexKey(from, token), nil); err != nil {
+			return fmt.Errorf("unable to delete pattern index entry: %w", err)
+		}
+	}
+	return nil
+}
+
+func movePatternBuckets(tx RwTx, from, into uint32) error {
+	var keys [][]byte
+	if err := tx.ForEach(patternBucketStorage, []byte{}, func(k, _ []byte) error {
+		if len(k) == patternBucketKeyLength && binary.BigEndian.Uint32(k[patternBucketKeyLength-exchangeIDLength:]) == from {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		intoKey := append([]byte(nil), k...)
+		binary.BigEndian.PutUint32(intoKey[patternBucketKeyLength-exchangeIDLength:], into)
+		value, err := sumPatternValues(tx, patternBucketStorage, k, intoKey)
+		if err != nil {
+			return err
+		}
+		if err := putPatternBucketRecord(tx, intoKey, value); err != nil {
+			return err
+		}
+		if err := tx.Delete(patternBucketStorage, k, nil); err != nil {
+			return fmt.Errorf("unable to delete pattern bucket: %w", err)
+		}
+	}
+	return nil
+}
+
+// sumPatternValues sums pattern values stored in the table by the keys, missing keys count as zero.
+func sumPatternValues(tx Tx, table string, keys ...[]byte) (_patternValue, error) {
+	sum := new(big.Int)
+	var times int
+	for _, k := range keys {
+		v, err := tx.GetOne(table, k)
+		if err != nil {
+			return _patternValue{}, fmt.Errorf("could not get pattern value: %w", err)
+		}
+		if v == nil {
+			continue
+		}
+		var value _patternValue
+		if err := cbor.Unmarshal(bytes.NewReader(v), &value); err != nil {
+			return _patternValue{}, fmt.Errorf("could not unmarshal pattern value: %w", err)
+		}
+		sum.Add(sum, new(big.Int).SetBytes(value.Value))
+		times += value.TimesOccured
+	}
+	return _patternValue{Value: sum.Bytes(), TimesOccured: times}, nil
+}
+
+// migrateExchangeIDs replaces exchange names stored in the hot wallets, accounts, fundings and pattern buckets
+// with the exchange IDs.
+func (db *DB) migrateExchangeIDs(tx RwTx) error {
+	// NOTE: records are collected in key order, so that the new IDs are assigned in it as well.
+	type wallet struct {
+		addr common.Address
+		name string
+	}
+	var wallets []wallet
+	if err := tx.ForEach(exchangeStorage, []byte{}, func(k, v []byte) error {
+		wallets = append(wallets, wallet{common.BytesToAddress(k), string(v)})
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to iterate through exchanges: %w", err)
+	}
+	for _, w := range wallets {
+		id, err := db.assignExchangeID(tx, w.name)
+		if err != nil {
+			return err
+		}
+		// NOTE: the stored value is the name, putHotWallet would look it up as the ID.
+		if err := tx.Put(exchangeStorage, w.addr.Bytes(), exchangeIDKey(id)); err != nil {
+			return fmt.Errorf("unable to put hot wallet %v: %w", w.addr, err)
+		}
+		if err := tx.Put(exchangeWalletIndex, exchangeWalletKey(id, w.addr), []byte{}); err != nil {
+			return fmt.Errorf("unable to put hot wallet index entry: %w", err)
+		}
+	}
+
+	type account struct {
+		addr common.Address
+		_namedAccount
+	}
+	var accounts []account
+	if err := tx.ForEach(accountStorage, []byte{}, func(k, v []byte) error {
+		a := account{addr: common.BytesToAddress(k)}
+		if err := cbor.Unmarshal(bytes.NewReader(v), &a._namedAccount); err != nil {
+			return fmt.Errorf("unable to unmarshal account value: %w", err)
+		}
+		accounts = append(accounts, a)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, a := range accounts {
+		id, err := db.assignExchangeID(tx, a.Exchange)
+		if err != nil {
+			return err
+		}
+		if err := putAccountRecord(tx, a.addr, _account{Balance: a.Balance, Received: a.Received, Spent: a.Spent, ExchangeID: id}); err != nil {
+			return err
+		}
+	}
+
+	type funding struct {
+		txHash common.Hash
+		_namedFunding
+	}
+	var fundings []funding
+	if err := tx.ForEach(fundingStorage, []byte{}, func(k, v []byte) error {
+		f := funding{txHash: common.BytesToHash(k)}
+		if err := cbor.Unmarshal(bytes.NewReader(v), &f._namedFunding); err != nil {
+			return fmt.Errorf("unable to decode funding record: %w", err)
+		}
+		fundings = append(fundings, f)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, f := range fundings {
+		id, err := db.assignExchangeID(tx, f.Exchange)
+		if err != nil {
+			return err
+		}
+		if err := putFundingRecord(tx, f.txHash, _funding{
+			ExchangeID:  id,
+			Wallet:      f.Wallet,
+			Value:       f.Value,
+			BlockNumber: f.BlockNumber,
+			Timestamp:   f.Timestamp,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// NOTE: bucket keys were resolution | bucket | token | exchange name.
+	var buckets [][2][]byte
+	if err := tx.ForEach(patternBucketStorage, []byte{}, func(k, v []byte) error {
+		if len(k) < 1+8+common.AddressLength {
+			return fmt.Errorf("invalid pattern bucket key: %x", k)
+		}
+		buckets = append(buckets, [2][]byte{append([]byte(nil), k...), append([]byte(nil), v...)})
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := tx.ClearBucket(patternBucketStorage); err != nil {
+		return fmt.Errorf("unable to clear pattern buckets: %w", err)
+	}
+	for _, b := range buckets {
+		k, v := b[0], b[1]
+		id, err := db.assignExchangeID(tx, string(k[29:]))
+		if err != nil {
+			return err
+		}
+		key := patternBucketKey(Resolution(k[0]), binary.BigEndian.Uint64(k[1:9]), common.BytesToAddress(k[9:29]), id)
+		if err := tx.Put(patternBucketStorage, key, v); err != nil {
+			return fmt.Errorf("unable to put pattern bucket: %w", err)
+		}
+	}
+	return nil
+}
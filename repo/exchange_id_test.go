@@ -0,0 +1,147 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDB_RenameExchange(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	var (
+		hot    = common.BytesToAddress([]byte("hot"))
+		wallet = common.BytesToAddress([]byte("wallet"))
+		token  = common.BytesToAddress([]byte("token"))
+	)
+	err := db.Update(context.Background(), func(tx RwTx) error {
+		for _, err := range []error{
+			db.PutExchange(tx, Exchange{Name: "Kraken", Address: common.BytesToAddress([]byte("kraken"))}),
+			db.PutExchange(tx, Exchange{Name: "Binance 14", Address: hot}),
+			db.PutAccount(tx, Account{Address: wallet, Balance: big.NewInt(0), Received: big.NewInt(1e18), Spent: big.NewInt(0), Exchange: "Binance 14"}),
+			db.PutPattern(tx, Pattern{TokenAddr: token, ExchangeName: "Binance 14", Value: big.NewInt(1e18), TimesOccured: 1}),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+		return db.RenameExchange(tx, "Binance 14", "Binance")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Update(context.Background(), func(tx RwTx) error {
+		if err := db.RenameExchange(tx, "Binance 14", "Binance"); !errors.Is(err, ErrUnknownExchange) {
+			t.Errorf("DB.RenameExchange(Binance 14) error = %v, want ErrUnknownExchange", err)
+		}
+		if err := db.RenameExchange(tx, "Binance", "Kraken"); !errors.Is(err, ErrExchangeExists) {
+			t.Errorf("DB.RenameExchange(Binance, Kraken) error = %v, want ErrExchangeExists", err)
+		}
+
+		e, err := db.PeekExchange(tx, hot)
+		if err != nil {
+			return err
+		}
+		if want := (Exchange{ID: 2, Name: "Binance", Address: hot}); e != want {
+			t.Errorf("DB.PeekExchange() = %v, want %v", e, want)
+		}
+		acc, err := db.PeekAccount(tx, wallet)
+		if err != nil {
+			return err
+		}
+		if acc.Exchange != "Binance" {
+			t.Errorf("DB.PeekAccount().Exchange = %q, want Binance", acc.Exchange)
+		}
+		patterns, err := db.PatternsByExchange(tx, "Binance")
+		if err != nil {
+			return err
+		}
+		if len(patterns) != 1 || patterns[0].TokenAddr != token {
+			t.Errorf("DB.PatternsByExchange() = %v, want pattern of %v", patterns, token)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_MergeExchanges(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	wallet, token := fillIntegrityDB(t, db)
+	var (
+		hot0 = common.BytesToAddress([]byte("hot0"))
+		hot1 = common.BytesToAddress([]byte("hot1"))
+	)
+	// NOTE: the wallet and half of it's swaps are attributed to the duplicate exchange.
+	err := db.Update(context.Background(), func(tx RwTx) error {
+		if err := tx.ClearBucket(patternBucketStorage); err != nil {
+			return err
+		}
+		for _, err := range []error{
+			db.PutExchange(tx, Exchange{Name: "Binance", Address: hot0}),
+			db.PutExchange(tx, Exchange{Name: "Binance 14", Address: hot1}),
+			db.PutFunding(tx, Funding{TxHash: common.HexToHash("0xf0"), Exchange: "Binance 14", Wallet: wallet, Value: big.NewInt(3e18), BlockNumber: 9}),
+			db.PutAccount(tx, Account{Address: wallet, Balance: big.NewInt(0), Received: big.NewInt(3e18), Spent: big.NewInt(2e18), Exchange: "Binance 14"}),
+			db.PutPattern(tx, Pattern{TokenAddr: token, ExchangeName: "Binance", Value: big.NewInt(1e18), TimesOccured: 1}),
+			db.PutPattern(tx, Pattern{TokenAddr: token, ExchangeName: "Binance 14", Value: big.NewInt(1e18), TimesOccured: 1}),
+			db.AddPatternBuckets(tx, token, "Binance", big.NewInt(1e18), time.Unix(1600000000, 0)),
+			db.AddPatternBuckets(tx, token, "Binance 14", big.NewInt(1e18), time.Unix(1600000013, 0)),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := db.MergeExchanges(tx, "Binance", "Binance"); err == nil {
+			t.Error("DB.MergeExchanges() into itself succeeded")
+		}
+		if err := db.MergeExchanges(tx, "Binance 15", "Binance"); !errors.Is(err, ErrUnknownExchange) {
+			t.Errorf("DB.MergeExchanges(Binance 15) error = %v, want ErrUnknownExchange", err)
+		}
+		return db.MergeExchanges(tx, "Binance 14", "Binance")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	mismatches, err := db.Check(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("DB.Check() = %v, want no mismatches", mismatches)
+	}
+
+	entities, err := db.ExchangeEntities(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ExchangeEntity{{ID: 1, Name: "Binance", HotWallets: []common.Address{hot0, hot1}}}
+	if !cmp.Equal(entities, want) {
+		t.Errorf("DB.ExchangeEntities() = %v, want %v", entities, want)
+	}
+
+	fundings, err := db.AllFundings(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fundings) != 1 || fundings[0].Exchange != "Binance" {
+		t.Errorf("DB.AllFundings() = %v, want funding of Binance", fundings)
+	}
+}
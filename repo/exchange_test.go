@@ -10,7 +10,6 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
-	"github.com/ledgerwatch/erigon-lib/kv"
 )
 
 func testDB_PutExchange(t *testing.T, db *DB, e Exchange, wantErr bool) {
@@ -47,10 +46,10 @@ func testDB_PutManyExchanges(t *testing.T, db *DB, exchanges []Exchange) {
 func TestDB_PutPeekExchange(t *testing.T) {
 	t.Parallel()
 	type fields struct {
-		d kv.RwDB
+		d Backend
 	}
 	type args struct {
-		tx   kv.Tx
+		tx   Tx
 		addr common.Address
 	}
 	tests := []struct {
@@ -125,7 +124,7 @@ func TestDB_PutPeekExchange(t *testing.T) {
 				t.Errorf("DB.PeekExchange() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !cmp.Equal(got, tt.want) {
+			if !cmp.Equal(got, tt.want, cmpopts.IgnoreFields(Exchange{}, "ID")) {
 				t.Errorf("DB.PeekExchange() = %v, want %v", got, tt.want)
 			}
 
@@ -160,10 +159,10 @@ func testdata_mapOfExchanges() map[common.Address]Exchange {
 
 func TestDB_AllExchanges(t *testing.T) {
 	type fields struct {
-		d kv.RwDB
+		d Backend
 	}
 	type args struct {
-		tx kv.RwTx
+		tx RwTx
 	}
 	tests := []struct {
 		name    string
@@ -199,7 +198,7 @@ func TestDB_AllExchanges(t *testing.T) {
 				return
 			}
 
-			if !cmp.Equal(got, tt.want, cmpopts.SortSlices(func(x, y Exchange) bool {
+			if !cmp.Equal(got, tt.want, cmpopts.IgnoreFields(Exchange{}, "ID"), cmpopts.SortSlices(func(x, y Exchange) bool {
 				xBig, yBig := new(big.Int).SetBytes(x.Address[:]), new(big.Int).SetBytes(y.Address[:])
 				return xBig.Cmp(yBig) >= 0
 			})) {
@@ -212,10 +211,10 @@ func TestDB_AllExchanges(t *testing.T) {
 
 func TestDB_AllExchangesMap(t *testing.T) {
 	type fields struct {
-		d kv.RwDB
+		d Backend
 	}
 	type args struct {
-		tx kv.RwTx
+		tx RwTx
 	}
 	tests := []struct {
 		name    string
@@ -250,7 +249,7 @@ func TestDB_AllExchangesMap(t *testing.T) {
 				return
 			}
 
-			if !cmp.Equal(got, tt.want, cmpopts.SortMaps(func(x, y common.Address) bool {
+			if !cmp.Equal(got, tt.want, cmpopts.IgnoreFields(Exchange{}, "ID"), cmpopts.SortMaps(func(x, y common.Address) bool {
 				xBig, yBig := new(big.Int).SetBytes(x[:]), new(big.Int).SetBytes(y[:])
 				return xBig.Cmp(yBig) >= 0
 			})) {
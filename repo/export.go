@@ -0,0 +1,549 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Format is the encoding of the exported records.
+type Format string
+
+const (
+	// NDJSON is one JSON object per line.
+	NDJSON Format = "ndjson"
+	// CSV has the header with column names followed by one record per line,
+	// list columns are JSON arrays.
+	CSV Format = "csv"
+)
+
+// ParseFormat returns the Format of the given name.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case NDJSON, CSV:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown format %q", name)
+	}
+}
+
+// kind is the type of the exported column.
+type kind int
+
+const (
+	kindString kind = iota
+	// kindAddress is EIP-55 checksummed address.
+	kindAddress
+	kindHash
+	// kindBig is non-negative big integer as decimal string, nil is null or empty.
+	kindBig
+	kindUint
+	kindInt
+	kindFloat
+	kindBool
+	kindAddresses
+	kindHashes
+	kindStrings
+)
+
+// literal reports whether the values are JSON literals rather than strings.
+func (k kind) literal() bool {
+	return k >= kindUint && k <= kindBool
+}
+
+func (k kind) list() bool {
+	return k >= kindAddresses
+}
+
+type column struct {
+	name string
+	kind kind
+}
+
+// row is the record of the exported table, values are in the column order.
+type row []interface{}
+
+// exportTable converts records of the kv table to rows and back.
+type exportTable struct {
+	name    string
+	table   string
+	columns []column
+	// encode converts the kv entry to the row.
+	encode func(k, v []byte) (row, error)
+	// put writes the validated row.
+	put func(db *DB, tx RwTx, r row) error
+	// usd are the columns of the amounts valued in USD at the blocks they were moved at, they follow the
+	// stored columns. They are derived from the valuations, so the import validates and ignores them.
+	usd []column
+	// valueUSD returns values of the usd columns of the row.
+	valueUSD func(vals *valuer, r row) (row, error)
+}
+
+// allColumns returns the stored columns followed by the usd columns.
+func (t *exportTable) allColumns() []column {
+	return append(append([]column{}, t.columns...), t.usd...)
+}
+
+// ExportTables returns names of the exported tables in the order they should be imported.
+// Secondary indexes are not exported, they are rebuilt by the import.
+func ExportTables() []string {
+	names := make([]string, len(exportTables))
+	for i, t := range exportTables {
+		names[i] = t.name
+	}
+	return names
+}
+
+func lookupExportTable(name string) (*exportTable, error) {
+	for i := range exportTables {
+		if exportTables[i].name == name {
+			return &exportTables[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown table %q", name)
+}
+
+// Export writes every record of the table to w, it returns the number of written records.
+func (db *DB) Export(tx Tx, table string, format Format, w io.Writer) (int, error) {
+	t, err := lookupExportTable(table)
+	if err != nil {
+		return 0, err
+	}
+
+	var enc rowEncoder
+	switch format {
+	case NDJSON:
+		enc = &jsonEncoder{w: bufio.NewWriter(w), columns: t.allColumns()}
+	case CSV:
+		enc = &csvEncoder{w: csv.NewWriter(w), columns: t.allColumns()}
+	default:
+		return 0, fmt.Errorf("unknown format %q", format)
+	}
+
+	vals := db.newValuer(tx)
+	var n int
+	if err := tx.ForEach(t.table, []byte{}, func(k, v []byte) error {
+		r, err := t.encode(k, v)
+		if err != nil {
+			return err
+		}
+		if t.valueUSD != nil {
+			usd, err := t.valueUSD(vals, r)
+			if err != nil {
+				return err
+			}
+			r = append(r, usd...)
+		}
+		if err := enc.encode(r); err != nil {
+			return fmt.Errorf("unable to write %s record: %w", t.name, err)
+		}
+		n++
+		return nil
+	}); err != nil {
+		return n, fmt.Errorf("unable to export %s: %w", t.name, err)
+	}
+	return n, enc.flush()
+}
+
+// Import validates records read from r and puts them into the table, records with the same key are overwritten.
+// It returns the number of imported records, the first invalid record fails the import.
+func (db *DB) Import(tx RwTx, table string, format Format, r io.Reader) (int, error) {
+	t, err := lookupExportTable(table)
+	if err != nil {
+		return 0, err
+	}
+
+	var dec rowDecoder
+	switch format {
+	case NDJSON:
+		s := bufio.NewScanner(r)
+		s.Buffer(nil, 16<<20)
+		dec = &jsonDecoder{s: s, columns: t.columns, usd: t.usd}
+	case CSV:
+		// NOTE: the number of fields is set by the header, the usd columns are optional.
+		dec = &csvDecoder{r: csv.NewReader(r), columns: t.columns, usd: t.usd}
+	default:
+		return 0, fmt.Errorf("unknown format %q", format)
+	}
+
+	var n int
+	for {
+		r, line, err := dec.decode()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err == nil {
+			err = t.put(db, tx, r)
+		}
+		if err != nil {
+			return n, fmt.Errorf("%s line %d: %w", t.name, line, err)
+		}
+		n++
+	}
+}
+
+type rowEncoder interface {
+	encode(r row) error
+	flush() error
+}
+
+type rowDecoder interface {
+	// decode returns the next row of the stored columns and it's line number, io.EOF after the last row.
+	// The usd columns are validated if present and dropped.
+	decode() (row, int, error)
+}
+
+type jsonEncoder struct {
+	w       *bufio.Writer
+	columns []column
+}
+
+// encode writes the row as JSON object with keys in the column order.
+func (e *jsonEncoder) encode(r row) error {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, col := range e.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(col.name)
+		buf.Write(name)
+		buf.WriteByte(':')
+
+		val, err := jsonValue(col.kind, r[i])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.name, err)
+		}
+		buf.Write(val)
+	}
+	buf.WriteString("}\n")
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+func (e *jsonEncoder) flush() error {
+	return e.w.Flush()
+}
+
+func jsonValue(k kind, v interface{}) ([]byte, error) {
+	switch {
+	case k.list():
+		return json.Marshal(formatList(k, v))
+	case k == kindBig && v.(*big.Int) == nil:
+		return []byte("null"), nil
+	case k.literal():
+		s := formatValue(k, v)
+		if !json.Valid([]byte(s)) {
+			return nil, fmt.Errorf("%s is not valid JSON", s)
+		}
+		return []byte(s), nil
+	default:
+		return json.Marshal(formatValue(k, v))
+	}
+}
+
+type jsonDecoder struct {
+	s       *bufio.Scanner
+	columns []column
+	usd     []column
+	line    int
+}
+
+func (d *jsonDecoder) decode() (row, int, error) {
+	var obj map[string]json.RawMessage
+	for {
+		if !d.s.Scan() {
+			if err := d.s.Err(); err != nil {
+				return nil, d.line, err
+			}
+			return nil, d.line, io.EOF
+		}
+		d.line++
+		if len(bytes.TrimSpace(d.s.Bytes())) > 0 {
+			break
+		}
+	}
+	if err := json.Unmarshal(d.s.Bytes(), &obj); err != nil {
+		return nil, d.line, err
+	}
+	want := len(d.columns)
+	for _, col := range d.usd {
+		if raw, ok := obj[col.name]; ok {
+			if _, err := parseJSONValue(col.kind, raw); err != nil {
+				return nil, d.line, fmt.Errorf("column %s: %w", col.name, err)
+			}
+			want++
+		}
+	}
+	if len(obj) != want {
+		return nil, d.line, fmt.Errorf("expected %d columns, got %d", want, len(obj))
+	}
+
+	r := make(row, len(d.columns))
+	for i, col := range d.columns {
+		raw, ok := obj[col.name]
+		if !ok {
+			return nil, d.line, fmt.Errorf("missing column %s", col.name)
+		}
+		v, err := parseJSONValue(col.kind, raw)
+		if err != nil {
+			return nil, d.line, fmt.Errorf("column %s: %w", col.name, err)
+		}
+		r[i] = v
+	}
+	return r, d.line, nil
+}
+
+func parseJSONValue(k kind, raw json.RawMessage) (interface{}, error) {
+	switch {
+	case k.list():
+		var elems []string
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return nil, err
+		}
+		return parseList(k, elems)
+	case k == kindBig && string(raw) == "null":
+		return (*big.Int)(nil), nil
+	case k.literal():
+		return parseValue(k, string(raw))
+	default:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return parseValue(k, s)
+	}
+}
+
+type csvEncoder struct {
+	w       *csv.Writer
+	columns []column
+	header  bool
+}
+
+func (e *csvEncoder) writeHeader() error {
+	header := make([]string, len(e.columns))
+	for i, col := range e.columns {
+		header[i] = col.name
+	}
+	e.header = true
+	return e.w.Write(header)
+}
+
+func (e *csvEncoder) encode(r row) error {
+	if !e.header {
+		if err := e.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]string, len(e.columns))
+	for i, col := range e.columns {
+		if !col.kind.list() {
+			record[i] = formatValue(col.kind, r[i])
+			continue
+		}
+		list, err := json.Marshal(formatList(col.kind, r[i]))
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.name, err)
+		}
+		record[i] = string(list)
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvEncoder) flush() error {
+	// NOTE: empty tables still get the header, so the file tells the columns apart.
+	if !e.header {
+		if err := e.writeHeader(); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type csvDecoder struct {
+	r       *csv.Reader
+	columns []column
+	usd     []column
+	header  bool
+}
+
+func (d *csvDecoder) decode() (row, int, error) {
+	record, err := d.r.Read()
+	line, _ := d.r.FieldPos(0)
+	if err != nil {
+		return nil, line, err
+	}
+	if !d.header {
+		columns := d.columns
+		if len(record) > len(d.columns) {
+			columns = append(append([]column{}, d.columns...), d.usd...)
+		} else {
+			d.usd = nil
+		}
+		if len(record) != len(columns) {
+			return nil, line, fmt.Errorf("expected %d columns, got %d", len(columns), len(record))
+		}
+		for i, col := range columns {
+			if record[i] != col.name {
+				return nil, line, fmt.Errorf("expected column %s, got %s", col.name, record[i])
+			}
+		}
+		d.header = true
+		return d.decode()
+	}
+
+	for i, col := range d.usd {
+		if _, err := parseValue(col.kind, record[len(d.columns)+i]); err != nil {
+			return nil, line, fmt.Errorf("column %s: %w", col.name, err)
+		}
+	}
+	r := make(row, len(d.columns))
+	for i, col := range d.columns {
+		var v interface{}
+		if col.kind.list() {
+			var elems []string
+			if err = json.Unmarshal([]byte(record[i]), &elems); err == nil {
+				v, err = parseList(col.kind, elems)
+			}
+		} else {
+			v, err = parseValue(col.kind, record[i])
+		}
+		if err != nil {
+			return nil, line, fmt.Errorf("column %s: %w", col.name, err)
+		}
+		r[i] = v
+	}
+	return r, line, nil
+}
+
+// formatValue returns text of the scalar value.
+func formatValue(k kind, v interface{}) string {
+	switch k {
+	case kindAddress:
+		return v.(common.Address).Hex()
+	case kindHash:
+		return v.(common.Hash).Hex()
+	case kindBig:
+		if v.(*big.Int) == nil {
+			return ""
+		}
+		return v.(*big.Int).String()
+	case kindUint:
+		return strconv.FormatUint(v.(uint64), 10)
+	case kindInt:
+		return strconv.FormatInt(v.(int64), 10)
+	case kindFloat:
+		return strconv.FormatFloat(v.(float64), 'g', -1, 64)
+	case kindBool:
+		return strconv.FormatBool(v.(bool))
+	default:
+		return v.(string)
+	}
+}
+
+func formatList(k kind, v interface{}) []string {
+	elems := []string{}
+	switch list := v.(type) {
+	case []common.Address:
+		for _, addr := range list {
+			elems = append(elems, formatValue(kindAddress, addr))
+		}
+	case []common.Hash:
+		for _, h := range list {
+			elems = append(elems, formatValue(kindHash, h))
+		}
+	case []string:
+		elems = append(elems, list...)
+	}
+	return elems
+}
+
+var errChecksum = errors.New("invalid address checksum")
+
+// parseValue validates text of the scalar value.
+func parseValue(k kind, s string) (interface{}, error) {
+	switch k {
+	case kindAddress:
+		if !common.IsHexAddress(s) || !strings.HasPrefix(s, "0x") {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+		addr := common.HexToAddress(s)
+		// NOTE: mixed case addresses are checksummed, all lower or upper case ones are not.
+		if hex := s[2:]; hex != strings.ToLower(hex) && hex != strings.ToUpper(hex) && s != addr.Hex() {
+			return nil, fmt.Errorf("%w: %s", errChecksum, s)
+		}
+		return addr, nil
+	case kindHash:
+		b, err := hexBytes(s)
+		if err != nil || len(b) != common.HashLength {
+			return nil, fmt.Errorf("invalid hash %q", s)
+		}
+		return common.BytesToHash(b), nil
+	case kindBig:
+		if s == "" {
+			return (*big.Int)(nil), nil
+		}
+		x, ok := new(big.Int).SetString(s, 10)
+		if !ok || x.Sign() < 0 {
+			return nil, fmt.Errorf("invalid non-negative integer %q", s)
+		}
+		return x, nil
+	case kindUint:
+		return strconv.ParseUint(s, 10, 64)
+	case kindInt:
+		return strconv.ParseInt(s, 10, 64)
+	case kindFloat:
+		return strconv.ParseFloat(s, 64)
+	case kindBool:
+		return strconv.ParseBool(s)
+	default:
+		return s, nil
+	}
+}
+
+func parseList(k kind, elems []string) (interface{}, error) {
+	switch k {
+	case kindAddresses:
+		list := make([]common.Address, len(elems))
+		for i, s := range elems {
+			v, err := parseValue(kindAddress, s)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v.(common.Address)
+		}
+		return list, nil
+	case kindHashes:
+		list := make([]common.Hash, len(elems))
+		for i, s := range elems {
+			v, err := parseValue(kindHash, s)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v.(common.Hash)
+		}
+		return list, nil
+	default:
+		return elems, nil
+	}
+}
+
+func hexBytes(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return nil, errors.New("missing 0x prefix")
+	}
+	return hex.DecodeString(s[2:])
+}
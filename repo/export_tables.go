@@ -0,0 +1,650 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/internal/cbor"
+)
+
+// exportTables are the exported tables in the import order.
+var exportTables = []exportTable{
+	{
+		name:  "exchange_ids",
+		table: exchangeNameStorage,
+		columns: []column{
+			{"id", kindUint},
+			{"name", kindString},
+		},
+		encode: func(k, v []byte) (row, error) {
+			if len(k) != exchangeIDLength {
+				return nil, fmt.Errorf("invalid exchange ID key: %x", k)
+			}
+			return row{uint64(binary.BigEndian.Uint32(k)), string(v)}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			id, err := exchangeIDOf(r[0])
+			if err != nil {
+				return err
+			}
+			if id == 0 || r[1].(string) == "" {
+				return fmt.Errorf("invalid exchange %d %q", id, r[1])
+			}
+			return putExchangeID(tx, id, r[1].(string))
+		},
+	},
+	{
+		name:  "exchanges",
+		table: exchangeStorage,
+		columns: []column{
+			{"address", kindAddress},
+			{"exchange_id", kindUint},
+		},
+		encode: func(k, v []byte) (row, error) {
+			if len(v) != exchangeIDLength {
+				return nil, fmt.Errorf("invalid exchange ID of hot wallet %x: %x", k, v)
+			}
+			return row{common.BytesToAddress(k), uint64(binary.BigEndian.Uint32(v))}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			id, err := exchangeIDOf(r[1])
+			if err != nil {
+				return err
+			}
+			if id == 0 {
+				return errors.New("hot wallet of no exchange")
+			}
+			return putHotWallet(tx, r[0].(common.Address), id)
+		},
+	},
+	{
+		name:  "accounts",
+		table: accountStorage,
+		columns: []column{
+			{"address", kindAddress},
+			{"exchange_id", kindUint},
+			{"balance", kindBig},
+			{"received", kindBig},
+			{"spent", kindBig},
+		},
+		encode: func(k, v []byte) (row, error) {
+			var a _account
+			if err := cbor.Unmarshal(bytes.NewReader(v), &a); err != nil {
+				return nil, fmt.Errorf("unable to unmarshal account value: %w", err)
+			}
+			return row{
+				common.BytesToAddress(k), uint64(a.ExchangeID),
+				new(big.Int).SetBytes(a.Balance), new(big.Int).SetBytes(a.Received), new(big.Int).SetBytes(a.Spent),
+			}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			id, err := exchangeIDOf(r[1])
+			if err != nil {
+				return err
+			}
+			return putAccountRecord(tx, r[0].(common.Address), _account{
+				Balance:    bigOrZero(r[2]).Bytes(),
+				Received:   bigOrZero(r[3]).Bytes(),
+				Spent:      bigOrZero(r[4]).Bytes(),
+				ExchangeID: id,
+			})
+		},
+		usd: []column{
+			{"received_usd", kindFloat},
+			{"spent_usd", kindFloat},
+		},
+		valueUSD: func(vals *valuer, r row) (row, error) {
+			fa, err := vals.db.fullAccount(vals.tx, vals, Account{Address: r[0].(common.Address), Received: r[3].(*big.Int), Spent: r[4].(*big.Int)})
+			if err != nil {
+				return nil, err
+			}
+			return row{fa.ReceivedUSD, fa.SpentUSD}, nil
+		},
+	},
+	{
+		name:  "fundings",
+		table: fundingStorage,
+		columns: []column{
+			{"tx_hash", kindHash},
+			{"exchange_id", kindUint},
+			{"wallet", kindAddress},
+			{"value", kindBig},
+			{"block_number", kindUint},
+			{"timestamp", kindUint},
+		},
+		encode: func(k, v []byte) (row, error) {
+			var f _funding
+			if err := cbor.Unmarshal(bytes.NewReader(v), &f); err != nil {
+				return nil, fmt.Errorf("unable to decode funding record: %w", err)
+			}
+			return row{common.BytesToHash(k), uint64(f.ExchangeID), f.Wallet, new(big.Int).SetBytes(f.Value), f.BlockNumber, f.Timestamp}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			id, err := exchangeIDOf(r[1])
+			if err != nil {
+				return err
+			}
+			return putFundingRecord(tx, r[0].(common.Hash), _funding{
+				ExchangeID:  id,
+				Wallet:      r[2].(common.Address),
+				Value:       bigOrZero(r[3]).Bytes(),
+				BlockNumber: r[4].(uint64),
+				Timestamp:   r[5].(uint64),
+			})
+		},
+		usd: []column{
+			{"value_usd", kindFloat},
+		},
+		valueUSD: func(vals *valuer, r row) (row, error) {
+			usd, err := vals.USD(r[3].(*big.Int), r[4].(uint64))
+			return row{usd}, err
+		},
+	},
+	{
+		name:  "received_baselines",
+		table: receivedBaselineStorage,
+		columns: []column{
+			{"wallet", kindAddress},
+			{"value", kindBig},
+		},
+		encode: func(k, v []byte) (row, error) {
+			return row{common.BytesToAddress(k), new(big.Int).SetBytes(v)}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			return db.PutReceivedBaseline(tx, r[0].(common.Address), bigOrZero(r[1]))
+		},
+	},
+	{
+		name:  "tokens",
+		table: tokenStorage,
+		columns: []column{
+			{"address", kindAddress},
+			{"symbol", kindString},
+			{"name", kindString},
+			{"decimals", kindInt},
+			{"price", kindBig},
+			{"total_bought", kindBig},
+			{"times_bought", kindInt},
+			{"safety_checked_at", kindUint},
+			{"buy_tax", kindFloat},
+			{"sell_tax", kindFloat},
+			{"honeypot", kindBool},
+			{"transfer_restricted", kindBool},
+			{"max_tx_limited", kindBool},
+			{"meta_updated_at", kindUint},
+			{"creation_block", kindUint},
+			{"deployer", kindAddress},
+			{"pair_creation_block", kindUint},
+			{"liquidity", kindBig},
+			{"total_supply", kindBig},
+			{"lp_locked", kindFloat},
+		},
+		encode: func(_, v []byte) (row, error) {
+			var tokenVal _token
+			if err := cbor.Unmarshal(bytes.NewReader(v), &tokenVal); err != nil {
+				return nil, fmt.Errorf("unable to decode token: %w", err)
+			}
+			t := decodeToken(tokenVal)
+			return row{
+				t.Address, t.Symbol, t.Name, t.Decimals, t.Price, t.TotalBought, int64(t.TimesBought),
+				t.Safety.CheckedAt, t.Safety.BuyTax, t.Safety.SellTax, t.Safety.Honeypot, t.Safety.TransferRestricted, t.Safety.MaxTxLimited,
+				t.Meta.UpdatedAt, t.Meta.CreationBlock, t.Meta.Deployer, t.Meta.PairCreationBlock, t.Meta.Liquidity, t.Meta.TotalSupply, t.Meta.LPLocked,
+			}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			decimals := r[3].(int64)
+			if decimals < 0 || decimals > math.MaxUint8 {
+				return fmt.Errorf("invalid decimals %d", decimals)
+			}
+			return db.PutToken(tx, Token{
+				Address:     r[0].(common.Address),
+				Symbol:      r[1].(string),
+				Name:        r[2].(string),
+				Decimals:    decimals,
+				Price:       bigOrZero(r[4]),
+				TotalBought: bigOrZero(r[5]),
+				TimesBought: int(r[6].(int64)),
+				Safety: TokenSafety{
+					CheckedAt:          r[7].(uint64),
+					BuyTax:             r[8].(float64),
+					SellTax:            r[9].(float64),
+					Honeypot:           r[10].(bool),
+					TransferRestricted: r[11].(bool),
+					MaxTxLimited:       r[12].(bool),
+				},
+				Meta: TokenMeta{
+					UpdatedAt:         r[13].(uint64),
+					CreationBlock:     r[14].(uint64),
+					Deployer:          r[15].(common.Address),
+					PairCreationBlock: r[16].(uint64),
+					Liquidity:         r[17].(*big.Int),
+					TotalSupply:       r[18].(*big.Int),
+					LPLocked:          r[19].(float64),
+				},
+			})
+		},
+		usd: []column{
+			{"price_usd", kindFloat},
+			{"total_bought_usd", kindFloat},
+			{"liquidity_usd", kindFloat},
+		},
+		valueUSD: func(vals *valuer, r row) (row, error) {
+			t := Token{
+				Address:     r[0].(common.Address),
+				Price:       r[4].(*big.Int),
+				TotalBought: r[5].(*big.Int),
+				Meta:        TokenMeta{UpdatedAt: r[13].(uint64), Liquidity: r[17].(*big.Int)},
+			}
+			buys, err := vals.db.tokenBuys(vals.tx, []Token{t})
+			if err != nil {
+				return nil, err
+			}
+			ft, err := fullToken(vals, t, buys[t.Address], 0)
+			if err != nil {
+				return nil, err
+			}
+			return row{ft.PriceUSD, ft.TotalBoughtUSD, ft.LiquidityUSD}, nil
+		},
+	},
+	{
+		name:  "patterns",
+		table: patternStorage,
+		columns: []column{
+			{"token", kindAddress},
+			{"exchange_id", kindUint},
+			{"value", kindBig},
+			{"times_occured", kindInt},
+		},
+		encode: func(k, v []byte) (row, error) {
+			if len(k) != patternKeyLength {
+				return nil, fmt.Errorf("invalid pattern key: %x", k)
+			}
+			var value _patternValue
+			if err := cbor.Unmarshal(bytes.NewReader(v), &value); err != nil {
+				return nil, fmt.Errorf("could not unmarshal pattern value: %w", err)
+			}
+			return row{
+				common.BytesToAddress(k[:common.AddressLength]), uint64(binary.BigEndian.Uint32(k[common.AddressLength:])),
+				new(big.Int).SetBytes(value.Value), int64(value.TimesOccured),
+			}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			id, err := exchangeIDOf(r[1])
+			if err != nil {
+				return err
+			}
+			return putPatternRecord(tx, r[0].(common.Address), id, _patternValue{
+				Value:        bigOrZero(r[2]).Bytes(),
+				TimesOccured: int(r[3].(int64)),
+			})
+		},
+		usd: []column{
+			{"value_usd", kindFloat},
+		},
+		valueUSD: func(vals *valuer, r row) (row, error) {
+			id, err := exchangeIDOf(r[1])
+			if err != nil {
+				return nil, err
+			}
+			name, err := vals.db.ExchangeName(vals.tx, id)
+			if err != nil {
+				return nil, err
+			}
+			amounts, err := vals.db.patternAmounts(vals.tx, make(map[common.Address]string), r[0].(common.Address))
+			if err != nil {
+				return nil, err
+			}
+			usd, err := vals.totalUSD(r[2].(*big.Int), amounts[name])
+			return row{usd}, err
+		},
+	},
+	{
+		name:  "pattern_buckets",
+		table: patternBucketStorage,
+		columns: []column{
+			{"resolution", kindString},
+			{"bucket", kindUint},
+			{"token", kindAddress},
+			{"exchange_id", kindUint},
+			{"value", kindBig},
+			{"times_occured", kindInt},
+		},
+		encode: func(k, v []byte) (row, error) {
+			if len(k) != patternBucketKeyLength {
+				return nil, fmt.Errorf("invalid pattern bucket key: %x", k)
+			}
+			var value _patternValue
+			if err := cbor.Unmarshal(bytes.NewReader(v), &value); err != nil {
+				return nil, fmt.Errorf("could not unmarshal pattern bucket value: %w", err)
+			}
+			return row{
+				Resolution(k[0]).String(), binary.BigEndian.Uint64(k[1:9]), common.BytesToAddress(k[9:29]), uint64(binary.BigEndian.Uint32(k[29:])),
+				new(big.Int).SetBytes(value.Value), int64(value.TimesOccured),
+			}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			var res Resolution
+			switch r[0].(string) {
+			case Hourly.String():
+				res = Hourly
+			case Daily.String():
+				res = Daily
+			default:
+				return fmt.Errorf("unknown resolution %q", r[0])
+			}
+			if r[1].(uint64)%uint64(res.Duration()/time.Second) != 0 {
+				return fmt.Errorf("bucket %d is not at the start of the %v bucket", r[1], res)
+			}
+			id, err := exchangeIDOf(r[3])
+			if err != nil {
+				return err
+			}
+			return putPatternBucketRecord(tx, patternBucketKey(res, r[1].(uint64), r[2].(common.Address), id), _patternValue{
+				Value:        bigOrZero(r[4]).Bytes(),
+				TimesOccured: int(r[5].(int64)),
+			})
+		},
+	},
+	{
+		name:  "swaps",
+		table: swapStorage,
+		columns: []column{
+			{"tx_hash", kindHash},
+			{"log_index", kindUint},
+			{"block_number", kindUint},
+			{"timestamp", kindUint},
+			{"tx_index", kindUint},
+			{"wallet", kindAddress},
+			{"token", kindAddress},
+			{"factory", kindAddress},
+			{"path", kindAddresses},
+			{"price", kindBig},
+			{"value", kindBig},
+		},
+		encode: func(k, v []byte) (row, error) {
+			s, err := decodeSwap(k, v)
+			if err != nil {
+				return nil, err
+			}
+			return row{
+				s.TxHash, uint64(s.LogIndex), s.BlockNumber, s.Timestamp, uint64(s.TxIndex),
+				s.Wallet, s.TokenAddr, s.Factory, s.Path, s.Price, s.Value,
+			}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			if r[1].(uint64) > math.MaxUint32 {
+				return fmt.Errorf("log index %d overflows uint32", r[1])
+			}
+			path := r[8].([]common.Address)
+			if len(path) == 0 {
+				return errors.New("empty swap path")
+			}
+			return db.PutSwap(tx, Swap{
+				TxHash:      r[0].(common.Hash),
+				LogIndex:    uint(r[1].(uint64)),
+				BlockNumber: r[2].(uint64),
+				Timestamp:   r[3].(uint64),
+				TxIndex:     uint(r[4].(uint64)),
+				Wallet:      r[5].(common.Address),
+				TokenAddr:   r[6].(common.Address),
+				Factory:     r[7].(common.Address),
+				Path:        path,
+				Price:       bigOrZero(r[9]),
+				Value:       bigOrZero(r[10]),
+			})
+		},
+		usd: []column{
+			{"price_usd", kindFloat},
+			{"value_usd", kindFloat},
+		},
+		valueUSD: func(vals *valuer, r row) (row, error) {
+			fs, err := vals.fullSwap(Swap{BlockNumber: r[2].(uint64), Price: r[9].(*big.Int), Value: r[10].(*big.Int)})
+			if err != nil {
+				return nil, err
+			}
+			return row{fs.PriceUSD, fs.ValueUSD}, nil
+		},
+	},
+	{
+		name:  "positions",
+		table: positionStorage,
+		columns: []column{
+			{"tx_hash", kindHash},
+			{"log_index", kindUint},
+			{"price", kindBig},
+			{"block_number", kindUint},
+			{"peak_price", kindBig},
+			{"opened_at", kindUint},
+			{"reached_2x_at", kindUint},
+		},
+		encode: func(k, v []byte) (row, error) {
+			p, err := decodePosition(k, v)
+			if err != nil {
+				return nil, err
+			}
+			return row{p.TxHash, uint64(p.LogIndex), p.Price, p.BlockNumber, p.PeakPrice, p.OpenedAt, p.Reached2xAt}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			return db.PutPosition(tx, Position{
+				TxHash:      r[0].(common.Hash),
+				LogIndex:    uint(r[1].(uint64)),
+				Price:       bigOrZero(r[2]),
+				BlockNumber: r[3].(uint64),
+				PeakPrice:   bigOrZero(r[4]),
+				OpenedAt:    r[5].(uint64),
+				Reached2xAt: r[6].(uint64),
+			})
+		},
+	},
+	{
+		name:  "pairs",
+		table: pairStorage,
+		columns: []column{
+			{"address", kindAddress},
+			{"factory", kindAddress},
+			{"token0", kindAddress},
+			{"token1", kindAddress},
+			{"reserve0", kindBig},
+			{"reserve1", kindBig},
+			{"block_number", kindUint},
+		},
+		encode: func(k, v []byte) (row, error) {
+			var pairVal _pair
+			if err := cbor.Unmarshal(bytes.NewReader(v), &pairVal); err != nil {
+				return nil, fmt.Errorf("unable to decode pair record: %w", err)
+			}
+			p := decodePair(common.BytesToAddress(k), pairVal)
+			return row{p.Address, p.Factory, p.Token0, p.Token1, p.Reserve0, p.Reserve1, p.BlockNumber}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			return db.PutPair(tx, Pair{
+				Address:     r[0].(common.Address),
+				Factory:     r[1].(common.Address),
+				Token0:      r[2].(common.Address),
+				Token1:      r[3].(common.Address),
+				Reserve0:    bigOrZero(r[4]),
+				Reserve1:    bigOrZero(r[5]),
+				BlockNumber: r[6].(uint64),
+			})
+		},
+	},
+	{
+		name:  "prices",
+		table: priceHistoryStorage,
+		columns: []column{
+			{"token", kindAddress},
+			{"block_number", kindUint},
+			{"price", kindBig},
+		},
+		encode: func(k, v []byte) (row, error) {
+			if len(k) != common.AddressLength+8 {
+				return nil, fmt.Errorf("invalid price history key: %x", k)
+			}
+			return row{
+				common.BytesToAddress(k[:common.AddressLength]), binary.BigEndian.Uint64(k[common.AddressLength:]), new(big.Int).SetBytes(v),
+			}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			return db.PutPriceAt(tx, r[0].(common.Address), r[1].(uint64), bigOrZero(r[2]))
+		},
+	},
+	{
+		name:  "valuations",
+		table: valuationStorage,
+		columns: []column{
+			{"block_number", kindUint},
+			{"eth_usd_num", kindBig},
+			{"eth_usd_denom", kindBig},
+		},
+		encode: func(k, v []byte) (row, error) {
+			var valuationVal _valuation
+			if err := cbor.Unmarshal(bytes.NewReader(v), &valuationVal); err != nil {
+				return nil, fmt.Errorf("unable to decode valuation: %w", err)
+			}
+			return row{
+				binary.BigEndian.Uint64(k), new(big.Int).SetBytes(valuationVal.EthUSDNum), new(big.Int).SetBytes(valuationVal.EthUSDDenom),
+			}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			denom := bigOrZero(r[2])
+			if denom.Sign() == 0 {
+				return errors.New("zero denominator")
+			}
+			return db.PutValuation(tx, Valuation{
+				BlockNumber: r[0].(uint64),
+				EthUSD:      new(big.Rat).SetFrac(bigOrZero(r[1]), denom),
+			})
+		},
+	},
+	{
+		name:  "signals",
+		table: signalStorage,
+		columns: []column{
+			{"time", kindUint},
+			{"token", kindAddress},
+			{"rule", kindString},
+			{"block_number", kindUint},
+			{"wallets", kindInt},
+			{"exchanges", kindStrings},
+			{"value", kindBig},
+			{"tx_hashes", kindHashes},
+		},
+		encode: func(k, v []byte) (row, error) {
+			if len(k) < 8+common.AddressLength {
+				return nil, fmt.Errorf("invalid signal key: %x", k)
+			}
+			var signalVal _signal
+			if err := cbor.Unmarshal(bytes.NewReader(v), &signalVal); err != nil {
+				return nil, fmt.Errorf("unable to decode signal: %w", err)
+			}
+			return row{
+				binary.BigEndian.Uint64(k[:8]), common.BytesToAddress(k[8 : 8+common.AddressLength]), string(k[8+common.AddressLength:]),
+				signalVal.BlockNumber, int64(signalVal.Wallets), signalVal.Exchanges, new(big.Int).SetBytes(signalVal.Value), signalVal.TxHashes,
+			}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			if r[0].(uint64) > math.MaxInt64 {
+				return fmt.Errorf("time %d overflows int64", r[0])
+			}
+			return db.PutSignal(tx, Signal{
+				Time:        time.Unix(int64(r[0].(uint64)), 0),
+				TokenAddr:   r[1].(common.Address),
+				Rule:        r[2].(string),
+				BlockNumber: r[3].(uint64),
+				Wallets:     int(r[4].(int64)),
+				Exchanges:   r[5].([]string),
+				Value:       bigOrZero(r[6]),
+				TxHashes:    r[7].([]common.Hash),
+			})
+		},
+	},
+	{
+		name:  "leaderboard",
+		table: leaderboardStorage,
+		columns: []column{
+			{"rank", kindUint},
+			{"wallet", kindAddress},
+			{"exchange", kindString},
+			{"swaps", kindInt},
+			{"distinct_tokens", kindInt},
+			{"win_rate", kindFloat},
+			{"median_return", kindFloat},
+			{"reached_2x", kindInt},
+			{"median_blocks_to_2x", kindUint},
+			{"recency_return", kindFloat},
+			{"score", kindFloat},
+			{"block_number", kindUint},
+		},
+		encode: func(k, v []byte) (row, error) {
+			if len(k) != 4 {
+				return nil, fmt.Errorf("invalid leaderboard key: %x", k)
+			}
+			var s _walletScore
+			if err := cbor.Unmarshal(bytes.NewReader(v), &s); err != nil {
+				return nil, fmt.Errorf("unable to decode wallet score: %w", err)
+			}
+			return row{
+				uint64(binary.BigEndian.Uint32(k)), s.Wallet, s.Exchange, int64(s.Swaps), int64(s.DistinctTokens), s.WinRate, s.MedianReturn,
+				int64(s.Reached2x), s.MedianBlocksTo2x, s.RecencyReturn, s.Score, s.BlockNumber,
+			}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			if r[0].(uint64) > math.MaxUint32 {
+				return fmt.Errorf("rank %d overflows uint32", r[0])
+			}
+			return putWalletScore(tx, uint32(r[0].(uint64)), WalletScore{
+				Wallet:           r[1].(common.Address),
+				Exchange:         r[2].(string),
+				Swaps:            int(r[3].(int64)),
+				DistinctTokens:   int(r[4].(int64)),
+				WinRate:          r[5].(float64),
+				MedianReturn:     r[6].(float64),
+				Reached2x:        int(r[7].(int64)),
+				MedianBlocksTo2x: r[8].(uint64),
+				RecencyReturn:    r[9].(float64),
+				Score:            r[10].(float64),
+				BlockNumber:      r[11].(uint64),
+			})
+		},
+	},
+	{
+		name:  "processed_txs",
+		table: processedTxStorage,
+		columns: []column{
+			{"tx_hash", kindHash},
+			{"block_number", kindUint},
+		},
+		encode: func(k, v []byte) (row, error) {
+			if len(k) != common.HashLength || len(v) != 8 {
+				return nil, fmt.Errorf("invalid processed transaction record: %x", k)
+			}
+			return row{common.BytesToHash(k), binary.BigEndian.Uint64(v)}, nil
+		},
+		put: func(db *DB, tx RwTx, r row) error {
+			return db.MarkTxProcessed(tx, r[0].(common.Hash), r[1].(uint64))
+		},
+	},
+}
+
+// bigOrZero returns the big integer of the row, null is zero.
+func bigOrZero(v interface{}) *big.Int {
+	if x := v.(*big.Int); x != nil {
+		return x
+	}
+	return new(big.Int)
+}
+
+// exchangeIDOf converts the imported exchange ID column to the exchange ID, zero stands for no exchange.
+func exchangeIDOf(v interface{}) (uint32, error) {
+	id := v.(uint64)
+	if id > math.MaxUint32 {
+		return 0, fmt.Errorf("invalid exchange ID %d", id)
+	}
+	return uint32(id), nil
+}
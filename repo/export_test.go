@@ -0,0 +1,250 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// fillExportDB puts a record into every exported table.
+func fillExportDB(t *testing.T, db *DB) {
+	var (
+		wallet = common.HexToAddress("0x52908400098527886E0F7030069857D2E4169EE7")
+		token  = common.HexToAddress("0xde709f2102306220921060314715629080e2fb77")
+		weth   = common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+		txHash = common.HexToHash("0x8a3b")
+	)
+	liquidity, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	hourly := time.Unix(1600000000, 0)
+
+	err := db.Update(context.Background(), func(tx RwTx) error {
+		for _, err := range []error{
+			db.PutExchange(tx, Exchange{Name: "Binance, \"hot\" 14", Address: weth}),
+			db.PutFunding(tx, Funding{TxHash: common.HexToHash("0xf0"), Exchange: "Binance", Wallet: wallet, Value: big.NewInt(3e18), BlockNumber: 11, Timestamp: 1599999988}),
+			db.PutAccount(tx, Account{Address: wallet, Exchange: "Binance", Balance: big.NewInt(0), Received: big.NewInt(4e18), Spent: big.NewInt(1e18)}),
+			db.PutReceivedBaseline(tx, wallet, big.NewInt(1e18)),
+			db.PutToken(tx, Token{
+				Address: token, Symbol: "TKN", Name: "Token\nName", Decimals: 9, Price: big.NewInt(42), TotalBought: big.NewInt(1e18), TimesBought: 2,
+				Safety: TokenSafety{CheckedAt: 10, BuyTax: 0.05, SellTax: 0.1, MaxTxLimited: true},
+				Meta:   TokenMeta{UpdatedAt: 11, CreationBlock: 5, Deployer: wallet, Liquidity: liquidity, TotalSupply: big.NewInt(1e9), LPLocked: 0.9},
+			}),
+			db.PutToken(tx, Token{Address: weth, Symbol: "WETH", Decimals: 18, Price: big.NewInt(1), TotalBought: big.NewInt(0)}),
+			db.PutPattern(tx, Pattern{TokenAddr: token, ExchangeName: "Binance", Value: big.NewInt(1e18), TimesOccured: 2}),
+			db.AddPatternBuckets(tx, token, "Binance", big.NewInt(1e18), hourly),
+			db.PutSwap(tx, Swap{
+				TxHash: txHash, LogIndex: 7, BlockNumber: 12, Timestamp: 1600000000, TxIndex: 3, Wallet: wallet, TokenAddr: token,
+				Factory: weth, Path: []common.Address{weth, token}, Price: big.NewInt(42), Value: big.NewInt(1e18),
+			}),
+			db.PutPosition(tx, Position{TxHash: txHash, LogIndex: 7, Price: big.NewInt(84), BlockNumber: 13, PeakPrice: big.NewInt(90), OpenedAt: 12, Reached2xAt: 13}),
+			db.PutPair(tx, Pair{Address: wallet, Factory: weth, Token0: token, Token1: weth, Reserve0: big.NewInt(5), Reserve1: big.NewInt(6), BlockNumber: 12}),
+			db.PutPriceAt(tx, token, 12, big.NewInt(42)),
+			db.PutValuation(tx, Valuation{BlockNumber: 12, EthUSD: big.NewRat(300001, 100)}),
+			db.PutSignal(tx, Signal{
+				Rule: "cluster", TokenAddr: token, Time: hourly, BlockNumber: 12, Wallets: 3, Exchanges: []string{"Binance", "OKX"},
+				Value: big.NewInt(3e18), TxHashes: []common.Hash{txHash},
+			}),
+			db.MarkTxProcessed(tx, txHash, 12),
+			db.PutLeaderboard(tx, []WalletScore{{Wallet: wallet, Exchange: "Binance", Swaps: 4, WinRate: 0.75, MedianReturn: -0.1, Score: 1.5e-7, BlockNumber: 13}}),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exportAll(t *testing.T, db *DB, format Format) map[string]string {
+	files := make(map[string]string)
+	err := db.View(context.Background(), func(tx Tx) error {
+		for _, name := range ExportTables() {
+			var buf bytes.Buffer
+			n, err := db.Export(tx, name, format, &buf)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				t.Errorf("Export(%s) wrote no records", name)
+			}
+			files[name] = buf.String()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestDB_ExportImport(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []Format{NDJSON, CSV} {
+		t.Run(string(format), func(t *testing.T) {
+			src := &DB{d: newTestDB(t)}
+			fillExportDB(t, src)
+			want := exportAll(t, src, format)
+
+			dst := &DB{d: newTestDB(t)}
+			err := dst.Update(context.Background(), func(tx RwTx) error {
+				for _, name := range ExportTables() {
+					if _, err := dst.Import(tx, name, format, strings.NewReader(want[name])); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Import() error = %v", err)
+			}
+
+			got := exportAll(t, dst, format)
+			for _, name := range ExportTables() {
+				if got[name] != want[name] {
+					t.Errorf("%s does not round-trip:\ngot  %s\nwant %s", name, got[name], want[name])
+				}
+			}
+
+			// NOTE: secondary indexes are rebuilt by the import.
+			err = dst.View(context.Background(), func(tx Tx) error {
+				swaps, err := dst.SwapsByWallet(tx, common.HexToAddress("0x52908400098527886E0F7030069857D2E4169EE7"), 0, 100)
+				if err != nil {
+					return err
+				}
+				if len(swaps) != 1 {
+					t.Errorf("SwapsByWallet() returned %d swaps, want 1", len(swaps))
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestDB_Export(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	fillExportDB(t, db)
+	files := exportAll(t, db, NDJSON)
+
+	want := `{"address":"0x52908400098527886E0F7030069857D2E4169EE7","exchange_id":2,"balance":"0","received":"4000000000000000000","spent":"1000000000000000000","received_usd":12000.04,"spent_usd":3000.01}` + "\n"
+	if files["accounts"] != want {
+		t.Errorf("Export(accounts) = %s, want %s", files["accounts"], want)
+	}
+	if !strings.Contains(files["tokens"], `"liquidity":null`) {
+		t.Errorf("Export(tokens) = %s, want null liquidity of WETH", files["tokens"])
+	}
+
+	var csv bytes.Buffer
+	err := db.View(context.Background(), func(tx Tx) error {
+		_, err := db.Export(tx, "signals", CSV, &csv)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "time,token,rule,block_number,wallets,exchanges,value,tx_hashes\n" +
+		`1600000000,0xde709f2102306220921060314715629080e2fb77,cluster,12,3,"[""Binance"",""OKX""]",3000000000000000000,"[""0x0000000000000000000000000000000000000000000000000000000000008a3b""]"` + "\n"
+	if csv.String() != wantCSV {
+		t.Errorf("Export(signals) = %s, want %s", csv.String(), wantCSV)
+	}
+}
+
+func TestDB_ImportInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		table   string
+		format  Format
+		input   string
+		wantErr string
+	}{
+		{
+			name:    "bad checksum",
+			table:   "exchanges",
+			format:  NDJSON,
+			input:   `{"address":"0x52908400098527886e0F7030069857D2E4169EE7","exchange_id":1}`,
+			wantErr: "invalid address checksum",
+		},
+		{
+			name:    "negative amount",
+			table:   "accounts",
+			format:  NDJSON,
+			input:   `{"address":"0x52908400098527886e0f7030069857d2e4169ee7","exchange_id":1,"balance":"0","received":"-1","spent":"0"}`,
+			wantErr: "invalid non-negative integer",
+		},
+		{
+			name:    "invalid usd",
+			table:   "fundings",
+			format:  NDJSON,
+			input:   `{"tx_hash":"0x00000000000000000000000000000000000000000000000000000000000000f0","exchange_id":1,"wallet":"0x52908400098527886e0f7030069857d2e4169ee7","value":"1","block_number":1,"timestamp":1,"value_usd":"1"}`,
+			wantErr: "column value_usd",
+		},
+		{
+			name:    "missing column",
+			table:   "exchanges",
+			format:  NDJSON,
+			input:   `{"address":"0x52908400098527886e0f7030069857d2e4169ee7","label":1}`,
+			wantErr: "missing column exchange_id",
+		},
+		{
+			name:    "amount as number",
+			table:   "prices",
+			format:  NDJSON,
+			input:   `{"token":"0x52908400098527886e0f7030069857d2e4169ee7","block_number":1,"price":5}`,
+			wantErr: "column price",
+		},
+		{
+			name:    "wrong header",
+			table:   "prices",
+			format:  CSV,
+			input:   "token,block,price\n",
+			wantErr: "expected column block_number",
+		},
+		{
+			name:    "second line",
+			table:   "prices",
+			format:  CSV,
+			input:   "token,block_number,price\n0x52908400098527886e0f7030069857d2e4169ee7,1,5\n0x5290,1,5\n",
+			wantErr: "prices line 3",
+		},
+		{
+			name:    "empty path",
+			table:   "swaps",
+			format:  CSV,
+			input:   "tx_hash,log_index,block_number,timestamp,tx_index,wallet,token,factory,path,price,value\n0x0000000000000000000000000000000000000000000000000000000000008a3b,0,1,1,0,0x52908400098527886e0f7030069857d2e4169ee7,0x52908400098527886e0f7030069857d2e4169ee7,0x52908400098527886e0f7030069857d2e4169ee7,[],1,1\n",
+			wantErr: "empty swap path",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			db := &DB{d: newTestDB(t)}
+			err := db.Update(context.Background(), func(tx RwTx) error {
+				_, err := db.Import(tx, tt.table, tt.format, strings.NewReader(tt.input))
+				return err
+			})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Import() error = %v, want %q", err, tt.wantErr)
+			}
+			if tt.name == "bad checksum" && !errors.Is(err, errChecksum) {
+				t.Errorf("Import() error = %v, want errChecksum", err)
+			}
+		})
+	}
+}
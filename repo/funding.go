@@ -0,0 +1,235 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/internal/cbor"
+)
+
+// Funding is ETH transfer from the exchange hot wallet to the tracked wallet.
+// Fundings are the primary records Account.Received is summed from.
+type Funding struct {
+	TxHash      common.Hash
+	Exchange    string
+	Wallet      common.Address
+	Value       *big.Int
+	BlockNumber uint64
+	Timestamp   uint64
+}
+
+type _funding struct {
+	ExchangeID  uint32
+	Wallet      common.Address
+	Value       []byte
+	BlockNumber uint64
+	Timestamp   uint64
+}
+
+// _namedFunding is the fundingStorage value of the schema before exchange IDs.
+type _namedFunding struct {
+	Exchange    string
+	Wallet      common.Address
+	Value       []byte
+	BlockNumber uint64
+	Timestamp   uint64
+}
+
+// PutFunding puts Funding into the fundingStorage keyed by it's transaction hash.
+func (db *DB) PutFunding(tx RwTx, f Funding) error {
+	id, err := db.assignExchangeID(tx, f.Exchange)
+	if err != nil {
+		return err
+	}
+	return putFundingRecord(tx, f.TxHash, _funding{
+		ExchangeID:  id,
+		Wallet:      f.Wallet,
+		Value:       f.Value.Bytes(),
+		BlockNumber: f.BlockNumber,
+		Timestamp:   f.Timestamp,
+	})
+}
+
+func putFundingRecord(tx RwTx, txHash common.Hash, fundingVal _funding) error {
+	if err := unindexFunding(tx, txHash); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := cbor.Marshal(&buf, fundingVal); err != nil {
+		return fmt.Errorf("unable to encode funding record: %w", err)
+	}
+	if err := tx.Put(fundingStorage, txHash.Bytes(), buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to put funding record: %w", err)
+	}
+	if err := tx.Put(fundingWalletIndex, fundingIndexKey(fundingVal.Wallet, fundingVal.BlockNumber, txHash), []byte{}); err != nil {
+		return fmt.Errorf("unable to put %s entry: %w", fundingWalletIndex, err)
+	}
+	return nil
+}
+
+// fundingIndexKey is the fundingWalletIndex key wallet | block | txHash, the block number is big-endian
+// so that fundings of the wallet are ordered by block. Values are empty.
+func fundingIndexKey(wallet common.Address, blockNumber uint64, txHash common.Hash) []byte {
+	k := make([]byte, common.AddressLength+8+common.HashLength)
+	copy(k, wallet.Bytes())
+	binary.BigEndian.PutUint64(k[common.AddressLength:], blockNumber)
+	copy(k[common.AddressLength+8:], txHash.Bytes())
+	return k
+}
+
+// unindexFunding deletes the index entry of the stored funding, it's a no-op if the funding is not stored.
+func unindexFunding(tx RwTx, txHash common.Hash) error {
+	v, err := tx.GetOne(fundingStorage, txHash.Bytes())
+	if err != nil {
+		return fmt.Errorf("could not peek funding record: %w", err)
+	}
+	if v == nil {
+		return nil
+	}
+	var fundingVal _funding
+	if err := cbor.Unmarshal(bytes.NewReader(v), &fundingVal); err != nil {
+		return fmt.Errorf("unable to decode funding record: %w", err)
+	}
+	if err := tx.Delete(fundingWalletIndex, fundingIndexKey(fundingVal.Wallet, fundingVal.BlockNumber, txHash), nil); err != nil {
+		return fmt.Errorf("unable to delete %s entry: %w", fundingWalletIndex, err)
+	}
+	return nil
+}
+
+// FundingsByWallet returns fundings of the wallet ordered by block.
+func (db *DB) FundingsByWallet(tx Tx, wallet common.Address) ([]Funding, error) {
+	names := make(exchangeNames)
+	var fundings []Funding
+	if err := tx.ForPrefix(fundingWalletIndex, wallet.Bytes(), func(k, _ []byte) error {
+		txHash := k[common.AddressLength+8:]
+		v, err := tx.GetOne(fundingStorage, txHash)
+		if err != nil {
+			return fmt.Errorf("could not peek funding record: %w", err)
+		}
+		if v == nil {
+			return fmt.Errorf("%s references missing funding %x", fundingWalletIndex, txHash)
+		}
+		f, err := db.decodeFunding(tx, names, txHash, v)
+		if err != nil {
+			return err
+		}
+		fundings = append(fundings, f)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through fundings of %v: %w", wallet, err)
+	}
+	return fundings, nil
+}
+
+// RebuildFundingIndex recreates the wallet index of fundingStorage.
+func (db *DB) RebuildFundingIndex(tx RwTx) error {
+	if err := tx.ClearBucket(fundingWalletIndex); err != nil {
+		return fmt.Errorf("unable to clear %s: %w", fundingWalletIndex, err)
+	}
+	return tx.ForEach(fundingStorage, []byte{}, func(k, v []byte) error {
+		var fundingVal _funding
+		if err := cbor.Unmarshal(bytes.NewReader(v), &fundingVal); err != nil {
+			return fmt.Errorf("unable to decode funding record: %w", err)
+		}
+		return tx.Put(fundingWalletIndex, fundingIndexKey(fundingVal.Wallet, fundingVal.BlockNumber, common.BytesToHash(k)), []byte{})
+	})
+}
+
+// PutReceivedBaseline puts the amount of wei the wallet received before the fundings were recorded.
+func (db *DB) PutReceivedBaseline(tx RwTx, wallet common.Address, value *big.Int) error {
+	if err := tx.Put(receivedBaselineStorage, wallet.Bytes(), value.Bytes()); err != nil {
+		return fmt.Errorf("unable to put received baseline: %w", err)
+	}
+	return nil
+}
+
+// ReceivedBaselines returns amounts of wei the wallets received before the fundings were recorded,
+// Account.Received of such wallets is the baseline plus their fundings.
+func (db *DB) ReceivedBaselines(tx Tx) (map[common.Address]*big.Int, error) {
+	baselines := make(map[common.Address]*big.Int)
+	if err := tx.ForEach(receivedBaselineStorage, []byte{}, func(k, v []byte) error {
+		baselines[common.BytesToAddress(k)] = new(big.Int).SetBytes(v)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through received baselines: %w", err)
+	}
+	return baselines, nil
+}
+
+// recordReceivedBaselines records the part of Account.Received which is not covered by the funding records,
+// the wallets were funded before the fundings were recorded.
+func (db *DB) recordReceivedBaselines(tx RwTx) error {
+	accounts, err := db.AllAccounts(tx)
+	if err != nil {
+		return err
+	}
+	for _, a := range accounts {
+		fundings, err := db.FundingsByWallet(tx, a.Address)
+		if err != nil {
+			return err
+		}
+		baseline := new(big.Int).Set(a.Received)
+		for _, f := range fundings {
+			baseline.Sub(baseline, f.Value)
+		}
+		// NOTE: accounts received less than their fundings are left to Check.
+		if baseline.Sign() <= 0 {
+			continue
+		}
+		if err := db.PutReceivedBaseline(tx, a.Address, baseline); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) decodeFunding(tx Tx, names exchangeNames, k, v []byte) (Funding, error) {
+	if len(k) != common.HashLength {
+		return Funding{}, fmt.Errorf("invalid funding key length: %d", len(k))
+	}
+	var fundingVal _funding
+	if err := cbor.Unmarshal(bytes.NewReader(v), &fundingVal); err != nil {
+		return Funding{}, fmt.Errorf("unable to decode funding record: %w", err)
+	}
+	exchange, err := names.name(db, tx, fundingVal.ExchangeID)
+	if err != nil {
+		return Funding{}, err
+	}
+
+	return Funding{
+		TxHash:      common.BytesToHash(k),
+		Exchange:    exchange,
+		Wallet:      fundingVal.Wallet,
+		Value:       new(big.Int).SetBytes(fundingVal.Value),
+		BlockNumber: fundingVal.BlockNumber,
+		Timestamp:   fundingVal.Timestamp,
+	}, nil
+}
+
+// IterFundings calls f for fundings ordered by their transaction hashes, Start of the options is the hash bytes.
+func (db *DB) IterFundings(tx Tx, opts IterOptions, f func(Funding) error) error {
+	names := make(exchangeNames)
+	return iterate(tx, fundingStorage, opts, func(k, v []byte) error {
+		funding, err := db.decodeFunding(tx, names, k, v)
+		if err != nil {
+			return err
+		}
+		return f(funding)
+	})
+}
+
+// AllFundings returns all fundings ordered by their transaction hashes.
+func (db *DB) AllFundings(tx Tx) ([]Funding, error) {
+	var fundings []Funding
+	if err := db.IterFundings(tx, IterOptions{}, func(f Funding) error {
+		fundings = append(fundings, f)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through fundings: %w", err)
+	}
+	return fundings, nil
+}
@@ -0,0 +1,468 @@
+package repo
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Mismatch is the stored value of the derived record which differs from the one recomputed from
+// the swap and funding records.
+type Mismatch struct {
+	Table string
+	Key   string
+	Field string
+	// Stored is the stored value, "missing" if there is no record.
+	Stored string
+	// Want is the recomputed value, "none" if there should be no record.
+	Want string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s %s %s: stored %s, want %s", m.Table, m.Key, m.Field, m.Stored, m.Want)
+}
+
+const (
+	missing = "missing"
+	none    = "none"
+)
+
+// total is the recomputed value and count of the aggregate.
+type total struct {
+	value *big.Int
+	times int
+}
+
+func (t *total) add(value *big.Int) {
+	if t.value == nil {
+		t.value = new(big.Int)
+	}
+	t.value.Add(t.value, value)
+	t.times++
+}
+
+type patternID struct {
+	token    common.Address
+	exchange string
+}
+
+// funded is the recomputed funding of the wallet, exchange is the one of the earliest funding.
+type funded struct {
+	total
+	exchange string
+	block    uint64
+}
+
+// derived is the derived data recomputed from the swap and funding records.
+type derived struct {
+	spent    map[common.Address]*total
+	received map[common.Address]*funded
+	tokens   map[common.Address]*total
+	patterns map[patternID]*total
+	// buckets are keyed by bucketKey, nil if some swap has no timestamp.
+	buckets map[string]PatternBucket
+	// indexes are the keys of each swap and funding index table.
+	indexes map[string]map[string]bool
+	// processed are the transactions of the fundings and swaps, they must be marked processed.
+	processed map[common.Hash]uint64
+}
+
+// recompute recomputes the derived data. Patterns are attributed to the exchange of the wallet's account,
+// swaps of wallets without account are not attributed to any pattern.
+func (db *DB) recompute(tx Tx) (*derived, error) {
+	d := &derived{
+		spent:     make(map[common.Address]*total),
+		received:  make(map[common.Address]*funded),
+		tokens:    make(map[common.Address]*total),
+		patterns:  make(map[patternID]*total),
+		buckets:   make(map[string]PatternBucket),
+		indexes:   make(map[string]map[string]bool),
+		processed: make(map[common.Hash]uint64),
+	}
+	for _, table := range []string{swapWalletIndex, swapTokenIndex, swapBlockIndex, fundingWalletIndex} {
+		d.indexes[table] = make(map[string]bool)
+	}
+
+	if err := db.IterFundings(tx, IterOptions{}, func(f Funding) error {
+		r, ok := d.received[f.Wallet]
+		if !ok || f.BlockNumber < r.block {
+			if !ok {
+				r = &funded{}
+				d.received[f.Wallet] = r
+			}
+			r.exchange, r.block = f.Exchange, f.BlockNumber
+		}
+		r.add(f.Value)
+		d.indexes[fundingWalletIndex][string(fundingIndexKey(f.Wallet, f.BlockNumber, f.TxHash))] = true
+		d.processed[f.TxHash] = f.BlockNumber
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through fundings: %w", err)
+	}
+
+	baselines, err := db.ReceivedBaselines(tx)
+	if err != nil {
+		return nil, err
+	}
+	for wallet, baseline := range baselines {
+		if r, ok := d.received[wallet]; ok {
+			r.value.Add(r.value, baseline)
+		}
+	}
+
+	exchanges := make(map[common.Address]string)
+	if err := db.IterAccounts(tx, IterOptions{}, func(a Account) error {
+		exchanges[a.Address] = a.Exchange
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through accounts: %w", err)
+	}
+	for wallet, r := range d.received {
+		if _, ok := exchanges[wallet]; !ok {
+			exchanges[wallet] = r.exchange
+		}
+	}
+
+	if err := db.IterSwaps(tx, IterOptions{}, func(s Swap) error {
+		for table, key := range swapIndexKeys(s) {
+			d.indexes[table][string(key)] = true
+		}
+		d.processed[s.TxHash] = s.BlockNumber
+
+		if d.spent[s.Wallet] == nil {
+			d.spent[s.Wallet] = &total{}
+		}
+		d.spent[s.Wallet].add(s.Value)
+		if d.tokens[s.TokenAddr] == nil {
+			d.tokens[s.TokenAddr] = &total{}
+		}
+		d.tokens[s.TokenAddr].add(s.Value)
+
+		exchange, ok := exchanges[s.Wallet]
+		if !ok {
+			return nil
+		}
+		id := patternID{s.TokenAddr, exchange}
+		if d.patterns[id] == nil {
+			d.patterns[id] = &total{}
+		}
+		d.patterns[id].add(s.Value)
+
+		// NOTE: swaps recorded before the timestamps were stored can't be put into buckets.
+		if s.Timestamp == 0 {
+			d.buckets = nil
+		}
+		if d.buckets == nil {
+			return nil
+		}
+		at := time.Unix(int64(s.Timestamp), 0)
+		for _, res := range []Resolution{Hourly, Daily} {
+			b := PatternBucket{Resolution: res, Bucket: res.Bucket(at), TokenAddr: s.TokenAddr, ExchangeName: exchange, Value: new(big.Int)}
+			key := bucketKey(b)
+			if stored, ok := d.buckets[key]; ok {
+				b = stored
+			}
+			b.Value = new(big.Int).Add(b.Value, s.Value)
+			b.TimesOccured++
+			d.buckets[key] = b
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through swaps: %w", err)
+	}
+	return d, nil
+}
+
+func valueOf(t *total) *big.Int {
+	if t == nil || t.value == nil {
+		return new(big.Int)
+	}
+	return t.value
+}
+
+func timesOf(t *total) int {
+	if t == nil {
+		return 0
+	}
+	return t.times
+}
+
+// Check recomputes every aggregate from the swap and funding records and returns the stored values
+// which differ. Account.Received is checked only for wallets with funding records, older accounts have none.
+// Received of the wallets funded before the fundings were recorded includes their received baseline.
+func (db *DB) Check(tx Tx) ([]Mismatch, error) {
+	d, err := db.recompute(tx)
+	if err != nil {
+		return nil, err
+	}
+	return db.check(tx, d)
+}
+
+func (db *DB) check(tx Tx, d *derived) ([]Mismatch, error) {
+	var mismatches []Mismatch
+	add := func(table, key, field string, stored, want interface{}) {
+		mismatches = append(mismatches, Mismatch{table, key, field, fmt.Sprint(stored), fmt.Sprint(want)})
+	}
+
+	seen := make(map[common.Address]bool)
+	if err := db.IterAccounts(tx, IterOptions{}, func(a Account) error {
+		seen[a.Address] = true
+		key := a.Address.Hex()
+		if want := valueOf(d.spent[a.Address]); a.Spent.Cmp(want) != 0 {
+			add(accountStorage, key, "Spent", a.Spent, want)
+		}
+		if r, ok := d.received[a.Address]; ok && a.Received.Cmp(r.value) != 0 {
+			add(accountStorage, key, "Received", a.Received, r.value)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through accounts: %w", err)
+	}
+	for wallet := range d.received {
+		if !seen[wallet] {
+			add(accountStorage, wallet.Hex(), "", missing, "account")
+		}
+	}
+	for wallet := range d.spent {
+		if !seen[wallet] && d.received[wallet] == nil {
+			add(accountStorage, wallet.Hex(), "", missing, "account")
+		}
+	}
+
+	seen = make(map[common.Address]bool)
+	if err := db.IterTokens(tx, IterOptions{}, func(t Token) error {
+		seen[t.Address] = true
+		key := t.Address.Hex()
+		if want := valueOf(d.tokens[t.Address]); t.TotalBought.Cmp(want) != 0 {
+			add(tokenStorage, key, "TotalBought", t.TotalBought, want)
+		}
+		if want := timesOf(d.tokens[t.Address]); t.TimesBought != want {
+			add(tokenStorage, key, "TimesBought", t.TimesBought, want)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through tokens: %w", err)
+	}
+	for token := range d.tokens {
+		if !seen[token] {
+			add(tokenStorage, token.Hex(), "", missing, "token")
+		}
+	}
+
+	seenPatterns := make(map[patternID]bool)
+	if err := db.IterPatterns(tx, IterOptions{}, func(p Pattern) error {
+		id := patternID{p.TokenAddr, p.ExchangeName}
+		seenPatterns[id] = true
+		key := p.TokenAddr.Hex() + "/" + p.ExchangeName
+		want, ok := d.patterns[id]
+		if !ok {
+			add(patternStorage, key, "", "pattern", none)
+			return nil
+		}
+		if p.Value.Cmp(want.value) != 0 {
+			add(patternStorage, key, "Value", p.Value, want.value)
+		}
+		if p.TimesOccured != want.times {
+			add(patternStorage, key, "TimesOccured", p.TimesOccured, want.times)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through patterns: %w", err)
+	}
+	for id, want := range d.patterns {
+		if !seenPatterns[id] {
+			add(patternStorage, id.token.Hex()+"/"+id.exchange, "", missing, fmt.Sprintf("%v x%d", want.value, want.times))
+		}
+	}
+
+	if d.buckets != nil {
+		names := make(exchangeNames)
+		seenBuckets := make(map[string]bool, len(d.buckets))
+		if err := tx.ForEach(patternBucketStorage, []byte{}, func(k, v []byte) error {
+			b, err := db.decodePatternBucket(tx, names, k, v)
+			if err != nil {
+				return err
+			}
+			key := bucketKey(b)
+			seenBuckets[key] = true
+			want, ok := d.buckets[key]
+			if !ok {
+				add(patternBucketStorage, key, "", "bucket", none)
+				return nil
+			}
+			if b.Value.Cmp(want.Value) != 0 {
+				add(patternBucketStorage, key, "Value", b.Value, want.Value)
+			}
+			if b.TimesOccured != want.TimesOccured {
+				add(patternBucketStorage, key, "TimesOccured", b.TimesOccured, want.TimesOccured)
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("unable to iterate through pattern buckets: %w", err)
+		}
+		for k, want := range d.buckets {
+			if !seenBuckets[k] {
+				add(patternBucketStorage, bucketKey(want), "", missing, fmt.Sprintf("%v x%d", want.Value, want.TimesOccured))
+			}
+		}
+	}
+
+	for _, table := range []string{swapWalletIndex, swapTokenIndex, swapBlockIndex, fundingWalletIndex} {
+		seen := make(map[string]bool, len(d.indexes[table]))
+		if err := tx.ForEach(table, []byte{}, func(k, _ []byte) error {
+			seen[string(k)] = true
+			if !d.indexes[table][string(k)] {
+				add(table, fmt.Sprintf("%x", k), "", "entry", none)
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("unable to iterate through %s: %w", table, err)
+		}
+		for k := range d.indexes[table] {
+			if !seen[k] {
+				add(table, fmt.Sprintf("%x", k), "", missing, "entry")
+			}
+		}
+	}
+
+	// NOTE: the pattern exchange index must mirror the stored patterns whatever their values are.
+	patternIndex := make(map[string]bool)
+	if err := tx.ForEach(patternStorage, []byte{}, func(k, _ []byte) error {
+		if len(k) == patternKeyLength {
+			patternIndex[string(k[common.AddressLength:])+string(k[:common.AddressLength])] = true
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through patterns: %w", err)
+	}
+	seenIndex := make(map[string]bool, len(patternIndex))
+	if err := tx.ForEach(patternExchangeIndex, []byte{}, func(k, _ []byte) error {
+		seenIndex[string(k)] = true
+		if !patternIndex[string(k)] {
+			add(patternExchangeIndex, fmt.Sprintf("%x", k), "", "entry", none)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through %s: %w", patternExchangeIndex, err)
+	}
+	for k := range patternIndex {
+		if !seenIndex[k] {
+			add(patternExchangeIndex, fmt.Sprintf("%x", k), "", missing, "entry")
+		}
+	}
+
+	for txHash := range d.processed {
+		ok, err := db.IsTxProcessed(tx, txHash)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			add(processedTxStorage, txHash.Hex(), "", missing, "marker")
+		}
+	}
+
+	sort.SliceStable(mismatches, func(i, j int) bool {
+		if mismatches[i].Table != mismatches[j].Table {
+			return mismatches[i].Table < mismatches[j].Table
+		}
+		return mismatches[i].Key < mismatches[j].Key
+	})
+	return mismatches, nil
+}
+
+func bucketKey(b PatternBucket) string {
+	return b.Resolution.String() + "/" + strconv.FormatUint(b.Bucket, 10) + "/" + b.TokenAddr.Hex() + "/" + b.ExchangeName
+}
+
+// Rebuild regenerates the derived data from the swap and funding records and returns the mismatches found before.
+// Missing accounts of funded wallets are created, missing tokens are left to the metadata refresh.
+// Pattern buckets are left intact if some swap has no timestamp.
+func (db *DB) Rebuild(tx RwTx) ([]Mismatch, error) {
+	d, err := db.recompute(tx)
+	if err != nil {
+		return nil, err
+	}
+	mismatches, err := db.check(tx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := db.AllAccounts(tx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[common.Address]bool, len(accounts))
+	for _, a := range accounts {
+		seen[a.Address] = true
+		a.Spent = valueOf(d.spent[a.Address])
+		if r, ok := d.received[a.Address]; ok {
+			a.Received = r.value
+		}
+		if err := db.PutAccount(tx, a); err != nil {
+			return nil, err
+		}
+	}
+	for wallet, r := range d.received {
+		if seen[wallet] {
+			continue
+		}
+		if err := db.PutAccount(tx, Account{
+			Address:  wallet,
+			Balance:  new(big.Int),
+			Received: r.value,
+			Spent:    valueOf(d.spent[wallet]),
+			Exchange: r.exchange,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	tokens, err := db.AllTokens(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		t.TotalBought = valueOf(d.tokens[t.Address])
+		t.TimesBought = timesOf(d.tokens[t.Address])
+		if err := db.PutToken(tx, t); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := clearPatterns(tx); err != nil {
+		return nil, err
+	}
+	for id, t := range d.patterns {
+		if err := db.PutPattern(tx, Pattern{TokenAddr: id.token, ExchangeName: id.exchange, Value: t.value, TimesOccured: t.times}); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.buckets != nil {
+		if err := tx.ClearBucket(patternBucketStorage); err != nil {
+			return nil, fmt.Errorf("unable to clear pattern buckets: %w", err)
+		}
+		for _, b := range d.buckets {
+			if err := db.putPatternBucket(tx, b); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := db.RebuildSwapIndexes(tx); err != nil {
+		return nil, fmt.Errorf("unable to rebuild swap indexes: %w", err)
+	}
+	if err := db.RebuildFundingIndex(tx); err != nil {
+		return nil, fmt.Errorf("unable to rebuild funding index: %w", err)
+	}
+	for txHash, blockNumber := range d.processed {
+		if err := db.MarkTxProcessed(tx, txHash, blockNumber); err != nil {
+			return nil, err
+		}
+	}
+	return mismatches, nil
+}
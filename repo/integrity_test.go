@@ -0,0 +1,176 @@
+package repo
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fillIntegrityDB stores two swaps of the funded wallet with the counters they add up to.
+func fillIntegrityDB(t *testing.T, db *DB) (wallet, token common.Address) {
+	wallet = common.BytesToAddress([]byte("wallet"))
+	token = common.BytesToAddress([]byte("token"))
+	s0 := testSwap(0, wallet, token, 10)
+	s0.Timestamp = 1600000000
+	s1 := testSwap(1, wallet, token, 11)
+	s1.Timestamp = 1600000013
+
+	err := db.Update(context.Background(), func(tx RwTx) error {
+		for _, err := range []error{
+			db.PutFunding(tx, Funding{TxHash: common.HexToHash("0xf0"), Exchange: "Binance", Wallet: wallet, Value: big.NewInt(3e18), BlockNumber: 9}),
+			db.PutAccount(tx, Account{Address: wallet, Balance: big.NewInt(0), Received: big.NewInt(3e18), Spent: big.NewInt(2e18), Exchange: "Binance"}),
+			db.PutToken(tx, Token{Address: token, Symbol: "TKN", Price: big.NewInt(1), TotalBought: big.NewInt(2e18), TimesBought: 2}),
+			db.PutPattern(tx, Pattern{TokenAddr: token, ExchangeName: "Binance", Value: big.NewInt(2e18), TimesOccured: 2}),
+			db.PutSwap(tx, s0),
+			db.PutSwap(tx, s1),
+			db.MarkTxProcessed(tx, common.HexToHash("0xf0"), 9),
+			db.MarkTxProcessed(tx, s0.TxHash, s0.BlockNumber),
+			db.MarkTxProcessed(tx, s1.TxHash, s1.BlockNumber),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+		for _, s := range []Swap{s0, s1} {
+			if err := db.AddPatternBuckets(tx, token, "Binance", s.Value, time.Unix(int64(s.Timestamp), 0)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wallet, token
+}
+
+func TestDB_Check(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		drift func(db *DB, tx RwTx, wallet, token common.Address) error
+		want  []Mismatch
+	}{
+		{
+			name:  "consistent",
+			drift: func(*DB, RwTx, common.Address, common.Address) error { return nil },
+		},
+		{
+			name: "counters",
+			drift: func(db *DB, tx RwTx, wallet, token common.Address) error {
+				if err := db.PutAccount(tx, Account{Address: wallet, Balance: big.NewInt(0), Received: big.NewInt(1e18), Spent: big.NewInt(1e18), Exchange: "Binance"}); err != nil {
+					return err
+				}
+				if err := db.PutToken(tx, Token{Address: token, Symbol: "TKN", Price: big.NewInt(1), TotalBought: big.NewInt(2e18), TimesBought: 3}); err != nil {
+					return err
+				}
+				return db.PutPattern(tx, Pattern{TokenAddr: token, ExchangeName: "Binance", Value: big.NewInt(2e18), TimesOccured: 1})
+			},
+			want: []Mismatch{
+				{accountStorage, common.BytesToAddress([]byte("wallet")).Hex(), "Spent", "1000000000000000000", "2000000000000000000"},
+				{accountStorage, common.BytesToAddress([]byte("wallet")).Hex(), "Received", "1000000000000000000", "3000000000000000000"},
+				{patternStorage, common.BytesToAddress([]byte("token")).Hex() + "/Binance", "TimesOccured", "1", "2"},
+				{tokenStorage, common.BytesToAddress([]byte("token")).Hex(), "TimesBought", "3", "2"},
+			},
+		},
+		{
+			name: "received before fundings",
+			drift: func(db *DB, tx RwTx, wallet, token common.Address) error {
+				if err := db.PutAccount(tx, Account{Address: wallet, Balance: big.NewInt(0), Received: big.NewInt(5e18), Spent: big.NewInt(2e18), Exchange: "Binance"}); err != nil {
+					return err
+				}
+				if err := db.recordReceivedBaselines(tx); err != nil {
+					return err
+				}
+				if err := db.PutFunding(tx, Funding{TxHash: common.HexToHash("0xf1"), Exchange: "Binance", Wallet: wallet, Value: big.NewInt(1e18), BlockNumber: 12}); err != nil {
+					return err
+				}
+				if err := db.MarkTxProcessed(tx, common.HexToHash("0xf1"), 12); err != nil {
+					return err
+				}
+				return db.PutAccount(tx, Account{Address: wallet, Balance: big.NewInt(0), Received: big.NewInt(6e18), Spent: big.NewInt(2e18), Exchange: "Binance"})
+			},
+		},
+		{
+			name: "received before fundings drift",
+			drift: func(db *DB, tx RwTx, wallet, token common.Address) error {
+				if err := db.PutReceivedBaseline(tx, wallet, big.NewInt(2e18)); err != nil {
+					return err
+				}
+				return db.PutAccount(tx, Account{Address: wallet, Balance: big.NewInt(0), Received: big.NewInt(3e18), Spent: big.NewInt(2e18), Exchange: "Binance"})
+			},
+			want: []Mismatch{
+				{accountStorage, common.BytesToAddress([]byte("wallet")).Hex(), "Received", "3000000000000000000", "5000000000000000000"},
+			},
+		},
+		{
+			name: "records",
+			drift: func(db *DB, tx RwTx, wallet, token common.Address) error {
+				if err := tx.Delete(accountStorage, wallet.Bytes(), nil); err != nil {
+					return err
+				}
+				if err := tx.ClearBucket(swapBlockIndex); err != nil {
+					return err
+				}
+				return db.PutPattern(tx, Pattern{TokenAddr: token, ExchangeName: "Kraken", Value: big.NewInt(1), TimesOccured: 1})
+			},
+			want: []Mismatch{
+				{accountStorage, common.BytesToAddress([]byte("wallet")).Hex(), "", "missing", "account"},
+				{patternStorage, common.BytesToAddress([]byte("token")).Hex() + "/Kraken", "", "pattern", "none"},
+				{swapBlockIndex, "000000000000000a" + "0000000000000000000000000000000000000000000000000000000000000000" + "00000000", "", "missing", "entry"},
+				{swapBlockIndex, "000000000000000b" + "0000000000000000000000000000000000000000000000000000000000000001" + "00000000", "", "missing", "entry"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			db := &DB{d: newTestDB(t)}
+			wallet, token := fillIntegrityDB(t, db)
+			if err := db.Update(context.Background(), func(tx RwTx) error {
+				return tt.drift(db, tx, wallet, token)
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []Mismatch
+			if err := db.View(context.Background(), func(tx Tx) (err error) {
+				got, err = db.Check(tx)
+				return err
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("DB.Check() mismatch (-got +want):\n%s", cmp.Diff(got, tt.want))
+			}
+
+			var fixed []Mismatch
+			if err := db.Update(context.Background(), func(tx RwTx) (err error) {
+				fixed, err = db.Rebuild(tx)
+				return err
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(fixed, tt.want) {
+				t.Errorf("DB.Rebuild() mismatch (-got +want):\n%s", cmp.Diff(fixed, tt.want))
+			}
+
+			if err := db.View(context.Background(), func(tx Tx) (err error) {
+				got, err = db.Check(tx)
+				return err
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 0 {
+				t.Errorf("DB.Check() after DB.Rebuild() = %v, want none", got)
+			}
+		})
+	}
+}
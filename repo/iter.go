@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrStop is returned from the iterator callbacks to stop the iteration early, the iterator returns nil then.
+var ErrStop = errors.New("stop iteration")
+
+// IterOptions tells where the iteration over the table starts, in which order and how many records are visited.
+type IterOptions struct {
+	// Start is the key the iteration starts at, the first key or the last one if Reverse is set.
+	// Reverse iteration starts at the greatest key less than or equal to Start.
+	Start []byte
+	// Limit is the maximum number of visited records, zero visits all of them.
+	Limit int
+	// Reverse visits records in descending key order.
+	Reverse bool
+}
+
+// iterate walks the table by the options until the walker returns an error, ErrStop stops the iteration without error.
+func iterate(tx Tx, table string, opts IterOptions, walker func(k, v []byte) error) error {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return fmt.Errorf("could not open %s cursor: %w", table, err)
+	}
+	defer c.Close()
+
+	var k, v []byte
+	switch {
+	case !opts.Reverse && len(opts.Start) == 0:
+		k, v, err = c.First()
+	case !opts.Reverse:
+		k, v, err = c.Seek(opts.Start)
+	case len(opts.Start) == 0:
+		k, v, err = c.Last()
+	default:
+		k, v, err = c.Seek(opts.Start)
+		if err == nil && !bytes.Equal(k, opts.Start) {
+			// NOTE: cursor is positioned after the start key, step back to the previous record.
+			if k == nil {
+				k, v, err = c.Last()
+			} else {
+				k, v, err = c.Prev()
+			}
+		}
+	}
+
+	for n := 0; ; n++ {
+		if err != nil {
+			return fmt.Errorf("could not iterate through %s: %w", table, err)
+		}
+		if k == nil || (opts.Limit > 0 && n >= opts.Limit) {
+			return nil
+		}
+		if err := walker(k, v); err != nil {
+			if err == ErrStop {
+				return nil
+			}
+			return err
+		}
+
+		if opts.Reverse {
+			k, v, err = c.Prev()
+		} else {
+			k, v, err = c.Next()
+		}
+	}
+}
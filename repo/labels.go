@@ -0,0 +1,193 @@
+package repo
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// LabelFormat is the encoding of the hot wallet label files.
+type LabelFormat string
+
+const (
+	// LabelJSON is JSON array of {"Name", "Address"} objects, the layout of testdata/exchanges.json.
+	LabelJSON LabelFormat = "json"
+	// LabelCSV has the header with address and name columns followed by one label per line,
+	// label is accepted instead of name and other columns are ignored.
+	LabelCSV LabelFormat = "csv"
+)
+
+// LabelFormatOf returns the LabelFormat of the file by it's extension.
+func LabelFormatOf(path string) (LabelFormat, error) {
+	switch f := LabelFormat(strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))); f {
+	case LabelJSON, LabelCSV:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown label file format of %s, expected .json or .csv", path)
+	}
+}
+
+//go:embed testdata/exchanges.json
+var defaultLabels []byte
+
+// DefaultLabels returns the hot wallet labels bundled with mettu.
+func DefaultLabels() ([]Exchange, error) {
+	return ReadLabels(bytes.NewReader(defaultLabels), LabelJSON)
+}
+
+// label is the entry of the JSON label file.
+type label struct {
+	Name    string `json:"Name"`
+	Address string `json:"Address"`
+}
+
+// ReadLabels reads hot wallet labels, names are trimmed and IDs are left unset.
+func ReadLabels(r io.Reader, format LabelFormat) ([]Exchange, error) {
+	var labels []label
+	switch format {
+	case LabelJSON:
+		if err := json.NewDecoder(r).Decode(&labels); err != nil {
+			return nil, fmt.Errorf("unable to decode labels: %w", err)
+		}
+	case LabelCSV:
+		records, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read labels: %w", err)
+		}
+		if len(records) == 0 {
+			return nil, errors.New("missing label header")
+		}
+		addrCol, nameCol := -1, -1
+		for i, col := range records[0] {
+			switch strings.ToLower(strings.TrimSpace(col)) {
+			case "address":
+				addrCol = i
+			case "name", "label":
+				nameCol = i
+			}
+		}
+		if addrCol < 0 || nameCol < 0 {
+			return nil, fmt.Errorf("label header %q has no address and name columns", strings.Join(records[0], ","))
+		}
+		for _, rec := range records[1:] {
+			labels = append(labels, label{Name: rec[nameCol], Address: rec[addrCol]})
+		}
+	default:
+		return nil, fmt.Errorf("unknown label format %q", format)
+	}
+
+	exchanges := make([]Exchange, 0, len(labels))
+	for i, l := range labels {
+		addr, err := parseValue(kindAddress, strings.TrimSpace(l.Address))
+		if err != nil {
+			return nil, fmt.Errorf("label %d: %w", i+1, err)
+		}
+		name := strings.TrimSpace(l.Name)
+		if name == "" {
+			return nil, fmt.Errorf("label %d: empty name of %v", i+1, addr)
+		}
+		exchanges = append(exchanges, Exchange{Name: name, Address: addr.(common.Address)})
+	}
+	return exchanges, nil
+}
+
+// WriteLabels writes hot wallet labels in the format ReadLabels reads.
+func WriteLabels(w io.Writer, format LabelFormat, exchanges []Exchange) error {
+	switch format {
+	case LabelJSON:
+		labels := make([]label, len(exchanges))
+		for i, e := range exchanges {
+			labels[i] = label{Name: e.Name, Address: e.Address.Hex()}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(labels)
+	case LabelCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"address", "name"})
+		for _, e := range exchanges {
+			cw.Write([]string{e.Address.Hex(), e.Name})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown label format %q", format)
+	}
+}
+
+// LabelConflict is the label of the address which already has another name.
+type LabelConflict struct {
+	Address common.Address
+	// Existing is the name the address is stored with or labeled with earlier in the file.
+	Existing string
+	Label    string
+}
+
+func (c LabelConflict) String() string {
+	return fmt.Sprintf("%v is labeled %q, but it is %q already", c.Address, c.Label, c.Existing)
+}
+
+// LabelReport sorts the labels by what importing them does.
+type LabelReport struct {
+	// Added are the new hot wallets in the order of the labels.
+	Added []Exchange
+	// Unchanged is the number of labels the addresses are stored with already.
+	Unchanged int
+	// Duplicates is the number of labels repeated in the file.
+	Duplicates int
+	// Conflicts are the labels which are not imported.
+	Conflicts []LabelConflict
+}
+
+// PlanLabels compares the labels with the stored hot wallets and with each other, nothing is written.
+func (db *DB) PlanLabels(tx Tx, labels []Exchange) (LabelReport, error) {
+	var report LabelReport
+	seen := make(map[common.Address]string, len(labels))
+	for _, l := range labels {
+		if name, ok := seen[l.Address]; ok {
+			if name == l.Name {
+				report.Duplicates++
+			} else {
+				report.Conflicts = append(report.Conflicts, LabelConflict{l.Address, name, l.Name})
+			}
+			continue
+		}
+		seen[l.Address] = l.Name
+
+		stored, err := db.PeekExchange(tx, l.Address)
+		if err != nil {
+			return LabelReport{}, err
+		}
+		switch stored.Name {
+		case "":
+			report.Added = append(report.Added, Exchange{Name: l.Name, Address: l.Address})
+		case l.Name:
+			report.Unchanged++
+		default:
+			report.Conflicts = append(report.Conflicts, LabelConflict{l.Address, stored.Name, l.Name})
+		}
+	}
+	return report, nil
+}
+
+// ImportLabels puts the new hot wallets of the labels, conflicting labels are reported and skipped.
+func (db *DB) ImportLabels(tx RwTx, labels []Exchange) (LabelReport, error) {
+	report, err := db.PlanLabels(tx, labels)
+	if err != nil {
+		return LabelReport{}, err
+	}
+	for _, e := range report.Added {
+		if err := db.PutExchange(tx, e); err != nil {
+			return LabelReport{}, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,172 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadLabels(t *testing.T) {
+	t.Parallel()
+	var (
+		a = common.HexToAddress("0x05f51aab068caa6ab7eeb672f88c180f67f17ec7")
+		b = common.HexToAddress("0x2ddd202174a72514ed522e77972b461b03155525")
+	)
+	tests := []struct {
+		name    string
+		format  LabelFormat
+		data    string
+		want    []Exchange
+		wantErr bool
+	}{
+		{
+			name:   "json",
+			format: LabelJSON,
+			data:   `[{"Name":"ABCC","Address":"0x05f51aab068caa6ab7eeb672f88c180f67f17ec7"},{"Name":" Alcumex ","Address":"0x2ddd202174a72514ed522e77972b461b03155525"}]`,
+			want:   []Exchange{{Name: "ABCC", Address: a}, {Name: "Alcumex", Address: b}},
+		},
+		{
+			name:   "csv",
+			format: LabelCSV,
+			data:   "source,Label,Address\netherscan,ABCC,0x05f51aab068caa6ab7eeb672f88c180f67f17ec7\nmanual,Alcumex, 0x2ddd202174a72514ed522e77972b461b03155525\n",
+			want:   []Exchange{{Name: "ABCC", Address: a}, {Name: "Alcumex", Address: b}},
+		},
+		{
+			name:    "csv without name column",
+			format:  LabelCSV,
+			data:    "address\n0x05f51aab068caa6ab7eeb672f88c180f67f17ec7\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid address",
+			format:  LabelJSON,
+			data:    `[{"Name":"ABCC","Address":"0x05f5"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "empty name",
+			format:  LabelCSV,
+			data:    "address,name\n0x05f51aab068caa6ab7eeb672f88c180f67f17ec7, \n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ReadLabels(strings.NewReader(tt.data), tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); !tt.wantErr && diff != "" {
+				t.Errorf("ReadLabels() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteLabels(t *testing.T) {
+	t.Parallel()
+	exchanges := []Exchange{
+		{Name: "ABCC", Address: common.BytesToAddress([]byte("abcc"))},
+		{Name: "Alcumex", Address: common.BytesToAddress([]byte("alcumex"))},
+	}
+	for _, format := range []LabelFormat{LabelJSON, LabelCSV} {
+		var buf bytes.Buffer
+		if err := WriteLabels(&buf, format, exchanges); err != nil {
+			t.Fatalf("WriteLabels(%s) error = %v", format, err)
+		}
+		got, err := ReadLabels(&buf, format)
+		if err != nil {
+			t.Fatalf("ReadLabels(%s) error = %v", format, err)
+		}
+		if diff := cmp.Diff(exchanges, got); diff != "" {
+			t.Errorf("%s labels mismatch (-want +got):\n%s", format, diff)
+		}
+	}
+}
+
+func TestDB_PlanLabels(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	var (
+		stored  = common.BytesToAddress([]byte("stored"))
+		renamed = common.BytesToAddress([]byte("renamed"))
+		fresh   = common.BytesToAddress([]byte("fresh"))
+		twice   = common.BytesToAddress([]byte("twice"))
+	)
+	labels := []Exchange{
+		{Name: "Kraken", Address: stored},
+		{Name: "Binance", Address: renamed},
+		{Name: "Binance", Address: fresh},
+		{Name: "Binance", Address: fresh},
+		{Name: "Binance", Address: twice},
+		{Name: "Kraken", Address: twice},
+	}
+	want := LabelReport{
+		Added:      []Exchange{{Name: "Binance", Address: fresh}, {Name: "Binance", Address: twice}},
+		Unchanged:  1,
+		Duplicates: 1,
+		Conflicts: []LabelConflict{
+			{Address: renamed, Existing: "Kraken", Label: "Binance"},
+			{Address: twice, Existing: "Binance", Label: "Kraken"},
+		},
+	}
+
+	err := db.Update(context.Background(), func(tx RwTx) error {
+		for _, addr := range []common.Address{stored, renamed} {
+			if err := db.PutExchange(tx, Exchange{Name: "Kraken", Address: addr}); err != nil {
+				return err
+			}
+		}
+
+		got, err := db.PlanLabels(tx, labels)
+		if err != nil {
+			return err
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("DB.PlanLabels() mismatch (-want +got):\n%s", diff)
+		}
+		if e, err := db.PeekExchange(tx, fresh); err != nil || e.Name != "" {
+			t.Errorf("DB.PlanLabels() stored %v, err %v", e, err)
+		}
+
+		got, err = db.ImportLabels(tx, labels)
+		if err != nil {
+			return err
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("DB.ImportLabels() mismatch (-want +got):\n%s", diff)
+		}
+		for _, l := range []Exchange{{Name: "Binance", Address: fresh}, {Name: "Binance", Address: twice}, {Name: "Kraken", Address: renamed}} {
+			e, err := db.PeekExchange(tx, l.Address)
+			if err != nil {
+				return err
+			}
+			if e.Name != l.Name {
+				t.Errorf("DB.PeekExchange(%v).Name = %q, want %q", l.Address, e.Name, l.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefaultLabels(t *testing.T) {
+	t.Parallel()
+
+	labels, err := DefaultLabels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) == 0 {
+		t.Error("DefaultLabels() returned no labels")
+	}
+}
@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/internal/cbor"
+)
+
+// WalletScore is the performance of the CEX funded wallet.
+type WalletScore struct {
+	Wallet   common.Address
+	Exchange string
+
+	Swaps          int
+	DistinctTokens int
+	// WinRate is the share of swaps with positive unrealized return.
+	WinRate      float64
+	MedianReturn float64
+	// Reached2x is the number of swaps which at least doubled.
+	Reached2x int
+	// MedianBlocksTo2x is the median number of blocks it took the doubled swaps to double.
+	MedianBlocksTo2x uint64
+	// RecencyReturn is the average return where recent swaps weigh more.
+	RecencyReturn float64
+
+	Score float64
+	// BlockNumber is the block the score was computed at.
+	BlockNumber uint64
+}
+
+type _walletScore struct {
+	Wallet           common.Address
+	Exchange         string
+	Swaps            int
+	DistinctTokens   int
+	WinRate          float64
+	MedianReturn     float64
+	Reached2x        int
+	MedianBlocksTo2x uint64
+	RecencyReturn    float64
+	Score            float64
+	BlockNumber      uint64
+}
+
+// PutLeaderboard replaces the stored leaderboard, scores are expected to be sorted by rank.
+func (db *DB) PutLeaderboard(tx RwTx, scores []WalletScore) error {
+	if err := tx.ClearBucket(leaderboardStorage); err != nil {
+		return fmt.Errorf("unable to clear leaderboard: %w", err)
+	}
+
+	for i, s := range scores {
+		if err := putWalletScore(tx, uint32(i), s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// putWalletScore puts the score of the given rank into the leaderboardStorage.
+func putWalletScore(tx RwTx, rank uint32, s WalletScore) error {
+	var buf bytes.Buffer
+	if err := cbor.Marshal(&buf, _walletScore(s)); err != nil {
+		return fmt.Errorf("unable to encode wallet score: %w", err)
+	}
+
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, rank)
+	if err := tx.Put(leaderboardStorage, key, buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to put wallet score: %w", err)
+	}
+	return nil
+}
+
+// Leaderboard returns up to limit best wallets by rank, zero limit returns the whole leaderboard.
+func (db *DB) Leaderboard(tx Tx, limit int) ([]WalletScore, error) {
+	var scores []WalletScore
+	if err := tx.ForEach(leaderboardStorage, []byte{}, func(_, v []byte) error {
+		if limit > 0 && len(scores) == limit {
+			return ErrStop
+		}
+
+		var s _walletScore
+		if err := cbor.Unmarshal(bytes.NewReader(v), &s); err != nil {
+			return fmt.Errorf("unable to decode wallet score: %w", err)
+		}
+		scores = append(scores, WalletScore(s))
+		return nil
+	}); err != nil && err != ErrStop {
+		return nil, fmt.Errorf("unable to iterate through leaderboard: %w", err)
+	}
+
+	return scores, nil
+}
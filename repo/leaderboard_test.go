@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDB_Leaderboard(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	scores := []WalletScore{
+		{Wallet: common.BytesToAddress([]byte("wallet0")), Exchange: "Binance", Swaps: 10, WinRate: 0.8, Score: 3.5},
+		{Wallet: common.BytesToAddress([]byte("wallet1")), Exchange: "Kraken", Swaps: 3, WinRate: 0.33, Score: 1.2},
+		{Wallet: common.BytesToAddress([]byte("wallet2")), Exchange: "Binance", Swaps: 1, Score: -0.5},
+	}
+
+	for _, board := range [][]WalletScore{scores[1:], scores} {
+		tx, err := db.BeginRw(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = db.PutLeaderboard(tx, board); err != nil {
+			t.Fatalf("DB.PutLeaderboard() error = %v", err)
+		}
+		if err = tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roTx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer roTx.Rollback()
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []WalletScore
+	}{
+		{name: "all", limit: 0, want: scores},
+		{name: "top2", limit: 2, want: scores[:2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.Leaderboard(roTx, tt.limit)
+			if err != nil {
+				t.Fatalf("DB.Leaderboard() error = %v", err)
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("DB.Leaderboard() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+)
+
+// mdbxBackend is Backend over the mdbx database.
+type mdbxBackend struct {
+	d kv.RwDB
+}
+
+func openMdbx(path string, readonly bool) (Backend, error) {
+	opts := mdbx.NewMDBX(nil).Path(path).WithTablessCfg(
+		func(defaultBuckets kv.TableCfg) kv.TableCfg {
+			return kvTablesCfg
+		})
+	if readonly {
+		opts = opts.Readonly()
+	}
+	d, err := opts.Open()
+	if err != nil {
+		return nil, err
+	}
+	return mdbxBackend{d}, nil
+}
+
+func (b mdbxBackend) BeginRo(ctx context.Context) (Tx, error) {
+	tx, err := b.d.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return mdbxTx{tx}, nil
+}
+
+func (b mdbxBackend) BeginRw(ctx context.Context) (RwTx, error) {
+	tx, err := b.d.BeginRw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return mdbxRwTx{tx}, nil
+}
+
+func (b mdbxBackend) Close() {
+	b.d.Close()
+}
+
+// mdbxTx and mdbxRwTx narrow cursors of the mdbx transactions to Cursor.
+type mdbxTx struct {
+	kv.Tx
+}
+
+func (tx mdbxTx) Cursor(table string) (Cursor, error) {
+	return tx.Tx.Cursor(table)
+}
+
+type mdbxRwTx struct {
+	kv.RwTx
+}
+
+func (tx mdbxRwTx) Cursor(table string) (Cursor, error) {
+	return tx.RwTx.Cursor(table)
+}
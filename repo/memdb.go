@@ -0,0 +1,310 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var errTxDone = errors.New("transaction is already committed or rolled back")
+
+// memBackend is pure-Go Backend keeping every table as a sorted slice.
+// Writers are serialized, readers see the tables committed before they began.
+type memBackend struct {
+	// writer is held by the open read-write transaction.
+	writer sync.Mutex
+
+	mu     sync.RWMutex
+	tables map[string]memTable
+}
+
+type memEntry struct {
+	k, v []byte
+}
+
+// memTable is sorted by key, committed tables are never modified.
+type memTable []memEntry
+
+// search returns index of the first entry with the key greater than or equal to k.
+func (t memTable) search(k []byte) int {
+	return sort.Search(len(t), func(i int) bool { return bytes.Compare(t[i].k, k) >= 0 })
+}
+
+func newMemBackend() *memBackend {
+	tables := make(map[string]memTable, len(kvTables))
+	for _, table := range kvTables {
+		tables[table] = nil
+	}
+	return &memBackend{tables: tables}
+}
+
+func (b *memBackend) snapshot() map[string]memTable {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.tables
+}
+
+func (b *memBackend) BeginRo(context.Context) (Tx, error) {
+	return &memTx{base: b.snapshot()}, nil
+}
+
+func (b *memBackend) BeginRw(ctx context.Context) (RwTx, error) {
+	b.writer.Lock()
+	return &memTx{b: b, base: b.snapshot(), dirty: make(map[string]memTable)}, nil
+}
+
+func (b *memBackend) Close() {}
+
+// memTx is transaction of the memBackend, tables written by the read-write transaction are copied on the first write.
+type memTx struct {
+	b    *memBackend
+	base map[string]memTable
+	// dirty are tables modified by the transaction, nil for read-only transactions.
+	dirty map[string]memTable
+	done  bool
+}
+
+func (tx *memTx) table(name string) (memTable, error) {
+	if tx.done {
+		return nil, errTxDone
+	}
+	if t, ok := tx.dirty[name]; ok {
+		return t, nil
+	}
+	t, ok := tx.base[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown table %s", name)
+	}
+	return t, nil
+}
+
+func (tx *memTx) GetOne(table string, key []byte) ([]byte, error) {
+	t, err := tx.table(table)
+	if err != nil {
+		return nil, err
+	}
+	if i := t.search(key); i < len(t) && bytes.Equal(t[i].k, key) {
+		return t[i].v, nil
+	}
+	return nil, nil
+}
+
+func (tx *memTx) Has(table string, key []byte) (bool, error) {
+	v, err := tx.GetOne(table, key)
+	return v != nil, err
+}
+
+func (tx *memTx) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(fromPrefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *memTx) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *memTx) Cursor(table string) (Cursor, error) {
+	if _, err := tx.table(table); err != nil {
+		return nil, err
+	}
+	return &memCursor{tx: tx, table: table}, nil
+}
+
+func (tx *memTx) writable(name string) (memTable, error) {
+	if tx.dirty == nil {
+		return nil, errors.New("read-only transaction")
+	}
+	t, err := tx.table(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := tx.dirty[name]; !ok {
+		t = append(memTable(nil), t...)
+	}
+	return t, nil
+}
+
+func (tx *memTx) Put(table string, k, v []byte) error {
+	t, err := tx.writable(table)
+	if err != nil {
+		return err
+	}
+
+	e := memEntry{common.CopyBytes(k), common.CopyBytes(v)}
+	if e.v == nil {
+		e.v = []byte{}
+	}
+	i := t.search(k)
+	if i < len(t) && bytes.Equal(t[i].k, k) {
+		t[i] = e
+	} else {
+		t = append(t, memEntry{})
+		copy(t[i+1:], t[i:])
+		t[i] = e
+	}
+	tx.dirty[table] = t
+	return nil
+}
+
+func (tx *memTx) Delete(table string, k, _ []byte) error {
+	t, err := tx.writable(table)
+	if err != nil {
+		return err
+	}
+	if i := t.search(k); i < len(t) && bytes.Equal(t[i].k, k) {
+		t = append(t[:i], t[i+1:]...)
+	}
+	tx.dirty[table] = t
+	return nil
+}
+
+func (tx *memTx) ClearBucket(table string) error {
+	if _, err := tx.writable(table); err != nil {
+		return err
+	}
+	tx.dirty[table] = nil
+	return nil
+}
+
+func (tx *memTx) Commit() error {
+	if tx.done {
+		return errTxDone
+	}
+	if tx.dirty != nil {
+		tables := make(map[string]memTable, len(tx.base))
+		for name, t := range tx.base {
+			tables[name] = t
+		}
+		for name, t := range tx.dirty {
+			tables[name] = t
+		}
+
+		tx.b.mu.Lock()
+		tx.b.tables = tables
+		tx.b.mu.Unlock()
+	}
+	tx.finish()
+	return nil
+}
+
+func (tx *memTx) Rollback() {
+	if !tx.done {
+		tx.finish()
+	}
+}
+
+func (tx *memTx) finish() {
+	tx.done = true
+	if tx.dirty != nil {
+		tx.b.writer.Unlock()
+	}
+}
+
+// memCursor remembers the current key rather than the position,
+// so it stays valid while the table is modified by the same transaction.
+type memCursor struct {
+	tx    *memTx
+	table string
+	k     []byte
+	// exhausted is set once the cursor moved past either end of the table.
+	exhausted bool
+}
+
+func (c *memCursor) at(t memTable, i int) ([]byte, []byte, error) {
+	if i < 0 || i >= len(t) {
+		c.k, c.exhausted = nil, true
+		return nil, nil, nil
+	}
+	c.k, c.exhausted = t[i].k, false
+	return t[i].k, t[i].v, nil
+}
+
+func (c *memCursor) First() ([]byte, []byte, error) {
+	t, err := c.tx.table(c.table)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.at(t, 0)
+}
+
+func (c *memCursor) Last() ([]byte, []byte, error) {
+	t, err := c.tx.table(c.table)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.at(t, len(t)-1)
+}
+
+func (c *memCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	t, err := c.tx.table(c.table)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.at(t, t.search(seek))
+}
+
+func (c *memCursor) Next() ([]byte, []byte, error) {
+	if c.exhausted {
+		return nil, nil, nil
+	}
+	if c.k == nil {
+		return c.First()
+	}
+	t, err := c.tx.table(c.table)
+	if err != nil {
+		return nil, nil, err
+	}
+	i := t.search(c.k)
+	if i < len(t) && bytes.Equal(t[i].k, c.k) {
+		i++
+	}
+	return c.at(t, i)
+}
+
+func (c *memCursor) Prev() ([]byte, []byte, error) {
+	if c.exhausted {
+		return nil, nil, nil
+	}
+	if c.k == nil {
+		return c.Last()
+	}
+	t, err := c.tx.table(c.table)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.at(t, t.search(c.k)-1)
+}
+
+func (c *memCursor) Close() {}
@@ -0,0 +1,175 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/internal/cbor"
+	"github.com/gelfand/mettu/lib"
+)
+
+// Pair is Uniswap V2 pair with it's reserves as of BlockNumber.
+type Pair struct {
+	Address     common.Address
+	Factory     common.Address
+	Token0      common.Address
+	Token1      common.Address
+	Reserve0    *big.Int
+	Reserve1    *big.Int
+	BlockNumber uint64
+}
+
+// Reserves returns pair reserves ordered for the swap from tokenIn.
+func (p Pair) Reserves(tokenIn common.Address) lib.Reserves {
+	if tokenIn == p.Token0 {
+		return lib.Reserves{In: p.Reserve0, Out: p.Reserve1}
+	}
+	return lib.Reserves{In: p.Reserve1, Out: p.Reserve0}
+}
+
+type _pair struct {
+	Factory     common.Address
+	Token0      common.Address
+	Token1      common.Address
+	Reserve0    []byte
+	Reserve1    []byte
+	BlockNumber uint64
+}
+
+// pairIndexKey returns factory|token0|token1 key of the pairIndexStorage,
+// tokens are sorted the same way as the factory does.
+func pairIndexKey(factory, tokenA, tokenB common.Address) []byte {
+	if bytes.Compare(tokenA.Bytes(), tokenB.Bytes()) > 0 {
+		tokenA, tokenB = tokenB, tokenA
+	}
+
+	key := make([]byte, 0, 3*common.AddressLength)
+	key = append(key, factory.Bytes()...)
+	key = append(key, tokenA.Bytes()...)
+	key = append(key, tokenB.Bytes()...)
+	return key
+}
+
+// PutPair puts Pair into the pairStorage and indexes it by factory and tokens.
+func (db *DB) PutPair(tx RwTx, p Pair) error {
+	pairVal := _pair{
+		Factory:     p.Factory,
+		Token0:      p.Token0,
+		Token1:      p.Token1,
+		Reserve0:    p.Reserve0.Bytes(),
+		Reserve1:    p.Reserve1.Bytes(),
+		BlockNumber: p.BlockNumber,
+	}
+
+	var buf bytes.Buffer
+	if err := cbor.Marshal(&buf, pairVal); err != nil {
+		return fmt.Errorf("unable to encode pair record: %w", err)
+	}
+
+	if err := tx.Put(pairStorage, p.Address.Bytes(), buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to put pair record: %w", err)
+	}
+	if err := tx.Put(pairIndexStorage, pairIndexKey(p.Factory, p.Token0, p.Token1), p.Address.Bytes()); err != nil {
+		return fmt.Errorf("unable to put pair index record: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) HasPair(tx Tx, addr common.Address) (bool, error) {
+	return tx.Has(pairStorage, addr.Bytes())
+}
+
+// PeekPair returns Pair from the pairStorage by it's address.
+func (db *DB) PeekPair(tx Tx, addr common.Address) (Pair, error) {
+	val, err := tx.GetOne(pairStorage, addr.Bytes())
+	if err != nil {
+		return Pair{}, fmt.Errorf("could not peek pair record: %w", err)
+	}
+
+	var pairVal _pair
+	if err := cbor.Unmarshal(bytes.NewReader(val), &pairVal); err != nil {
+		return Pair{}, fmt.Errorf("could not unmarshal pair value: %w", err)
+	}
+
+	return decodePair(addr, pairVal), nil
+}
+
+// PairAddress returns address of the pair created by the factory for the given tokens,
+// ok is false if pair is not stored yet.
+func (db *DB) PairAddress(tx Tx, factory, tokenA, tokenB common.Address) (addr common.Address, ok bool, err error) {
+	val, err := tx.GetOne(pairIndexStorage, pairIndexKey(factory, tokenA, tokenB))
+	if err != nil {
+		return common.Address{}, false, fmt.Errorf("could not peek pair index record: %w", err)
+	}
+	if val == nil {
+		return common.Address{}, false, nil
+	}
+
+	return common.BytesToAddress(val), true, nil
+}
+
+// IterPairs calls f for pairs ordered by address, Start of the options is the address bytes.
+func (db *DB) IterPairs(tx Tx, opts IterOptions, f func(Pair) error) error {
+	return iterate(tx, pairStorage, opts, func(k, v []byte) error {
+		var pairVal _pair
+		if err := cbor.Unmarshal(bytes.NewReader(v), &pairVal); err != nil {
+			return fmt.Errorf("unable to decode pair record: %w", err)
+		}
+		return f(decodePair(common.BytesToAddress(k), pairVal))
+	})
+}
+
+// AllPairs returns all pairs stored in the pairStorage.
+func (db *DB) AllPairs(tx Tx) ([]Pair, error) {
+	var pairs []Pair
+	if err := db.IterPairs(tx, IterOptions{}, func(p Pair) error {
+		pairs = append(pairs, p)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("could not retrieve all pair records: %w", err)
+	}
+
+	return pairs, nil
+}
+
+func decodePair(addr common.Address, pairVal _pair) Pair {
+	return Pair{
+		Address:     addr,
+		Factory:     pairVal.Factory,
+		Token0:      pairVal.Token0,
+		Token1:      pairVal.Token1,
+		Reserve0:    new(big.Int).SetBytes(pairVal.Reserve0),
+		Reserve1:    new(big.Int).SetBytes(pairVal.Reserve1),
+		BlockNumber: pairVal.BlockNumber,
+	}
+}
+
+// reservesHeadKey is the headStorage key of the last block whose `Sync` events were applied to the pairs.
+var reservesHeadKey = []byte("reserves")
+
+// PutReservesHead records the last block whose `Sync` events were applied to the stored pairs.
+func (db *DB) PutReservesHead(tx RwTx, blockNumber uint64) error {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, blockNumber)
+	if err := tx.Put(headStorage, reservesHeadKey, v); err != nil {
+		return fmt.Errorf("unable to put reserves head: %w", err)
+	}
+	return nil
+}
+
+// ReservesHead returns the last block whose `Sync` events were applied to the stored pairs,
+// zero if it was never recorded.
+func (db *DB) ReservesHead(tx Tx) (uint64, error) {
+	v, err := tx.GetOne(headStorage, reservesHeadKey)
+	if err != nil {
+		return 0, fmt.Errorf("could not get reserves head: %w", err)
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/lib"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDB_PutPeekPair(t *testing.T) {
+	t.Parallel()
+
+	type fields struct {
+		d Backend
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		pair   Pair
+	}{
+		{
+			name:   "test0",
+			fields: fields{newTestDB(t)},
+			pair: Pair{
+				Address:     common.BytesToAddress([]byte("pair")),
+				Factory:     common.BytesToAddress([]byte("factory")),
+				Token0:      common.BytesToAddress([]byte("token0")),
+				Token1:      common.BytesToAddress([]byte("token1")),
+				Reserve0:    big.NewInt(1e18),
+				Reserve1:    big.NewInt(3e9),
+				BlockNumber: 13_000_000,
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			db := &DB{
+				d: tt.fields.d,
+			}
+			tx, err := db.BeginRw(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = db.PutPair(tx, tt.pair); err != nil {
+				t.Errorf("DB.PutPair() error = %v", err)
+			}
+			if err = tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+
+			roTx, err := db.BeginRo(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer roTx.Rollback()
+
+			got, err := db.PeekPair(roTx, tt.pair.Address)
+			if err != nil {
+				t.Fatalf("DB.PeekPair() error = %v", err)
+			}
+			if !cmp.Equal(got, tt.pair, cmp.AllowUnexported(big.Int{})) {
+				t.Errorf("DB.PeekPair() = %v, want %v", got, tt.pair)
+			}
+
+			// NOTE: index must not depend on the order of the tokens.
+			addr, ok, err := db.PairAddress(roTx, tt.pair.Factory, tt.pair.Token1, tt.pair.Token0)
+			if err != nil {
+				t.Fatalf("DB.PairAddress() error = %v", err)
+			}
+			if !ok || addr != tt.pair.Address {
+				t.Errorf("DB.PairAddress() = %v, %v, want %v, %v", addr, ok, tt.pair.Address, true)
+			}
+
+			_, ok, err = db.PairAddress(roTx, tt.pair.Factory, tt.pair.Token0, common.Address{0x01})
+			if err != nil {
+				t.Fatalf("DB.PairAddress() error = %v", err)
+			}
+			if ok {
+				t.Errorf("DB.PairAddress() ok = %v, want %v", ok, false)
+			}
+		})
+	}
+}
+
+func TestPair_Reserves(t *testing.T) {
+	t.Parallel()
+
+	p := Pair{
+		Token0:   common.Address{0x01},
+		Token1:   common.Address{0x02},
+		Reserve0: big.NewInt(100),
+		Reserve1: big.NewInt(200),
+	}
+
+	tests := []struct {
+		name    string
+		tokenIn common.Address
+		want    lib.Reserves
+	}{
+		{name: "token0", tokenIn: p.Token0, want: lib.Reserves{In: big.NewInt(100), Out: big.NewInt(200)}},
+		{name: "token1", tokenIn: p.Token1, want: lib.Reserves{In: big.NewInt(200), Out: big.NewInt(100)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Reserves(tt.tokenIn); !cmp.Equal(got, tt.want, cmp.AllowUnexported(big.Int{})) {
+				t.Errorf("Pair.Reserves() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_ReservesHead(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	ctx := context.Background()
+	if err := db.View(ctx, func(tx Tx) error {
+		head, err := db.ReservesHead(tx)
+		if err != nil || head != 0 {
+			t.Errorf("DB.ReservesHead() = %v, %v, want 0 before it's recorded", head, err)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(ctx, func(tx RwTx) error { return db.PutReservesHead(tx, 13_000_000) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.View(ctx, func(tx Tx) error {
+		head, err := db.ReservesHead(tx)
+		if err != nil || head != 13_000_000 {
+			t.Errorf("DB.ReservesHead() = %v, %v, want %v", head, err, 13_000_000)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
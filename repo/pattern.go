@@ -2,18 +2,20 @@ package repo
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"math"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/gelfand/mettu/internal/cbor"
-	"github.com/ledgerwatch/erigon-lib/kv"
 )
 
 type FullPattern struct {
 	Token    Token
 	Exchange string
 	Value    *big.Int
+	ValueUSD float64
 	Counter  int
 }
 
@@ -24,6 +26,7 @@ type Pattern struct {
 	TimesOccured int
 }
 
+// _patternKey is the CBOR patternStorage key of the schema before binary pattern keys.
 type _patternKey struct {
 	TokenAddr    common.Address
 	ExchangeName string
@@ -34,56 +37,85 @@ type _patternValue struct {
 	TimesOccured int
 }
 
-func (db *DB) PutPattern(tx kv.RwTx, p Pattern) error {
-	key := _patternKey{
-		TokenAddr:    p.TokenAddr,
-		ExchangeName: p.ExchangeName,
-	}
-	value := _patternValue{
-		Value:        p.Value.Bytes(),
-		TimesOccured: p.TimesOccured,
-	}
+// Pattern keys are
+//
+//	patternStorage:       token | exchange ID
+//	patternExchangeIndex: exchange ID | token
+//
+// so that patterns of the token or of the exchange are found by the prefix scan.
+// Values of the index are empty, records are looked up in patternStorage.
 
-	var keyBuf bytes.Buffer
-	var valueBuf bytes.Buffer
+// patternKeyLength is the length of token | exchange ID patternStorage keys.
+const patternKeyLength = common.AddressLength + exchangeIDLength
 
-	if err := cbor.Marshal(&keyBuf, key); err != nil {
-		return fmt.Errorf("unable to marshal pattern key value: %w", err)
-	}
-	if err := cbor.Marshal(&valueBuf, value); err != nil {
+func patternKey(token common.Address, exchangeID uint32) []byte {
+	k := make([]byte, patternKeyLength)
+	copy(k, token.Bytes())
+	binary.BigEndian.PutUint32(k[common.AddressLength:], exchangeID)
+	return k
+}
+
+func patternIndexKey(exchangeID uint32, token common.Address) []byte {
+	k := make([]byte, patternKeyLength)
+	binary.BigEndian.PutUint32(k, exchangeID)
+	copy(k[exchangeIDLength:], token.Bytes())
+	return k
+}
+
+// putPatternRecord puts the pattern value and it's index entry.
+func putPatternRecord(tx RwTx, token common.Address, exchangeID uint32, value _patternValue) error {
+	var buf bytes.Buffer
+	if err := cbor.Marshal(&buf, value); err != nil {
 		return fmt.Errorf("unable to marshal pattern value: %w", err)
 	}
-
-	if err := tx.Put(patternStorage, keyBuf.Bytes(), valueBuf.Bytes()); err != nil {
+	if err := tx.Put(patternStorage, patternKey(token, exchangeID), buf.Bytes()); err != nil {
 		return fmt.Errorf("unable to put key value pattern: %w", err)
 	}
+	if err := tx.Put(patternExchangeIndex, patternIndexKey(exchangeID, token), []byte{}); err != nil {
+		return fmt.Errorf("unable to put pattern index entry: %w", err)
+	}
 	return nil
 }
 
-func (db *DB) HasPattern(tx kv.Tx, token common.Address, exchangeName string) (bool, error) {
-	key := _patternKey{
-		TokenAddr:    token,
-		ExchangeName: exchangeName,
+// clearPatterns deletes every pattern and it's index entry.
+func clearPatterns(tx RwTx) error {
+	for _, table := range []string{patternStorage, patternExchangeIndex} {
+		if err := tx.ClearBucket(table); err != nil {
+			return fmt.Errorf("unable to clear %s: %w", table, err)
+		}
 	}
-	var keyBuf bytes.Buffer
-	if err := cbor.Marshal(&keyBuf, key); err != nil {
-		return false, fmt.Errorf("unable to marshal key value: %w", err)
+	return nil
+}
+
+func (db *DB) PutPattern(tx RwTx, p Pattern) error {
+	id, err := db.assignExchangeID(tx, p.ExchangeName)
+	if err != nil {
+		return err
 	}
+	return putPatternRecord(tx, p.TokenAddr, id, _patternValue{
+		Value:        p.Value.Bytes(),
+		TimesOccured: p.TimesOccured,
+	})
+}
 
-	return tx.Has(patternStorage, keyBuf.Bytes())
+func (db *DB) HasPattern(tx Tx, token common.Address, exchangeName string) (bool, error) {
+	id, ok, err := db.ExchangeID(tx, exchangeName)
+	if err != nil || !ok {
+		return false, err
+	}
+	return tx.Has(patternStorage, patternKey(token, id))
 }
 
-func (db *DB) PeekPattern(tx kv.Tx, token common.Address, exchangeName string) (Pattern, error) {
-	key := _patternKey{
-		TokenAddr:    token,
-		ExchangeName: exchangeName,
+func (db *DB) PeekPattern(tx Tx, token common.Address, exchangeName string) (Pattern, error) {
+	id, ok, err := db.ExchangeID(tx, exchangeName)
+	if err != nil {
+		return Pattern{}, err
 	}
-	var keyBuf bytes.Buffer
-	if err := cbor.Marshal(&keyBuf, key); err != nil {
-		return Pattern{}, fmt.Errorf("unable to marshal key value: %w", err)
+	if !ok {
+		return Pattern{}, fmt.Errorf("no pattern of exchange %q", exchangeName)
 	}
 
-	val, err := tx.GetOne(patternStorage, keyBuf.Bytes())
+	val, err := tx.GetOne(patternStorage, patternKey(token, id))
 	if err != nil {
 		return Pattern{}, fmt.Errorf("unable to tx.GetOne in PeekPattern: %w", err)
 	}
@@ -101,28 +133,136 @@ func (db *DB) PeekPattern(tx kv.Tx, token common.Address, exchangeName string) (
 	}, nil
 }
 
-func (db *DB) AllPatterns(tx kv.Tx) ([]Pattern, error) {
+func (db *DB) decodePattern(tx Tx, names exchangeNames, k, v []byte) (Pattern, error) {
+	if len(k) != patternKeyLength {
+		return Pattern{}, fmt.Errorf("invalid pattern key: %x", k)
+	}
+	name, err := names.name(db, tx, binary.BigEndian.Uint32(k[common.AddressLength:]))
+	if err != nil {
+		return Pattern{}, err
+	}
+
+	var value _patternValue
+	if err := cbor.Unmarshal(bytes.NewReader(v), &value); err != nil {
+		return Pattern{}, fmt.Errorf("could not unmarshal pattern value: %w", err)
+	}
+
+	return Pattern{
+		TokenAddr:    common.BytesToAddress(k[:common.AddressLength]),
+		ExchangeName: name,
+		Value:        new(big.Int).SetBytes(value.Value),
+		TimesOccured: value.TimesOccured,
+	}, nil
+}
+
+// PatternsByToken returns patterns of the token ordered by exchange ID.
+func (db *DB) PatternsByToken(tx Tx, token common.Address) ([]Pattern, error) {
+	names := make(exchangeNames)
 	var patterns []Pattern
-	if err := tx.ForEach(patternStorage, []byte{}, func(k, v []byte) error {
-		var (
-			value _patternValue
-			key   _patternKey
-		)
+	if err := tx.ForPrefix(patternStorage, token.Bytes(), func(k, v []byte) error {
+		p, err := db.decodePattern(tx, names, k, v)
+		if err != nil {
+			return err
+		}
+		patterns = append(patterns, p)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through patterns of %v: %w", token, err)
+	}
+	return patterns, nil
+}
 
-		if err := cbor.Unmarshal(bytes.NewReader(k), &key); err != nil {
+// PatternsByExchange returns patterns of the exchange ordered by token.
+func (db *DB) PatternsByExchange(tx Tx, exchangeName string) ([]Pattern, error) {
+	id, ok, err := db.ExchangeID(tx, exchangeName)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	names := exchangeNames{id: exchangeName}
+	var patterns []Pattern
+	if err := tx.ForPrefix(patternExchangeIndex, exchangeIDKey(id), func(k, _ []byte) error {
+		key := patternKey(common.BytesToAddress(k[exchangeIDLength:]), id)
+		v, err := tx.GetOne(patternStorage, key)
+		if err != nil {
+			return fmt.Errorf("could not peek pattern record: %w", err)
+		}
+		if v == nil {
+			return fmt.Errorf("%s references missing pattern %x", patternExchangeIndex, key)
+		}
+		p, err := db.decodePattern(tx, names, key, v)
+		if err != nil {
+			return err
+		}
+		patterns = append(patterns, p)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through patterns of %s: %w", exchangeName, err)
+	}
+	return patterns, nil
+}
+
+// migratePatternKeys rewrites CBOR pattern keys into token | exchange ID keys and builds the exchange index.
+// Exchanges of the hot wallets get their IDs first, in the exchangeStorage order.
+func (db *DB) migratePatternKeys(tx RwTx) error {
+	if err := tx.ForEach(exchangeStorage, []byte{}, func(_, v []byte) error {
+		_, err := db.assignExchangeID(tx, string(v))
+		return err
+	}); err != nil {
+		return fmt.Errorf("unable to assign exchange IDs: %w", err)
+	}
+
+	type legacyPattern struct {
+		key   _patternKey
+		value _patternValue
+	}
+	var patterns []legacyPattern
+	if err := tx.ForEach(patternStorage, []byte{}, func(k, v []byte) error {
+		var p legacyPattern
+		if err := cbor.Unmarshal(bytes.NewReader(k), &p.key); err != nil {
 			return fmt.Errorf("could not unmarshal pattern key: %w", err)
 		}
-		if err := cbor.Unmarshal(bytes.NewReader(v), &value); err != nil {
+		if err := cbor.Unmarshal(bytes.NewReader(v), &p.value); err != nil {
 			return fmt.Errorf("could not unmarshal pattern value: %w", err)
 		}
+		patterns = append(patterns, p)
+		return nil
+	}); err != nil {
+		return err
+	}
 
-		pattern := Pattern{
-			TokenAddr:    key.TokenAddr,
-			ExchangeName: key.ExchangeName,
-			Value:        new(big.Int).SetBytes(value.Value),
-			TimesOccured: value.TimesOccured,
+	if err := clearPatterns(tx); err != nil {
+		return err
+	}
+	for _, p := range patterns {
+		id, err := db.assignExchangeID(tx, p.key.ExchangeName)
+		if err != nil {
+			return err
+		}
+		if err := putPatternRecord(tx, p.key.TokenAddr, id, p.value); err != nil {
+			return err
 		}
-		patterns = append(patterns, pattern)
+	}
+	return nil
+}
+
+// IterPatterns calls f for patterns ordered by token and exchange ID, Start of the options is the token address bytes
+// optionally followed by the exchange ID.
+func (db *DB) IterPatterns(tx Tx, opts IterOptions, f func(Pattern) error) error {
+	names := make(exchangeNames)
+	return iterate(tx, patternStorage, opts, func(k, v []byte) error {
+		p, err := db.decodePattern(tx, names, k, v)
+		if err != nil {
+			return err
+		}
+		return f(p)
+	})
+}
+
+func (db *DB) AllPatterns(tx Tx) ([]Pattern, error) {
+	var patterns []Pattern
+	if err := db.IterPatterns(tx, IterOptions{}, func(p Pattern) error {
+		patterns = append(patterns, p)
 		return nil
 	}); err != nil {
 		return nil, fmt.Errorf("unable to iterate through all patterns: %w", err)
@@ -131,33 +271,40 @@ func (db *DB) AllPatterns(tx kv.Tx) ([]Pattern, error) {
 	return patterns, nil
 }
 
-func (db *DB) AllPatternsData(tx kv.Tx) ([]FullPattern, error) {
-	tokensMap, err := db.AllTokensMap(tx)
-	if err != nil {
-		return nil, err
-	}
+// AllPatternsData returns all patterns with their values in USD, each swap of the pattern is valued
+// at it's block.
+func (db *DB) AllPatternsData(tx Tx) ([]FullPattern, error) {
+	vals := db.newValuer(tx)
+	exchanges := make(map[common.Address]string)
 
+	// NOTE: patterns are ordered by token, so patterns of the same token share the token and swaps lookups.
+	var (
+		token   Token
+		amounts map[string][]amount
+	)
 	var patterns []FullPattern
-	if err := tx.ForEach(patternStorage, []byte{}, func(k, v []byte) error {
-		var (
-			value _patternValue
-			key   _patternKey
-		)
-
-		if err := cbor.Unmarshal(bytes.NewReader(k), &key); err != nil {
-			return fmt.Errorf("could not unmarshal pattern key: %w", err)
-		}
-		if err := cbor.Unmarshal(bytes.NewReader(v), &value); err != nil {
-			return fmt.Errorf("could not unmarshal pattern value: %w", err)
+	if err := db.IterPatterns(tx, IterOptions{}, func(p Pattern) error {
+		if amounts == nil || token.Address != p.TokenAddr {
+			var err error
+			if token, err = db.patternToken(tx, p.TokenAddr); err != nil {
+				return err
+			}
+			if amounts, err = db.patternAmounts(tx, exchanges, p.TokenAddr); err != nil {
+				return err
+			}
 		}
 
-		pattern := FullPattern{
-			Token:    tokensMap[key.TokenAddr],
-			Exchange: key.ExchangeName,
-			Value:    new(big.Int).SetBytes(value.Value),
-			Counter:  value.TimesOccured,
+		valueUSD, err := vals.totalUSD(p.Value, amounts[p.ExchangeName])
+		if err != nil {
+			return err
 		}
-		patterns = append(patterns, pattern)
+		patterns = append(patterns, FullPattern{
+			Token:    token,
+			Exchange: p.ExchangeName,
+			Value:    p.Value,
+			ValueUSD: valueUSD,
+			Counter:  p.TimesOccured,
+		})
 		return nil
 	}); err != nil {
 		return nil, fmt.Errorf("unable to iterate through all patterns: %w", err)
@@ -165,3 +312,82 @@ func (db *DB) AllPatternsData(tx kv.Tx) ([]FullPattern, error) {
 
 	return patterns, nil
 }
+
+// patternToken returns the token of the pattern with the address set even if the token is not stored.
+func (db *DB) patternToken(tx Tx, addr common.Address) (Token, error) {
+	ok, err := db.HasToken(tx, addr)
+	if err != nil || !ok {
+		return Token{Address: addr}, err
+	}
+	return db.PeekToken(tx, addr)
+}
+
+// patternAmounts returns the buys of the token by the exchange of the buying wallet's account,
+// exchanges caches the exchanges of the wallets.
+func (db *DB) patternAmounts(tx Tx, exchanges map[common.Address]string, token common.Address) (map[string][]amount, error) {
+	swaps, err := db.SwapsByToken(tx, token, 0, math.MaxUint64)
+	if err != nil {
+		return nil, err
+	}
+
+	amounts := make(map[string][]amount)
+	for _, s := range swaps {
+		exchange, ok := exchanges[s.Wallet]
+		if !ok {
+			has, err := db.HasAccount(tx, s.Wallet)
+			if err != nil {
+				return nil, err
+			}
+			if has {
+				acc, err := db.PeekAccount(tx, s.Wallet)
+				if err != nil {
+					return nil, err
+				}
+				exchange = acc.Exchange
+			}
+			exchanges[s.Wallet] = exchange
+		}
+		if exchange != "" {
+			amounts[exchange] = append(amounts[exchange], amount{s.Value, s.BlockNumber})
+		}
+	}
+	return amounts, nil
+}
+
+// SafePatternsData returns AllPatternsData without patterns of the tokens found unsafe.
+func (db *DB) SafePatternsData(tx Tx) ([]FullPattern, error) {
+	patterns, err := db.AllPatternsData(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	safe := patterns[:0]
+	for _, p := range patterns {
+		if !p.Token.Safety.Unsafe() {
+			safe = append(safe, p)
+		}
+	}
+	return safe, nil
+}
+
+// ExcludeUnsafe drops patterns of the tokens found unsafe.
+func (db *DB) ExcludeUnsafe(tx Tx, patterns []Pattern) ([]Pattern, error) {
+	safe := make([]Pattern, 0, len(patterns))
+	for _, p := range patterns {
+		val, err := tx.GetOne(tokenStorage, p.TokenAddr.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("unable to get token by address=%v, err=%w", p.TokenAddr, err)
+		}
+		if val != nil {
+			var tokenVal _token
+			if err := cbor.Unmarshal(bytes.NewReader(val), &tokenVal); err != nil {
+				return nil, fmt.Errorf("unable to decode token, err=%w", err)
+			}
+			if tokenVal.Safety.Unsafe() {
+				continue
+			}
+		}
+		safe = append(safe, p)
+	}
+	return safe, nil
+}
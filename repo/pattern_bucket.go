@@ -0,0 +1,305 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/internal/cbor"
+)
+
+// Resolution is the width of the pattern buckets.
+type Resolution uint8
+
+const (
+	Hourly Resolution = iota + 1
+	Daily
+)
+
+// Duration returns the width of the bucket.
+func (r Resolution) Duration() time.Duration {
+	switch r {
+	case Hourly:
+		return time.Hour
+	case Daily:
+		return 24 * time.Hour
+	default:
+		panic(fmt.Sprintf("unknown resolution: %d", r))
+	}
+}
+
+// Bucket returns unix timestamp of the start of the bucket t belongs to.
+func (r Resolution) Bucket(t time.Time) uint64 {
+	width := uint64(r.Duration() / time.Second)
+	return uint64(t.Unix()) / width * width
+}
+
+func (r Resolution) String() string {
+	switch r {
+	case Hourly:
+		return "hourly"
+	case Daily:
+		return "daily"
+	default:
+		return fmt.Sprintf("Resolution(%d)", r)
+	}
+}
+
+// PatternBucket is Pattern aggregated over a single hour or day.
+type PatternBucket struct {
+	Resolution Resolution
+	// Bucket is unix timestamp of the start of the bucket.
+	Bucket       uint64
+	TokenAddr    common.Address
+	ExchangeName string
+	Value        *big.Int
+	TimesOccured int
+}
+
+// Time returns the start of the bucket.
+func (b PatternBucket) Time() time.Time {
+	return time.Unix(int64(b.Bucket), 0).UTC()
+}
+
+// patternBucketKeyLength is the length of resolution | bucket | token | exchange ID keys.
+const patternBucketKeyLength = 1 + 8 + common.AddressLength + exchangeIDLength
+
+// patternBucketKey is resolution | bucket | token | exchange ID, buckets of the same resolution are ordered by time.
+func patternBucketKey(res Resolution, bucket uint64, token common.Address, exchangeID uint32) []byte {
+	key := make([]byte, patternBucketKeyLength)
+	key[0] = byte(res)
+	binary.BigEndian.PutUint64(key[1:9], bucket)
+	copy(key[9:], token.Bytes())
+	binary.BigEndian.PutUint32(key[9+common.AddressLength:], exchangeID)
+	return key
+}
+
+func (db *DB) decodePatternBucket(tx Tx, names exchangeNames, k, v []byte) (PatternBucket, error) {
+	if len(k) != patternBucketKeyLength {
+		return PatternBucket{}, fmt.Errorf("invalid pattern bucket key: %x", k)
+	}
+	exchange, err := names.name(db, tx, binary.BigEndian.Uint32(k[29:]))
+	if err != nil {
+		return PatternBucket{}, err
+	}
+
+	var value _patternValue
+	if err := cbor.Unmarshal(bytes.NewReader(v), &value); err != nil {
+		return PatternBucket{}, fmt.Errorf("could not unmarshal pattern bucket value: %w", err)
+	}
+
+	return PatternBucket{
+		Resolution:   Resolution(k[0]),
+		Bucket:       binary.BigEndian.Uint64(k[1:9]),
+		TokenAddr:    common.BytesToAddress(k[9:29]),
+		ExchangeName: exchange,
+		Value:        new(big.Int).SetBytes(value.Value),
+		TimesOccured: value.TimesOccured,
+	}, nil
+}
+
+// putPatternBucket puts the bucket into the patternBucketStorage.
+func (db *DB) putPatternBucket(tx RwTx, b PatternBucket) error {
+	id, err := db.assignExchangeID(tx, b.ExchangeName)
+	if err != nil {
+		return err
+	}
+	return putPatternBucketRecord(tx, patternBucketKey(b.Resolution, b.Bucket, b.TokenAddr, id), _patternValue{
+		Value:        b.Value.Bytes(),
+		TimesOccured: b.TimesOccured,
+	})
+}
+
+func putPatternBucketRecord(tx RwTx, key []byte, value _patternValue) error {
+	var buf bytes.Buffer
+	if err := cbor.Marshal(&buf, value); err != nil {
+		return fmt.Errorf("unable to marshal pattern bucket value: %w", err)
+	}
+	if err := tx.Put(patternBucketStorage, key, buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to put %v pattern bucket: %w", Resolution(key[0]), err)
+	}
+	return nil
+}
+
+// AddPatternBuckets adds the swap of value wei made at the given time to the hourly and daily buckets of the pattern.
+func (db *DB) AddPatternBuckets(tx RwTx, token common.Address, exchangeName string, value *big.Int, at time.Time) error {
+	id, err := db.assignExchangeID(tx, exchangeName)
+	if err != nil {
+		return err
+	}
+	for _, res := range []Resolution{Hourly, Daily} {
+		key := patternBucketKey(res, res.Bucket(at), token, id)
+		val, err := tx.GetOne(patternBucketStorage, key)
+		if err != nil {
+			return fmt.Errorf("could not peek %v pattern bucket: %w", res, err)
+		}
+
+		bucketVal := _patternValue{}
+		if val != nil {
+			if err := cbor.Unmarshal(bytes.NewReader(val), &bucketVal); err != nil {
+				return fmt.Errorf("could not unmarshal pattern bucket value: %w", err)
+			}
+		}
+		if err := putPatternBucketRecord(tx, key, _patternValue{
+			Value:        new(big.Int).Add(new(big.Int).SetBytes(bucketVal.Value), value).Bytes(),
+			TimesOccured: bucketVal.TimesOccured + 1,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PatternBuckets returns buckets of the given resolution which start in [from, to), ordered by time.
+func (db *DB) PatternBuckets(tx Tx, res Resolution, from, to time.Time) ([]PatternBucket, error) {
+	c, err := tx.Cursor(patternBucketStorage)
+	if err != nil {
+		return nil, fmt.Errorf("could not open pattern bucket cursor: %w", err)
+	}
+	defer c.Close()
+
+	start := make([]byte, 9)
+	start[0] = byte(res)
+	binary.BigEndian.PutUint64(start[1:], res.Bucket(from))
+	end := uint64(to.Unix())
+
+	names := make(exchangeNames)
+	var buckets []PatternBucket
+	// NOTE: failed Seek returns nil key, so the error is checked before the end of the table.
+	k, v, err := c.Seek(start)
+	for ; ; k, v, err = c.Next() {
+		if err != nil {
+			return nil, fmt.Errorf("could not iterate through pattern buckets: %w", err)
+		}
+		if k == nil || k[0] != byte(res) || len(k) < 9 || binary.BigEndian.Uint64(k[1:9]) >= end {
+			break
+		}
+
+		b, err := db.decodePatternBucket(tx, names, k, v)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// PatternsBetween returns patterns aggregated over the buckets of the given resolution which start in [from, to).
+func (db *DB) PatternsBetween(tx Tx, res Resolution, from, to time.Time) ([]Pattern, error) {
+	buckets, err := db.PatternBuckets(tx, res, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return mergePatternBuckets(buckets), nil
+}
+
+// RecentPatterns returns patterns aggregated over the last n hours before now, current hour included.
+func (db *DB) RecentPatterns(tx Tx, now time.Time, n int) ([]Pattern, error) {
+	from := now.Add(-time.Duration(n-1) * time.Hour)
+	return db.PatternsBetween(tx, Hourly, from, now.Add(time.Nanosecond))
+}
+
+// PatternTrend compares the pattern over the current window to the previous window of the same width.
+type PatternTrend struct {
+	TokenAddr    common.Address
+	ExchangeName string
+	Current      Pattern
+	Previous     Pattern
+}
+
+// Change returns relative change of TimesOccured, +Inf if the pattern is new.
+func (t PatternTrend) Change() float64 {
+	prev, cur := float64(t.Previous.TimesOccured), float64(t.Current.TimesOccured)
+	if prev == 0 {
+		if cur == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return cur/prev - 1
+}
+
+// PatternTrends compares patterns over the window ending at now to the window right before it,
+// trends are ordered by Change, growing patterns go first.
+func (db *DB) PatternTrends(tx Tx, res Resolution, now time.Time, window time.Duration) ([]PatternTrend, error) {
+	end := time.Unix(int64(res.Bucket(now)), 0).Add(res.Duration())
+	mid := end.Add(-window)
+	buckets, err := db.PatternBuckets(tx, res, mid.Add(-window), end)
+	if err != nil {
+		return nil, err
+	}
+
+	type patternKey struct {
+		token    common.Address
+		exchange string
+	}
+	trends := make(map[patternKey]*PatternTrend)
+	for _, b := range buckets {
+		k := patternKey{b.TokenAddr, b.ExchangeName}
+		t, ok := trends[k]
+		if !ok {
+			t = &PatternTrend{
+				TokenAddr:    b.TokenAddr,
+				ExchangeName: b.ExchangeName,
+				Current:      Pattern{TokenAddr: b.TokenAddr, ExchangeName: b.ExchangeName, Value: new(big.Int)},
+				Previous:     Pattern{TokenAddr: b.TokenAddr, ExchangeName: b.ExchangeName, Value: new(big.Int)},
+			}
+			trends[k] = t
+		}
+
+		p := &t.Previous
+		if b.Bucket >= uint64(mid.Unix()) {
+			p = &t.Current
+		}
+		p.Value.Add(p.Value, b.Value)
+		p.TimesOccured += b.TimesOccured
+	}
+
+	result := make([]PatternTrend, 0, len(trends))
+	for _, t := range trends {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if ci, cj := result[i].Change(), result[j].Change(); ci != cj {
+			return ci > cj
+		}
+		return result[i].Current.TimesOccured > result[j].Current.TimesOccured
+	})
+	return result, nil
+}
+
+// mergePatternBuckets sums the buckets by token and exchange, patterns are ordered by TimesOccured.
+func mergePatternBuckets(buckets []PatternBucket) []Pattern {
+	type patternKey struct {
+		token    common.Address
+		exchange string
+	}
+	merged := make(map[patternKey]*Pattern)
+	for _, b := range buckets {
+		k := patternKey{b.TokenAddr, b.ExchangeName}
+		p, ok := merged[k]
+		if !ok {
+			p = &Pattern{TokenAddr: b.TokenAddr, ExchangeName: b.ExchangeName, Value: new(big.Int)}
+			merged[k] = p
+		}
+		p.Value.Add(p.Value, b.Value)
+		p.TimesOccured += b.TimesOccured
+	}
+
+	patterns := make([]Pattern, 0, len(merged))
+	for _, p := range merged {
+		patterns = append(patterns, *p)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].TimesOccured != patterns[j].TimesOccured {
+			return patterns[i].TimesOccured > patterns[j].TimesOccured
+		}
+		return bytes.Compare(patterns[i].TokenAddr.Bytes(), patterns[j].TokenAddr.Bytes()) < 0
+	})
+	return patterns
+}
@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDB_PatternBuckets(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	token0 := common.BytesToAddress([]byte("token0"))
+	token1 := common.BytesToAddress([]byte("token1"))
+	now := time.Date(2021, 12, 20, 15, 30, 0, 0, time.UTC)
+
+	swaps := []struct {
+		token    common.Address
+		exchange string
+		value    int64
+		at       time.Time
+	}{
+		{token0, "Binance", 1, now.Add(-50 * time.Hour)},
+		{token0, "Binance", 2, now.Add(-2 * time.Hour)},
+		{token0, "Binance", 3, now.Add(-10 * time.Minute)},
+		{token0, "Kraken", 4, now.Add(-5 * time.Minute)},
+		{token1, "Binance", 5, now.Add(-30 * time.Hour)},
+		{token1, "Binance", 6, now.Add(-26 * time.Hour)},
+		{token1, "Binance", 7, now.Add(-1 * time.Hour)},
+	}
+	if err := db.Update(context.Background(), func(tx RwTx) error {
+		for _, s := range swaps {
+			if err := db.AddPatternBuckets(tx, s.token, s.exchange, big.NewInt(s.value), s.at); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	hourly, err := db.PatternBuckets(tx, Hourly, now.Add(-time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hourly) != 3 {
+		t.Fatalf("DB.PatternBuckets() = %+v, want %d buckets", hourly, 3)
+	}
+	if hourly[0].Time() != now.Truncate(time.Hour).Add(-time.Hour) || hourly[0].TokenAddr != token1 {
+		t.Errorf("DB.PatternBuckets()[0] = %+v", hourly[0])
+	}
+
+	recent, err := db.RecentPatterns(tx, now, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Pattern{
+		{TokenAddr: token0, ExchangeName: "Binance", Value: big.NewInt(5), TimesOccured: 2},
+		{TokenAddr: token0, ExchangeName: "Kraken", Value: big.NewInt(4), TimesOccured: 1},
+		{TokenAddr: token1, ExchangeName: "Binance", Value: big.NewInt(7), TimesOccured: 1},
+	}
+	if !cmp.Equal(recent, want, cmp.AllowUnexported(big.Int{})) {
+		t.Errorf("DB.RecentPatterns() diff = %v", cmp.Diff(recent, want, cmp.AllowUnexported(big.Int{})))
+	}
+
+	daily, err := db.PatternsBetween(tx, Daily, now.Add(-72*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) != 3 || daily[0].TimesOccured != 3 || daily[0].Value.Int64() != 6 || daily[1].Value.Int64() != 18 {
+		t.Errorf("DB.PatternsBetween() = %+v", daily)
+	}
+
+	trends, err := db.PatternTrends(tx, Daily, now, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trends) != 3 {
+		t.Fatalf("DB.PatternTrends() = %+v, want %d trends", trends, 3)
+	}
+	if trends[0].TokenAddr != token0 || trends[0].ExchangeName != "Binance" || !math.IsInf(trends[0].Change(), 1) {
+		t.Errorf("DB.PatternTrends()[0] = %+v, change = %v", trends[0], trends[0].Change())
+	}
+	if got := trends[2]; got.TokenAddr != token1 || got.Current.TimesOccured != 1 || got.Previous.TimesOccured != 2 || got.Change() != -0.5 {
+		t.Errorf("DB.PatternTrends()[2] = %+v, change = %v", got, got.Change())
+	}
+}
+
+func TestDB_PatternBucketsSeekError(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	if err := db.View(context.Background(), func(tx Tx) error {
+		now := time.Now()
+		_, err := db.PatternBuckets(seekErrTx{tx}, Hourly, now.Add(-time.Hour), now)
+		if !errors.Is(err, errSeek) {
+			t.Errorf("DB.PatternBuckets() error = %v, want %v", err, errSeek)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
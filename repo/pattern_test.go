@@ -9,7 +9,6 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
-	"github.com/ledgerwatch/erigon-lib/kv"
 )
 
 func TestDB_Pattern(t *testing.T) {
@@ -18,10 +17,10 @@ func TestDB_Pattern(t *testing.T) {
 	hugeNumber := new(big.Int).Mul(bigNumber, big.NewInt(1<<20))
 
 	type fields struct {
-		d kv.RwDB
+		d Backend
 	}
 	type args struct {
-		tx kv.RwTx
+		tx RwTx
 		p  Pattern
 	}
 	tests := []struct {
@@ -93,10 +92,10 @@ func TestDB_Pattern(t *testing.T) {
 
 // func TestDB_PutPattern(t *testing.T) {
 // 	type fields struct {
-// 		d kv.RwDB
+// 		d Backend
 // 	}
 // 	type args struct {
-// 		tx kv.RwTx
+// 		tx RwTx
 // 		p  Pattern
 // 	}
 // 	tests := []struct {
@@ -121,10 +120,10 @@ func TestDB_Pattern(t *testing.T) {
 
 // func TestDB_HasPattern(t *testing.T) {
 // 	type fields struct {
-// 		d kv.RwDB
+// 		d Backend
 // 	}
 // 	type args struct {
-// 		tx           kv.Tx
+// 		tx           Tx
 // 		token        common.Address
 // 		exchangeName string
 // 	}
@@ -156,10 +155,10 @@ func TestDB_Pattern(t *testing.T) {
 
 // func TestDB_PeekPattern(t *testing.T) {
 // 	type fields struct {
-// 		d kv.RwDB
+// 		d Backend
 // 	}
 // 	type args struct {
-// 		tx           kv.Tx
+// 		tx           Tx
 // 		token        common.Address
 // 		exchangeName string
 // 	}
@@ -203,10 +202,10 @@ func TestDB_AllPatterns(t *testing.T) {
 	hugeNumber := new(big.Int).Mul(bigNumber, big.NewInt(1<<20))
 
 	type fields struct {
-		d kv.RwDB
+		d Backend
 	}
 	type args struct {
-		tx kv.Tx
+		tx Tx
 	}
 	tests := []struct {
 		name    string
@@ -255,3 +254,49 @@ func TestDB_AllPatterns(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_ExcludeUnsafe(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	safe := Token{Address: common.BytesToAddress([]byte("safe")), TotalBought: big.NewInt(1), Safety: TokenSafety{CheckedAt: 10, BuyTax: 0.01}}
+	honeypot := Token{Address: common.BytesToAddress([]byte("honeypot")), TotalBought: big.NewInt(1), Safety: TokenSafety{CheckedAt: 10, Honeypot: true}}
+	unchecked := common.BytesToAddress([]byte("unchecked"))
+
+	if err := db.Update(context.Background(), func(tx RwTx) error {
+		for _, token := range []Token{safe, honeypot} {
+			if err := db.PutToken(tx, token); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	got, err := db.PeekToken(tx, honeypot.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Safety != honeypot.Safety {
+		t.Errorf("DB.PeekToken() safety = %+v, want %+v", got.Safety, honeypot.Safety)
+	}
+
+	patterns, err := db.ExcludeUnsafe(tx, []Pattern{
+		{TokenAddr: safe.Address},
+		{TokenAddr: honeypot.Address},
+		{TokenAddr: unchecked},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patterns) != 2 || patterns[0].TokenAddr != safe.Address || patterns[1].TokenAddr != unchecked {
+		t.Errorf("DB.ExcludeUnsafe() = %+v", patterns)
+	}
+}
@@ -0,0 +1,162 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/internal/cbor"
+)
+
+// Position is the state of the Swap revalued as of BlockNumber, it's keyed by the swap key.
+type Position struct {
+	TxHash   common.Hash
+	LogIndex uint
+	// Price is the ETH price of the swapped token as of BlockNumber.
+	Price       *big.Int
+	BlockNumber uint64
+	// PeakPrice is the highest Price the position was ever revalued at.
+	PeakPrice *big.Int
+	// OpenedAt is the first block the position was revalued at.
+	OpenedAt uint64
+	// Reached2xAt is the first block the Price was at least twice the entry price, zero if never.
+	Reached2xAt uint64
+}
+
+type _position struct {
+	Price       []byte
+	BlockNumber uint64
+	PeakPrice   []byte
+	OpenedAt    uint64
+	Reached2xAt uint64
+}
+
+// Key returns positionStorage key of the position, it's the key of it's swap.
+func (p Position) Key() []byte {
+	return SwapKey(p.TxHash, p.LogIndex)
+}
+
+// PutPosition puts Position into the positionStorage.
+func (db *DB) PutPosition(tx RwTx, p Position) error {
+	positionVal := _position{
+		Price:       p.Price.Bytes(),
+		BlockNumber: p.BlockNumber,
+		PeakPrice:   p.PeakPrice.Bytes(),
+		OpenedAt:    p.OpenedAt,
+		Reached2xAt: p.Reached2xAt,
+	}
+
+	var buf bytes.Buffer
+	if err := cbor.Marshal(&buf, positionVal); err != nil {
+		return fmt.Errorf("unable to encode position record: %w", err)
+	}
+
+	if err := tx.Put(positionStorage, p.Key(), buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to put position record: %w", err)
+	}
+	return nil
+}
+
+// PeekPosition returns Position of the swap with the given log index made in the transaction.
+func (db *DB) PeekPosition(tx Tx, txHash common.Hash, logIndex uint) (Position, error) {
+	key := SwapKey(txHash, logIndex)
+	val, err := tx.GetOne(positionStorage, key)
+	if err != nil {
+		return Position{}, fmt.Errorf("could not peek position record: %w", err)
+	}
+
+	return decodePosition(key, val)
+}
+
+// IterPositions calls f for positions ordered by their keys, Start of the options is SwapKey of the swap.
+func (db *DB) IterPositions(tx Tx, opts IterOptions, f func(Position) error) error {
+	return iterate(tx, positionStorage, opts, func(k, v []byte) error {
+		p, err := decodePosition(k, v)
+		if err != nil {
+			return err
+		}
+		return f(p)
+	})
+}
+
+// AllPositionsMap returns all positions mapped to the keys of their swaps.
+func (db *DB) AllPositionsMap(tx Tx) (map[string]Position, error) {
+	positions := make(map[string]Position)
+	if err := db.IterPositions(tx, IterOptions{}, func(p Position) error {
+		positions[string(p.Key())] = p
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("could not retrieve all position records: %w", err)
+	}
+
+	return positions, nil
+}
+
+func decodePosition(k, v []byte) (Position, error) {
+	if len(k) != swapKeyLength {
+		return Position{}, fmt.Errorf("invalid position key length: %d", len(k))
+	}
+	var positionVal _position
+	if err := cbor.Unmarshal(bytes.NewReader(v), &positionVal); err != nil {
+		return Position{}, fmt.Errorf("unable to decode position record: %w", err)
+	}
+
+	return Position{
+		TxHash:      common.BytesToHash(k[:common.HashLength]),
+		LogIndex:    uint(binary.BigEndian.Uint32(k[common.HashLength:])),
+		Price:       new(big.Int).SetBytes(positionVal.Price),
+		BlockNumber: positionVal.BlockNumber,
+		PeakPrice:   new(big.Int).SetBytes(positionVal.PeakPrice),
+		OpenedAt:    positionVal.OpenedAt,
+		Reached2xAt: positionVal.Reached2xAt,
+	}, nil
+}
+
+// migratePositionKeys rewrites positions stored by transaction hash alone to the key of the first swap made in the
+// transaction, positions of transactions without swaps are dropped. Other swaps of the transaction had no state of
+// their own, they are revalued on the next block.
+func (db *DB) migratePositionKeys(tx RwTx) error {
+	var legacy [][]byte
+	if err := tx.ForEach(positionStorage, []byte{}, func(k, _ []byte) error {
+		if len(k) == common.HashLength {
+			legacy = append(legacy, common.CopyBytes(k))
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("could not scan position records: %w", err)
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	c, err := tx.Cursor(swapStorage)
+	if err != nil {
+		return fmt.Errorf("unable to open swap cursor: %w", err)
+	}
+	defer c.Close()
+
+	for _, k := range legacy {
+		v, err := tx.GetOne(positionStorage, k)
+		if err != nil {
+			return fmt.Errorf("could not peek position record: %w", err)
+		}
+		v = common.CopyBytes(v)
+		if err := tx.Delete(positionStorage, k, nil); err != nil {
+			return fmt.Errorf("unable to delete legacy position record: %w", err)
+		}
+
+		swapK, _, err := c.Seek(k)
+		if err != nil {
+			return fmt.Errorf("unable to seek swap record: %w", err)
+		}
+		if swapK == nil || !bytes.HasPrefix(swapK, k) {
+			continue
+		}
+		if err := tx.Put(positionStorage, common.CopyBytes(swapK), v); err != nil {
+			return fmt.Errorf("unable to put migrated position record: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// priceHistoryKey returns token|blockNumber key, block number is big endian
+// so prices of the token are sorted by block.
+func priceHistoryKey(token common.Address, blockNumber uint64) []byte {
+	key := make([]byte, common.AddressLength+8)
+	copy(key, token.Bytes())
+	binary.BigEndian.PutUint64(key[common.AddressLength:], blockNumber)
+	return key
+}
+
+// PutPriceAt puts ETH price of the token at the given block into the priceHistoryStorage.
+func (db *DB) PutPriceAt(tx RwTx, token common.Address, blockNumber uint64, price *big.Int) error {
+	if err := tx.Put(priceHistoryStorage, priceHistoryKey(token, blockNumber), price.Bytes()); err != nil {
+		return fmt.Errorf("unable to put price of %v at block %d: %w", token, blockNumber, err)
+	}
+	return nil
+}
+
+// PeekPriceAt returns ETH price of the token recorded exactly at the given block,
+// ok is false if the price was never recorded.
+func (db *DB) PeekPriceAt(tx Tx, token common.Address, blockNumber uint64) (price *big.Int, ok bool, err error) {
+	val, err := tx.GetOne(priceHistoryStorage, priceHistoryKey(token, blockNumber))
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to get price of %v at block %d: %w", token, blockNumber, err)
+	}
+	if val == nil {
+		return nil, false, nil
+	}
+
+	return new(big.Int).SetBytes(val), true, nil
+}
+
+// LatestPriceAt returns the most recent ETH price of the token recorded at or before the given block
+// together with the block it was recorded at, ok is false if there is no such record.
+func (db *DB) LatestPriceAt(tx Tx, token common.Address, blockNumber uint64) (price *big.Int, at uint64, ok bool, err error) {
+	k, v, err := seekAtOrBefore(tx, priceHistoryStorage, priceHistoryKey(token, blockNumber))
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("unable to seek price history: %w", err)
+	}
+	if k == nil || !bytes.HasPrefix(k, token.Bytes()) {
+		return nil, 0, false, nil
+	}
+
+	return new(big.Int).SetBytes(v), binary.BigEndian.Uint64(k[common.AddressLength:]), true, nil
+}
+
+// PriceHistory returns all ETH prices of the token recorded within [from, to] blocks range mapped to their blocks.
+func (db *DB) PriceHistory(tx Tx, token common.Address, from, to uint64) (map[uint64]*big.Int, error) {
+	prices := make(map[uint64]*big.Int)
+	if err := tx.ForEach(priceHistoryStorage, priceHistoryKey(token, from), func(k, v []byte) error {
+		if !bytes.HasPrefix(k, token.Bytes()) {
+			return ErrStop
+		}
+		blockNumber := binary.BigEndian.Uint64(k[common.AddressLength:])
+		if blockNumber > to {
+			return ErrStop
+		}
+
+		prices[blockNumber] = new(big.Int).SetBytes(v)
+		return nil
+	}); err != nil && err != ErrStop {
+		return nil, fmt.Errorf("unable to iterate through price history: %w", err)
+	}
+
+	return prices, nil
+}
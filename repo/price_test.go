@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestDB_PriceHistory(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	token := common.BytesToAddress([]byte("token"))
+	other := common.BytesToAddress([]byte("token1"))
+
+	tx, err := db.BeginRw(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for blockNumber, price := range map[uint64]int64{100: 1e15, 200: 2e15, 300: 3e15} {
+		if err = db.PutPriceAt(tx, token, blockNumber, big.NewInt(price)); err != nil {
+			t.Fatalf("DB.PutPriceAt() error = %v", err)
+		}
+	}
+	if err = db.PutPriceAt(tx, other, 250, big.NewInt(1)); err != nil {
+		t.Fatalf("DB.PutPriceAt() error = %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	roTx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer roTx.Rollback()
+
+	if _, ok, err := db.PeekPriceAt(roTx, token, 150); err != nil || ok {
+		t.Errorf("DB.PeekPriceAt() ok = %v, err = %v, want %v, %v", ok, err, false, nil)
+	}
+	if price, ok, err := db.PeekPriceAt(roTx, token, 200); err != nil || !ok || price.Cmp(big.NewInt(2e15)) != 0 {
+		t.Errorf("DB.PeekPriceAt() = %v, %v, %v, want %v", price, ok, err, 2e15)
+	}
+
+	tests := []struct {
+		name        string
+		token       common.Address
+		blockNumber uint64
+		want        *big.Int
+		wantAt      uint64
+		wantOk      bool
+	}{
+		{name: "before first", token: token, blockNumber: 99},
+		{name: "exact", token: token, blockNumber: 200, want: big.NewInt(2e15), wantAt: 200, wantOk: true},
+		{name: "between", token: token, blockNumber: 299, want: big.NewInt(2e15), wantAt: 200, wantOk: true},
+		{name: "after last", token: token, blockNumber: ^uint64(0), want: big.NewInt(3e15), wantAt: 300, wantOk: true},
+		{name: "other token", token: other, blockNumber: 1000, want: big.NewInt(1), wantAt: 250, wantOk: true},
+		{name: "unknown token", token: common.Address{0x01}, blockNumber: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, at, ok, err := db.LatestPriceAt(roTx, tt.token, tt.blockNumber)
+			if err != nil {
+				t.Fatalf("DB.LatestPriceAt() error = %v", err)
+			}
+			if ok != tt.wantOk || at != tt.wantAt || (ok && got.Cmp(tt.want) != 0) {
+				t.Errorf("DB.LatestPriceAt() = %v, %v, %v, want %v, %v, %v", got, at, ok, tt.want, tt.wantAt, tt.wantOk)
+			}
+		})
+	}
+
+	history, err := db.PriceHistory(roTx, token, 150, 300)
+	if err != nil {
+		t.Fatalf("DB.PriceHistory() error = %v", err)
+	}
+	if len(history) != 2 || history[200].Cmp(big.NewInt(2e15)) != 0 || history[300].Cmp(big.NewInt(3e15)) != 0 {
+		t.Errorf("DB.PriceHistory() = %v", history)
+	}
+}
@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/internal/cbor"
+)
+
+// NOTE: processedTxStorage marks transactions which were applied to the aggregates, keys are transaction hashes
+// and values are big-endian numbers of the blocks they were applied at. Replayed transactions are skipped,
+// so that processing the same block twice, or a reorged block which includes them again, doesn't double count.
+
+// MarkTxProcessed marks the transaction included in the block as applied.
+func (db *DB) MarkTxProcessed(tx RwTx, txHash common.Hash, blockNumber uint64) error {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, blockNumber)
+	if err := tx.Put(processedTxStorage, txHash.Bytes(), v); err != nil {
+		return fmt.Errorf("unable to mark transaction %v processed: %w", txHash, err)
+	}
+	return nil
+}
+
+// IsTxProcessed tells whether the transaction was applied already.
+func (db *DB) IsTxProcessed(tx Tx, txHash common.Hash) (bool, error) {
+	ok, err := tx.Has(processedTxStorage, txHash.Bytes())
+	if err != nil {
+		return false, fmt.Errorf("could not check if transaction %v was processed: %w", txHash, err)
+	}
+	return ok, nil
+}
+
+// markStoredTxsProcessed marks transactions of the stored fundings and swaps as processed,
+// they were applied before the markers existed.
+func (db *DB) markStoredTxsProcessed(tx RwTx) error {
+	if err := tx.ForEach(fundingStorage, []byte{}, func(k, v []byte) error {
+		var f _namedFunding
+		if err := cbor.Unmarshal(bytes.NewReader(v), &f); err != nil {
+			return fmt.Errorf("unable to decode funding record: %w", err)
+		}
+		return db.MarkTxProcessed(tx, common.BytesToHash(k), f.BlockNumber)
+	}); err != nil {
+		return fmt.Errorf("unable to mark fundings processed: %w", err)
+	}
+	if err := tx.ForEach(swapStorage, []byte{}, func(k, v []byte) error {
+		s, err := decodeSwap(k, v)
+		if err != nil {
+			return err
+		}
+		return db.MarkTxProcessed(tx, s.TxHash, s.BlockNumber)
+	}); err != nil {
+		return fmt.Errorf("unable to mark swaps processed: %w", err)
+	}
+	return nil
+}
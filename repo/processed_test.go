@@ -0,0 +1,61 @@
+package repo
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestDB_TxProcessed(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	wallet := common.BytesToAddress([]byte("wallet"))
+	funding := Funding{TxHash: common.HexToHash("0xf0"), Exchange: "Binance", Wallet: wallet, Value: big.NewInt(1e18), BlockNumber: 9}
+	swap := testSwap(1, wallet, common.BytesToAddress([]byte("token")), 10)
+	marked := common.HexToHash("0xaa")
+
+	err := db.Update(context.Background(), func(tx RwTx) error {
+		if err := db.PutFunding(tx, funding); err != nil {
+			return err
+		}
+		if err := db.PutSwap(tx, swap); err != nil {
+			return err
+		}
+		if err := db.MarkTxProcessed(tx, marked, 11); err != nil {
+			return err
+		}
+		// NOTE: stored fundings and swaps are marked by the migration.
+		return db.markStoredTxsProcessed(tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		txHash common.Hash
+		want   bool
+	}{
+		{"marked", marked, true},
+		{"funding", funding.TxHash, true},
+		{"swap", swap.TxHash, true},
+		{"unknown", common.HexToHash("0xbb"), false},
+	}
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, tt := range tests {
+		got, err := db.IsTxProcessed(tx, tt.txHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: DB.IsTxProcessed() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
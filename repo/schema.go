@@ -0,0 +1,199 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/internal/cbor"
+)
+
+var (
+	// ErrSchemaTooNew is returned when the database was written by a newer version.
+	ErrSchemaTooNew = errors.New("database schema is newer than supported")
+	// ErrSchemaOutdated is returned when a read-only database needs migrations.
+	ErrSchemaOutdated = errors.New("database schema is outdated, open it read-write to migrate")
+)
+
+var schemaVersionKey = []byte("version")
+
+// migration rewrites records stored by the previous schema version in place.
+type migration struct {
+	name string
+	up   func(db *DB, tx RwTx) error
+}
+
+// migrations are applied in order, the schema version is the number of applied migrations.
+// NOTE: append only, never reorder or remove steps.
+var migrations = []migration{
+	{"re-encode records in the current layout", reencodeRecords},
+	{"key swaps by txHash | logIndex", (*DB).migrateSwapKeys},
+	{"rebuild swap indexes", (*DB).RebuildSwapIndexes},
+	{"mark stored transactions processed", (*DB).markStoredTxsProcessed},
+	{"key patterns by token | exchange ID", (*DB).migratePatternKeys},
+	{"store exchange IDs instead of names", (*DB).migrateExchangeIDs},
+	{"index fundings by wallet", (*DB).RebuildFundingIndex},
+	{"key positions by txHash | logIndex", (*DB).migratePositionKeys},
+	{"record received baselines of the wallets funded before fundings", (*DB).recordReceivedBaselines},
+}
+
+// SchemaVersion is the schema version of this build.
+var SchemaVersion = uint64(len(migrations))
+
+// SchemaVersion returns the schema version of the stored records, zero for databases created before versioning.
+func (db *DB) SchemaVersion(tx Tx) (uint64, error) {
+	v, err := tx.GetOne(schemaStorage, schemaVersionKey)
+	if err != nil {
+		return 0, fmt.Errorf("could not get schema version: %w", err)
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+func putSchemaVersion(tx RwTx, version uint64) error {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, version)
+	if err := tx.Put(schemaStorage, schemaVersionKey, v); err != nil {
+		return fmt.Errorf("unable to put schema version: %w", err)
+	}
+	return nil
+}
+
+// Migrate applies pending migrations and bumps the schema version after each of them,
+// callers commit the transaction so that either all steps are applied or none.
+func (db *DB) Migrate(tx RwTx) error {
+	version, err := db.SchemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: %d > %d", ErrSchemaTooNew, version, SchemaVersion)
+	}
+
+	for ; version < SchemaVersion; version++ {
+		m := migrations[version]
+		if err := m.up(db, tx); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", version+1, m.name, err)
+		}
+		if err := putSchemaVersion(tx, version+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSchema returns an error if the records can not be read by this build without migrations.
+func (db *DB) checkSchema(tx Tx) error {
+	version, err := db.SchemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version > SchemaVersion:
+		return fmt.Errorf("%w: %d > %d", ErrSchemaTooNew, version, SchemaVersion)
+	case version < SchemaVersion:
+		return fmt.Errorf("%w: %d < %d", ErrSchemaOutdated, version, SchemaVersion)
+	}
+	return nil
+}
+
+// reencodeRecords decodes CBOR arrays written with fewer fields and writes them back with every field present.
+func reencodeRecords(_ *DB, tx RwTx) error {
+	tables := map[string]func() interface{}{
+		accountStorage: func() interface{} { return new(_namedAccount) },
+		tokenStorage:   func() interface{} { return new(_v1Token) },
+		patternStorage: func() interface{} { return new(_v1PatternValue) },
+		swapStorage:    func() interface{} { return new(_v1Swap) },
+	}
+	for table, newVal := range tables {
+		if err := reencode(tx, table, newVal); err != nil {
+			return fmt.Errorf("unable to re-encode %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// The values of schema version 1 are frozen below, so that reencodeRecords writes the same records whatever
+// the live structs become. NOTE: never change them, add a migration instead.
+
+// _v1Token is the tokenStorage value of schema version 1.
+type _v1Token struct {
+	Address     common.Address
+	Symbol      string
+	Decimals    int64
+	TimesBought int
+	Price       []byte
+	TotalBought []byte
+	Safety      _v1TokenSafety
+	Meta        _v1TokenMeta
+	Name        string
+}
+
+type _v1TokenSafety struct {
+	CheckedAt          uint64
+	BuyTax             float64
+	SellTax            float64
+	Honeypot           bool
+	TransferRestricted bool
+	MaxTxLimited       bool
+}
+
+type _v1TokenMeta struct {
+	UpdatedAt         uint64
+	CreationBlock     uint64
+	Deployer          common.Address
+	PairCreationBlock uint64
+	Liquidity         []byte
+	TotalSupply       []byte
+	LPLocked          float64
+}
+
+// _v1PatternValue is the patternStorage value of schema version 1.
+type _v1PatternValue struct {
+	Value        []byte
+	TimesOccured int
+}
+
+// _v1Swap is the swapStorage value of schema version 1.
+type _v1Swap struct {
+	Wallet      common.Address
+	TokenAddr   common.Address
+	Path        []common.Address
+	Factory     common.Address
+	Price       []byte
+	Value       []byte
+	BlockNumber uint64
+	Timestamp   uint64
+	TxIndex     uint
+}
+
+func reencode(tx RwTx, table string, newVal func() interface{}) error {
+	records := make(map[string][]byte)
+	if err := tx.ForEach(table, []byte{}, func(k, v []byte) error {
+		val := newVal()
+		if err := cbor.Unmarshal(bytes.NewReader(v), val); err != nil {
+			return fmt.Errorf("unable to decode %x: %w", k, err)
+		}
+		var buf bytes.Buffer
+		if err := cbor.Marshal(&buf, val); err != nil {
+			return fmt.Errorf("unable to encode %x: %w", k, err)
+		}
+		if !bytes.Equal(v, buf.Bytes()) {
+			records[string(k)] = buf.Bytes()
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for k, v := range records {
+		if err := tx.Put(table, []byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
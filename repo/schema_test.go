@@ -0,0 +1,230 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/internal/cbor"
+	"github.com/google/go-cmp/cmp"
+)
+
+// _legacyToken is the layout of _token before safety and metadata were added.
+type _legacyToken struct {
+	Address     common.Address
+	Symbol      string
+	Decimals    int64
+	TimesBought int
+	Price       []byte
+	TotalBought []byte
+}
+
+func TestDB_Migrate(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	token := Token{
+		Address:     common.BytesToAddress([]byte("token")),
+		Symbol:      "TKN",
+		Decimals:    18,
+		Price:       big.NewInt(42),
+		TotalBought: big.NewInt(1e18),
+		TimesBought: 1,
+	}
+	s := Swap{
+		TxHash:      common.BytesToHash([]byte("legacy")),
+		Wallet:      common.BytesToAddress([]byte("wallet")),
+		TokenAddr:   token.Address,
+		Price:       big.NewInt(42),
+		Value:       big.NewInt(1e18),
+		BlockNumber: 10,
+	}
+	p := Pattern{TokenAddr: token.Address, ExchangeName: "Binance", Value: big.NewInt(1e18), TimesOccured: 1}
+	hot := Exchange{ID: 1, Name: "Kraken", Address: common.BytesToAddress([]byte("hot"))}
+	acc := Account{Address: s.Wallet, Balance: big.NewInt(0), Received: big.NewInt(2e18), Spent: big.NewInt(1e18), Exchange: "Binance"}
+	pos := Position{TxHash: s.TxHash, Price: big.NewInt(84), BlockNumber: 12, PeakPrice: big.NewInt(84), OpenedAt: 10, Reached2xAt: 12}
+	bucket := PatternBucket{Resolution: Hourly, Bucket: 1599998400, TokenAddr: token.Address, ExchangeName: "Binance", Value: big.NewInt(1e18), TimesOccured: 1}
+
+	err := db.Update(context.Background(), func(tx RwTx) error {
+		var buf bytes.Buffer
+		if err := cbor.Marshal(&buf, _legacyToken{token.Address, token.Symbol, token.Decimals, token.TimesBought, token.Price.Bytes(), token.TotalBought.Bytes()}); err != nil {
+			return err
+		}
+		if err := tx.Put(tokenStorage, token.Address.Bytes(), buf.Bytes()); err != nil {
+			return err
+		}
+
+		buf.Reset()
+		if err := cbor.Marshal(&buf, _swap{Wallet: s.Wallet, TokenAddr: s.TokenAddr, Price: s.Price.Bytes(), Value: s.Value.Bytes(), BlockNumber: s.BlockNumber}); err != nil {
+			return err
+		}
+		if err := tx.Put(swapStorage, s.TxHash.Bytes(), buf.Bytes()); err != nil {
+			return err
+		}
+
+		buf.Reset()
+		if err := cbor.Marshal(&buf, _position{pos.Price.Bytes(), pos.BlockNumber, pos.PeakPrice.Bytes(), pos.OpenedAt, pos.Reached2xAt}); err != nil {
+			return err
+		}
+		if err := tx.Put(positionStorage, s.TxHash.Bytes(), buf.Bytes()); err != nil {
+			return err
+		}
+
+		buf.Reset()
+		if err := cbor.Marshal(&buf, _patternKey{token.Address, p.ExchangeName}); err != nil {
+			return err
+		}
+		key := append([]byte(nil), buf.Bytes()...)
+		buf.Reset()
+		if err := cbor.Marshal(&buf, _patternValue{p.Value.Bytes(), p.TimesOccured}); err != nil {
+			return err
+		}
+		if err := tx.Put(patternStorage, key, buf.Bytes()); err != nil {
+			return err
+		}
+
+		buf.Reset()
+		if err := cbor.Marshal(&buf, _namedAccount{acc.Balance.Bytes(), acc.Received.Bytes(), acc.Spent.Bytes(), acc.Exchange}); err != nil {
+			return err
+		}
+		if err := tx.Put(accountStorage, acc.Address.Bytes(), buf.Bytes()); err != nil {
+			return err
+		}
+		if err := tx.Put(exchangeStorage, hot.Address.Bytes(), []byte(hot.Name)); err != nil {
+			return err
+		}
+
+		buf.Reset()
+		if err := cbor.Marshal(&buf, _patternValue{bucket.Value.Bytes(), bucket.TimesOccured}); err != nil {
+			return err
+		}
+		bucketKey := append(patternBucketKey(bucket.Resolution, bucket.Bucket, bucket.TokenAddr, 0)[:29], bucket.ExchangeName...)
+		if err := tx.Put(patternBucketStorage, bucketKey, buf.Bytes()); err != nil {
+			return err
+		}
+
+		if err := db.Migrate(tx); err != nil {
+			return err
+		}
+		// NOTE: migrated databases are left as is.
+		return db.Migrate(tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if version, err := db.SchemaVersion(tx); err != nil || version != SchemaVersion {
+		t.Errorf("DB.SchemaVersion() = %d, %v, want %d", version, err, SchemaVersion)
+	}
+
+	gotToken, err := db.PeekToken(tx, token.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(gotToken, token, cmp.AllowUnexported(big.Int{})) {
+		t.Errorf("DB.PeekToken() = %+v, want %+v", gotToken, token)
+	}
+	raw, err := tx.GetOne(tokenStorage, token.Address.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := cbor.Marshal(&buf, encodeTestToken(token)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, buf.Bytes()) {
+		t.Error("token record was not re-encoded in the current layout")
+	}
+
+	swaps, err := db.SwapsByToken(tx, token.Address, 0, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(swaps, []Swap{s}, cmp.AllowUnexported(big.Int{})) {
+		t.Errorf("DB.SwapsByToken() = %v, want %v", swaps, []Swap{s})
+	}
+
+	gotPos, err := db.PeekPosition(tx, s.TxHash, s.LogIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(gotPos, pos, cmp.AllowUnexported(big.Int{})) {
+		t.Errorf("DB.PeekPosition() = %+v, want %+v", gotPos, pos)
+	}
+
+	patterns, err := db.PatternsByExchange(tx, p.ExchangeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(patterns, []Pattern{p}, cmp.AllowUnexported(big.Int{})) {
+		t.Errorf("DB.PatternsByExchange() = %v, want %v", patterns, []Pattern{p})
+	}
+
+	// NOTE: hot wallet exchanges are assigned IDs before the pattern exchanges.
+	gotHot, err := db.PeekExchange(tx, hot.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotHot != hot {
+		t.Errorf("DB.PeekExchange() = %v, want %v", gotHot, hot)
+	}
+	gotAcc, err := db.PeekAccount(tx, acc.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(gotAcc, acc, cmp.AllowUnexported(big.Int{})) {
+		t.Errorf("DB.PeekAccount() = %v, want %v", gotAcc, acc)
+	}
+	buckets, err := db.PatternBuckets(tx, Hourly, bucket.Time(), bucket.Time().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(buckets, []PatternBucket{bucket}, cmp.AllowUnexported(big.Int{})) {
+		t.Errorf("DB.PatternBuckets() = %v, want %v", buckets, []PatternBucket{bucket})
+	}
+}
+
+func encodeTestToken(t Token) _token {
+	return _token{
+		Address:     t.Address,
+		Symbol:      t.Symbol,
+		Decimals:    t.Decimals,
+		TimesBought: t.TimesBought,
+		Price:       t.Price.Bytes(),
+		TotalBought: t.TotalBought.Bytes(),
+		Meta:        encodeTokenMeta(t.Meta),
+	}
+}
+
+func TestNewDB_SchemaTooNew(t *testing.T) {
+	t.Parallel()
+
+	path := t.TempDir()
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(context.Background(), func(tx RwTx) error {
+		return putSchemaVersion(tx, SchemaVersion+1)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if _, err := NewDB(path); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("NewDB() error = %v, want %v", err, ErrSchemaTooNew)
+	}
+	if _, err := NewDBReadOnly(path); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("NewDBReadOnly() error = %v, want %v", err, ErrSchemaTooNew)
+	}
+}
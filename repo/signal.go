@@ -0,0 +1,101 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/internal/cbor"
+)
+
+// Signal is fired when CEX funded wallets accumulate the token as described by the rule.
+type Signal struct {
+	Rule      string
+	TokenAddr common.Address
+	// Time is the time of the block the signal was fired at.
+	Time        time.Time
+	BlockNumber uint64
+	Wallets     int
+	Exchanges   []string
+	// Value is the total amount of wei spent by the supporting swaps.
+	Value *big.Int
+	// TxHashes are hashes of the supporting swaps.
+	TxHashes []common.Hash
+}
+
+type _signal struct {
+	BlockNumber uint64
+	Wallets     int
+	Exchanges   []string
+	Value       []byte
+	TxHashes    []common.Hash
+}
+
+// signalKey is time | token | rule, so signals are ordered by the time they were fired.
+func signalKey(t time.Time, token common.Address, rule string) []byte {
+	key := make([]byte, 8+common.AddressLength, 8+common.AddressLength+len(rule))
+	binary.BigEndian.PutUint64(key[:8], uint64(t.Unix()))
+	copy(key[8:], token.Bytes())
+	return append(key, rule...)
+}
+
+// PutSignal puts Signal into the signalStorage.
+func (db *DB) PutSignal(tx RwTx, s Signal) error {
+	signalVal := _signal{
+		BlockNumber: s.BlockNumber,
+		Wallets:     s.Wallets,
+		Exchanges:   s.Exchanges,
+		Value:       s.Value.Bytes(),
+		TxHashes:    s.TxHashes,
+	}
+
+	var buf bytes.Buffer
+	if err := cbor.Marshal(&buf, signalVal); err != nil {
+		return fmt.Errorf("unable to encode signal: %w", err)
+	}
+
+	if err := tx.Put(signalStorage, signalKey(s.Time, s.TokenAddr, s.Rule), buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to put signal: %w", err)
+	}
+	return nil
+}
+
+// Signals returns signals fired in [from, to), ordered by time.
+func (db *DB) Signals(tx Tx, from, to time.Time) ([]Signal, error) {
+	start := make([]byte, 8)
+	binary.BigEndian.PutUint64(start, uint64(from.Unix()))
+	end := uint64(to.Unix())
+
+	var signals []Signal
+	if err := tx.ForEach(signalStorage, start, func(k, v []byte) error {
+		if len(k) < 8+common.AddressLength {
+			return fmt.Errorf("invalid signal key: %x", k)
+		}
+		if binary.BigEndian.Uint64(k[:8]) >= end {
+			return ErrStop
+		}
+
+		var signalVal _signal
+		if err := cbor.Unmarshal(bytes.NewReader(v), &signalVal); err != nil {
+			return fmt.Errorf("unable to decode signal: %w", err)
+		}
+		signals = append(signals, Signal{
+			Rule:        string(k[8+common.AddressLength:]),
+			TokenAddr:   common.BytesToAddress(k[8 : 8+common.AddressLength]),
+			Time:        time.Unix(int64(binary.BigEndian.Uint64(k[:8])), 0),
+			BlockNumber: signalVal.BlockNumber,
+			Wallets:     signalVal.Wallets,
+			Exchanges:   signalVal.Exchanges,
+			Value:       new(big.Int).SetBytes(signalVal.Value),
+			TxHashes:    signalVal.TxHashes,
+		})
+		return nil
+	}); err != nil && err != ErrStop {
+		return nil, fmt.Errorf("unable to iterate through signals: %w", err)
+	}
+
+	return signals, nil
+}
@@ -0,0 +1,75 @@
+package repo
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDB_Signals(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	now := time.Unix(1640000000, 0)
+	signals := []Signal{
+		{
+			Rule:        "accumulation",
+			TokenAddr:   common.BytesToAddress([]byte("token0")),
+			Time:        now.Add(-time.Hour),
+			BlockNumber: 100,
+			Wallets:     3,
+			Exchanges:   []string{"Binance", "Kraken"},
+			Value:       big.NewInt(5e18),
+			TxHashes:    []common.Hash{common.BytesToHash([]byte("tx0")), common.BytesToHash([]byte("tx1"))},
+		},
+		{
+			Rule:        "whales",
+			TokenAddr:   common.BytesToAddress([]byte("token1")),
+			Time:        now,
+			BlockNumber: 400,
+			Wallets:     2,
+			Exchanges:   []string{"Binance"},
+			Value:       big.NewInt(9e18),
+			TxHashes:    []common.Hash{common.BytesToHash([]byte("tx2"))},
+		},
+	}
+	if err := db.Update(context.Background(), func(tx RwTx) error {
+		for _, s := range signals {
+			if err := db.PutSignal(tx, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []Signal
+	}{
+		{"all", now.Add(-24 * time.Hour), now.Add(time.Second), signals},
+		{"window", now.Add(-time.Hour), now, signals[:1]},
+		{"empty", now.Add(time.Second), now.Add(time.Hour), nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Signal
+			if err := db.View(context.Background(), func(tx Tx) (err error) {
+				got, err = db.Signals(tx, tt.from, tt.to)
+				return err
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, tt.want, cmp.AllowUnexported(big.Int{}, time.Time{})) {
+				t.Errorf("DB.Signals() diff = %v", cmp.Diff(got, tt.want, cmp.AllowUnexported(big.Int{}, time.Time{})))
+			}
+		})
+	}
+}
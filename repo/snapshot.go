@@ -0,0 +1,147 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotBatch is the number of entries written by one transaction of the snapshot copy.
+const snapshotBatch = 100000
+
+// Snapshot copies every table as of a single read transaction into a new mdbx database at path,
+// writers are not blocked while it's taken. The database appears at path only once the copy is complete.
+func (db *DB) Snapshot(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("snapshot %s already exists", path)
+	}
+	tmp := path + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return fmt.Errorf("unable to remove stale snapshot: %w", err)
+	}
+
+	dst, err := openMdbx(tmp, false)
+	if err != nil {
+		return fmt.Errorf("unable to create snapshot database: %w", err)
+	}
+	err = db.View(ctx, func(tx Tx) error {
+		return copyTables(ctx, tx, dst)
+	})
+	dst.Close()
+	if err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("unable to copy database: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// copyTables copies every table seen by src into dst, dst is committed every snapshotBatch entries.
+func copyTables(ctx context.Context, src Tx, dst Backend) error {
+	var (
+		w RwTx
+		n int
+	)
+	defer func() {
+		if w != nil {
+			w.Rollback()
+		}
+	}()
+	commit := func() error {
+		err := w.Commit()
+		w = nil
+		return err
+	}
+
+	for _, table := range kvTables {
+		if err := src.ForEach(table, []byte{}, func(k, v []byte) error {
+			if w == nil {
+				tx, err := dst.BeginRw(ctx)
+				if err != nil {
+					return err
+				}
+				w = tx
+			}
+			if err := w.Put(table, k, v); err != nil {
+				return err
+			}
+			if n++; n%snapshotBatch != 0 {
+				return nil
+			}
+			if err := commit(); err != nil {
+				return err
+			}
+			return ctx.Err()
+		}); err != nil {
+			return fmt.Errorf("unable to copy %s: %w", table, err)
+		}
+	}
+
+	if w == nil {
+		return nil
+	}
+	return commit()
+}
+
+// ReadSchemaVersion returns the schema version of the mdbx database at path without migrating it.
+func ReadSchemaVersion(ctx context.Context, path string) (uint64, error) {
+	if _, err := os.Stat(filepath.Join(path, "mdbx.dat")); err != nil {
+		return 0, fmt.Errorf("no database at %s: %w", path, err)
+	}
+	d, err := openMdbx(path, true)
+	if err != nil {
+		return 0, err
+	}
+	db := &DB{d}
+	defer db.Close()
+
+	var version uint64
+	err = db.View(ctx, func(tx Tx) error {
+		version, err = db.SchemaVersion(tx)
+		return err
+	})
+	return version, err
+}
+
+// Restore replaces the database at datadir with the snapshot and migrates it to the current schema,
+// the replaced database is moved aside and it's new path is returned, empty if there was none.
+// NOTE: mettu must not be running against datadir.
+func Restore(ctx context.Context, snapshot, datadir string) (old string, err error) {
+	version, err := ReadSchemaVersion(ctx, snapshot)
+	if err != nil {
+		return "", err
+	}
+	if version > SchemaVersion {
+		return "", fmt.Errorf("%w: snapshot is %d, supported %d", ErrSchemaTooNew, version, SchemaVersion)
+	}
+
+	d, err := openMdbx(snapshot, true)
+	if err != nil {
+		return "", err
+	}
+	src := &DB{d}
+	restored := datadir + ".restore"
+	err = src.Snapshot(ctx, restored)
+	src.Close()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(datadir); err == nil {
+		old = fmt.Sprintf("%s.old-%d", datadir, time.Now().Unix())
+		if err := os.Rename(datadir, old); err != nil {
+			return "", fmt.Errorf("unable to move aside %s: %w", datadir, err)
+		}
+	}
+	if err := os.Rename(restored, datadir); err != nil {
+		return old, fmt.Errorf("unable to move restored database into place: %w", err)
+	}
+
+	db, err := NewDB(datadir)
+	if err != nil {
+		return old, err
+	}
+	db.Close()
+	return old, nil
+}
@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestCopyTables_ReadTransaction(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := &DB{d: newTestDB(t)}
+	put := func(addr common.Address) {
+		if err := db.Update(ctx, func(tx RwTx) error {
+			return db.PutExchange(tx, Exchange{Name: addr.Hex(), Address: addr})
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := common.HexToAddress("0x01")
+	after := common.HexToAddress("0x02")
+	put(before)
+
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	// NOTE: the writer is not blocked by the snapshot and it's changes are not copied.
+	put(after)
+
+	dst := &DB{d: newTestDB(t)}
+	if err := copyTables(ctx, tx, dst.d); err != nil {
+		t.Fatalf("copyTables() error = %v", err)
+	}
+	if err := dst.View(ctx, func(tx Tx) error {
+		exchanges, err := dst.AllExchanges(tx)
+		if err != nil {
+			return err
+		}
+		if len(exchanges) != 1 || exchanges[0].Address != before {
+			t.Errorf("copyTables() copied %v, want only %v", exchanges, before)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	datadir := filepath.Join(dir, "db")
+	snapshot := filepath.Join(dir, "snapshot")
+	acc := Account{Address: common.HexToAddress("0x01"), Balance: big.NewInt(0), Received: big.NewInt(1), Spent: big.NewInt(0), Exchange: "Binance"}
+
+	db, err := NewDB(datadir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(ctx, func(tx RwTx) error { return db.PutAccount(tx, acc) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Snapshot(ctx, snapshot); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if err := db.Snapshot(ctx, snapshot); err == nil {
+		t.Errorf("Snapshot() overwrote existing snapshot")
+	}
+	if err := db.Update(ctx, func(tx RwTx) error { return tx.Delete(accountStorage, acc.Address.Bytes(), nil) }); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	old, err := Restore(ctx, snapshot, datadir)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if _, err := os.Stat(old); err != nil {
+		t.Errorf("Restore() did not keep the replaced database: %v", err)
+	}
+
+	db, err = NewDB(datadir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.View(ctx, func(tx Tx) error {
+		ok, err := db.HasAccount(tx, acc.Address)
+		if !ok {
+			t.Errorf("restored database misses the account")
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestore_SchemaTooNew(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "snapshot")
+
+	db, err := NewDB(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(ctx, func(tx RwTx) error { return putSchemaVersion(tx, SchemaVersion+1) }); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	datadir := filepath.Join(dir, "db")
+	if _, err := Restore(ctx, snapshot, datadir); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("Restore() error = %v, want %v", err, ErrSchemaTooNew)
+	}
+	if _, err := os.Stat(datadir); !os.IsNotExist(err) {
+		t.Errorf("Restore() created %s: %v", datadir, err)
+	}
+}
@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Tx is a read-only transaction over the tables of the Backend.
+type Tx interface {
+	// GetOne returns value of the key, nil if the key does not exist.
+	GetOne(table string, key []byte) ([]byte, error)
+	Has(table string, key []byte) (bool, error)
+	// ForEach walks the table in key order starting at fromPrefix.
+	ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error
+	// ForPrefix walks keys of the table starting with prefix in key order.
+	ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error
+	Cursor(table string) (Cursor, error)
+
+	Commit() error
+	Rollback()
+}
+
+// RwTx is a read-write transaction over the tables of the Backend.
+type RwTx interface {
+	Tx
+
+	Put(table string, k, v []byte) error
+	Delete(table string, k, v []byte) error
+	ClearBucket(table string) error
+}
+
+// Cursor navigates through the table in key order, k is nil once the cursor is exhausted.
+type Cursor interface {
+	First() (k, v []byte, err error)
+	Last() (k, v []byte, err error)
+	// Seek positions the cursor at the first key greater than or equal to seek.
+	Seek(seek []byte) (k, v []byte, err error)
+	Next() (k, v []byte, err error)
+	Prev() (k, v []byte, err error)
+	Close()
+}
+
+// Backend is a transactional ordered key-value store the DB is built on.
+type Backend interface {
+	BeginRo(ctx context.Context) (Tx, error)
+	BeginRw(ctx context.Context) (RwTx, error)
+	Close()
+}
+
+// Storage is the part of DB used by the coordinator, the website, the postgres sink and the backups.
+// DB is it's only implementation, NewMemDB is DB over the in-memory Backend rather than another Storage,
+// other methods of DB are used by the commands and the migrations through *DB.
+type Storage interface {
+	BeginRo(ctx context.Context) (Tx, error)
+	BeginRw(ctx context.Context) (RwTx, error)
+	View(ctx context.Context, f func(tx Tx) error) error
+	Update(ctx context.Context, f func(tx RwTx) error) error
+	Close()
+
+	PutAccount(tx RwTx, acc Account) error
+	HasAccount(tx Tx, addr common.Address) (bool, error)
+	PeekAccount(tx Tx, addr common.Address) (Account, error)
+	IterAccounts(tx Tx, opts IterOptions, f func(Account) error) error
+
+	PeekExchange(tx Tx, addr common.Address) (Exchange, error)
+	IterExchanges(tx Tx, opts IterOptions, f func(Exchange) error) error
+	AllExchanges(tx Tx) ([]Exchange, error)
+	AllExchangesMap(tx Tx) (map[common.Address]Exchange, error)
+
+	PutToken(tx RwTx, t Token) error
+	HasToken(tx Tx, addr common.Address) (bool, error)
+	PeekToken(tx Tx, addr common.Address) (Token, error)
+	IterTokens(tx Tx, opts IterOptions, f func(Token) error) error
+
+	PutPattern(tx RwTx, p Pattern) error
+	HasPattern(tx Tx, token common.Address, exchangeName string) (bool, error)
+	PeekPattern(tx Tx, token common.Address, exchangeName string) (Pattern, error)
+	IterPatterns(tx Tx, opts IterOptions, f func(Pattern) error) error
+
+	PutSwap(tx RwTx, s Swap) error
+	SwapsByBlock(tx Tx, from, to uint64) ([]Swap, error)
+	IterSwapsByBlock(tx Tx, from, to uint64, f func(Swap) error) error
+	IterSwaps(tx Tx, opts IterOptions, f func(Swap) error) error
+	UndatedSwaps(tx Tx) ([]Swap, error)
+	RedateSwap(tx RwTx, undated, s Swap) error
+	MarkSwapsBackfilled(tx RwTx) error
+	SwapsBackfilled(tx Tx) (bool, error)
+
+	PutFunding(tx RwTx, f Funding) error
+	IterFundings(tx Tx, opts IterOptions, f func(Funding) error) error
+	IsTxProcessed(tx Tx, txHash common.Hash) (bool, error)
+	MarkTxProcessed(tx RwTx, txHash common.Hash, blockNumber uint64) error
+
+	PutPair(tx RwTx, p Pair) error
+	IterPairs(tx Tx, opts IterOptions, f func(Pair) error) error
+	PairAddress(tx Tx, factory, tokenA, tokenB common.Address) (addr common.Address, ok bool, err error)
+	PutReservesHead(tx RwTx, blockNumber uint64) error
+	ReservesHead(tx Tx) (uint64, error)
+	PeekPriceAt(tx Tx, token common.Address, blockNumber uint64) (price *big.Int, ok bool, err error)
+	PutPriceAt(tx RwTx, token common.Address, blockNumber uint64, price *big.Int) error
+	PutValuation(tx RwTx, v Valuation) error
+	LatestValuation(tx Tx) (Valuation, bool, error)
+	StaleTokens(tx Tx, before uint64, limit int) ([]Token, error)
+
+	AddPatternBuckets(tx RwTx, token common.Address, exchangeName string, value *big.Int, at time.Time) error
+	PutPosition(tx RwTx, p Position) error
+	AllPositionsMap(tx Tx) (map[string]Position, error)
+	PutSignal(tx RwTx, s Signal) error
+	Signals(tx Tx, from, to time.Time) ([]Signal, error)
+	PutLeaderboard(tx RwTx, scores []WalletScore) error
+	Leaderboard(tx Tx, limit int) ([]WalletScore, error)
+
+	AccountsData(tx Tx, opts IterOptions) ([]FullAccount, error)
+	TokensData(tx Tx, opts IterOptions, filter func(t Token, head uint64) bool) ([]FullToken, error)
+	AllPatternsData(tx Tx) ([]FullPattern, error)
+	SafePatternsData(tx Tx) ([]FullPattern, error)
+	Snapshot(ctx context.Context, path string) error
+}
+
+var _ Storage = (*DB)(nil)
@@ -0,0 +1,523 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/go-cmp/cmp"
+)
+
+// storageBackends are the Backends every conformance test of DB is run against.
+var storageBackends = map[string]func(t *testing.T) *DB{
+	"mdbx": func(t *testing.T) *DB {
+		db, err := newDB(newTestDB(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(db.Close)
+		return db
+	},
+	"memory": func(t *testing.T) *DB {
+		return NewMemDB()
+	},
+}
+
+func TestStorage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, s *DB)
+	}{
+		{"accounts", testStorageAccounts},
+		{"exchanges", testStorageExchanges},
+		{"tokens", testStorageTokens},
+		{"patterns", testStoragePatterns},
+		{"swaps", testStorageSwaps},
+		{"transactions", testStorageTransactions},
+		{"cursor", testStorageCursor},
+		{"iterators", testStorageIterators},
+	}
+	for name, newStorage := range storageBackends {
+		name, newStorage := name, newStorage
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			for _, tt := range tests {
+				tt := tt
+				t.Run(tt.name, func(t *testing.T) {
+					t.Parallel()
+					tt.test(t, newStorage(t))
+				})
+			}
+		})
+	}
+}
+
+func update(t *testing.T, s *DB, f func(tx RwTx) error) {
+	t.Helper()
+	if err := s.Update(context.Background(), f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func view(t *testing.T, s *DB, f func(tx Tx) error) {
+	t.Helper()
+	if err := s.View(context.Background(), f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testStorageAccounts(t *testing.T, s *DB) {
+	accounts := []Account{
+		{Address: common.BytesToAddress([]byte("account0")), Balance: big.NewInt(1), Received: big.NewInt(2e18), Spent: big.NewInt(0), Exchange: "Binance"},
+		{Address: common.BytesToAddress([]byte("account1")), Balance: big.NewInt(0), Received: big.NewInt(5e18), Spent: big.NewInt(1e18), Exchange: "Kraken"},
+	}
+	update(t, s, func(tx RwTx) error {
+		for _, acc := range accounts {
+			if err := s.PutAccount(tx, acc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	view(t, s, func(tx Tx) error {
+		for _, want := range accounts {
+			ok, err := s.HasAccount(tx, want.Address)
+			if err != nil || !ok {
+				t.Errorf("Storage.HasAccount(%v) = %v, %v", want.Address, ok, err)
+			}
+			got, err := s.PeekAccount(tx, want.Address)
+			if err != nil {
+				return err
+			}
+			if !cmp.Equal(got, want, cmp.AllowUnexported(big.Int{})) {
+				t.Errorf("Storage.PeekAccount() = %v, want %v", got, want)
+			}
+		}
+		if ok, err := s.HasAccount(tx, common.BytesToAddress([]byte("missing"))); err != nil || ok {
+			t.Errorf("Storage.HasAccount(missing) = %v, %v", ok, err)
+		}
+
+		all, err := s.AllAccounts(tx)
+		if err != nil {
+			return err
+		}
+		if !cmp.Equal(all, accounts, cmp.AllowUnexported(big.Int{})) {
+			t.Errorf("Storage.AllAccounts() = %v, want %v", all, accounts)
+		}
+		m, err := s.AllAccountsMap(tx)
+		if err != nil {
+			return err
+		}
+		if len(m) != len(accounts) || m[accounts[1].Address].Exchange != "Kraken" {
+			t.Errorf("Storage.AllAccountsMap() = %v", m)
+		}
+		return nil
+	})
+}
+
+func testStorageExchanges(t *testing.T, s *DB) {
+	exchanges := []Exchange{
+		{ID: 1, Name: "Binance", Address: common.HexToAddress("0x28c6c06298d514db089934071355e5743bf21d60")},
+		{ID: 2, Name: "Kraken", Address: common.HexToAddress("0x2910543af39aba0cd09dbb2d50200b3e800a63d2")},
+	}
+	update(t, s, func(tx RwTx) error {
+		for _, e := range exchanges {
+			if err := s.PutExchange(tx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	view(t, s, func(tx Tx) error {
+		got, err := s.PeekExchange(tx, exchanges[1].Address)
+		if err != nil {
+			return err
+		}
+		if got != exchanges[1] {
+			t.Errorf("Storage.PeekExchange() = %v, want %v", got, exchanges[1])
+		}
+
+		all, err := s.AllExchanges(tx)
+		if err != nil {
+			return err
+		}
+		if !cmp.Equal(all, exchanges) {
+			t.Errorf("Storage.AllExchanges() = %v, want %v", all, exchanges)
+		}
+		m, err := s.AllExchangesMap(tx)
+		if err != nil {
+			return err
+		}
+		if len(m) != len(exchanges) || m[exchanges[0].Address] != exchanges[0] {
+			t.Errorf("Storage.AllExchangesMap() = %v", m)
+		}
+		return nil
+	})
+
+	update(t, s, func(tx RwTx) error { return s.DeleteExchange(tx, exchanges[0].Address) })
+	view(t, s, func(tx Tx) error {
+		all, err := s.AllExchanges(tx)
+		if err != nil {
+			return err
+		}
+		if !cmp.Equal(all, exchanges[1:]) {
+			t.Errorf("Storage.AllExchanges() after DeleteExchange = %v, want %v", all, exchanges[1:])
+		}
+		return nil
+	})
+}
+
+func testStorageTokens(t *testing.T, s *DB) {
+	tokens := []Token{
+		// NOTE: ordered by address.
+		{
+			Address:     common.BytesToAddress([]byte("token")),
+			Symbol:      "TKN",
+			Decimals:    9,
+			Price:       big.NewInt(42),
+			TotalBought: big.NewInt(3e18),
+			TimesBought: 3,
+			Safety:      TokenSafety{CheckedAt: 10, SellTax: 0.1},
+			Meta:        TokenMeta{UpdatedAt: 10, CreationBlock: 5, Liquidity: big.NewInt(1e18), TotalSupply: big.NewInt(1e9), LPLocked: 1},
+		},
+		{
+			Address:     common.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"),
+			Symbol:      "WETH",
+			Name:        "Wrapped Ether",
+			Decimals:    18,
+			Price:       big.NewInt(1e18),
+			TotalBought: big.NewInt(0),
+		},
+	}
+	update(t, s, func(tx RwTx) error {
+		for _, token := range tokens {
+			if err := s.PutToken(tx, token); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	view(t, s, func(tx Tx) error {
+		for _, want := range tokens {
+			if ok, err := s.HasToken(tx, want.Address); err != nil || !ok {
+				t.Errorf("Storage.HasToken(%v) = %v, %v", want.Address, ok, err)
+			}
+			got, err := s.PeekToken(tx, want.Address)
+			if err != nil {
+				return err
+			}
+			if !cmp.Equal(got, want, cmp.AllowUnexported(big.Int{})) {
+				t.Errorf("Storage.PeekToken() = %+v, want %+v", got, want)
+			}
+		}
+
+		all, err := s.AllTokens(tx)
+		if err != nil {
+			return err
+		}
+		if !cmp.Equal(all, tokens, cmp.AllowUnexported(big.Int{})) {
+			t.Errorf("Storage.AllTokens() = %+v, want %+v", all, tokens)
+		}
+		m, err := s.AllTokensMap(tx)
+		if err != nil {
+			return err
+		}
+		if len(m) != len(tokens) || m[tokens[0].Address].Symbol != "TKN" {
+			t.Errorf("Storage.AllTokensMap() = %v", m)
+		}
+		return nil
+	})
+}
+
+func testStoragePatterns(t *testing.T, s *DB) {
+	token := common.BytesToAddress([]byte("token"))
+	patterns := []Pattern{
+		{TokenAddr: token, ExchangeName: "Binance", Value: big.NewInt(2e18), TimesOccured: 2},
+		{TokenAddr: token, ExchangeName: "Kraken", Value: big.NewInt(1e18), TimesOccured: 1},
+	}
+	update(t, s, func(tx RwTx) error {
+		for _, p := range patterns {
+			if err := s.PutPattern(tx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	view(t, s, func(tx Tx) error {
+		for _, want := range patterns {
+			if ok, err := s.HasPattern(tx, want.TokenAddr, want.ExchangeName); err != nil || !ok {
+				t.Errorf("Storage.HasPattern(%v) = %v, %v", want.ExchangeName, ok, err)
+			}
+			got, err := s.PeekPattern(tx, want.TokenAddr, want.ExchangeName)
+			if err != nil {
+				return err
+			}
+			if !cmp.Equal(got, want, cmp.AllowUnexported(big.Int{})) {
+				t.Errorf("Storage.PeekPattern() = %v, want %v", got, want)
+			}
+		}
+		if ok, err := s.HasPattern(tx, token, "Coinbase"); err != nil || ok {
+			t.Errorf("Storage.HasPattern(Coinbase) = %v, %v", ok, err)
+		}
+
+		all, err := s.AllPatterns(tx)
+		if err != nil {
+			return err
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i].ExchangeName < all[j].ExchangeName })
+		if !cmp.Equal(all, patterns, cmp.AllowUnexported(big.Int{})) {
+			t.Errorf("Storage.AllPatterns() = %v, want %v", all, patterns)
+		}
+		return nil
+	})
+
+	other := Pattern{TokenAddr: common.BytesToAddress([]byte("other")), ExchangeName: "Binance", Value: big.NewInt(3e18), TimesOccured: 3}
+	update(t, s, func(tx RwTx) error { return s.PutPattern(tx, other) })
+
+	view(t, s, func(tx Tx) error {
+		byToken, err := s.PatternsByToken(tx, token)
+		if err != nil {
+			return err
+		}
+		if !cmp.Equal(byToken, patterns, cmp.AllowUnexported(big.Int{})) {
+			t.Errorf("Storage.PatternsByToken() = %v, want %v", byToken, patterns)
+		}
+
+		tests := []struct {
+			exchange string
+			want     []Pattern
+		}{
+			{"Binance", []Pattern{other, patterns[0]}},
+			{"Kraken", patterns[1:]},
+			{"Coinbase", nil},
+		}
+		for _, tt := range tests {
+			got, err := s.PatternsByExchange(tx, tt.exchange)
+			if err != nil {
+				return err
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i].TimesOccured > got[j].TimesOccured })
+			if !cmp.Equal(got, tt.want, cmp.AllowUnexported(big.Int{})) {
+				t.Errorf("Storage.PatternsByExchange(%s) = %v, want %v", tt.exchange, got, tt.want)
+			}
+		}
+		return nil
+	})
+}
+
+func testStorageSwaps(t *testing.T, s *DB) {
+	var (
+		wallet = common.BytesToAddress([]byte("wallet"))
+		token0 = common.BytesToAddress([]byte("token0"))
+		token1 = common.BytesToAddress([]byte("token1"))
+	)
+	swaps := []Swap{
+		testSwap(0, wallet, token0, 10),
+		testSwap(1, wallet, token1, 11),
+		testSwap(2, common.BytesToAddress([]byte("other")), token0, 12),
+	}
+	// NOTE: second swap of the same transaction.
+	second := swaps[0]
+	second.LogIndex = 5
+	second.TokenAddr = token1
+	swaps = append(swaps, second)
+
+	update(t, s, func(tx RwTx) error {
+		for _, sw := range swaps {
+			if err := s.PutSwap(tx, sw); err != nil {
+				return err
+			}
+		}
+		return s.DeleteSwap(tx, swaps[2].TxHash, swaps[2].LogIndex)
+	})
+
+	view(t, s, func(tx Tx) error {
+		got, err := s.PeekSwap(tx, second.TxHash, second.LogIndex)
+		if err != nil {
+			return err
+		}
+		if !cmp.Equal(got, second, cmp.AllowUnexported(big.Int{})) {
+			t.Errorf("Storage.PeekSwap() = %v, want %v", got, second)
+		}
+
+		queries := []struct {
+			name  string
+			query func() ([]Swap, error)
+			want  []Swap
+		}{
+			{"SwapsByTx", func() ([]Swap, error) { return s.SwapsByTx(tx, swaps[0].TxHash) }, []Swap{swaps[0], second}},
+			{"SwapsByWallet", func() ([]Swap, error) { return s.SwapsByWallet(tx, wallet, 0, math.MaxUint64) }, []Swap{swaps[0], second, swaps[1]}},
+			{"SwapsByToken", func() ([]Swap, error) { return s.SwapsByToken(tx, token0, 0, math.MaxUint64) }, []Swap{swaps[0]}},
+			{"SwapsByBlock", func() ([]Swap, error) { return s.SwapsByBlock(tx, 11, 13) }, []Swap{swaps[1]}},
+			{"AllSwaps", func() ([]Swap, error) { return s.AllSwaps(tx) }, []Swap{swaps[0], second, swaps[1]}},
+		}
+		for _, q := range queries {
+			got, err := q.query()
+			if err != nil {
+				return err
+			}
+			if !cmp.Equal(got, q.want, cmp.AllowUnexported(big.Int{})) {
+				t.Errorf("Storage.%s() = %v, want %v", q.name, got, q.want)
+			}
+		}
+		return nil
+	})
+}
+
+func testStorageTransactions(t *testing.T, s *DB) {
+	e := Exchange{Name: "Binance", Address: common.BytesToAddress([]byte("binance"))}
+	errAbort := errors.New("abort")
+
+	if err := s.Update(context.Background(), func(tx RwTx) error {
+		if err := s.PutExchange(tx, e); err != nil {
+			return err
+		}
+		return errAbort
+	}); !errors.Is(err, errAbort) {
+		t.Fatalf("Storage.Update() error = %v, want %v", err, errAbort)
+	}
+	view(t, s, func(tx Tx) error {
+		if all, _ := s.AllExchanges(tx); len(all) != 0 {
+			t.Errorf("rolled back transaction left %v", all)
+		}
+		return nil
+	})
+
+	// NOTE: readers see the state committed before they began.
+	ro, err := s.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Rollback()
+	update(t, s, func(tx RwTx) error { return s.PutExchange(tx, e) })
+
+	if all, _ := s.AllExchanges(ro); len(all) != 0 {
+		t.Errorf("reader sees uncommitted or later state: %v", all)
+	}
+	view(t, s, func(tx Tx) error {
+		if all, _ := s.AllExchanges(tx); len(all) != 1 {
+			t.Errorf("Storage.AllExchanges() = %v, want %v", all, []Exchange{e})
+		}
+		return nil
+	})
+}
+
+func testStorageCursor(t *testing.T, s *DB) {
+	keys := [][]byte{{1}, {1, 1}, {2}, {3, 0}}
+	update(t, s, func(tx RwTx) error {
+		for _, k := range keys {
+			if err := tx.Put(exchangeStorage, k, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	view(t, s, func(tx Tx) error {
+		c, err := tx.Cursor(exchangeStorage)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		steps := []struct {
+			name string
+			move func() ([]byte, []byte, error)
+			want []byte
+		}{
+			{"First", c.First, keys[0]},
+			{"Next", c.Next, keys[1]},
+			{"Seek", func() ([]byte, []byte, error) { return c.Seek([]byte{1, 2}) }, keys[2]},
+			{"Prev", c.Prev, keys[1]},
+			{"Last", c.Last, keys[3]},
+			{"Next past end", c.Next, nil},
+			{"Seek past end", func() ([]byte, []byte, error) { return c.Seek([]byte{4}) }, nil},
+		}
+		for _, step := range steps {
+			k, _, err := step.move()
+			if err != nil {
+				return err
+			}
+			if !cmp.Equal(k, step.want, cmp.Comparer(func(a, b []byte) bool { return string(a) == string(b) })) {
+				t.Errorf("Cursor.%s() = %x, want %x", step.name, k, step.want)
+			}
+		}
+
+		var prefixed [][]byte
+		if err := tx.ForPrefix(exchangeStorage, []byte{1}, func(k, _ []byte) error {
+			prefixed = append(prefixed, k)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if len(prefixed) != 2 {
+			t.Errorf("Tx.ForPrefix() walked %x, want %x", prefixed, keys[:2])
+		}
+		return nil
+	})
+}
+
+func testStorageIterators(t *testing.T, s *DB) {
+	var exchanges []Exchange
+	for i := byte(1); i <= 5; i++ {
+		exchanges = append(exchanges, Exchange{Name: string('A' + i), Address: common.BytesToAddress([]byte{i})})
+	}
+	update(t, s, func(tx RwTx) error {
+		for _, e := range exchanges {
+			if err := s.PutExchange(tx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	stopAt := errors.New("stop at C")
+	tests := []struct {
+		name    string
+		opts    IterOptions
+		stop    error
+		want    string
+		wantErr error
+	}{
+		{"all", IterOptions{}, nil, "BCDEF", nil},
+		{"start", IterOptions{Start: exchanges[2].Address.Bytes()}, nil, "DEF", nil},
+		{"start between keys", IterOptions{Start: append(exchanges[2].Address.Bytes(), 0)}, nil, "EF", nil},
+		{"limit", IterOptions{Start: exchanges[1].Address.Bytes(), Limit: 2}, nil, "CD", nil},
+		{"reverse", IterOptions{Reverse: true}, nil, "FEDCB", nil},
+		{"reverse start", IterOptions{Start: exchanges[2].Address.Bytes(), Reverse: true, Limit: 2}, nil, "DC", nil},
+		{"reverse start between keys", IterOptions{Start: append(exchanges[2].Address.Bytes(), 0), Reverse: true}, nil, "DCB", nil},
+		{"reverse start after last", IterOptions{Start: common.BytesToAddress([]byte{9}).Bytes(), Reverse: true, Limit: 1}, nil, "F", nil},
+		{"start after last", IterOptions{Start: common.BytesToAddress([]byte{9}).Bytes()}, nil, "", nil},
+		{"early stop", IterOptions{}, ErrStop, "BC", nil},
+		{"error", IterOptions{}, stopAt, "BC", stopAt},
+	}
+	view(t, s, func(tx Tx) error {
+		for _, tt := range tests {
+			var got string
+			err := s.IterExchanges(tx, tt.opts, func(e Exchange) error {
+				got += e.Name
+				if tt.stop != nil && e.Name == "C" {
+					return tt.stop
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: Storage.IterExchanges() error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("%s: Storage.IterExchanges() visited %q, want %q", tt.name, got, tt.want)
+			}
+		}
+		return nil
+	})
+}
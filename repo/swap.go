@@ -2,12 +2,12 @@ package repo
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/gelfand/mettu/internal/cbor"
-	"github.com/ledgerwatch/erigon-lib/kv"
 )
 
 type SwapWithToken struct {
@@ -33,25 +33,115 @@ type Swap struct {
 	Factory   common.Address
 	Price     *big.Int
 	Value     *big.Int
+	// BlockNumber is the block the swap was included in.
+	BlockNumber uint64
+	// Timestamp is the unix time of the block.
+	Timestamp uint64
+	// TxIndex is the index of the transaction in the block.
+	TxIndex uint
+	// LogIndex is the index of the `Swap` log of the last hop in the block,
+	// it tells apart swaps of the same transaction.
+	LogIndex uint
+}
+
+// FullSwap is Swap with it's amounts valued in USD at the block of the swap.
+type FullSwap struct {
+	Swap
+	PriceUSD float64
+	ValueUSD float64
+}
+
+// SwapsData values the swaps in USD at their blocks.
+func (db *DB) SwapsData(tx Tx, swaps []Swap) ([]FullSwap, error) {
+	vals := db.newValuer(tx)
+	fullSwaps := make([]FullSwap, len(swaps))
+	for i, s := range swaps {
+		fs, err := vals.fullSwap(s)
+		if err != nil {
+			return nil, err
+		}
+		fullSwaps[i] = fs
+	}
+	return fullSwaps, nil
+}
+
+func (v *valuer) fullSwap(s Swap) (FullSwap, error) {
+	val, err := v.at(s.BlockNumber)
+	if err != nil {
+		return FullSwap{}, err
+	}
+	return FullSwap{Swap: s, PriceUSD: val.USD(s.Price), ValueUSD: val.USD(s.Value)}, nil
+}
+
+// swapKeyLength is the length of txHash | logIndex swapStorage keys.
+const swapKeyLength = common.HashLength + 4
+
+// SwapKey returns swapStorage key of the swap with the given log index made in the transaction.
+func SwapKey(txHash common.Hash, logIndex uint) []byte {
+	k := make([]byte, swapKeyLength)
+	copy(k, txHash.Bytes())
+	binary.BigEndian.PutUint32(k[common.HashLength:], uint32(logIndex))
+	return k
+}
+
+// Key returns swapStorage key of the swap.
+func (s Swap) Key() []byte {
+	return SwapKey(s.TxHash, s.LogIndex)
 }
 
 type _swap struct {
-	Wallet    common.Address
-	TokenAddr common.Address
-	Path      []common.Address
-	Factory   common.Address
-	Price     []byte
-	Value     []byte
+	Wallet      common.Address
+	TokenAddr   common.Address
+	Path        []common.Address
+	Factory     common.Address
+	Price       []byte
+	Value       []byte
+	BlockNumber uint64
+	Timestamp   uint64
+	TxIndex     uint
 }
 
-func (db *DB) PutSwap(tx kv.RwTx, s Swap) error {
+func decodeSwap(k, v []byte) (Swap, error) {
+	if len(k) != swapKeyLength {
+		return Swap{}, fmt.Errorf("invalid swap key length: %d", len(k))
+	}
+	var swapVal _swap
+	if err := cbor.Unmarshal(bytes.NewReader(v), &swapVal); err != nil {
+		return Swap{}, fmt.Errorf("unable to decode swap record: %w", err)
+	}
+
+	return Swap{
+		TxHash:      common.BytesToHash(k[:common.HashLength]),
+		LogIndex:    uint(binary.BigEndian.Uint32(k[common.HashLength:])),
+		Wallet:      swapVal.Wallet,
+		TokenAddr:   swapVal.TokenAddr,
+		Path:        swapVal.Path,
+		Factory:     swapVal.Factory,
+		Price:       new(big.Int).SetBytes(swapVal.Price),
+		Value:       new(big.Int).SetBytes(swapVal.Value),
+		BlockNumber: swapVal.BlockNumber,
+		Timestamp:   swapVal.Timestamp,
+		TxIndex:     swapVal.TxIndex,
+	}, nil
+}
+
+// PutSwap puts swap record into swapStorage and updates it's secondary indexes.
+func (db *DB) PutSwap(tx RwTx, s Swap) error {
 	swapVal := _swap{
-		Wallet:    s.Wallet,
-		TokenAddr: s.TokenAddr,
-		Path:      s.Path,
-		Factory:   s.Factory,
-		Price:     s.Price.Bytes(),
-		Value:     s.Value.Bytes(),
+		Wallet:      s.Wallet,
+		TokenAddr:   s.TokenAddr,
+		Path:        s.Path,
+		Factory:     s.Factory,
+		Price:       s.Price.Bytes(),
+		Value:       s.Value.Bytes(),
+		BlockNumber: s.BlockNumber,
+		Timestamp:   s.Timestamp,
+		TxIndex:     s.TxIndex,
+	}
+
+	// NOTE: the record may be overwritten with another wallet, token or block, drop it's stale index entries.
+	if err := db.unindexSwap(tx, s.Key()); err != nil {
+		return err
 	}
 
 	var buf bytes.Buffer
@@ -59,79 +149,167 @@ func (db *DB) PutSwap(tx kv.RwTx, s Swap) error {
 		return fmt.Errorf("unable to encode swap record: %w", err)
 	}
 
-	if err := tx.Put(swapStorage, s.TxHash.Bytes(), buf.Bytes()); err != nil {
+	if err := tx.Put(swapStorage, s.Key(), buf.Bytes()); err != nil {
 		return fmt.Errorf("unable to put swap record: %w", err)
 	}
 
-	return nil
+	return indexSwap(tx, s)
 }
 
-func (db *DB) PeekSwap(tx kv.Tx, txHash common.Hash) (Swap, error) {
-	val, err := tx.GetOne(swapStorage, txHash.Bytes())
+// PeekSwap returns the swap with the given log index made in the transaction.
+func (db *DB) PeekSwap(tx Tx, txHash common.Hash, logIndex uint) (Swap, error) {
+	key := SwapKey(txHash, logIndex)
+	val, err := tx.GetOne(swapStorage, key)
 	if err != nil {
 		return Swap{}, fmt.Errorf("could not peek swap record: %w", err)
 	}
 
-	var swapVal _swap
-	if err := cbor.Unmarshal(bytes.NewReader(val), &swapVal); err != nil {
+	s, err := decodeSwap(key, val)
+	if err != nil {
 		return Swap{}, fmt.Errorf("could not unmarshal swap value: %w", err)
 	}
 
-	s := Swap{
-		TxHash:    txHash,
-		Wallet:    swapVal.Wallet,
-		TokenAddr: swapVal.TokenAddr,
-		Path:      swapVal.Path,
-		Factory:   swapVal.Factory,
-		Price:     new(big.Int).SetBytes(swapVal.Price),
-		Value:     new(big.Int).SetBytes(swapVal.Value),
-	}
-
 	return s, nil
 }
 
-// DeleteSwap deletes swap record from swapStorage.
-func (db *DB) DeleteSwap(tx kv.RwTx, txHash common.Hash) error {
-	v, err := tx.GetOne(swapStorage, txHash.Bytes())
+// DeleteSwap deletes swap record from swapStorage and it's secondary indexes.
+func (db *DB) DeleteSwap(tx RwTx, txHash common.Hash, logIndex uint) error {
+	key := SwapKey(txHash, logIndex)
+	if err := db.unindexSwap(tx, key); err != nil {
+		return err
+	}
+
+	v, err := tx.GetOne(swapStorage, key)
 	if err != nil {
 		return err
 	}
 
-	if err := tx.Delete(swapStorage, txHash.Bytes(), v); err != nil {
+	if err := tx.Delete(swapStorage, key, v); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (db *DB) AllSwaps(tx kv.Tx) ([]Swap, error) {
-	// 	wallets, err := db.AllAccountsMap(tx)
-	// 	if err != nil {
-	// 		return nil, fmt.Errorf("unable to retrieve all accounts: %w", err)
-	// 	}
+// SwapsByTx returns swaps made in the transaction ordered by log index.
+func (db *DB) SwapsByTx(tx Tx, txHash common.Hash) ([]Swap, error) {
+	var swaps []Swap
+	if err := tx.ForPrefix(swapStorage, txHash.Bytes(), func(k, v []byte) error {
+		s, err := decodeSwap(k, v)
+		if err != nil {
+			return err
+		}
+		swaps = append(swaps, s)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("could not retrieve swaps of %v: %w", txHash, err)
+	}
+	return swaps, nil
+}
 
-	// 	tokens, err := db.AllTokensMap(tx)
-	// 	if err != nil {
-	// 		return nil, fmt.Errorf("unable to retrieve all tokens")
-	// 	}
+// migrateSwapKeys rewrites swaps stored by transaction hash alone to txHash | logIndex keys with zero log index.
+// NOTE: legacy records have no block metadata, see UndatedSwaps.
+func (db *DB) migrateSwapKeys(tx RwTx) error {
+	var legacy [][]byte
+	if err := tx.ForEach(swapStorage, []byte{}, func(k, _ []byte) error {
+		if len(k) == common.HashLength {
+			legacy = append(legacy, common.CopyBytes(k))
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("could not scan swap records: %w", err)
+	}
+	for _, k := range legacy {
+		v, err := tx.GetOne(swapStorage, k)
+		if err != nil {
+			return fmt.Errorf("could not peek swap record: %w", err)
+		}
+		if err := tx.Put(swapStorage, SwapKey(common.BytesToHash(k), 0), common.CopyBytes(v)); err != nil {
+			return fmt.Errorf("unable to put migrated swap record: %w", err)
+		}
+		if err := tx.Delete(swapStorage, k, nil); err != nil {
+			return fmt.Errorf("unable to delete legacy swap record: %w", err)
+		}
+	}
+	return nil
+}
 
+// UndatedSwaps returns swaps recorded before the block metadata was stored, they were migrated with zero
+// BlockNumber, Timestamp, TxIndex and LogIndex. Such swaps are not found by SwapsByBlock, nor put into
+// pattern buckets, until they are redated with RedateSwap.
+func (db *DB) UndatedSwaps(tx Tx) ([]Swap, error) {
 	var swaps []Swap
-	if err := tx.ForEach(swapStorage, []byte{}, func(k, v []byte) error {
-		txHash := common.BytesToHash(k)
-
-		var swapVal _swap
-		if err := cbor.Unmarshal(bytes.NewReader(v), &swapVal); err != nil {
-			return fmt.Errorf("unable to decode swap record: %w", err)
+	if err := db.IterSwaps(tx, IterOptions{}, func(s Swap) error {
+		if s.BlockNumber == 0 {
+			swaps = append(swaps, s)
 		}
-		s := Swap{
-			TxHash:    txHash,
-			Wallet:    swapVal.Wallet,
-			TokenAddr: swapVal.TokenAddr,
-			Path:      swapVal.Path,
-			Factory:   swapVal.Factory,
-			Price:     new(big.Int).SetBytes(swapVal.Price),
-			Value:     new(big.Int).SetBytes(swapVal.Value),
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("could not retrieve undated swap records: %w", err)
+	}
+	return swaps, nil
+}
+
+// swapsBackfilledKey is the headStorage key marking that the undated swaps were backfilled.
+var swapsBackfilledKey = []byte("backfill")
+
+// MarkSwapsBackfilled records that the undated swaps were backfilled, so they're not looked for again.
+func (db *DB) MarkSwapsBackfilled(tx RwTx) error {
+	if err := tx.Put(headStorage, swapsBackfilledKey, []byte{1}); err != nil {
+		return fmt.Errorf("unable to mark swaps backfilled: %w", err)
+	}
+	return nil
+}
+
+// SwapsBackfilled reports whether the undated swaps were backfilled.
+func (db *DB) SwapsBackfilled(tx Tx) (bool, error) {
+	v, err := tx.GetOne(headStorage, swapsBackfilledKey)
+	if err != nil {
+		return false, fmt.Errorf("could not get swaps backfill mark: %w", err)
+	}
+	return len(v) != 0, nil
+}
+
+// RedateSwap replaces the undated swap with s, it's the same swap with the block metadata and log index filled.
+// Position of the swap is moved to the new key.
+func (db *DB) RedateSwap(tx RwTx, undated, s Swap) error {
+	if err := db.DeleteSwap(tx, undated.TxHash, undated.LogIndex); err != nil {
+		return fmt.Errorf("unable to delete undated swap record: %w", err)
+	}
+	if err := db.PutSwap(tx, s); err != nil {
+		return err
+	}
+
+	v, err := tx.GetOne(positionStorage, undated.Key())
+	if err != nil {
+		return fmt.Errorf("could not peek position record: %w", err)
+	}
+	if v == nil || bytes.Equal(undated.Key(), s.Key()) {
+		return nil
+	}
+	v = common.CopyBytes(v)
+	if err := tx.Delete(positionStorage, undated.Key(), nil); err != nil {
+		return fmt.Errorf("unable to delete position record: %w", err)
+	}
+	if err := tx.Put(positionStorage, s.Key(), v); err != nil {
+		return fmt.Errorf("unable to put position record: %w", err)
+	}
+	return nil
+}
+
+// IterSwaps calls f for swaps ordered by their keys, Start of the options is SwapKey of the swap.
+func (db *DB) IterSwaps(tx Tx, opts IterOptions, f func(Swap) error) error {
+	return iterate(tx, swapStorage, opts, func(k, v []byte) error {
+		s, err := decodeSwap(k, v)
+		if err != nil {
+			return err
 		}
+		return f(s)
+	})
+}
 
+func (db *DB) AllSwaps(tx Tx) ([]Swap, error) {
+	var swaps []Swap
+	if err := db.IterSwaps(tx, IterOptions{}, func(s Swap) error {
 		swaps = append(swaps, s)
 		return nil
 	}); err != nil {
@@ -141,7 +319,7 @@ func (db *DB) AllSwaps(tx kv.Tx) ([]Swap, error) {
 	return swaps, nil
 }
 
-// func (db *DB) AllSwapsMap(tx kv.Tx) (map[common.Address][]SwapWithToken, error) {
+// func (db *DB) AllSwapsMap(tx Tx) (map[common.Address][]SwapWithToken, error) {
 // 	wallets, err := db.AllAccountsMap(tx)
 // 	if err != nil {
 // 		return nil, fmt.Errorf("unable to retrieve all accounts: %w", err)
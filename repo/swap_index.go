@@ -0,0 +1,153 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Secondary indexes of swapStorage, keys are
+//
+//	swapWalletIndex: wallet | block | swap key
+//	swapTokenIndex:  token | block | swap key
+//	swapBlockIndex:  block | swap key
+//
+// with big-endian block numbers so that swaps of the same wallet or token are ordered by block.
+// Values are empty, records are looked up in swapStorage by the trailing swap key.
+
+func swapIndexKey(prefix []byte, blockNumber uint64, swapKey []byte) []byte {
+	k := make([]byte, len(prefix)+8+swapKeyLength)
+	copy(k, prefix)
+	binary.BigEndian.PutUint64(k[len(prefix):], blockNumber)
+	copy(k[len(prefix)+8:], swapKey)
+	return k
+}
+
+func swapIndexKeys(s Swap) map[string][]byte {
+	key := s.Key()
+	return map[string][]byte{
+		swapWalletIndex: swapIndexKey(s.Wallet.Bytes(), s.BlockNumber, key),
+		swapTokenIndex:  swapIndexKey(s.TokenAddr.Bytes(), s.BlockNumber, key),
+		swapBlockIndex:  swapIndexKey(nil, s.BlockNumber, key),
+	}
+}
+
+func indexSwap(tx RwTx, s Swap) error {
+	for table, k := range swapIndexKeys(s) {
+		if err := tx.Put(table, k, []byte{}); err != nil {
+			return fmt.Errorf("unable to put %s entry: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// unindexSwap deletes index entries of the stored swap, it's a no-op if the swap is not stored.
+func (db *DB) unindexSwap(tx RwTx, key []byte) error {
+	v, err := tx.GetOne(swapStorage, key)
+	if err != nil {
+		return fmt.Errorf("could not peek swap record: %w", err)
+	}
+	if v == nil {
+		return nil
+	}
+	s, err := decodeSwap(key, v)
+	if err != nil {
+		return err
+	}
+
+	for table, k := range swapIndexKeys(s) {
+		if err := tx.Delete(table, k, nil); err != nil {
+			return fmt.Errorf("unable to delete %s entry: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// SwapsByWallet returns swaps of the wallet included in blocks [from, to), ordered by block.
+func (db *DB) SwapsByWallet(tx Tx, wallet common.Address, from, to uint64) ([]Swap, error) {
+	return db.swapsByIndex(tx, swapWalletIndex, wallet.Bytes(), from, to)
+}
+
+// SwapsByToken returns buys of the token included in blocks [from, to), ordered by block.
+func (db *DB) SwapsByToken(tx Tx, token common.Address, from, to uint64) ([]Swap, error) {
+	return db.swapsByIndex(tx, swapTokenIndex, token.Bytes(), from, to)
+}
+
+// SwapsByBlock returns swaps included in blocks [from, to), ordered by block.
+func (db *DB) SwapsByBlock(tx Tx, from, to uint64) ([]Swap, error) {
+	return db.swapsByIndex(tx, swapBlockIndex, nil, from, to)
+}
+
+// IterSwapsByBlock calls f for swaps included in blocks [from, to) ordered by block, the swaps are streamed
+// from the block index. ErrStop stops the iteration without error.
+func (db *DB) IterSwapsByBlock(tx Tx, from, to uint64, f func(Swap) error) error {
+	return db.iterSwapsByIndex(tx, swapBlockIndex, nil, from, to, f)
+}
+
+func (db *DB) swapsByIndex(tx Tx, table string, prefix []byte, from, to uint64) ([]Swap, error) {
+	var swaps []Swap
+	if err := db.iterSwapsByIndex(tx, table, prefix, from, to, func(s Swap) error {
+		swaps = append(swaps, s)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return swaps, nil
+}
+
+func (db *DB) iterSwapsByIndex(tx Tx, table string, prefix []byte, from, to uint64, f func(Swap) error) error {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return fmt.Errorf("could not open %s cursor: %w", table, err)
+	}
+	defer c.Close()
+
+	// NOTE: failed Seek returns nil key, so the error is checked before the end of the table.
+	k, _, err := c.Seek(swapIndexKey(prefix, from, nil))
+	for ; ; k, _, err = c.Next() {
+		if err != nil {
+			return fmt.Errorf("could not iterate through %s: %w", table, err)
+		}
+		if k == nil || !bytes.HasPrefix(k, prefix) || binary.BigEndian.Uint64(k[len(prefix):]) >= to {
+			return nil
+		}
+
+		key := k[len(prefix)+8:]
+		v, err := tx.GetOne(swapStorage, key)
+		if err != nil {
+			return fmt.Errorf("could not peek swap record: %w", err)
+		}
+		if v == nil {
+			return fmt.Errorf("%s references missing swap %x", table, key)
+		}
+		s, err := decodeSwap(key, v)
+		if err != nil {
+			return err
+		}
+		if err := f(s); err != nil {
+			if err == ErrStop {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// RebuildSwapIndexes recreates the secondary indexes from swapStorage.
+func (db *DB) RebuildSwapIndexes(tx RwTx) error {
+	for _, table := range []string{swapWalletIndex, swapTokenIndex, swapBlockIndex} {
+		if err := tx.ClearBucket(table); err != nil {
+			return fmt.Errorf("unable to clear %s: %w", table, err)
+		}
+	}
+
+	return tx.ForEach(swapStorage, []byte{}, func(k, v []byte) error {
+		s, err := decodeSwap(k, v)
+		if err != nil {
+			return err
+		}
+		return indexSwap(tx, s)
+	})
+}
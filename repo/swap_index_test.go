@@ -0,0 +1,225 @@
+package repo
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/go-cmp/cmp"
+)
+
+func testSwap(i int, wallet, token common.Address, blockNumber uint64) Swap {
+	var txHash common.Hash
+	binary.BigEndian.PutUint64(txHash[24:], uint64(i))
+	return Swap{
+		TxHash:      txHash,
+		Wallet:      wallet,
+		TokenAddr:   token,
+		Path:        []common.Address{token},
+		Price:       big.NewInt(int64(i)),
+		Value:       big.NewInt(1e18),
+		BlockNumber: blockNumber,
+	}
+}
+
+var errSeek = errors.New("seek failed")
+
+// seekErrTx is Tx whose cursors fail to Seek.
+type seekErrTx struct{ Tx }
+
+func (tx seekErrTx) Cursor(table string) (Cursor, error) {
+	c, err := tx.Tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	return seekErrCursor{c}, nil
+}
+
+type seekErrCursor struct{ Cursor }
+
+func (seekErrCursor) Seek([]byte) ([]byte, []byte, error) { return nil, nil, errSeek }
+
+func TestDB_SwapIndexes(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	var (
+		wallet0 = common.BytesToAddress([]byte("wallet0"))
+		wallet1 = common.BytesToAddress([]byte("wallet1"))
+		token0  = common.BytesToAddress([]byte("token0"))
+		token1  = common.BytesToAddress([]byte("token1"))
+	)
+	swaps := []Swap{
+		testSwap(0, wallet0, token0, 10),
+		testSwap(1, wallet1, token0, 11),
+		testSwap(2, wallet0, token1, 12),
+		testSwap(3, wallet0, token0, 13),
+	}
+
+	err := db.Update(context.Background(), func(tx RwTx) error {
+		for _, s := range swaps {
+			if err := db.PutSwap(tx, s); err != nil {
+				return err
+			}
+		}
+		// NOTE: moving the swap to another block must drop it's old index entries.
+		swaps[3].BlockNumber = 14
+		if err := db.PutSwap(tx, swaps[3]); err != nil {
+			return err
+		}
+		return db.DeleteSwap(tx, swaps[1].TxHash, swaps[1].LogIndex)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	tests := []struct {
+		name  string
+		query func() ([]Swap, error)
+		want  []Swap
+	}{
+		{"wallet", func() ([]Swap, error) { return db.SwapsByWallet(tx, wallet0, 0, math.MaxUint64) }, []Swap{swaps[0], swaps[2], swaps[3]}},
+		{"wallet range", func() ([]Swap, error) { return db.SwapsByWallet(tx, wallet0, 11, 14) }, []Swap{swaps[2]}},
+		{"deleted", func() ([]Swap, error) { return db.SwapsByWallet(tx, wallet1, 0, math.MaxUint64) }, nil},
+		{"token", func() ([]Swap, error) { return db.SwapsByToken(tx, token0, 0, math.MaxUint64) }, []Swap{swaps[0], swaps[3]}},
+		{"token range", func() ([]Swap, error) { return db.SwapsByToken(tx, token0, 14, 15) }, []Swap{swaps[3]}},
+		{"block", func() ([]Swap, error) { return db.SwapsByBlock(tx, 10, 14) }, []Swap{swaps[0], swaps[2]}},
+		{"moved block", func() ([]Swap, error) { return db.SwapsByBlock(tx, 13, 14) }, nil},
+	}
+	for _, tt := range tests {
+		got, err := tt.query()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !cmp.Equal(got, tt.want, cmp.AllowUnexported(big.Int{})) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDB_RebuildSwapIndexes(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	wallet := common.BytesToAddress([]byte("wallet"))
+	s := testSwap(0, wallet, common.BytesToAddress([]byte("token")), 10)
+
+	err := db.Update(context.Background(), func(tx RwTx) error {
+		if err := db.PutSwap(tx, s); err != nil {
+			return err
+		}
+		// NOTE: simulate swaps stored before the indexes existed.
+		for _, table := range []string{swapWalletIndex, swapTokenIndex, swapBlockIndex} {
+			if err := tx.ClearBucket(table); err != nil {
+				return err
+			}
+		}
+		return db.RebuildSwapIndexes(tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	got, err := db.SwapsByWallet(tx, wallet, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, []Swap{s}, cmp.AllowUnexported(big.Int{})) {
+		t.Errorf("DB.SwapsByWallet() = %v, want %v", got, []Swap{s})
+	}
+}
+
+// benchSwapDB stores 100 swaps of each of the 100 wallets.
+func benchSwapDB(b *testing.B) (*DB, common.Address) {
+	b.Helper()
+
+	db := &DB{d: newTestDB(b)}
+
+	var wallets [100]common.Address
+	for i := range wallets {
+		wallets[i] = common.BytesToAddress([]byte{byte(i), 1})
+	}
+	err := db.Update(context.Background(), func(tx RwTx) error {
+		for i := 0; i < 100*len(wallets); i++ {
+			s := testSwap(i, wallets[i%len(wallets)], common.BytesToAddress([]byte{byte(i % 7), 2}), uint64(i))
+			if err := db.PutSwap(tx, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return db, wallets[42]
+}
+
+func BenchmarkDB_SwapsByWallet(b *testing.B) {
+	db, wallet := benchSwapDB(b)
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.SwapsByWallet(tx, wallet, 0, math.MaxUint64); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDB_AllSwapsByWallet(b *testing.B) {
+	db, wallet := benchSwapDB(b)
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		all, err := db.AllSwaps(tx)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var swaps []Swap
+		for _, s := range all {
+			if s.Wallet == wallet {
+				swaps = append(swaps, s)
+			}
+		}
+	}
+}
+
+func TestDB_SwapsByBlockSeekError(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	if err := db.View(context.Background(), func(tx Tx) error {
+		_, err := db.SwapsByBlock(seekErrTx{tx}, 0, math.MaxUint64)
+		if !errors.Is(err, errSeek) {
+			t.Errorf("DB.SwapsByBlock() error = %v, want %v", err, errSeek)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,17 +7,16 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/google/go-cmp/cmp"
-	"github.com/ledgerwatch/erigon-lib/kv"
 )
 
 func TestDB_PutSwap(t *testing.T) {
 	t.Parallel()
 
 	type fields struct {
-		d kv.RwDB
+		d Backend
 	}
 	type args struct {
-		tx kv.RwTx
+		tx RwTx
 		s  Swap
 	}
 	tests := []struct {
@@ -76,7 +75,7 @@ func TestDB_PutSwap(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			got, err := db.PeekSwap(roTx, tt.args.s.TxHash)
+			got, err := db.PeekSwap(roTx, tt.args.s.TxHash, tt.args.s.LogIndex)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -91,10 +90,10 @@ func TestDB_PutSwap(t *testing.T) {
 
 func TestDB_PeekSwap(t *testing.T) {
 	type fields struct {
-		d kv.RwDB
+		d Backend
 	}
 	type args struct {
-		tx     kv.Tx
+		tx     Tx
 		txHash common.Hash
 	}
 	tests := []struct {
@@ -166,7 +165,7 @@ func TestDB_PeekSwap(t *testing.T) {
 			}
 			defer tt.args.tx.Rollback()
 
-			got, err := db.PeekSwap(tt.args.tx, tt.args.txHash)
+			got, err := db.PeekSwap(tt.args.tx, tt.args.txHash, 0)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DB.PeekSwap() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -180,10 +179,10 @@ func TestDB_PeekSwap(t *testing.T) {
 
 // func TestDB_AllSwapsMap(t *testing.T) {
 // 	type fields struct {
-// 		d kv.RwDB
+// 		d Backend
 // 	}
 // 	type args struct {
-// 		tx kv.Tx
+// 		tx Tx
 // 	}
 // 	tests := []struct {
 // 		name    string
@@ -283,7 +282,7 @@ func TestDB_PeekSwap(t *testing.T) {
 // 	}
 // }
 
-func testDB_swap(t *testing.T) kv.RwDB {
+func testDB_swap(t *testing.T) Backend {
 	d := newTestDB(t)
 	db := &DB{
 		d: d,
@@ -385,3 +384,124 @@ func testDB_swap(t *testing.T) kv.RwDB {
 	}
 	return d
 }
+
+func TestDB_SwapsByTx(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	txHash := common.BytesToHash([]byte("tx"))
+	swaps := []Swap{
+		{TxHash: txHash, LogIndex: 3, Wallet: common.BytesToAddress([]byte("wallet")), Price: big.NewInt(1), Value: big.NewInt(1), BlockNumber: 10, Timestamp: 1640995200, TxIndex: 2},
+		{TxHash: txHash, LogIndex: 7, Wallet: common.BytesToAddress([]byte("wallet")), Price: big.NewInt(2), Value: big.NewInt(2), BlockNumber: 10, Timestamp: 1640995200, TxIndex: 2},
+		{TxHash: common.BytesToHash([]byte("other")), Price: big.NewInt(3), Value: big.NewInt(3)},
+	}
+
+	if err := db.Update(context.Background(), func(tx RwTx) error {
+		for _, s := range swaps {
+			if err := db.PutSwap(tx, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	got, err := db.SwapsByTx(tx, txHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, swaps[:2], cmp.AllowUnexported(big.Int{})) {
+		t.Errorf("DB.SwapsByTx() = %v, want %v", got, swaps[:2])
+	}
+}
+
+func TestDB_RedateSwap(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	undated := Swap{TxHash: common.BytesToHash([]byte("legacy")), Wallet: common.BytesToAddress([]byte("wallet")), Price: big.NewInt(1), Value: big.NewInt(1)}
+	dated := undated
+	dated.LogIndex, dated.BlockNumber, dated.Timestamp, dated.TxIndex = 5, 10, 1640995200, 2
+	pos := Position{TxHash: undated.TxHash, Price: big.NewInt(2), BlockNumber: 12, PeakPrice: big.NewInt(2), OpenedAt: 10}
+
+	err := db.Update(context.Background(), func(tx RwTx) error {
+		if err := db.PutSwap(tx, undated); err != nil {
+			return err
+		}
+		if err := db.PutSwap(tx, Swap{TxHash: common.BytesToHash([]byte("dated")), Price: big.NewInt(1), Value: big.NewInt(1), BlockNumber: 9}); err != nil {
+			return err
+		}
+		if err := db.PutPosition(tx, pos); err != nil {
+			return err
+		}
+
+		got, err := db.UndatedSwaps(tx)
+		if err != nil {
+			return err
+		}
+		if !cmp.Equal(got, []Swap{undated}, cmp.AllowUnexported(big.Int{})) {
+			t.Errorf("DB.UndatedSwaps() = %v, want %v", got, []Swap{undated})
+		}
+		return db.RedateSwap(tx, undated, dated)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if got, err := db.UndatedSwaps(tx); err != nil || len(got) != 0 {
+		t.Errorf("DB.UndatedSwaps() = %v, %v, want none", got, err)
+	}
+	got, err := db.SwapsByBlock(tx, 10, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, []Swap{dated}, cmp.AllowUnexported(big.Int{})) {
+		t.Errorf("DB.SwapsByBlock() = %v, want %v", got, []Swap{dated})
+	}
+	pos.LogIndex = dated.LogIndex
+	gotPos, err := db.PeekPosition(tx, dated.TxHash, dated.LogIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(gotPos, pos, cmp.AllowUnexported(big.Int{})) {
+		t.Errorf("DB.PeekPosition() = %+v, want %+v", gotPos, pos)
+	}
+}
+
+func TestDB_SwapsBackfilled(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	ctx := context.Background()
+	check := func(want bool) {
+		t.Helper()
+		if err := db.View(ctx, func(tx Tx) error {
+			got, err := db.SwapsBackfilled(tx)
+			if err != nil || got != want {
+				t.Errorf("DB.SwapsBackfilled() = %v, %v, want %v", got, err, want)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check(false)
+	if err := db.Update(ctx, func(tx RwTx) error { return db.MarkSwapsBackfilled(tx) }); err != nil {
+		t.Fatal(err)
+	}
+	check(true)
+}
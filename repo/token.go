@@ -4,20 +4,148 @@ import (
 	"bytes"
 	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/gelfand/mettu/internal/cbor"
-	"github.com/ledgerwatch/erigon-lib/kv"
 )
 
 // Token is Ethereum `token`.
 type Token struct {
 	Address     common.Address
 	Symbol      string
+	Name        string
 	Decimals    int64
 	Price       *big.Int
 	TotalBought *big.Int
 	TimesBought int
+	Safety      TokenSafety
+	Meta        TokenMeta
+}
+
+// TokenMeta is the on-chain metadata of the token and it's WETH pair.
+type TokenMeta struct {
+	// UpdatedAt is the block the metadata was refreshed at, zero if it was never fetched.
+	UpdatedAt     uint64
+	CreationBlock uint64
+	// Deployer is the sender of the contract creation transaction, zero if the token was created by another contract.
+	Deployer common.Address
+	// PairCreationBlock is the block `PairCreated` of the WETH pair was emitted at.
+	PairCreationBlock uint64
+	// Liquidity is the amount of WETH in the pair.
+	Liquidity   *big.Int
+	TotalSupply *big.Int
+	// LPLocked is the share of the pair liquidity tokens burned or held by the known lockers, 0.9 is 90%.
+	LPLocked float64
+}
+
+// Age returns the number of blocks since the token was created as of the head block.
+func (m TokenMeta) Age(head uint64) uint64 {
+	if m.CreationBlock == 0 || head < m.CreationBlock {
+		return 0
+	}
+	return head - m.CreationBlock
+}
+
+type _tokenMeta struct {
+	UpdatedAt         uint64
+	CreationBlock     uint64
+	Deployer          common.Address
+	PairCreationBlock uint64
+	Liquidity         []byte
+	TotalSupply       []byte
+	LPLocked          float64
+}
+
+func encodeTokenMeta(m TokenMeta) _tokenMeta {
+	metaVal := _tokenMeta{
+		UpdatedAt:         m.UpdatedAt,
+		CreationBlock:     m.CreationBlock,
+		Deployer:          m.Deployer,
+		PairCreationBlock: m.PairCreationBlock,
+		LPLocked:          m.LPLocked,
+	}
+	if m.Liquidity != nil {
+		metaVal.Liquidity = m.Liquidity.Bytes()
+	}
+	if m.TotalSupply != nil {
+		metaVal.TotalSupply = m.TotalSupply.Bytes()
+	}
+	return metaVal
+}
+
+func decodeTokenMeta(metaVal _tokenMeta) TokenMeta {
+	m := TokenMeta{
+		UpdatedAt:         metaVal.UpdatedAt,
+		CreationBlock:     metaVal.CreationBlock,
+		Deployer:          metaVal.Deployer,
+		PairCreationBlock: metaVal.PairCreationBlock,
+		LPLocked:          metaVal.LPLocked,
+	}
+	// NOTE: amounts are left nil until the metadata is fetched.
+	if m.UpdatedAt != 0 {
+		m.Liquidity = new(big.Int).SetBytes(metaVal.Liquidity)
+		m.TotalSupply = new(big.Int).SetBytes(metaVal.TotalSupply)
+	}
+	return m
+}
+
+// TokenFilter selects tokens by their safety and metadata, zero fields do not filter.
+// Tokens whose metadata was never fetched do not match metadata filters.
+type TokenFilter struct {
+	// MinLiquidity is the minimum amount of WETH in the pair.
+	MinLiquidity *big.Int
+	// MaxAge is the maximum number of blocks since the token creation.
+	MaxAge      uint64
+	MinLPLocked float64
+	// ExcludeUnsafe drops tokens which were found to be honeypots, restricted or heavily taxed.
+	ExcludeUnsafe bool
+}
+
+// Match reports whether the token passes the filter as of the head block.
+func (f TokenFilter) Match(t Token, head uint64) bool {
+	if f.ExcludeUnsafe && t.Safety.Unsafe() {
+		return false
+	}
+	if f.MinLiquidity == nil && f.MaxAge == 0 && f.MinLPLocked == 0 {
+		return true
+	}
+	if t.Meta.UpdatedAt == 0 {
+		return false
+	}
+
+	switch {
+	case f.MinLiquidity != nil && (t.Meta.Liquidity == nil || t.Meta.Liquidity.Cmp(f.MinLiquidity) < 0):
+		return false
+	case f.MaxAge != 0 && (t.Meta.CreationBlock == 0 || t.Meta.Age(head) > f.MaxAge):
+		return false
+	case t.Meta.LPLocked < f.MinLPLocked:
+		return false
+	}
+	return true
+}
+
+// TokenSafety is the outcome of the simulated buy and sell of the token.
+type TokenSafety struct {
+	// CheckedAt is the block the token was checked at, zero if it was never checked.
+	CheckedAt uint64
+	// BuyTax and SellTax are shares of the tokens taken on buys and sells, 0.1 is 10%.
+	BuyTax  float64
+	SellTax float64
+	// Honeypot is set if the token can not be bought or sold back.
+	Honeypot bool
+	// TransferRestricted is set if the bought tokens can not be transferred to another wallet.
+	TransferRestricted bool
+	// MaxTxLimited is set if only smaller amounts of the token can be bought or sold.
+	MaxTxLimited bool
+}
+
+// MaxTax is the highest buy or sell tax of the token considered safe.
+const MaxTax = 0.15
+
+// Unsafe reports whether the token was checked and found to be a honeypot, restricted or heavily taxed.
+func (s TokenSafety) Unsafe() bool {
+	return s.CheckedAt != 0 && (s.Honeypot || s.TransferRestricted || s.BuyTax > MaxTax || s.SellTax > MaxTax)
 }
 
 func (t Token) Denominator() *big.Int {
@@ -33,10 +161,13 @@ type _token struct {
 	TimesBought int
 	Price       []byte
 	TotalBought []byte
+	Safety      TokenSafety
+	Meta        _tokenMeta
+	Name        string
 }
 
 // PutToken puts Token object into the storage.
-func (db *DB) PutToken(tx kv.RwTx, t Token) error {
+func (db *DB) PutToken(tx RwTx, t Token) error {
 	tokenVal := _token{
 		Address:     t.Address,
 		Symbol:      t.Symbol,
@@ -44,6 +175,9 @@ func (db *DB) PutToken(tx kv.RwTx, t Token) error {
 		TimesBought: t.TimesBought,
 		Price:       big.NewInt(0).Bytes(),
 		TotalBought: t.TotalBought.Bytes(),
+		Safety:      t.Safety,
+		Meta:        encodeTokenMeta(t.Meta),
+		Name:        t.Name,
 	}
 	if t.Price != nil {
 		tokenVal.Price = t.Price.Bytes()
@@ -61,12 +195,12 @@ func (db *DB) PutToken(tx kv.RwTx, t Token) error {
 	return nil
 }
 
-func (db *DB) HasToken(tx kv.Tx, addr common.Address) (bool, error) {
+func (db *DB) HasToken(tx Tx, addr common.Address) (bool, error) {
 	return tx.Has(tokenStorage, addr.Bytes())
 }
 
 // PeekToken returns Token from the key value storage by it's Address.
-func (db *DB) PeekToken(tx kv.Tx, addr common.Address) (Token, error) {
+func (db *DB) PeekToken(tx Tx, addr common.Address) (Token, error) {
 	val, err := tx.GetOne(tokenStorage, addr.Bytes())
 	if err != nil {
 		return Token{}, fmt.Errorf("unable to get token by address=%v, err=%w", addr, err)
@@ -77,65 +211,198 @@ func (db *DB) PeekToken(tx kv.Tx, addr common.Address) (Token, error) {
 		return Token{}, fmt.Errorf("unable to decode token, err=%w", err)
 	}
 
-	t := Token{
-		Address:     tokenVal.Address,
-		Symbol:      tokenVal.Symbol,
-		Decimals:    tokenVal.Decimals,
-		TotalBought: new(big.Int).SetBytes(tokenVal.TotalBought),
-		TimesBought: tokenVal.TimesBought,
-		Price:       new(big.Int).SetBytes(tokenVal.Price),
-	}
-	return t, nil
+	return decodeToken(tokenVal), nil
 }
 
-func (db *DB) AllTokens(tx kv.Tx) ([]Token, error) {
-	var tokens []Token
-	if tokensErr := tx.ForEach(tokenStorage, []byte{}, func(_, v []byte) error {
+// IterTokens calls f for tokens ordered by address, Start of the options is the address bytes.
+func (db *DB) IterTokens(tx Tx, opts IterOptions, f func(Token) error) error {
+	return iterate(tx, tokenStorage, opts, func(_, v []byte) error {
 		var tokenVal _token
 		if err := cbor.Unmarshal(bytes.NewReader(v), &tokenVal); err != nil {
 			return fmt.Errorf("unable to decode token, err=%w", err)
 		}
+		return f(decodeToken(tokenVal))
+	})
+}
 
-		t := Token{
-			Address:     tokenVal.Address,
-			Symbol:      tokenVal.Symbol,
-			Decimals:    tokenVal.Decimals,
-			Price:       new(big.Int).SetBytes(tokenVal.Price),
-			TotalBought: new(big.Int).SetBytes(tokenVal.TotalBought),
-			TimesBought: tokenVal.TimesBought,
-		}
+func (db *DB) AllTokens(tx Tx) ([]Token, error) {
+	var tokens []Token
+	if err := db.IterTokens(tx, IterOptions{}, func(t Token) error {
 		tokens = append(tokens, t)
-
 		return nil
-	}); tokensErr != nil {
-		return nil, fmt.Errorf("unable to retrieve all tokens: err=%w", tokensErr)
+	}); err != nil {
+		return nil, fmt.Errorf("unable to retrieve all tokens: err=%w", err)
 	}
 
 	return tokens, nil
 }
 
-func (db *DB) AllTokensMap(tx kv.Tx) (map[common.Address]Token, error) {
+func (db *DB) AllTokensMap(tx Tx) (map[common.Address]Token, error) {
 	tokens := make(map[common.Address]Token)
-	if tokensErr := tx.ForEach(tokenStorage, []byte{}, func(_, v []byte) error {
-		var tokenVal _token
-		if err := cbor.Unmarshal(bytes.NewReader(v), &tokenVal); err != nil {
-			return fmt.Errorf("unable to decode token value, err=%w", err)
+	if err := db.IterTokens(tx, IterOptions{}, func(t Token) error {
+		tokens[t.Address] = t
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to retrieve all tokens: err=%w", err)
+	}
+
+	return tokens, nil
+}
+
+func decodeToken(tokenVal _token) Token {
+	return Token{
+		Address:     tokenVal.Address,
+		Symbol:      tokenVal.Symbol,
+		Name:        tokenVal.Name,
+		Decimals:    tokenVal.Decimals,
+		Price:       new(big.Int).SetBytes(tokenVal.Price),
+		TotalBought: new(big.Int).SetBytes(tokenVal.TotalBought),
+		TimesBought: tokenVal.TimesBought,
+		Safety:      tokenVal.Safety,
+		Meta:        decodeTokenMeta(tokenVal.Meta),
+	}
+}
+
+// FullToken is Token with it's amounts valued in USD.
+type FullToken struct {
+	Token          Token
+	PriceUSD       float64
+	TotalBoughtUSD float64
+	LiquidityUSD   float64
+	// Age is the number of blocks since the token creation as of the latest valuation.
+	Age uint64
+}
+
+// TokensData returns tokens selected by the options and matching the filter with their amounts valued in USD
+// at the blocks they were recorded at. The filter is called with the latest valuation block as the head,
+// Limit of the options counts matching tokens, nil filter matches every token.
+func (db *DB) TokensData(tx Tx, opts IterOptions, filter func(t Token, head uint64) bool) ([]FullToken, error) {
+	latest, _, err := db.LatestValuation(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := opts.Limit
+	opts.Limit = 0
+	var tokens []Token
+	if err := db.IterTokens(tx, opts, func(t Token) error {
+		if filter != nil && !filter(t, latest.BlockNumber) {
+			return nil
+		}
+		tokens = append(tokens, t)
+		if limit > 0 && len(tokens) == limit {
+			return ErrStop
 		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through tokens: %w", err)
+	}
 
-		t := Token{
-			Address:     tokenVal.Address,
-			Symbol:      tokenVal.Symbol,
-			TimesBought: tokenVal.TimesBought,
-			Decimals:    tokenVal.Decimals,
-			TotalBought: new(big.Int).SetBytes(tokenVal.TotalBought),
-			Price:       new(big.Int).SetBytes(tokenVal.Price),
+	// NOTE: buys of the whole page are read in a single pass over the token index, valuations are shared.
+	buys, err := db.tokenBuys(tx, tokens)
+	if err != nil {
+		return nil, err
+	}
+	vals := db.newValuer(tx)
+	fullTokens := make([]FullToken, 0, len(tokens))
+	for _, t := range tokens {
+		ft, err := fullToken(vals, t, buys[t.Address], latest.BlockNumber)
+		if err != nil {
+			return nil, err
 		}
-		tokens[tokenVal.Address] = t
+		fullTokens = append(fullTokens, ft)
+	}
+	return fullTokens, nil
+}
+
+// tokenBuys returns the amounts the tokens were bought for at the blocks of the buys, ordered by block.
+// The tokens are looked up with a single cursor over swapTokenIndex in the address order.
+func (db *DB) tokenBuys(tx Tx, tokens []Token) (map[common.Address][]amount, error) {
+	addrs := make([]common.Address, len(tokens))
+	for i, t := range tokens {
+		addrs[i] = t.Address
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i].Bytes(), addrs[j].Bytes()) < 0 })
+
+	c, err := tx.Cursor(swapTokenIndex)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s cursor: %w", swapTokenIndex, err)
+	}
+	defer c.Close()
 
+	buys := make(map[common.Address][]amount, len(addrs))
+	for _, addr := range addrs {
+		prefix := addr.Bytes()
+		// NOTE: failed Seek returns nil key, so the error is checked before the end of the token.
+		k, _, err := c.Seek(prefix)
+		for ; ; k, _, err = c.Next() {
+			if err != nil {
+				return nil, fmt.Errorf("could not iterate through %s: %w", swapTokenIndex, err)
+			}
+			if k == nil || !bytes.HasPrefix(k, prefix) {
+				break
+			}
+
+			key := k[len(prefix)+8:]
+			v, err := tx.GetOne(swapStorage, key)
+			if err != nil {
+				return nil, fmt.Errorf("could not peek swap record: %w", err)
+			}
+			if v == nil {
+				return nil, fmt.Errorf("%s references missing swap %x", swapTokenIndex, key)
+			}
+			s, err := decodeSwap(key, v)
+			if err != nil {
+				return nil, err
+			}
+			buys[addr] = append(buys[addr], amount{s.Value, s.BlockNumber})
+		}
+	}
+	return buys, nil
+}
+
+// fullToken values the token amounts: the price at the first buy it was recorded at, the total bought
+// at the blocks of the buys and the liquidity at the block of the metadata refresh.
+func fullToken(vals *valuer, t Token, buys []amount, head uint64) (FullToken, error) {
+	var firstBuy uint64
+	if len(buys) > 0 {
+		firstBuy = buys[0].block
+	}
+
+	ft := FullToken{Token: t, Age: t.Meta.Age(head)}
+	var err error
+	if ft.PriceUSD, err = vals.USD(t.Price, firstBuy); err != nil {
+		return FullToken{}, err
+	}
+	if ft.TotalBoughtUSD, err = vals.totalUSD(t.TotalBought, buys); err != nil {
+		return FullToken{}, err
+	}
+	if ft.LiquidityUSD, err = vals.USD(t.Meta.Liquidity, t.Meta.UpdatedAt); err != nil {
+		return FullToken{}, err
+	}
+	return ft, nil
+}
+
+// AllTokensData returns all tokens with their amounts valued in USD at the blocks they were recorded at.
+func (db *DB) AllTokensData(tx Tx) ([]FullToken, error) {
+	return db.TokensData(tx, IterOptions{}, nil)
+}
+
+// StaleTokens returns up to limit tokens whose metadata was refreshed before the given block, least recently refreshed first.
+func (db *DB) StaleTokens(tx Tx, before uint64, limit int) ([]Token, error) {
+	var stale []Token
+	if err := db.IterTokens(tx, IterOptions{}, func(t Token) error {
+		if t.Meta.UpdatedAt < before {
+			stale = append(stale, t)
+		}
 		return nil
-	}); tokensErr != nil {
-		return nil, fmt.Errorf("unable to retrieve all tokens: err=%w", tokensErr)
+	}); err != nil {
+		return nil, fmt.Errorf("unable to iterate through tokens: %w", err)
 	}
 
-	return tokens, nil
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Meta.UpdatedAt < stale[j].Meta.UpdatedAt })
+	if limit > 0 && len(stale) > limit {
+		stale = stale[:limit]
+	}
+	return stale, nil
 }
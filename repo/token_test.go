@@ -7,7 +7,6 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/google/go-cmp/cmp"
-	"github.com/ledgerwatch/erigon-lib/kv"
 )
 
 func testDB_PutToken(t *testing.T, db *DB, token Token, wantErr bool) {
@@ -33,10 +32,10 @@ func TestDB_PutPeekToken(t *testing.T) {
 	hugeNumber := new(big.Int).Mul(bigNumber, big.NewInt(128))
 
 	type fields struct {
-		d kv.RwDB
+		d Backend
 	}
 	type args struct {
-		tx   kv.Tx
+		tx   Tx
 		addr common.Address
 	}
 	tests := []struct {
@@ -55,6 +54,7 @@ func TestDB_PutPeekToken(t *testing.T) {
 			want: Token{
 				Address:     common.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"),
 				Symbol:      "WETH",
+				Name:        "Wrapped Ether",
 				Decimals:    18,
 				Price:       hugeNumber,
 				TotalBought: hugeNumber,
@@ -94,3 +94,73 @@ func TestDB_PutPeekToken(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenFilter_Match(t *testing.T) {
+	t.Parallel()
+
+	fresh := Token{Meta: TokenMeta{UpdatedAt: 1000, CreationBlock: 900, Liquidity: big.NewInt(50), LPLocked: 0.95}}
+	honeypot := fresh
+	honeypot.Safety = TokenSafety{CheckedAt: 1000, Honeypot: true}
+
+	tests := []struct {
+		name   string
+		filter TokenFilter
+		token  Token
+		want   bool
+	}{
+		{"no filter", TokenFilter{}, Token{}, true},
+		{"never fetched", TokenFilter{MaxAge: 500}, Token{}, false},
+		{"young", TokenFilter{MaxAge: 500}, fresh, true},
+		{"old", TokenFilter{MaxAge: 50}, fresh, false},
+		{"liquid", TokenFilter{MinLiquidity: big.NewInt(50)}, fresh, true},
+		{"illiquid", TokenFilter{MinLiquidity: big.NewInt(51)}, fresh, false},
+		{"locked", TokenFilter{MinLPLocked: 0.9}, fresh, true},
+		{"unlocked", TokenFilter{MinLPLocked: 0.99}, fresh, false},
+		{"unsafe", TokenFilter{ExcludeUnsafe: true}, honeypot, false},
+		{"unsafe allowed", TokenFilter{MaxAge: 500}, honeypot, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.filter.Match(tt.token, 1000); got != tt.want {
+				t.Errorf("TokenFilter.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_StaleTokens(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	tokens := []Token{
+		{Address: common.BytesToAddress([]byte("token0")), TotalBought: new(big.Int), Meta: TokenMeta{UpdatedAt: 500, Liquidity: big.NewInt(1), TotalSupply: big.NewInt(1e18)}},
+		{Address: common.BytesToAddress([]byte("token1")), TotalBought: new(big.Int)},
+		{Address: common.BytesToAddress([]byte("token2")), TotalBought: new(big.Int), Meta: TokenMeta{UpdatedAt: 900}},
+	}
+	for _, token := range tokens {
+		testDB_PutToken(t, db, token, false)
+	}
+
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	got, err := db.StaleTokens(tx, 600, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Address != tokens[1].Address || got[1].Address != tokens[0].Address {
+		t.Fatalf("DB.StaleTokens() = %+v", got)
+	}
+	if !cmp.Equal(got[1].Meta, tokens[0].Meta, cmp.AllowUnexported(big.Int{})) {
+		t.Errorf("DB.StaleTokens() meta = %+v, want %+v", got[1].Meta, tokens[0].Meta)
+	}
+
+	if got, _ = db.StaleTokens(tx, 1000, 1); len(got) != 1 {
+		t.Errorf("DB.StaleTokens() returned %d tokens, want %d", len(got), 1)
+	}
+}
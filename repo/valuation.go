@@ -0,0 +1,189 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/gelfand/mettu/internal/cbor"
+	"github.com/gelfand/mettu/lib"
+)
+
+// Valuation is ETH/USD price as of BlockNumber, it converts wei amounts into USD.
+type Valuation struct {
+	BlockNumber uint64
+	EthUSD      *big.Rat
+}
+
+// USD converts wei amount into USD, zero Valuation converts everything to zero.
+func (v Valuation) USD(wei *big.Int) float64 {
+	usd, _ := lib.WeiToUSD(wei, v.EthUSD).Float64()
+	return usd
+}
+
+type _valuation struct {
+	EthUSDNum   []byte
+	EthUSDDenom []byte
+}
+
+func valuationKey(blockNumber uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, blockNumber)
+	return key
+}
+
+// PutValuation puts ETH/USD price at the block into the valuationStorage.
+func (db *DB) PutValuation(tx RwTx, v Valuation) error {
+	val := _valuation{
+		EthUSDNum:   v.EthUSD.Num().Bytes(),
+		EthUSDDenom: v.EthUSD.Denom().Bytes(),
+	}
+
+	var buf bytes.Buffer
+	if err := cbor.Marshal(&buf, val); err != nil {
+		return fmt.Errorf("unable to encode valuation: %w", err)
+	}
+
+	if err := tx.Put(valuationStorage, valuationKey(v.BlockNumber), buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to put valuation at block %d: %w", v.BlockNumber, err)
+	}
+	return nil
+}
+
+// ValuationAt returns the most recent ETH/USD price recorded at or before the given block,
+// ok is false if there is no such record.
+func (db *DB) ValuationAt(tx Tx, blockNumber uint64) (v Valuation, ok bool, err error) {
+	k, val, err := seekAtOrBefore(tx, valuationStorage, valuationKey(blockNumber))
+	if err != nil {
+		return Valuation{}, false, fmt.Errorf("unable to seek valuation: %w", err)
+	}
+	if k == nil {
+		return Valuation{}, false, nil
+	}
+
+	v, err = decodeValuation(k, val)
+	return v, err == nil, err
+}
+
+// FirstValuation returns the earliest ETH/USD price, ok is false if no price was recorded.
+func (db *DB) FirstValuation(tx Tx) (v Valuation, ok bool, err error) {
+	c, err := tx.Cursor(valuationStorage)
+	if err != nil {
+		return Valuation{}, false, fmt.Errorf("unable to open valuation cursor: %w", err)
+	}
+	defer c.Close()
+
+	k, val, err := c.First()
+	if err != nil {
+		return Valuation{}, false, fmt.Errorf("unable to seek valuation: %w", err)
+	}
+	if k == nil {
+		return Valuation{}, false, nil
+	}
+	v, err = decodeValuation(k, val)
+	return v, err == nil, err
+}
+
+func decodeValuation(k, v []byte) (Valuation, error) {
+	var valuationVal _valuation
+	if err := cbor.Unmarshal(bytes.NewReader(v), &valuationVal); err != nil {
+		return Valuation{}, fmt.Errorf("unable to decode valuation: %w", err)
+	}
+
+	return Valuation{
+		BlockNumber: binary.BigEndian.Uint64(k),
+		EthUSD: new(big.Rat).SetFrac(
+			new(big.Int).SetBytes(valuationVal.EthUSDNum),
+			new(big.Int).SetBytes(valuationVal.EthUSDDenom),
+		),
+	}, nil
+}
+
+// LatestValuation returns the most recent ETH/USD price.
+func (db *DB) LatestValuation(tx Tx) (Valuation, bool, error) {
+	return db.ValuationAt(tx, ^uint64(0))
+}
+
+// amount is the wei amount moved at the block, zero block means it's unknown.
+type amount struct {
+	wei   *big.Int
+	block uint64
+}
+
+func fundingAmounts(fundings []Funding) []amount {
+	amounts := make([]amount, len(fundings))
+	for i, f := range fundings {
+		amounts[i] = amount{f.Value, f.BlockNumber}
+	}
+	return amounts
+}
+
+func swapAmounts(swaps []Swap) []amount {
+	amounts := make([]amount, len(swaps))
+	for i, s := range swaps {
+		amounts[i] = amount{s.Value, s.BlockNumber}
+	}
+	return amounts
+}
+
+// valuer values amounts in USD at the blocks they were moved at, so that USD amounts are comparable
+// across months. Amounts moved before the first valuation or at unknown blocks are valued at the first
+// valuation, the closest one to them. Valuations are looked up once per block.
+type valuer struct {
+	db     *DB
+	tx     Tx
+	blocks map[uint64]Valuation
+}
+
+func (db *DB) newValuer(tx Tx) *valuer {
+	return &valuer{db: db, tx: tx, blocks: make(map[uint64]Valuation)}
+}
+
+// at returns the ETH/USD price as of the block.
+func (v *valuer) at(blockNumber uint64) (Valuation, error) {
+	if val, ok := v.blocks[blockNumber]; ok {
+		return val, nil
+	}
+	val, ok, err := v.db.ValuationAt(v.tx, blockNumber)
+	if err == nil && !ok {
+		val, _, err = v.db.FirstValuation(v.tx)
+	}
+	if err != nil {
+		return Valuation{}, err
+	}
+	v.blocks[blockNumber] = val
+	return val, nil
+}
+
+// USD converts wei amount moved at the block into USD.
+func (v *valuer) USD(wei *big.Int, blockNumber uint64) (float64, error) {
+	if wei == nil {
+		return 0, nil
+	}
+	val, err := v.at(blockNumber)
+	if err != nil {
+		return 0, err
+	}
+	return val.USD(wei), nil
+}
+
+// totalUSD values the total of the amounts in USD, each amount at it's block. The part of the total
+// the amounts do not cover was moved before the records were kept, it's valued at the first valuation.
+func (v *valuer) totalUSD(total *big.Int, amounts []amount) (float64, error) {
+	var usd float64
+	covered := new(big.Int)
+	for _, a := range amounts {
+		u, err := v.USD(a.wei, a.block)
+		if err != nil {
+			return 0, err
+		}
+		usd += u
+		covered.Add(covered, a.wei)
+	}
+	if total == nil || total.Cmp(covered) <= 0 {
+		return usd, nil
+	}
+	rest, err := v.USD(new(big.Int).Sub(total, covered), 0)
+	return usd + rest, err
+}
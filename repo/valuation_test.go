@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestDB_ValueAtBlocks(t *testing.T) {
+	t.Parallel()
+
+	db := &DB{d: newTestDB(t)}
+	var (
+		wallet = common.BytesToAddress([]byte("wallet"))
+		token  = common.BytesToAddress([]byte("token"))
+		other  = common.BytesToAddress([]byte("other"))
+	)
+	swap := Swap{
+		TxHash: common.HexToHash("0x5a"), Wallet: wallet, TokenAddr: token, Path: []common.Address{{}, token},
+		Price: big.NewInt(1e15), Value: big.NewInt(1e18), BlockNumber: 20,
+	}
+	err := db.Update(context.Background(), func(tx RwTx) error {
+		for _, err := range []error{
+			db.PutValuation(tx, Valuation{BlockNumber: 10, EthUSD: big.NewRat(1000, 1)}),
+			db.PutValuation(tx, Valuation{BlockNumber: 20, EthUSD: big.NewRat(2000, 1)}),
+			db.PutFunding(tx, Funding{TxHash: common.HexToHash("0xf1"), Exchange: "Binance", Wallet: wallet, Value: big.NewInt(1e18), BlockNumber: 10}),
+			db.PutFunding(tx, Funding{TxHash: common.HexToHash("0xf2"), Exchange: "Binance", Wallet: wallet, Value: big.NewInt(1e18), BlockNumber: 25}),
+			// NOTE: 1 ETH was received before the fundings were recorded, it's valued at the first valuation.
+			db.PutAccount(tx, Account{Address: wallet, Exchange: "Binance", Balance: big.NewInt(0), Received: big.NewInt(3e18), Spent: big.NewInt(1e18)}),
+			db.PutToken(tx, Token{Address: token, Symbol: "TKN", Decimals: 18, Price: big.NewInt(1e15), TotalBought: big.NewInt(1e18), TimesBought: 1}),
+			db.PutPattern(tx, Pattern{TokenAddr: token, ExchangeName: "Binance", Value: big.NewInt(1e18), TimesOccured: 1}),
+			db.PutSwap(tx, swap),
+			db.PutToken(tx, Token{Address: other, Symbol: "OTH", Decimals: 18, Price: big.NewInt(1e15), TotalBought: big.NewInt(1e18), TimesBought: 1}),
+			db.PutSwap(tx, Swap{
+				TxHash: common.HexToHash("0x5b"), Wallet: common.BytesToAddress([]byte("wallet2")), TokenAddr: other, Path: []common.Address{{}, other},
+				Price: big.NewInt(1e15), Value: big.NewInt(1e18), BlockNumber: 10,
+			}),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.View(context.Background(), func(tx Tx) error {
+		accounts, err := db.AllAccountsData(tx)
+		if err != nil {
+			return err
+		}
+		if len(accounts) != 1 || accounts[0].ReceivedUSD != 4000 || accounts[0].SpentUSD != 2000 {
+			t.Errorf("DB.AllAccountsData() = %+v, want 4000 received and 2000 spent", accounts)
+		}
+
+		tokens, err := db.AllTokensData(tx)
+		if err != nil {
+			return err
+		}
+		// NOTE: tokens are ordered by address, the buys of every token are valued at their own blocks.
+		if len(tokens) != 2 || tokens[0].PriceUSD != 1 || tokens[0].TotalBoughtUSD != 1000 ||
+			tokens[1].PriceUSD != 2 || tokens[1].TotalBoughtUSD != 2000 {
+			t.Errorf("DB.AllTokensData() = %+v, want price 1 and 1000 bought, price 2 and 2000 bought", tokens)
+		}
+
+		patterns, err := db.AllPatternsData(tx)
+		if err != nil {
+			return err
+		}
+		if len(patterns) != 1 || patterns[0].ValueUSD != 2000 {
+			t.Errorf("DB.AllPatternsData() = %+v, want 2000 value", patterns)
+		}
+
+		swaps, err := db.SwapsData(tx, []Swap{swap})
+		if err != nil {
+			return err
+		}
+		if swaps[0].PriceUSD != 2 || swaps[0].ValueUSD != 2000 {
+			t.Errorf("DB.SwapsData() = %+v, want price 2 and value 2000", swaps)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,167 @@
+// Package safety detects honeypots and taxed tokens by simulating a buy followed by a sell through the router.
+package safety
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+	"github.com/gelfand/mettu/repo"
+)
+
+// Caller executes eth_call, the checker code must be deployed at CheckerAddress.
+type Caller interface {
+	CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// OverrideCaller executes eth_call with state overrides.
+type OverrideCaller interface {
+	CallContractOverride(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int, overrides map[common.Address]gethclient.OverrideAccount) ([]byte, error)
+}
+
+type checkerCaller struct {
+	c OverrideCaller
+}
+
+// WithChecker returns Caller which places the checker code at CheckerAddress with the state override.
+func WithChecker(c OverrideCaller) Caller {
+	return checkerCaller{c}
+}
+
+func (c checkerCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return c.c.CallContractOverride(ctx, call, blockNumber, map[common.Address]gethclient.OverrideAccount{
+		CheckerAddress: {Code: CheckerCode()},
+		call.From:      {Balance: new(big.Int).Mul(call.Value, big.NewInt(2))},
+	})
+}
+
+// DefaultAmount is the amount of wei spent on the simulated buy.
+var DefaultAmount = big.NewInt(1e17)
+
+// maxRetries is the number of times the amount is divided by 10 when the buy or the sell fails.
+const maxRetries = 2
+
+// Analyzer checks whether the token bought through the router can be sold back.
+type Analyzer struct {
+	Caller Caller
+	WETH   common.Address
+	// Amount is the amount of wei spent on the simulated buy, DefaultAmount is used if it's nil.
+	Amount *big.Int
+}
+
+// Check simulates a buy and a sell of the token through the router at the given block,
+// pair is the WETH pair of the token the router swaps through.
+func (a *Analyzer) Check(ctx context.Context, router, pair, token common.Address, blockNumber uint64) (repo.TokenSafety, error) {
+	amount := a.Amount
+	if amount == nil {
+		amount = DefaultAmount
+	}
+	block := new(big.Int).SetUint64(blockNumber)
+
+	s := repo.TokenSafety{CheckedAt: blockNumber}
+
+	// Smaller buys succeeding after the failed one mean the buy amount is limited.
+	var (
+		res checkResult
+		err error
+	)
+	for i := 0; i <= maxRetries; i++ {
+		if res, err = a.simulate(ctx, router, pair, token, amount, 1, block); err != nil {
+			return repo.TokenSafety{}, err
+		}
+		if res.buyOK {
+			s.MaxTxLimited = i > 0
+			break
+		}
+		amount = new(big.Int).Div(amount, big.NewInt(10))
+	}
+	if !res.buyOK {
+		s.Honeypot = true
+		return s, nil
+	}
+	s.BuyTax = tax(res.bought, res.expectedBought)
+	s.TransferRestricted = !res.transferOK
+
+	// The same goes for sells of the part of bought tokens.
+	divisor := int64(1)
+	for i := 0; !res.sellOK && i < maxRetries; i++ {
+		divisor *= 10
+		if res, err = a.simulate(ctx, router, pair, token, amount, divisor, block); err != nil {
+			return repo.TokenSafety{}, err
+		}
+		s.MaxTxLimited = s.MaxTxLimited || res.sellOK
+	}
+	if !res.sellOK {
+		s.Honeypot = true
+		return s, nil
+	}
+
+	sold := new(big.Int).Div(res.bought, big.NewInt(divisor))
+	sold.Sub(sold, new(big.Int).Div(sold, big.NewInt(100)))
+	s.SellTax = tax(res.received, sold)
+	return s, nil
+}
+
+// checkResult is the decoded result of the checker call, see CheckerCode.
+type checkResult struct {
+	buyOK          bool
+	expectedBought *big.Int
+	bought         *big.Int
+	transferOK     bool
+	approveOK      bool
+	received       *big.Int
+	sellOK         bool
+	ethOut         *big.Int
+	expectedETHOut *big.Int
+}
+
+func (a *Analyzer) simulate(ctx context.Context, router, pair, token common.Address, amount *big.Int, divisor int64, block *big.Int) (checkResult, error) {
+	data := make([]byte, 0, 5*32)
+	data = append(data, common.LeftPadBytes(pair.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(a.WETH.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(token.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(divisor).Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(router.Bytes(), 32)...)
+
+	out, err := a.Caller.CallContract(ctx, ethereum.CallMsg{
+		From:  callerAddress,
+		To:    &CheckerAddress,
+		Value: amount,
+		Data:  data,
+	}, block)
+	if err != nil {
+		return checkResult{}, fmt.Errorf("could not simulate swaps of %v: %w", token, err)
+	}
+	if len(out) != 32*resultWords {
+		return checkResult{}, errors.New("unexpected checker result length, is the checker deployed?")
+	}
+
+	word := func(i int) *big.Int { return new(big.Int).SetBytes(out[32*i : 32*(i+1)]) }
+	return checkResult{
+		buyOK:          word(resBuyOK).Sign() != 0,
+		expectedBought: word(resExpectedBought),
+		bought:         word(resBought),
+		transferOK:     word(resTransferOK).Sign() != 0,
+		approveOK:      word(resApproveOK).Sign() != 0,
+		received:       word(resReceived),
+		sellOK:         word(resSellOK).Sign() != 0,
+		ethOut:         word(resETHOut),
+		expectedETHOut: word(resExpectedETHOut),
+	}, nil
+}
+
+// tax returns 1 - got/want.
+func tax(got, want *big.Int) float64 {
+	if want.Sign() == 0 {
+		return 0
+	}
+	r, _ := new(big.Rat).SetFrac(got, want).Float64()
+	if r > 1 {
+		return 0
+	}
+	return 1 - r
+}
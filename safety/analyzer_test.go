@@ -0,0 +1,280 @@
+package safety
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gelfand/mettu/repo"
+	"github.com/gelfand/mettu/uniswap/pair"
+	"github.com/gelfand/mettu/uniswap/router"
+)
+
+// tokenOpts configure behaviour of the mock token.
+type tokenOpts struct {
+	// taxBps is the share of every transfer burned, in basis points, the owner does not pay it.
+	taxBps uint64
+	// maxTx limits the amount of a single transfer, zero means no limit.
+	maxTx *big.Int
+	// blockSells reverts transfers to the pair.
+	blockSells bool
+	// blockTransfers reverts transfers between wallets.
+	blockTransfers bool
+}
+
+// Selectors implemented by the mock token only.
+const (
+	selDeposit      = 0xd0e30db0 // deposit()
+	selWithdraw     = 0x2e1a7d4d // withdraw(uint256)
+	selTransferFrom = 0x23b872dd // transferFrom(address,address,uint256)
+)
+
+// mockToken returns runtime code of ERC20 token which keeps balances in the storage slots of the holder
+// addresses, approvals are not tracked. It also implements WETH `deposit()` and `withdraw(uint256)`.
+func mockToken(owner, pairAddr common.Address, opts tokenOpts) []byte {
+	var (
+		caller  = opExpr(vm.CALLER)
+		isOwner = eq(caller, constant(new(big.Int).SetBytes(owner.Bytes())))
+		pairArg = constant(new(big.Int).SetBytes(pairAddr.Bytes()))
+		sel     = binary(vm.SHR, uintConst(224), calldata(0))
+	)
+
+	p := newProgram()
+	p.jumpi("balanceOf", eq(sel, uintConst(selBalanceOf)))
+	p.jumpi("transfer", eq(sel, uintConst(selTransfer)))
+	p.jumpi("transferFrom", eq(sel, uintConst(selTransferFrom)))
+	p.jumpi("approve", eq(sel, uintConst(selApprove)))
+	p.jumpi("deposit", eq(sel, uintConst(selDeposit)))
+	p.jumpi("withdraw", eq(sel, uintConst(selWithdraw)))
+	p.jump("revert")
+
+	p.label("balanceOf")
+	p.mstore(0, sload(calldata(4)))
+	p.ret(0, 32)
+
+	p.label("deposit")
+	p.sstore(caller, add(sload(caller), opExpr(vm.CALLVALUE)))
+	p.op(vm.STOP)
+
+	p.label("withdraw")
+	p.jumpi("revert", lt(sload(caller), calldata(4)))
+	p.sstore(caller, sub(sload(caller), calldata(4)))
+	p.pushUint(0)
+	p.pushUint(0)
+	p.pushUint(0)
+	p.pushUint(0)
+	calldata(4)(p)
+	caller(p)
+	p.op(vm.GAS, vm.CALL, vm.ISZERO)
+	p.pushLabel("revert")
+	p.op(vm.JUMPI)
+	p.op(vm.STOP)
+
+	p.label("approve")
+	p.mstore(0, uintConst(1))
+	p.ret(0, 32)
+
+	move := func(from, to, amount expr) {
+		if opts.blockSells {
+			p.jumpi("revert", and(eq(to, pairArg), iszero(isOwner)))
+		}
+		if opts.blockTransfers {
+			p.jumpi("revert", and(iszero(eq(to, pairArg)), and(iszero(eq(from, pairArg)), iszero(isOwner))))
+		}
+		if opts.maxTx != nil {
+			p.jumpi("revert", and(gt(amount, constant(opts.maxTx)), iszero(isOwner)))
+		}
+		p.jumpi("revert", lt(sload(from), amount))
+		p.sstore(from, sub(sload(from), amount))
+		fee := mul(iszero(isOwner), div(mul(amount, uintConst(opts.taxBps)), uintConst(10000)))
+		p.sstore(to, add(sload(to), sub(amount, fee)))
+		p.mstore(0, uintConst(1))
+		p.ret(0, 32)
+	}
+
+	p.label("transfer")
+	move(caller, calldata(4), calldata(36))
+
+	p.label("transferFrom")
+	move(calldata(4), calldata(36), calldata(68))
+
+	p.label("revert")
+	p.revert()
+	return p.bytes()
+}
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+// pairInitCodeHash is the init code hash of Uniswap V2 pairs the router derives pair addresses with.
+var pairInitCodeHash = common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f")
+
+var (
+	pairCodeOnce sync.Once
+	pairCode     []byte
+	pairCodeErr  error
+)
+
+// pairRuntimeCode returns runtime code of the Uniswap V2 pair, it's deployed once to a throwaway chain.
+func pairRuntimeCode(t *testing.T) []byte {
+	t.Helper()
+
+	pairCodeOnce.Do(func() {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			pairCodeErr = err
+			return
+		}
+		owner := crypto.PubkeyToAddress(key.PublicKey)
+		sim := backends.NewSimulatedBackend(core.GenesisAlloc{owner: {Balance: ether(1)}}, 30_000_000)
+		defer sim.Close()
+
+		auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+		if err != nil {
+			pairCodeErr = err
+			return
+		}
+		addr, _, _, err := pair.DeployPair(auth, sim)
+		if err != nil {
+			pairCodeErr = err
+			return
+		}
+		sim.Commit()
+		pairCode, pairCodeErr = sim.CodeAt(context.Background(), addr, nil)
+	})
+	if pairCodeErr != nil {
+		t.Fatal(pairCodeErr)
+	}
+	return pairCode
+}
+
+// newTestChain deploys the router and the pair of WETH and the mock token with 100 ETH and 1M tokens of liquidity.
+// The pair is placed at the address the router derives for the factory.
+func newTestChain(t *testing.T, opts tokenOpts) (*backends.SimulatedBackend, *Analyzer, common.Address, common.Address, common.Address) {
+	t.Helper()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	factory := common.BytesToAddress([]byte("factory"))
+	weth := common.BytesToAddress([]byte("weth"))
+	token := common.BytesToAddress([]byte("token"))
+
+	token0, token1 := weth, token
+	if token1.Hash().Big().Cmp(token0.Hash().Big()) < 0 {
+		token0, token1 = token1, token0
+	}
+	salt := crypto.Keccak256Hash(token0.Bytes(), token1.Bytes())
+	pairAddr := crypto.CreateAddress2(factory, salt, pairInitCodeHash.Bytes())
+
+	balances := func(amount *big.Int) map[common.Hash]common.Hash {
+		return map[common.Hash]common.Hash{
+			common.BytesToHash(pairAddr.Bytes()): common.BigToHash(amount),
+		}
+	}
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{
+		owner:          {Balance: ether(1000)},
+		weth:           {Code: mockToken(owner, pairAddr, tokenOpts{}), Storage: balances(ether(100)), Balance: ether(100)},
+		token:          {Code: mockToken(owner, pairAddr, opts), Storage: balances(ether(1_000_000)), Balance: new(big.Int)},
+		CheckerAddress: {Code: CheckerCode(), Balance: new(big.Int)},
+		// NOTE: slots of UniswapV2Pair: 5 factory, 6 token0, 7 token1, 12 unlocked.
+		pairAddr: {
+			Code: pairRuntimeCode(t),
+			Storage: map[common.Hash]common.Hash{
+				common.BigToHash(big.NewInt(5)):  common.BytesToHash(factory.Bytes()),
+				common.BigToHash(big.NewInt(6)):  common.BytesToHash(token0.Bytes()),
+				common.BigToHash(big.NewInt(7)):  common.BytesToHash(token1.Bytes()),
+				common.BigToHash(big.NewInt(12)): common.BigToHash(big.NewInt(1)),
+			},
+			Balance: new(big.Int),
+		},
+	}, 30_000_000)
+	t.Cleanup(func() { sim.Close() })
+
+	auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	routerAddr, _, _, err := router.DeployRouter(auth, sim, factory, weth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := pair.NewPair(pairAddr, sim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Sync(auth); err != nil {
+		t.Fatal(err)
+	}
+	sim.Commit()
+
+	return sim, &Analyzer{Caller: sim, WETH: weth, Amount: ether(1)}, routerAddr, pairAddr, token
+}
+
+func TestAnalyzer_Check(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		opts tokenOpts
+		want repo.TokenSafety
+	}{
+		{
+			name: "safe",
+			want: repo.TokenSafety{},
+		},
+		{
+			name: "taxed",
+			opts: tokenOpts{taxBps: 1000},
+			want: repo.TokenSafety{BuyTax: 0.1, SellTax: 0.1},
+		},
+		{
+			name: "honeypot",
+			opts: tokenOpts{blockSells: true},
+			want: repo.TokenSafety{Honeypot: true},
+		},
+		{
+			name: "restricted",
+			opts: tokenOpts{blockTransfers: true},
+			want: repo.TokenSafety{TransferRestricted: true},
+		},
+		{
+			name: "max tx",
+			opts: tokenOpts{maxTx: ether(1000)},
+			want: repo.TokenSafety{MaxTxLimited: true},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sim, a, routerAddr, pairAddr, token := newTestChain(t, tt.opts)
+			head := sim.Blockchain().CurrentBlock().NumberU64()
+			got, err := a.Check(context.Background(), routerAddr, pairAddr, token, head)
+			if err != nil {
+				t.Fatalf("Analyzer.Check() error = %v", err)
+			}
+
+			tt.want.CheckedAt = head
+			if math.Abs(got.BuyTax-tt.want.BuyTax) > 1e-6 || math.Abs(got.SellTax-tt.want.SellTax) > 1e-6 {
+				t.Errorf("Analyzer.Check() taxes = %v, %v, want %v, %v", got.BuyTax, got.SellTax, tt.want.BuyTax, tt.want.SellTax)
+			}
+			got.BuyTax, got.SellTax, tt.want.BuyTax, tt.want.SellTax = 0, 0, 0, 0
+			if got != tt.want {
+				t.Errorf("Analyzer.Check() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
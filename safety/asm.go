@@ -0,0 +1,202 @@
+package safety
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// program assembles EVM bytecode, jump targets are resolved when the code is built.
+type program struct {
+	code   []byte
+	labels map[string]int
+	// fixups are offsets of PUSH2 immediates which must be replaced by the label offset.
+	fixups map[int]string
+}
+
+func newProgram() *program {
+	return &program{labels: make(map[string]int), fixups: make(map[int]string)}
+}
+
+func (p *program) op(ops ...vm.OpCode) {
+	for _, op := range ops {
+		p.code = append(p.code, byte(op))
+	}
+}
+
+// push pushes the smallest PUSH of v.
+func (p *program) push(v *big.Int) {
+	b := v.Bytes()
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	if len(b) > 32 {
+		panic(fmt.Sprintf("push of %d bytes", len(b)))
+	}
+	p.code = append(p.code, byte(vm.PUSH1)+byte(len(b)-1))
+	p.code = append(p.code, b...)
+}
+
+func (p *program) pushUint(v uint64) {
+	p.push(new(big.Int).SetUint64(v))
+}
+
+// label marks the jump destination.
+func (p *program) label(name string) {
+	if _, ok := p.labels[name]; ok {
+		panic("duplicate label " + name)
+	}
+	p.labels[name] = len(p.code)
+	p.op(vm.JUMPDEST)
+}
+
+// pushLabel pushes offset of the label.
+func (p *program) pushLabel(name string) {
+	p.op(vm.PUSH2)
+	p.fixups[len(p.code)] = name
+	p.code = append(p.code, 0, 0)
+}
+
+// jumpi jumps to the label if cond is not zero.
+func (p *program) jumpi(name string, cond expr) {
+	cond(p)
+	p.pushLabel(name)
+	p.op(vm.JUMPI)
+}
+
+func (p *program) jump(name string) {
+	p.pushLabel(name)
+	p.op(vm.JUMP)
+}
+
+// mstore stores the value at the memory offset.
+func (p *program) mstore(offset uint64, v expr) {
+	v(p)
+	p.pushUint(offset)
+	p.op(vm.MSTORE)
+}
+
+func (p *program) sstore(key, v expr) {
+	v(p)
+	key(p)
+	p.op(vm.SSTORE)
+}
+
+// ret returns size bytes of memory at offset.
+func (p *program) ret(offset, size uint64) {
+	p.pushUint(size)
+	p.pushUint(offset)
+	p.op(vm.RETURN)
+}
+
+func (p *program) revert() {
+	p.pushUint(0)
+	p.pushUint(0)
+	p.op(vm.REVERT)
+}
+
+func (p *program) bytes() []byte {
+	code := append([]byte(nil), p.code...)
+	for offset, name := range p.fixups {
+		target, ok := p.labels[name]
+		if !ok {
+			panic("unknown label " + name)
+		}
+		code[offset], code[offset+1] = byte(target>>8), byte(target)
+	}
+	return code
+}
+
+// expr emits code which pushes a single value on the stack.
+type expr func(p *program)
+
+func constant(v *big.Int) expr {
+	return func(p *program) { p.push(v) }
+}
+
+func uintConst(v uint64) expr {
+	return func(p *program) { p.pushUint(v) }
+}
+
+// opExpr is an expression of the opcode without arguments, e.g. CALLER.
+func opExpr(op vm.OpCode) expr {
+	return func(p *program) { p.op(op) }
+}
+
+// mload loads the word at the memory offset.
+func mload(offset uint64) expr {
+	return func(p *program) {
+		p.pushUint(offset)
+		p.op(vm.MLOAD)
+	}
+}
+
+func sload(key expr) expr {
+	return func(p *program) {
+		key(p)
+		p.op(vm.SLOAD)
+	}
+}
+
+// calldata loads the word of the call data at the offset.
+func calldata(offset uint64) expr {
+	return func(p *program) {
+		p.pushUint(offset)
+		p.op(vm.CALLDATALOAD)
+	}
+}
+
+// binary emits op(x, y) where x is on the top of the stack.
+func binary(op vm.OpCode, x, y expr) expr {
+	return func(p *program) {
+		y(p)
+		x(p)
+		p.op(op)
+	}
+}
+
+func add(x, y expr) expr { return binary(vm.ADD, x, y) }
+func sub(x, y expr) expr { return binary(vm.SUB, x, y) }
+func mul(x, y expr) expr { return binary(vm.MUL, x, y) }
+func div(x, y expr) expr { return binary(vm.DIV, x, y) }
+func eq(x, y expr) expr  { return binary(vm.EQ, x, y) }
+func lt(x, y expr) expr  { return binary(vm.LT, x, y) }
+func gt(x, y expr) expr  { return binary(vm.GT, x, y) }
+func or(x, y expr) expr  { return binary(vm.OR, x, y) }
+func and(x, y expr) expr { return binary(vm.AND, x, y) }
+
+func iszero(x expr) expr {
+	return func(p *program) {
+		x(p)
+		p.op(vm.ISZERO)
+	}
+}
+
+// selector returns the function selector shifted to the first 4 bytes of the word.
+func selector(sel uint32) expr {
+	return constant(new(big.Int).Lsh(big.NewInt(int64(sel)), 224))
+}
+
+// callArgsOffset is where call data of the outgoing calls is built.
+const callArgsOffset = 0x00
+
+// call calls the function of the contract with the given static arguments, the result is copied
+// to the outOffset. It pushes the CALL success flag.
+func call(addr, value expr, sel uint32, args []expr, outOffset, outSize uint64) expr {
+	return func(p *program) {
+		p.mstore(callArgsOffset, selector(sel))
+		for i, a := range args {
+			p.mstore(callArgsOffset+4+32*uint64(i), a)
+		}
+
+		p.pushUint(outSize)
+		p.pushUint(outOffset)
+		p.pushUint(4 + 32*uint64(len(args)))
+		p.pushUint(callArgsOffset)
+		value(p)
+		addr(p)
+		p.op(vm.GAS)
+		p.op(vm.CALL)
+	}
+}
@@ -0,0 +1,173 @@
+package safety
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// CheckerAddress is the address the checker code is placed at with the state override.
+	CheckerAddress = common.BytesToAddress(crypto.Keccak256([]byte("mettu.safety.checker"))[12:])
+	// callerAddress sends the checker call, it's given the balance with the state override.
+	callerAddress = common.BytesToAddress(crypto.Keccak256([]byte("mettu.safety.caller"))[12:])
+	// probeAddress receives the test transfer of the bought tokens.
+	probeAddress = common.BytesToAddress(crypto.Keccak256([]byte("mettu.safety.probe"))[12:])
+)
+
+// Function selectors used by the checker.
+const (
+	selTransfer         = 0xa9059cbb // transfer(address,uint256)
+	selApprove          = 0x095ea7b3 // approve(address,uint256)
+	selBalanceOf        = 0x70a08231 // balanceOf(address)
+	selGetAmountsOut    = 0xd06ca61f // getAmountsOut(uint256,address[])
+	selSwapETHForTokens = 0x7ff36ab5 // swapExactETHForTokens(uint256,address[],address,uint256)
+	// swapExactTokensForETHSupportingFeeOnTransferTokens(uint256,uint256,address[],address,uint256)
+	selSwapTokensForETH = 0x791ac947
+)
+
+// Checker call data is abi.encode(pair, weth, token, divisor, router), the call value is spent on the buy.
+const (
+	argPair    = 0x00
+	argWETH    = 0x20
+	argToken   = 0x40
+	argDivisor = 0x60
+	argRouter  = 0x80
+)
+
+// Checker memory layout.
+const (
+	// retOffset receives return data of the outgoing calls.
+	retOffset = 0x200
+
+	varSellAmount = 0x620
+	varProbe      = 0x640
+	varPairBefore = 0x660
+	varETHBefore  = 0x680
+
+	// resultOffset is the start of the returned words, see checkResult.
+	resultOffset = 0x400
+	resultWords  = 9
+)
+
+// result returns memory offset of the i-th result word.
+func result(i uint64) uint64 { return resultOffset + 32*i }
+
+// Indices of the result words.
+const (
+	resBuyOK = iota
+	resExpectedBought
+	resBought
+	resTransferOK
+	resApproveOK
+	resReceived
+	resSellOK
+	resETHOut
+	resExpectedETHOut
+)
+
+var (
+	checkerOnce sync.Once
+	checkerCode []byte
+)
+
+// CheckerCode returns runtime code of the checker contract.
+//
+// The checker buys the token for the call value with the router's swapExactETHForTokens, transfers
+// 1% of the bought tokens to the probe address and sells the rest back with the router's
+// swapExactTokensForETHSupportingFeeOnTransferTokens, so tokens which treat router swaps differently
+// from the pair calls are caught. It never reverts, instead it returns the outcome of every step as 9 words:
+//
+//	buyOK, expectedBought, bought, transferOK, approveOK, received, sellOK, ethOut, expectedETHOut
+//
+// where received is the amount of tokens the pair actually received on the sell.
+// Only 1/divisor of the bought tokens is sold, so sells limited by the max tx amount can be retried.
+// Calls made by anyone but callerAddress, i.e. the router paying out ETH, just stop.
+func CheckerCode() []byte {
+	checkerOnce.Do(func() { checkerCode = buildChecker() })
+	return checkerCode
+}
+
+func buildChecker() []byte {
+	var (
+		pair     = calldata(argPair)
+		weth     = calldata(argWETH)
+		token    = calldata(argToken)
+		divisor  = calldata(argDivisor)
+		router   = calldata(argRouter)
+		self     = opExpr(vm.ADDRESS)
+		value    = opExpr(vm.CALLVALUE)
+		deadline = opExpr(vm.TIMESTAMP)
+		zero     = uintConst(0)
+
+		returned = mload(retOffset)
+		// amountsOut is the last element of the two element uint[] returned by the router.
+		amountsOut = mload(retOffset + 0x60)
+	)
+	// path encodes the two hop address[] tail of the router call arguments.
+	path := func(from, to expr) []expr { return []expr{uintConst(2), from, to} }
+
+	p := newProgram()
+	p.jumpi("stop", iszero(eq(opExpr(vm.CALLER), caller())))
+
+	// Buy.
+	p.jumpi("exit", iszero(call(router, zero, selGetAmountsOut,
+		append([]expr{value, uintConst(0x40)}, path(weth, token)...), retOffset, 0x80)))
+	p.mstore(result(resExpectedBought), amountsOut)
+	p.jumpi("exit", iszero(call(router, value, selSwapETHForTokens,
+		append([]expr{zero, uintConst(0x80), self, deadline}, path(weth, token)...), retOffset, 0)))
+	p.mstore(result(resBuyOK), uintConst(1))
+
+	p.jumpi("exit", iszero(call(token, zero, selBalanceOf, []expr{self}, retOffset, 32)))
+	p.mstore(result(resBought), returned)
+
+	// Transfer to the probe address.
+	p.mstore(varSellAmount, div(mload(result(resBought)), divisor))
+	p.mstore(varProbe, div(mload(varSellAmount), uintConst(100)))
+	p.mstore(result(resTransferOK), callOK(call(token, zero, selTransfer, []expr{probe(), mload(varProbe)}, retOffset, 32)))
+
+	// Sell.
+	p.mstore(varSellAmount, sub(mload(varSellAmount), mload(varProbe)))
+	p.mstore(result(resApproveOK), callOK(call(token, zero, selApprove, []expr{router, mload(varSellAmount)}, retOffset, 32)))
+	p.jumpi("exit", iszero(mload(result(resApproveOK))))
+	p.jumpi("exit", iszero(call(router, zero, selGetAmountsOut,
+		append([]expr{mload(varSellAmount), uintConst(0x40)}, path(token, weth)...), retOffset, 0x80)))
+	p.mstore(result(resExpectedETHOut), amountsOut)
+	p.jumpi("exit", iszero(call(token, zero, selBalanceOf, []expr{pair}, retOffset, 32)))
+	p.mstore(varPairBefore, returned)
+	p.mstore(varETHBefore, opExpr(vm.SELFBALANCE))
+	p.jumpi("exit", iszero(call(router, zero, selSwapTokensForETH,
+		append([]expr{mload(varSellAmount), zero, uintConst(0xa0), self, deadline}, path(token, weth)...), retOffset, 0)))
+	p.mstore(result(resSellOK), uintConst(1))
+	p.mstore(result(resETHOut), sub(opExpr(vm.SELFBALANCE), mload(varETHBefore)))
+
+	p.jumpi("exit", iszero(call(token, zero, selBalanceOf, []expr{pair}, retOffset, 32)))
+	p.mstore(result(resReceived), sub(returned, mload(varPairBefore)))
+
+	p.label("exit")
+	p.ret(resultOffset, 32*resultWords)
+
+	p.label("stop")
+	p.op(vm.STOP)
+	return p.bytes()
+}
+
+// callOK pushes whether the ERC20 call succeeded, tokens which return nothing are treated as succeeded.
+func callOK(c expr) expr {
+	return func(p *program) {
+		c(p)
+		or(iszero(opExpr(vm.RETURNDATASIZE)), iszero(iszero(mload(retOffset))))(p)
+		p.op(vm.AND)
+	}
+}
+
+func probe() expr {
+	return constant(new(big.Int).SetBytes(probeAddress.Bytes()))
+}
+
+func caller() expr {
+	return constant(new(big.Int).SetBytes(callerAddress.Bytes()))
+}
@@ -0,0 +1,154 @@
+// Package score ranks CEX funded wallets by the performance of their swaps.
+package score
+
+import (
+	"bytes"
+	"math"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/pnl"
+	"github.com/gelfand/mettu/repo"
+)
+
+// Model is the wallet scoring model.
+//
+// Score of the wallet is RecencyReturn * confidence + WinRateWeight * WinRate, where confidence = n / (n + PriorTokens)
+// and n is the number of distinct tokens, so wallets which bought a single lucky token do not top the board.
+// The score grows with both the return and the win rate, losing wallets rank below each other by their losses.
+type Model struct {
+	// HalfLife is the age in blocks after which the swap weighs half as much in RecencyReturn.
+	HalfLife uint64
+	// PriorTokens is the number of distinct tokens needed for the half confidence.
+	PriorTokens int
+	// MinSwaps is the minimum number of revalued swaps for the wallet to be ranked.
+	MinSwaps int
+	// WinRateWeight is the score of the wallet which won every swap on top of it's return.
+	WinRateWeight float64
+}
+
+// DefaultModel is Model with roughly a week half life.
+var DefaultModel = Model{
+	HalfLife:      45_000,
+	PriorTokens:   3,
+	MinSwaps:      2,
+	WinRateWeight: 0.5,
+}
+
+// Score computes the score of the wallet by it's positions as of the head block.
+func (m Model) Score(wallet common.Address, positions []pnl.Position, head uint64) repo.WalletScore {
+	s := repo.WalletScore{
+		Wallet:      wallet,
+		BlockNumber: head,
+	}
+
+	var (
+		returns       []float64
+		blocksTo2x    []uint64
+		wins          int
+		weightSum     float64
+		weightedTotal float64
+		tokens        = make(map[common.Address]struct{})
+	)
+	for _, p := range positions {
+		if p.Swap.Price == nil || p.Swap.Price.Sign() == 0 || p.State.Price == nil {
+			continue
+		}
+		if s.Exchange == "" {
+			s.Exchange = p.Exchange
+		}
+
+		r := p.Return()
+		returns = append(returns, r)
+		if r > 0 {
+			wins++
+		}
+		if p.State.Reached2xAt != 0 {
+			blocksTo2x = append(blocksTo2x, p.State.Reached2xAt-p.State.OpenedAt)
+		}
+		tokens[p.Swap.TokenAddr] = struct{}{}
+
+		w := m.weight(p, head)
+		weightSum += w
+		weightedTotal += w * r
+	}
+
+	s.Swaps = len(returns)
+	if s.Swaps == 0 {
+		return s
+	}
+	s.DistinctTokens = len(tokens)
+	s.WinRate = float64(wins) / float64(s.Swaps)
+	s.MedianReturn = medianFloat(returns)
+	s.Reached2x = len(blocksTo2x)
+	s.MedianBlocksTo2x = medianUint(blocksTo2x)
+	if weightSum > 0 {
+		s.RecencyReturn = weightedTotal / weightSum
+	}
+
+	confidence := float64(s.DistinctTokens) / float64(s.DistinctTokens+m.PriorTokens)
+	s.Score = s.RecencyReturn*confidence + m.WinRateWeight*s.WinRate
+	return s
+}
+
+// Leaderboard scores every wallet with at least MinSwaps revalued swaps, best wallets go first.
+func (m Model) Leaderboard(positions []pnl.Position, head uint64) []repo.WalletScore {
+	byWallet := make(map[common.Address][]pnl.Position)
+	for _, p := range positions {
+		byWallet[p.Swap.Wallet] = append(byWallet[p.Swap.Wallet], p)
+	}
+
+	scores := make([]repo.WalletScore, 0, len(byWallet))
+	for wallet, walletPositions := range byWallet {
+		s := m.Score(wallet, walletPositions, head)
+		if s.Swaps < m.MinSwaps {
+			continue
+		}
+		scores = append(scores, s)
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return bytes.Compare(scores[i].Wallet.Bytes(), scores[j].Wallet.Bytes()) < 0
+	})
+	return scores
+}
+
+// weight returns exponentially decaying weight of the position by it's age.
+func (m Model) weight(p pnl.Position, head uint64) float64 {
+	if m.HalfLife == 0 || p.State.OpenedAt >= head {
+		return 1
+	}
+	age := float64(head - p.State.OpenedAt)
+	return math.Exp2(-age / float64(m.HalfLife))
+}
+
+func medianFloat(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), xs...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func medianUint(xs []uint64) uint64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sorted := append([]uint64(nil), xs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
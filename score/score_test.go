@@ -0,0 +1,95 @@
+package score
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/pnl"
+	"github.com/gelfand/mettu/repo"
+)
+
+var (
+	alice = common.BytesToAddress([]byte("alice"))
+	bob   = common.BytesToAddress([]byte("bob"))
+	carol = common.BytesToAddress([]byte("carol"))
+	dave  = common.BytesToAddress([]byte("dave"))
+	erin  = common.BytesToAddress([]byte("erin"))
+)
+
+func testPosition(wallet common.Address, token string, entry, price int64, openedAt, reached2xAt uint64) pnl.Position {
+	return pnl.Position{
+		Swap: repo.Swap{
+			Wallet:    wallet,
+			TokenAddr: common.BytesToAddress([]byte(token)),
+			Price:     big.NewInt(entry),
+			Value:     big.NewInt(1e18),
+		},
+		Exchange: "Binance",
+		State: repo.Position{
+			Price:       big.NewInt(price),
+			OpenedAt:    openedAt,
+			Reached2xAt: reached2xAt,
+		},
+	}
+}
+
+func TestModel_Score(t *testing.T) {
+	t.Parallel()
+
+	m := Model{HalfLife: 100, PriorTokens: 1, WinRateWeight: 0.5}
+	positions := []pnl.Position{
+		testPosition(alice, "token0", 100, 300, 900, 950),
+		testPosition(alice, "token1", 100, 50, 1000, 0),
+		testPosition(alice, "token1", 100, 250, 1000, 1080),
+	}
+
+	got := m.Score(alice, positions, 1000)
+	if got.Swaps != 3 || got.DistinctTokens != 2 || got.Reached2x != 2 || got.Exchange != "Binance" {
+		t.Errorf("Model.Score() = %+v", got)
+	}
+	if math.Abs(got.WinRate-2.0/3) > 1e-9 {
+		t.Errorf("Model.Score() WinRate = %v, want %v", got.WinRate, 2.0/3)
+	}
+	if got.MedianReturn != 1.5 {
+		t.Errorf("Model.Score() MedianReturn = %v, want %v", got.MedianReturn, 1.5)
+	}
+	if got.MedianBlocksTo2x != 65 {
+		t.Errorf("Model.Score() MedianBlocksTo2x = %v, want %v", got.MedianBlocksTo2x, 65)
+	}
+
+	// token0 is one half life old, so it weighs 0.5 against 1 of the fresh swaps.
+	wantRecency := (0.5*2 + 1*(-0.5) + 1*1.5) / 2.5
+	if math.Abs(got.RecencyReturn-wantRecency) > 1e-9 {
+		t.Errorf("Model.Score() RecencyReturn = %v, want %v", got.RecencyReturn, wantRecency)
+	}
+	wantScore := wantRecency*(2.0/3) + 0.5*(2.0/3)
+	if math.Abs(got.Score-wantScore) > 1e-9 {
+		t.Errorf("Model.Score() Score = %v, want %v", got.Score, wantScore)
+	}
+}
+
+func TestModel_Leaderboard(t *testing.T) {
+	t.Parallel()
+
+	m := Model{HalfLife: 100, PriorTokens: 1, MinSwaps: 2, WinRateWeight: 0.5}
+	positions := []pnl.Position{
+		testPosition(alice, "token0", 100, 200, 1000, 1000),
+		testPosition(alice, "token1", 100, 200, 1000, 1000),
+		testPosition(bob, "token0", 100, 400, 1000, 1000),
+		testPosition(bob, "token1", 100, 400, 1000, 1000),
+		// carol is not ranked, she made only one swap.
+		testPosition(carol, "token0", 100, 10000, 1000, 1000),
+		// dave lost more than erin, so dave ranks below erin.
+		testPosition(dave, "token0", 100, 10, 1000, 0),
+		testPosition(dave, "token1", 100, 10, 1000, 0),
+		testPosition(erin, "token0", 100, 50, 1000, 0),
+		testPosition(erin, "token1", 100, 50, 1000, 0),
+	}
+
+	got := m.Leaderboard(positions, 1000)
+	if len(got) != 4 || got[0].Wallet != bob || got[1].Wallet != alice || got[2].Wallet != erin || got[3].Wallet != dave {
+		t.Errorf("Model.Leaderboard() = %+v", got)
+	}
+}
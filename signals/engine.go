@@ -0,0 +1,251 @@
+// Package signals fires signals when CEX funded wallets accumulate a token.
+package signals
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/repo"
+)
+
+// Buy is a single swap of ETH for the token made by CEX funded wallet.
+type Buy struct {
+	TxHash   common.Hash
+	Wallet   common.Address
+	Token    common.Address
+	Exchange string
+	// Value is the amount of wei spent.
+	Value *big.Int
+	Time  time.Time
+}
+
+// TokenLookup returns the stored token, it's used by the rules filtering tokens by their metadata.
+type TokenLookup func(token common.Address) (repo.Token, bool)
+
+type firedKey struct {
+	rule  string
+	token common.Address
+}
+
+// Engine keeps buys within the widest rule window and evaluates the rules against them.
+// Observed buys and fired signals are staged and become part of the engine state only once committed,
+// so that the state follows the block transaction.
+type Engine struct {
+	mu sync.Mutex
+
+	rules     []Rule
+	maxWindow time.Duration
+	// buys are ordered by time for every token.
+	buys  map[common.Address][]Buy
+	fired map[firedKey]time.Time
+
+	// pending are buys observed since the last commit.
+	pending      []Buy
+	pendingFired map[firedKey]time.Time
+	evaluatedAt  time.Time
+}
+
+// NewEngine creates new Engine, rules are expected to be valid.
+func NewEngine(rules []Rule) *Engine {
+	e := &Engine{
+		rules:        rules,
+		buys:         make(map[common.Address][]Buy),
+		fired:        make(map[firedKey]time.Time),
+		pendingFired: make(map[firedKey]time.Time),
+	}
+	for _, r := range rules {
+		if w := time.Duration(r.Window); w > e.maxWindow {
+			e.maxWindow = w
+		}
+	}
+	return e
+}
+
+// MaxWindow returns the widest rule window, buys made within it should be observed on start.
+func (e *Engine) MaxWindow() time.Duration {
+	return e.maxWindow
+}
+
+// MaxCooldown returns the longest rule cool-down, signals fired within it should be restored on start.
+func (e *Engine) MaxCooldown() time.Duration {
+	var max time.Duration
+	for _, r := range e.rules {
+		if c := time.Duration(r.Cooldown); c > max {
+			max = c
+		}
+	}
+	return max
+}
+
+// Restore remembers already fired signals so they are not fired again within the cool-down.
+func (e *Engine) Restore(signals []repo.Signal) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, s := range signals {
+		k := firedKey{s.Rule, s.TokenAddr}
+		if s.Time.After(e.fired[k]) {
+			e.fired[k] = s.Time
+		}
+	}
+}
+
+// Observe stages the buy, it's added to the sliding window by Commit.
+func (e *Engine) Observe(b Buy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.pending = append(e.pending, b)
+}
+
+// Evaluate evaluates the rules against the tokens bought since the last commit and returns the signals
+// which fired at the block, the signals are staged for the cool-down until Commit.
+// Rules with token filters never fire if lookup is nil.
+func (e *Engine) Evaluate(now time.Time, blockNumber uint64, lookup TokenLookup) []repo.Signal {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	pending := make(map[common.Address][]Buy)
+	for _, b := range e.pending {
+		pending[b.Token] = append(pending[b.Token], b)
+	}
+
+	var fired []repo.Signal
+	for token, buys := range pending {
+		buys = append(buys, e.buys[token]...)
+		for _, r := range e.rules {
+			if r.Token != nil && *r.Token != token {
+				continue
+			}
+			k := firedKey{r.Name, token}
+			if last, ok := e.lastFired(k); ok && now.Sub(last) < time.Duration(r.Cooldown) {
+				continue
+			}
+			if !matches(r, token, blockNumber, lookup) {
+				continue
+			}
+
+			s, ok := evaluate(r, buys, now)
+			if !ok {
+				continue
+			}
+			s.TokenAddr, s.BlockNumber = token, blockNumber
+			e.pendingFired[k] = now
+			fired = append(fired, s)
+		}
+	}
+	e.evaluatedAt = now
+
+	sort.Slice(fired, func(i, j int) bool {
+		if c := bytes.Compare(fired[i].TokenAddr.Bytes(), fired[j].TokenAddr.Bytes()); c != 0 {
+			return c < 0
+		}
+		return fired[i].Rule < fired[j].Rule
+	})
+	return fired
+}
+
+// lastFired returns the time the rule last fired for the token, staged signals included. e.mu must be held.
+func (e *Engine) lastFired(k firedKey) (time.Time, bool) {
+	if t, ok := e.pendingFired[k]; ok {
+		return t, true
+	}
+	t, ok := e.fired[k]
+	return t, ok
+}
+
+// Commit adds the staged buys to the sliding window and remembers the staged signals,
+// it's called once the block transaction is committed.
+func (e *Engine) Commit() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, b := range e.pending {
+		buys := append(e.buys[b.Token], b)
+		// Buys come in block order, so only the last one may be out of order.
+		for i := len(buys) - 1; i > 0 && buys[i].Time.Before(buys[i-1].Time); i-- {
+			buys[i], buys[i-1] = buys[i-1], buys[i]
+		}
+		e.buys[b.Token] = buys
+	}
+	for k, t := range e.pendingFired {
+		e.fired[k] = t
+	}
+	if !e.evaluatedAt.IsZero() {
+		e.expire(e.evaluatedAt)
+	}
+	e.reset()
+}
+
+// Discard drops the staged buys and signals of the rolled back block transaction.
+func (e *Engine) Discard() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.reset()
+}
+
+// reset clears the staged changes, e.mu must be held.
+func (e *Engine) reset() {
+	e.pending = nil
+	e.pendingFired = make(map[firedKey]time.Time)
+	e.evaluatedAt = time.Time{}
+}
+
+// expire drops buys which are older than the widest window, it must be called with the lock held.
+func (e *Engine) expire(now time.Time) {
+	cutoff := now.Add(-e.maxWindow)
+	for token, buys := range e.buys {
+		i := sort.Search(len(buys), func(i int) bool { return !buys[i].Time.Before(cutoff) })
+		if i == len(buys) {
+			delete(e.buys, token)
+			continue
+		}
+		e.buys[token] = buys[i:]
+	}
+}
+
+// matches reports whether the token passes the token filter of the rule.
+func matches(r Rule, token common.Address, blockNumber uint64, lookup TokenLookup) bool {
+	f, ok := r.filter()
+	if !ok {
+		return true
+	}
+	if lookup == nil {
+		return false
+	}
+	t, ok := lookup(token)
+	return ok && f.Match(t, blockNumber)
+}
+
+// evaluate checks the rule against time ordered buys of a single token.
+func evaluate(r Rule, buys []Buy, now time.Time) (repo.Signal, bool) {
+	cutoff := now.Add(-time.Duration(r.Window))
+	wallets := make(map[common.Address]struct{})
+	exchanges := make(map[string]struct{})
+	s := repo.Signal{Rule: r.Name, Time: now, Value: new(big.Int)}
+	for _, b := range buys {
+		if b.Time.Before(cutoff) || b.Time.After(now) {
+			continue
+		}
+		wallets[b.Wallet] = struct{}{}
+		exchanges[b.Exchange] = struct{}{}
+		s.Value.Add(s.Value, b.Value)
+		s.TxHashes = append(s.TxHashes, b.TxHash)
+	}
+
+	if len(wallets) < r.MinWallets || len(exchanges) < r.MinExchanges || s.Value.Cmp(r.minValueWei()) < 0 {
+		return repo.Signal{}, false
+	}
+
+	s.Wallets = len(wallets)
+	for exchange := range exchanges {
+		s.Exchanges = append(s.Exchanges, exchange)
+	}
+	sort.Strings(s.Exchanges)
+	return s, true
+}
@@ -0,0 +1,196 @@
+package signals
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/repo"
+)
+
+var (
+	token0 = common.BytesToAddress([]byte("token0"))
+	token1 = common.BytesToAddress([]byte("token1"))
+)
+
+func testBuy(hash, wallet string, token common.Address, exchange string, eth int64, at time.Time) Buy {
+	return Buy{
+		TxHash:   common.BytesToHash([]byte(hash)),
+		Wallet:   common.BytesToAddress([]byte(wallet)),
+		Token:    token,
+		Exchange: exchange,
+		Value:    new(big.Int).Mul(big.NewInt(eth), big.NewInt(1e18)),
+		Time:     at,
+	}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	t.Parallel()
+
+	rule := Rule{
+		Name:         "accumulation",
+		MinWallets:   3,
+		MinExchanges: 2,
+		Window:       Duration(30 * time.Minute),
+		MinValue:     5,
+		Cooldown:     Duration(time.Hour),
+	}
+	e := NewEngine([]Rule{rule})
+	now := time.Unix(1640000000, 0)
+
+	// Out of the window.
+	e.Observe(testBuy("tx0", "alice", token0, "Kraken", 10, now.Add(-time.Hour)))
+	e.Observe(testBuy("tx1", "alice", token0, "Binance", 1, now.Add(-20*time.Minute)))
+	e.Observe(testBuy("tx2", "bob", token0, "Binance", 2, now.Add(-10*time.Minute)))
+	// The same wallet twice is a single wallet.
+	e.Observe(testBuy("tx3", "bob", token0, "Binance", 2, now.Add(-5*time.Minute)))
+	if got := e.Evaluate(now, 100, nil); len(got) != 0 {
+		t.Fatalf("Engine.Evaluate() = %+v, want no signals", got)
+	}
+	e.Commit()
+
+	e.Observe(testBuy("tx4", "carol", token0, "Kraken", 1, now))
+	e.Observe(testBuy("tx5", "carol", token1, "Kraken", 1, now))
+	got := e.Evaluate(now, 101, nil)
+	if len(got) != 1 {
+		t.Fatalf("Engine.Evaluate() = %+v, want one signal", got)
+	}
+	s := got[0]
+	if s.Rule != "accumulation" || s.TokenAddr != token0 || s.BlockNumber != 101 || s.Wallets != 3 ||
+		strings.Join(s.Exchanges, ",") != "Binance,Kraken" || len(s.TxHashes) != 4 ||
+		s.Value.Cmp(new(big.Int).Mul(big.NewInt(6), big.NewInt(1e18))) != 0 {
+		t.Errorf("Engine.Evaluate() = %+v", s)
+	}
+	e.Commit()
+
+	// Cool-down suppresses the same signal.
+	e.Observe(testBuy("tx6", "dave", token0, "Kraken", 1, now.Add(time.Minute)))
+	if got := e.Evaluate(now.Add(time.Minute), 102, nil); len(got) != 0 {
+		t.Errorf("Engine.Evaluate() = %+v, want no signals within cool-down", got)
+	}
+}
+
+func TestEngine_Restore(t *testing.T) {
+	t.Parallel()
+
+	rule := Rule{Name: "whale", MinWallets: 1, Window: Duration(time.Minute), Cooldown: Duration(time.Hour), Token: &token1}
+	e := NewEngine([]Rule{rule})
+	now := time.Unix(1640000000, 0)
+	e.Restore([]repo.Signal{{Rule: "whale", TokenAddr: token1, Time: now.Add(-30 * time.Minute)}})
+
+	e.Observe(testBuy("tx0", "alice", token0, "Binance", 1, now))
+	e.Observe(testBuy("tx1", "alice", token1, "Binance", 1, now))
+	if got := e.Evaluate(now, 100, nil); len(got) != 0 {
+		t.Errorf("Engine.Evaluate() = %+v, want no signals", got)
+	}
+	e.Commit()
+
+	e.Observe(testBuy("tx2", "alice", token1, "Binance", 1, now.Add(31*time.Minute)))
+	if got := e.Evaluate(now.Add(31*time.Minute), 200, nil); len(got) != 1 || got[0].TokenAddr != token1 {
+		t.Errorf("Engine.Evaluate() = %+v, want one signal after cool-down", got)
+	}
+}
+
+func TestEngine_Discard(t *testing.T) {
+	t.Parallel()
+
+	rules := []Rule{
+		{Name: "whale", MinWallets: 1, Window: Duration(time.Minute), Cooldown: Duration(time.Hour), Token: &token1},
+		{Name: "crowd", MinWallets: 2, Window: Duration(time.Minute)},
+	}
+	e := NewEngine(rules)
+	now := time.Unix(1640000000, 0)
+
+	e.Observe(testBuy("tx0", "alice", token0, "Binance", 1, now))
+	e.Observe(testBuy("tx1", "alice", token1, "Binance", 1, now))
+	if got := e.Evaluate(now, 100, nil); len(got) != 1 || got[0].Rule != "whale" {
+		t.Fatalf("Engine.Evaluate() = %+v, want whale signal", got)
+	}
+	e.Discard()
+
+	// Neither the discarded buys nor the cool-down of the discarded signal are remembered.
+	e.Observe(testBuy("tx2", "bob", token0, "Binance", 1, now))
+	e.Observe(testBuy("tx3", "bob", token1, "Binance", 1, now))
+	if got := e.Evaluate(now, 100, nil); len(got) != 1 || got[0].Rule != "whale" || got[0].Wallets != 1 {
+		t.Errorf("Engine.Evaluate() = %+v, want whale signal of a single wallet", got)
+	}
+}
+
+func TestReadRules(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			config: `[{"name": "a", "min_wallets": 3, "min_exchanges": 2, "window": "30m", "min_value": 5.5, "cooldown": "6h"}]`,
+		},
+		{
+			name:   "token",
+			config: `[{"name": "a", "min_wallets": 1, "window": "1m", "token": "0x6b175474e89094c44da98b954eedeac495271d0f"}]`,
+		},
+		{name: "invalid window", config: `[{"name": "a", "min_wallets": 1, "window": "soon"}]`, wantErr: true},
+		{name: "no window", config: `[{"name": "a", "min_wallets": 1}]`, wantErr: true},
+		{name: "unknown field", config: `[{"name": "a", "min_wallets": 1, "window": "1m", "wallets": 2}]`, wantErr: true},
+		{
+			name:    "duplicate",
+			config:  `[{"name": "a", "min_wallets": 1, "window": "1m"}, {"name": "a", "min_wallets": 2, "window": "1m"}]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ReadRules(strings.NewReader(tt.config))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEngine_EvaluateFilter(t *testing.T) {
+	t.Parallel()
+
+	rule := Rule{Name: "fresh", MinWallets: 1, Window: Duration(time.Minute), MinLiquidity: 10, MaxAge: 1000, ExcludeUnsafe: true}
+	tokens := map[common.Address]repo.Token{
+		token0: {Meta: repo.TokenMeta{UpdatedAt: 5000, CreationBlock: 4500, Liquidity: new(big.Int).Mul(big.NewInt(20), big.NewInt(1e18))}},
+		token1: {
+			Meta:   repo.TokenMeta{UpdatedAt: 5000, CreationBlock: 4500, Liquidity: new(big.Int).Mul(big.NewInt(20), big.NewInt(1e18))},
+			Safety: repo.TokenSafety{CheckedAt: 5000, Honeypot: true},
+		},
+	}
+	lookup := func(token common.Address) (repo.Token, bool) {
+		t, ok := tokens[token]
+		return t, ok
+	}
+
+	e := NewEngine([]Rule{rule})
+	now := time.Unix(1640000000, 0)
+	e.Observe(testBuy("tx0", "alice", token0, "Binance", 1, now))
+	e.Observe(testBuy("tx1", "alice", token1, "Binance", 1, now))
+	if got := e.Evaluate(now, 5000, nil); len(got) != 0 {
+		t.Errorf("Engine.Evaluate() = %+v, want no signals without lookup", got)
+	}
+	e.Commit()
+
+	e.Observe(testBuy("tx2", "bob", token0, "Binance", 1, now))
+	e.Observe(testBuy("tx3", "bob", token1, "Binance", 1, now))
+	got := e.Evaluate(now, 5000, lookup)
+	if len(got) != 1 || got[0].TokenAddr != token0 {
+		t.Errorf("Engine.Evaluate() = %+v, want signal of the safe token", got)
+	}
+
+	// token0 is too old by now.
+	e = NewEngine([]Rule{rule})
+	e.Observe(testBuy("tx4", "alice", token0, "Binance", 1, now))
+	if got := e.Evaluate(now, 6000, lookup); len(got) != 0 {
+		t.Errorf("Engine.Evaluate() = %+v, want no signals of the old token", got)
+	}
+}
@@ -0,0 +1,130 @@
+package signals
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gelfand/mettu/repo"
+)
+
+// Duration is time.Duration encoded in JSON as a string, e.g. "30m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Rule fires when at least MinWallets distinct wallets funded from at least MinExchanges exchanges
+// bought the token within Window, spending at least MinValue ETH in total.
+type Rule struct {
+	Name         string   `json:"name"`
+	MinWallets   int      `json:"min_wallets"`
+	MinExchanges int      `json:"min_exchanges"`
+	Window       Duration `json:"window"`
+	// MinValue is the minimum total amount of ETH spent.
+	MinValue float64 `json:"min_value"`
+	// Cooldown is the time the rule does not fire again for the same token.
+	Cooldown Duration `json:"cooldown"`
+	// Token restricts the rule to a single token if set.
+	Token *common.Address `json:"token,omitempty"`
+
+	// MinLiquidity is the minimum amount of ETH in the WETH pair of the token.
+	MinLiquidity float64 `json:"min_liquidity,omitempty"`
+	// MaxAge is the maximum number of blocks since the token creation.
+	MaxAge      uint64  `json:"max_age,omitempty"`
+	MinLPLocked float64 `json:"min_lp_locked,omitempty"`
+	// ExcludeUnsafe skips honeypots, restricted and heavily taxed tokens.
+	ExcludeUnsafe bool `json:"exclude_unsafe,omitempty"`
+}
+
+// DefaultRules are used when no rules are configured.
+var DefaultRules = []Rule{
+	{
+		Name:         "accumulation",
+		MinWallets:   3,
+		MinExchanges: 2,
+		Window:       Duration(30 * time.Minute),
+		MinValue:     5,
+		Cooldown:     Duration(6 * time.Hour),
+	},
+}
+
+// Validate checks that the rule can ever fire.
+func (r Rule) Validate() error {
+	switch {
+	case r.Name == "":
+		return errors.New("rule name is empty")
+	case r.MinWallets < 1:
+		return fmt.Errorf("rule %q: min_wallets must be positive", r.Name)
+	case r.Window <= 0:
+		return fmt.Errorf("rule %q: window must be positive", r.Name)
+	case r.MinValue < 0 || r.Cooldown < 0:
+		return fmt.Errorf("rule %q: min_value and cooldown must not be negative", r.Name)
+	case r.MinLiquidity < 0 || r.MinLPLocked < 0 || r.MinLPLocked > 1:
+		return fmt.Errorf("rule %q: min_liquidity must not be negative and min_lp_locked must be within [0, 1]", r.Name)
+	}
+	return nil
+}
+
+// minValueWei returns MinValue in wei.
+func (r Rule) minValueWei() *big.Int {
+	return etherToWei(r.MinValue)
+}
+
+// filter returns the token filter of the rule, ok is false if the rule does not filter tokens.
+func (r Rule) filter() (f repo.TokenFilter, ok bool) {
+	f = repo.TokenFilter{
+		MaxAge:        r.MaxAge,
+		MinLPLocked:   r.MinLPLocked,
+		ExcludeUnsafe: r.ExcludeUnsafe,
+	}
+	if r.MinLiquidity > 0 {
+		f.MinLiquidity = etherToWei(r.MinLiquidity)
+	}
+	return f, f != (repo.TokenFilter{})
+}
+
+func etherToWei(eth float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(eth), big.NewFloat(1e18)).Int(nil)
+	return wei
+}
+
+// ReadRules decodes JSON array of rules and validates them, rule names must be unique.
+func ReadRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("unable to decode signal rules: %w", err)
+	}
+
+	names := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := names[rule.Name]; ok {
+			return nil, fmt.Errorf("duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+	}
+	return rules, nil
+}